@@ -400,6 +400,7 @@ export default {
         model: 'Model',
         prompt: 'Prompt',
         retrieval: 'Retrieval',
+        workspace: 'Workspace',
         delete: 'Delete',
       },
       model: {
@@ -421,6 +422,24 @@ export default {
         topK: 'Chunk Count',
         default: 'Default',
       },
+      workspace: {
+        dir: 'Workspace',
+        dirPlaceholder: 'Home directory',
+        dirHint: 'File tools can only modify files in this directory, and commands run here.',
+        pick: 'Choose',
+        pickTitle: 'Choose Workspace',
+        commandMode: 'Command Restriction',
+        modes: {
+          blocklist: 'Blocklist',
+          allowlist: 'Allowlist',
+        },
+        blocklistWarning:
+          'Blocklist mode is not a sandbox. It only rejects commands containing a few known dangerous patterns; any other command runs with your account and can read or change files outside the workspace. Use allowlist mode for agents you do not fully trust.',
+        allowlistHint:
+          'Only the listed programs can run. Redirections (>, >>, <) must stay inside the workspace, and command substitution is rejected.',
+        allowedCommands: 'Allowed Programs',
+        allowedCommandsPlaceholder: 'e.g. git, npm, go',
+      },
       delete: {
         title: 'Delete Agent',
         hint: 'Deleting the agent will remove all related conversations. This cannot be undone.',
@@ -549,6 +568,11 @@ export default {
         pending: 'Pending',
       },
       fileMissing: 'File missing',
+      skippedSteps: {
+        notice: 'This document is large, so {steps} was skipped',
+        context_enrichment: 'context enrichment',
+        raptor: 'RAPTOR summary',
+      },
       menu: {
         rename: 'Rename',
         relearn: 'Relearn',
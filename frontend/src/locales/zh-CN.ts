@@ -397,6 +397,7 @@ export default {
         model: '模型设置',
         prompt: '提示词设置',
         retrieval: '知识库检索',
+        workspace: '工作区',
         delete: '删除助手',
       },
       model: {
@@ -418,6 +419,23 @@ export default {
         topK: '检索分片数',
         default: '默认',
       },
+      workspace: {
+        dir: '工作区',
+        dirPlaceholder: '用户主目录',
+        dirHint: '文件工具只能修改此目录中的文件，命令也在此目录中运行。',
+        pick: '选择',
+        pickTitle: '选择工作区',
+        commandMode: '命令限制',
+        modes: {
+          blocklist: '黑名单',
+          allowlist: '白名单',
+        },
+        blocklistWarning:
+          '黑名单模式不是沙箱：它只拒绝包含少数已知危险片段的命令，其他命令都以你的账户权限运行，可以读取或修改工作区以外的文件。对不完全信任的助手请使用白名单模式。',
+        allowlistHint: '只能运行列出的程序；重定向（>、>>、<）的目标必须在工作区内，且不允许命令替换。',
+        allowedCommands: '允许的程序',
+        allowedCommandsPlaceholder: '例如 git, npm, go',
+      },
       delete: {
         title: '删除助手',
         hint: '删除助手后，将清理所有的对话记录，操作不可逆',
@@ -547,6 +565,11 @@ export default {
         pending: '待学习',
       },
       fileMissing: '原始文件已丢失',
+      skippedSteps: {
+        notice: '文档较大，已跳过{steps}',
+        context_enrichment: '上下文增强',
+        raptor: 'RAPTOR 摘要',
+      },
       menu: {
         rename: '重命名',
         relearn: '重新学习',
@@ -6,6 +6,9 @@ import {
   type Message,
   SendMessageInput,
   EditAndResendInput,
+  SwitchBranchInput,
+  RegenerateMessageInput,
+  ContinueGenerationInput,
 } from '@bindings/chatclaw/internal/services/chat'
 
 // Message status constants
@@ -162,11 +165,16 @@ export const useChatStore = defineStore('chat', () => {
         messagesByConversation.value[conversationId] = merged
       }
 
-      // Build a map of tool results from tool-role messages (tool_call_id → content)
+      // Build a map of tool results from tool-role messages (tool_call_id → content).
+      // Tool results of sub-agents also carry the sub-agent's call (not part of the assistant's tool_calls).
       const toolResultMap = new Map<string, string>()
+      const subAgentToolCalls: string[] = []
       for (const msg of fetched) {
         if (msg.role === 'tool' && msg.tool_call_id) {
           toolResultMap.set(msg.tool_call_id, msg.content)
+          if (msg.agent_id && msg.tool_calls) {
+            subAgentToolCalls.push(msg.tool_calls)
+          }
         }
       }
 
@@ -180,11 +188,12 @@ export const useChatStore = defineStore('chat', () => {
               tool_call_ids?: string[]
             }>
             if (Array.isArray(rawSegments) && rawSegments.length > 0) {
-              // Parse tool_calls from the message to build ToolCallInfo map
+              // Parse tool_calls from the message and its sub-agents to build ToolCallInfo map
               const toolCallMap = new Map<string, ToolCallInfo>()
-              if (msg.tool_calls) {
+              for (const raw of [msg.tool_calls, ...subAgentToolCalls]) {
+                if (!raw) continue
                 try {
-                  const toolCalls = JSON.parse(msg.tool_calls) as Array<{
+                  const toolCalls = JSON.parse(raw) as Array<{
                     ID?: string
                     id?: string
                     Function?: { Name?: string; Arguments?: string }
@@ -360,6 +369,11 @@ export const useChatStore = defineStore('chat', () => {
 
       if (result) {
         activeRequestByConversation.value[conversationId] = result.request_id
+        // The edit is saved as a new sibling message; the original stays as another branch
+        const list = messagesByConversation.value[conversationId] ?? []
+        messagesByConversation.value[conversationId] = list.map((m) =>
+          m.id === messageId ? ({ ...m, id: result.message_id } as Message) : m
+        )
       }
 
       return result
@@ -370,6 +384,93 @@ export const useChatStore = defineStore('chat', () => {
     }
   }
 
+  // Regenerate an answer as a new variant (optionally with another provider/model)
+  const regenerateMessage = async (
+    conversationId: number,
+    messageId: number,
+    tabId: string,
+    providerId = '',
+    modelId = ''
+  ) => {
+    if (conversationId <= 0 || messageId <= 0) return null
+
+    // Optimistic UX: hide the current answer; the new variant streams in its place
+    ensureConversationMessages(conversationId)
+    const current = messagesByConversation.value[conversationId]
+    const idx = current.findIndex((m) => m.id === messageId)
+    if (idx >= 0) {
+      const keep = current[idx].role === MessageRole.USER ? idx + 1 : idx
+      messagesByConversation.value[conversationId] = current.slice(0, keep)
+    }
+
+    delete streamingByConversation.value[conversationId]
+    delete activeRequestByConversation.value[conversationId]
+
+    try {
+      const result = await ChatService.RegenerateMessage(
+        new RegenerateMessageInput({
+          conversation_id: conversationId,
+          message_id: messageId,
+          provider_id: providerId,
+          model_id: modelId,
+          tab_id: tabId,
+        })
+      )
+
+      if (result) {
+        activeRequestByConversation.value[conversationId] = result.request_id
+      }
+
+      return result
+    } catch (error: unknown) {
+      void loadMessages(conversationId)
+      throw error
+    }
+  }
+
+  // Continue an interrupted or truncated answer in place
+  const continueGeneration = async (conversationId: number, messageId: number, tabId: string) => {
+    if (conversationId <= 0 || messageId <= 0) return null
+
+    const result = await ChatService.ContinueGeneration(
+      new ContinueGenerationInput({
+        conversation_id: conversationId,
+        message_id: messageId,
+        tab_id: tabId,
+      })
+    )
+    if (result) {
+      activeRequestByConversation.value[conversationId] = result.request_id
+    }
+    return result
+  }
+
+  // Mark an answer variant as preferred (only it feeds later context)
+  const setPreferredVariant = async (conversationId: number, messageId: number) => {
+    if (conversationId <= 0 || messageId <= 0) return
+
+    const messages = await ChatService.SetPreferredVariant(
+      new SwitchBranchInput({
+        conversation_id: conversationId,
+        message_id: messageId,
+      })
+    )
+    messagesByConversation.value[conversationId] = messages ?? []
+  }
+
+  // Switch the displayed branch of the conversation tree
+  const switchBranch = async (conversationId: number, messageId: number) => {
+    if (conversationId <= 0 || messageId <= 0) return
+
+    const messages = await ChatService.SwitchBranch(
+      new SwitchBranchInput({
+        conversation_id: conversationId,
+        message_id: messageId,
+      })
+    )
+    messagesByConversation.value[conversationId] = messages ?? []
+  }
+
   // Stop generation
   const stopGeneration = async (conversationId: number) => {
     if (conversationId <= 0) return
@@ -404,14 +505,37 @@ export const useChatStore = defineStore('chat', () => {
 
     const { conversation_id, request_id, message_id } = data
 
+    // A continued answer (ContinueGeneration / auto-continue) starts from its partial content
+    const existing = (messagesByConversation.value[conversation_id] ?? []).find(
+      (m) => m.id === message_id
+    )
+    const prevContent = existing?.content ?? ''
+    const prevThinking = existing?.thinking_content ?? ''
+
+    // Keep the stored segments (including tool calls) of the answer being continued;
+    // rebuild them from the text only when none were loaded. Deep-clone to detach from stored state.
+    const prevToolCalls: ToolCallInfo[] = []
+    const prevSegments: MessageSegment[] = (segmentsByMessage.value[message_id] ?? []).map((seg) => {
+      if (seg.type === 'tools') {
+        const toolCalls = seg.toolCalls.map((tc) => ({ ...tc }))
+        prevToolCalls.push(...toolCalls)
+        return { type: 'tools' as const, toolCalls }
+      }
+      return { ...seg }
+    })
+    if (prevSegments.length === 0) {
+      if (prevThinking) prevSegments.push({ type: 'thinking', content: prevThinking })
+      if (prevContent) prevSegments.push({ type: 'content', content: prevContent })
+    }
+
     // Initialize streaming state
     streamingByConversation.value[conversation_id] = {
       messageId: message_id,
       requestId: request_id,
-      content: '',
-      thinkingContent: '',
-      toolCalls: [],
-      segments: [],
+      content: prevContent,
+      thinkingContent: prevThinking,
+      toolCalls: prevToolCalls,
+      segments: prevSegments,
       status: MessageStatus.STREAMING,
     }
 
@@ -420,9 +544,9 @@ export const useChatStore = defineStore('chat', () => {
       id: message_id,
       conversation_id,
       role: MessageRole.ASSISTANT,
-      content: '',
+      content: prevContent,
       status: MessageStatus.STREAMING,
-      thinking_content: '',
+      thinking_content: prevThinking,
       tool_calls: '[]',
       input_tokens: 0,
       output_tokens: 0,
@@ -818,6 +942,10 @@ export const useChatStore = defineStore('chat', () => {
     loadMessages,
     sendMessage,
     editAndResend,
+    switchBranch,
+    regenerateMessage,
+    continueGeneration,
+    setPreferredVariant,
     stopGeneration,
     clearMessages,
 
@@ -23,9 +23,13 @@ import (
 	"chatclaw/internal/services/greet"
 	"chatclaw/internal/services/i18n"
 	"chatclaw/internal/services/library"
+	"chatclaw/internal/services/maintenance"
+	"chatclaw/internal/services/memory"
 	"chatclaw/internal/services/multiask"
 	"chatclaw/internal/services/providers"
+	"chatclaw/internal/services/scheduler"
 	"chatclaw/internal/services/settings"
+	"chatclaw/internal/services/tasks"
 	"chatclaw/internal/services/textselection"
 	"chatclaw/internal/services/tray"
 	"chatclaw/internal/services/updater"
@@ -222,6 +226,7 @@ func NewApp(opts Options) (app *application.App, cleanup func(), err error) {
 		Queues: map[string]taskmanager.QueueConfig{
 			taskmanager.QueueThumbnail: {Workers: 10, PollInterval: 50 * time.Millisecond}, // 缩略图任务
 			taskmanager.QueueDocument:  {Workers: 3, PollInterval: 100 * time.Millisecond}, // 文档处理任务
+			taskmanager.QueueSchedule:  {Workers: 2, PollInterval: time.Second},            // 助手定时运行
 		},
 	}); err != nil {
 		sqlite.Close()
@@ -279,13 +284,22 @@ func NewApp(opts Options) (app *application.App, cleanup func(), err error) {
 	// 注册会话服务
 	app.RegisterService(application.NewService(conversations.NewConversationsService(app)))
 	// 注册聊天服务
-	app.RegisterService(application.NewService(chat.NewChatService(app)))
+	chatService := chat.NewChatService(app)
+	app.RegisterService(application.NewService(chatService))
+	// 注册定时任务服务（需在文档服务启动任务管理器之前注册任务处理器）
+	app.RegisterService(application.NewService(scheduler.NewSchedulerService(app, chatService)))
 	// 注册知识库服务
 	app.RegisterService(application.NewService(library.NewLibraryService(app)))
 	// 注册文档服务
 	app.RegisterService(application.NewService(document.NewDocumentService(app)))
 	// 注册自动更新服务
 	app.RegisterService(application.NewService(updater.NewUpdaterService(app)))
+	// 注册后台任务服务
+	app.RegisterService(application.NewService(tasks.NewTasksService(app)))
+	// 注册索引维护服务
+	app.RegisterService(application.NewService(maintenance.NewMaintenanceService(app)))
+	// 注册长期记忆服务
+	app.RegisterService(application.NewService(memory.NewMemoryService(app)))
 
 	// ========== macOS 应用菜单 ==========
 	// Set up standard macOS application menu so that system shortcuts work:
@@ -7,11 +7,14 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"chatclaw/internal/eino/filesystem"
+	"chatclaw/internal/eino/ratelimit"
 	"chatclaw/internal/eino/tools"
 	"chatclaw/internal/errs"
 
@@ -45,6 +48,7 @@ type ProviderConfig struct {
 // Config contains the configuration for creating an agent.
 type Config struct {
 	Name        string
+	Description string // shown to a parent agent when this agent is a sub-agent (default "AI Assistant")
 	Instruction string
 	ModelID     string
 	Provider    ProviderConfig
@@ -59,6 +63,61 @@ type Config struct {
 	ContextCount   int  // Max messages in context (0 or >=200 = unlimited)
 	RetrievalTopK  int  // Max document chunks to retrieve
 	EnableThinking bool // Thinking mode (for providers that support it)
+
+	// ToolIDs is the tool allow-list of the agent; empty means all tools.
+	// It covers registered tools and the filesystem/execute and skill middleware tools;
+	// tools passed as extraTools (e.g. library_retriever) are always available.
+	ToolIDs []string
+
+	// MessageModifier, if set, rewrites the message list before every LLM call
+	// (e.g. to inject knowledge base context retrieved for the latest user message).
+	MessageModifier MessageModifierFunc
+
+	// SubAgents are other agents this agent can call as a tool or hand the conversation off to.
+	// The caller owns them and must release their resources after the run.
+	SubAgents []SubAgent
+
+	// ResponseFormat, if set, requires the final answer to be JSON matching a schema.
+	// The instruction is extended with the schema and the chat model is configured for it.
+	ResponseFormat *ResponseFormat
+
+	// Workspace restricts the filesystem and execute tools; the zero value uses the user's home directory.
+	Workspace WorkspaceConfig
+}
+
+// WorkspaceConfig is the sandbox of the filesystem and execute tools.
+type WorkspaceConfig struct {
+	// Root is the only directory the file tools may modify and the execute working directory.
+	// Empty means the user's home directory.
+	Root string
+	// ReadOnlyPaths are extra files or directories the file tools may read.
+	ReadOnlyPaths []string
+	// CommandAllowlist only allows execute commands that run programs in AllowedCommands,
+	// instead of rejecting a fixed list of dangerous patterns.
+	CommandAllowlist bool
+	AllowedCommands  []string
+}
+
+// blockedCommands are rejected by the execute tool in every mode.
+var blockedCommands = []string{
+	"rm -rf /", "rm -rf /*", "mkfs", "dd if=",
+	":(){:|:&};:", "format c:", "format d:",
+}
+
+// SubAgentMode controls how a sub-agent is exposed to its parent agent.
+type SubAgentMode string
+
+const (
+	// SubAgentAsTool exposes the sub-agent as a tool; the parent receives its answer and continues.
+	SubAgentAsTool SubAgentMode = "tool"
+	// SubAgentTransfer lets the parent transfer the conversation; the sub-agent answers the user directly.
+	SubAgentTransfer SubAgentMode = "transfer"
+)
+
+// SubAgent is an agent composed into another agent.
+type SubAgent struct {
+	Agent adk.Agent
+	Mode  SubAgentMode
 }
 
 func applyOpenAIModelParams(cfg *openai.ChatModelConfig, config Config) {
@@ -75,6 +134,46 @@ func applyOpenAIModelParams(cfg *openai.ChatModelConfig, config Config) {
 	}
 }
 
+// newOpenAIChatModel creates an OpenAI-compatible chat model. With a response format it sends the
+// schema as a json_schema response format, falling back to the instruction and validation alone
+// for providers that reject it.
+func newOpenAIChatModel(ctx context.Context, cfg *openai.ChatModelConfig, config Config) (model.ToolCallingChatModel, error) {
+	plain, err := openai.NewChatModel(ctx, cfg)
+	if err != nil || config.ResponseFormat == nil {
+		return plain, err
+	}
+	withFormat := *cfg
+	applyOpenAIResponseFormat(&withFormat, config)
+	native, err := openai.NewChatModel(ctx, &withFormat)
+	if err != nil {
+		return nil, err
+	}
+	key := config.Provider.ProviderID + "/" + config.ModelID
+	return newResponseFormatFallbackModel(key, native, plain), nil
+}
+
+func applyOpenAIResponseFormat(cfg *openai.ChatModelConfig, config Config) {
+	if config.ResponseFormat == nil {
+		return
+	}
+	// Not strict: strict mode rejects common schemas (optional properties, open objects);
+	// the answer is validated against the schema afterwards.
+	cfg.ResponseFormat = &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:       config.ResponseFormat.Name,
+			JSONSchema: config.ResponseFormat.Schema,
+		},
+	}
+}
+
+// httpClient returns an HTTP client that shares the provider's rate limits with
+// the embedders and document-processing models of the same provider.
+func httpClient(config Config) *http.Client {
+	p := config.Provider
+	return ratelimit.NewHTTPClient(ratelimit.ProviderKey(p.ProviderID, p.Type, p.APIEndpoint), 0)
+}
+
 // CreateChatModel creates a ToolCallingChatModel based on the provider type.
 func CreateChatModel(ctx context.Context, config Config) (model.ToolCallingChatModel, error) {
 	switch config.Provider.Type {
@@ -95,9 +194,10 @@ func CreateChatModel(ctx context.Context, config Config) (model.ToolCallingChatM
 
 func createOpenAIChatModel(ctx context.Context, config Config) (model.ToolCallingChatModel, error) {
 	cfg := &openai.ChatModelConfig{
-		APIKey:  config.Provider.APIKey,
-		Model:   config.ModelID,
-		BaseURL: config.Provider.APIEndpoint,
+		APIKey:     config.Provider.APIKey,
+		Model:      config.ModelID,
+		BaseURL:    config.Provider.APIEndpoint,
+		HTTPClient: httpClient(config),
 	}
 	applyOpenAIModelParams(cfg, config)
 
@@ -108,7 +208,7 @@ func createOpenAIChatModel(ctx context.Context, config Config) (model.ToolCallin
 		cfg.ExtraFields["enable_thinking"] = true
 	}
 
-	return openai.NewChatModel(ctx, cfg)
+	return newOpenAIChatModel(ctx, cfg, config)
 }
 
 func createAzureChatModel(ctx context.Context, config Config) (model.ToolCallingChatModel, error) {
@@ -127,6 +227,7 @@ func createAzureChatModel(ctx context.Context, config Config) (model.ToolCalling
 		BaseURL:    config.Provider.APIEndpoint,
 		ByAzure:    true,
 		APIVersion: extraConfig.APIVersion,
+		HTTPClient: httpClient(config),
 	}
 	applyOpenAIModelParams(cfg, config)
 
@@ -137,7 +238,7 @@ func createAzureChatModel(ctx context.Context, config Config) (model.ToolCalling
 		cfg.ExtraFields["enable_thinking"] = true
 	}
 
-	return openai.NewChatModel(ctx, cfg)
+	return newOpenAIChatModel(ctx, cfg, config)
 }
 
 func createClaudeChatModel(ctx context.Context, config Config) (model.ToolCallingChatModel, error) {
@@ -147,9 +248,10 @@ func createClaudeChatModel(ctx context.Context, config Config) (model.ToolCallin
 	}
 
 	cfg := &claude.Config{
-		APIKey:  config.Provider.APIKey,
-		Model:   config.ModelID,
-		BaseURL: baseURL,
+		APIKey:     config.Provider.APIKey,
+		Model:      config.ModelID,
+		BaseURL:    baseURL,
+		HTTPClient: httpClient(config),
 	}
 
 	if config.EnableTemp && config.Temperature != nil {
@@ -166,12 +268,21 @@ func createClaudeChatModel(ctx context.Context, config Config) (model.ToolCallin
 		cfg.MaxTokens = 4096
 	}
 
-	return claude.NewChatModel(ctx, cfg)
+	chatModel, err := claude.NewChatModel(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	// Claude has no native response format: force the answer through a tool taking the schema
+	if config.ResponseFormat != nil {
+		return newForcedOutputModel(chatModel, config.ResponseFormat), nil
+	}
+	return chatModel, nil
 }
 
 func createGeminiChatModel(ctx context.Context, config Config) (model.ToolCallingChatModel, error) {
 	clientConfig := &genai.ClientConfig{
-		APIKey: config.Provider.APIKey,
+		APIKey:     config.Provider.APIKey,
+		HTTPClient: httpClient(config),
 	}
 	if config.Provider.APIEndpoint != "" {
 		clientConfig.HTTPOptions = genai.HTTPOptions{
@@ -197,14 +308,21 @@ func createGeminiChatModel(ctx context.Context, config Config) (model.ToolCallin
 		topP := float32(*config.TopP)
 		cfg.TopP = &topP
 	}
+	if config.ResponseFormat != nil {
+		cfg.ResponseJSONSchema = config.ResponseFormat.Schema
+	}
 
 	return einogemini.NewChatModel(ctx, cfg)
 }
 
 func createOllamaChatModel(ctx context.Context, config Config) (model.ToolCallingChatModel, error) {
 	cfg := &ollama.ChatModelConfig{
-		BaseURL: config.Provider.APIEndpoint,
-		Model:   config.ModelID,
+		BaseURL:    config.Provider.APIEndpoint,
+		Model:      config.ModelID,
+		HTTPClient: httpClient(config),
+	}
+	if config.ResponseFormat != nil {
+		cfg.Format = config.ResponseFormat.Raw
 	}
 	return ollama.NewChatModel(ctx, cfg)
 }
@@ -214,6 +332,11 @@ func createOllamaChatModel(ctx context.Context, config Config) (model.ToolCallin
 // This is useful for logging the full prompt context.
 type BeforeChatModelFunc func(ctx context.Context, messages []*schema.Message)
 
+// MessageModifierFunc rewrites the messages that will be sent to the model.
+// The returned slice replaces the agent state, so it must be idempotent across
+// the multiple LLM calls of one ReAct loop.
+type MessageModifierFunc func(ctx context.Context, messages []*schema.Message) []*schema.Message
+
 // AgentResult holds the created agent and a cleanup function that should be
 // called (typically via defer) when the agent is no longer needed. Cleanup
 // releases per-session resources such as headless Chrome processes.
@@ -236,12 +359,22 @@ func NewChatModelAgent(ctx context.Context, config Config, toolRegistry *tools.T
 		return nil, err
 	}
 
+	// The browser extracts page content as plain text, without the response format
+	extractModel := chatModel
+	if config.ResponseFormat != nil {
+		plain := config
+		plain.ResponseFormat = nil
+		if extractModel, err = CreateChatModel(ctx, plain); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create a per-session browserTool. It is lazily initialized (Chrome only
 	// starts if the LLM actually calls the tool), so the cost of creating one
 	// per conversation is negligible.
 	browserTool, err := tools.NewBrowserTool(ctx, &tools.BrowserConfig{
 		Headless:         true,
-		ExtractChatModel: chatModel,
+		ExtractChatModel: extractModel,
 	})
 	if err != nil {
 		return nil, errs.Wrap("error.chat_browser_tool_failed", err)
@@ -256,12 +389,34 @@ func NewChatModelAgent(ctx context.Context, config Config, toolRegistry *tools.T
 	baseTools := make([]tool.BaseTool, 0, len(enabledTools)+len(extraTools)+1)
 	baseTools = append(baseTools, enabledTools...)
 	baseTools = append(baseTools, browserTool)
+	baseTools = filterAllowedTools(ctx, baseTools, config.ToolIDs)
 	baseTools = append(baseTools, extraTools...)
 
+	// Sub-agents called as tools stream their events through the parent (EmitInternalEvents);
+	// transfer targets are attached after the agent is created.
+	var transferAgents []adk.Agent
+	agentTools := 0
+	for _, sub := range config.SubAgents {
+		if sub.Mode == SubAgentTransfer {
+			transferAgents = append(transferAgents, sub.Agent)
+			continue
+		}
+		baseTools = append(baseTools, adk.NewAgentTool(ctx, sub.Agent))
+		agentTools++
+	}
+
+	description := config.Description
+	if description == "" {
+		description = "AI Assistant"
+	}
+	instruction := config.Instruction
+	if config.ResponseFormat != nil {
+		instruction += config.ResponseFormat.Instruction()
+	}
 	agentConfig := &adk.ChatModelAgentConfig{
 		Name:          config.Name,
-		Description:   "AI Assistant",
-		Instruction:   config.Instruction,
+		Description:   description,
+		Instruction:   instruction,
 		Model:         chatModel,
 		MaxIterations: UnlimitedIterations,
 	}
@@ -272,10 +427,20 @@ func NewChatModelAgent(ctx context.Context, config Config, toolRegistry *tools.T
 				Tools:               baseTools,
 				ToolCallMiddlewares: []compose.ToolMiddleware{ErrorCatchingToolMiddleware()},
 			},
+			EmitInternalEvents: agentTools > 0,
 		}
 	}
 
-	agentConfig.Middlewares = BuildMiddlewares(ctx)
+	agentConfig.Middlewares = BuildMiddlewares(ctx, config.Workspace, config.ToolIDs)
+
+	if config.MessageModifier != nil {
+		agentConfig.Middlewares = append(agentConfig.Middlewares, adk.AgentMiddleware{
+			BeforeChatModel: func(ctx context.Context, state *adk.ChatModelAgentState) error {
+				state.Messages = config.MessageModifier(ctx, state.Messages)
+				return nil
+			},
+		})
+	}
 
 	// Append a logging middleware that fires before each LLM call.
 	if beforeChatModel != nil {
@@ -287,12 +452,21 @@ func NewChatModelAgent(ctx context.Context, config Config, toolRegistry *tools.T
 		})
 	}
 
-	agent, err := adk.NewChatModelAgent(ctx, agentConfig)
+	chatAgent, err := adk.NewChatModelAgent(ctx, agentConfig)
 	if err != nil {
 		browserTool.Close()
 		return nil, err
 	}
 
+	var agent adk.Agent = chatAgent
+	if len(transferAgents) > 0 {
+		agent, err = adk.SetSubAgents(ctx, chatAgent, transferAgents)
+		if err != nil {
+			browserTool.Close()
+			return nil, errs.Wrap("error.chat_sub_agents_failed", err)
+		}
+	}
+
 	return &AgentResult{
 		Agent: agent,
 		Cleanup: func() {
@@ -301,9 +475,52 @@ func NewChatModelAgent(ctx context.Context, config Config, toolRegistry *tools.T
 	}, nil
 }
 
+// toolAllowed reports whether a tool name is in allowIDs (empty allowIDs allows every tool).
+func toolAllowed(allowIDs []string) func(name string) bool {
+	if len(allowIDs) == 0 {
+		return func(string) bool { return true }
+	}
+	allowed := make(map[string]bool, len(allowIDs))
+	for _, id := range allowIDs {
+		allowed[id] = true
+	}
+	return func(name string) bool { return allowed[name] }
+}
+
+// filterAllowedTools keeps only the tools whose name is in allowIDs (empty allowIDs keeps all).
+func filterAllowedTools(ctx context.Context, in []tool.BaseTool, allowIDs []string) []tool.BaseTool {
+	if len(allowIDs) == 0 {
+		return in
+	}
+	allowed := toolAllowed(allowIDs)
+	out := make([]tool.BaseTool, 0, len(in))
+	for _, t := range in {
+		info, err := t.Info(ctx)
+		if err != nil || !allowed(info.Name) {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// filesystemToolDocs describes each filesystem tool in the system prompt ({workspace} is the workspace directory).
+var filesystemToolDocs = []struct {
+	name string
+	doc  string
+}{
+	{"ls", `list files in a directory (use absolute path, e.g. "{workspace}")`},
+	{"read_file", "read a file from the filesystem"},
+	{"write_file", "write/create a file (prefer this over shell echo for creating files with code)"},
+	{"edit_file", "edit a file in the filesystem (string replacement based)"},
+	{filesystem.PatchToolID, "apply line-based patch operations (insert/delete/replace by line numbers). More precise than edit_file for multi-line changes."},
+	{"glob", `find files matching a pattern (e.g., "{workspace}/**/*.py")`},
+	{filesystem.GrepToolID, "search for text within files (supports regex, context lines, case-insensitive, output modes)"},
+}
+
 // buildFilesystemSystemPrompt generates a system prompt that tells the LLM about
-// the OS environment, home directory, and available filesystem/execute tools.
-func buildFilesystemSystemPrompt(baseDir string) string {
+// the OS environment, workspace directory, and the filesystem/execute tools it is allowed to use.
+func buildFilesystemSystemPrompt(baseDir string, workspace WorkspaceConfig, allowed func(name string) bool) string {
 	osName := runtime.GOOS
 	shell := "/bin/bash"
 	switch osName {
@@ -313,26 +530,35 @@ func buildFilesystemSystemPrompt(baseDir string) string {
 		shell = "/bin/zsh"
 	}
 
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = baseDir
+	}
+
 	prompt := fmt.Sprintf(`
 # Filesystem & Execute Tools — Environment Info
 
 - Operating System: %s
 - Shell: %s
-- Home directory: %s
+- Workspace directory: %s
 - All tools use real OS absolute paths. For example: ls(path="%s"), write_file(file_path="%s/foo.txt").
-- The execute tool runs commands with home directory as working directory.
+- The file tools can only access paths inside the workspace directory (symlinks pointing outside it are rejected).
+- The execute tool runs commands with the workspace directory as working directory.
 - When the user mentions "user directory" or "home directory", it refers to: %s
+`, osName, shell, baseDir, baseDir, baseDir, homeDir)
 
-# Filesystem Tools
-
-- ls: list files in a directory (use absolute path, e.g. "%s")
-- read_file: read a file from the filesystem
-- write_file: write/create a file (prefer this over shell echo for creating files with code)
-- edit_file: edit a file in the filesystem (string replacement based)
-- patch_file: apply line-based patch operations (insert/delete/replace by line numbers). More precise than edit_file for multi-line changes.
-- glob: find files matching a pattern (e.g., "%s/**/*.py")
-- grep: search for text within files (supports regex, context lines, case-insensitive, output modes)
+	var fileTools []string
+	for _, t := range filesystemToolDocs {
+		if allowed(t.name) {
+			fileTools = append(fileTools, "- "+t.name+": "+strings.ReplaceAll(t.doc, "{workspace}", baseDir))
+		}
+	}
+	if len(fileTools) > 0 {
+		prompt += "\n# Filesystem Tools\n\n" + strings.Join(fileTools, "\n") + "\n"
+	}
 
+	if allowed("execute") {
+		prompt += fmt.Sprintf(`
 # Execute Tool
 
 - Working directory: %s
@@ -341,9 +567,25 @@ func buildFilesystemSystemPrompt(baseDir string) string {
 - **NEVER run long-running or persistent commands** (e.g. "php artisan serve", "npm run dev", "python manage.py runserver", "docker compose up", "tail -f", "watch"). These will block and timeout. If the user needs to start a server, instruct them to run it manually in a separate terminal.
 - For build commands that may take long, keep them focused (e.g. "npm run build" is fine, but avoid running dev servers).
 - Avoid using cat/head/tail (use read_file), find (use glob), grep command (use grep tool)
-`, osName, shell, baseDir, baseDir, baseDir, baseDir, baseDir, baseDir, baseDir)
+`, baseDir)
+	}
 
-	if osName == "windows" {
+	if len(workspace.ReadOnlyPaths) > 0 {
+		prompt += "\n# Read-only Paths\n\nThese paths can be read with ls/read_file/glob/grep but not modified:\n"
+		for _, p := range workspace.ReadOnlyPaths {
+			prompt += "- " + p + "\n"
+		}
+	}
+	if workspace.CommandAllowlist && allowed("execute") {
+		commands := "(none — the execute tool cannot run any command)"
+		if len(workspace.AllowedCommands) > 0 {
+			commands = strings.Join(workspace.AllowedCommands, ", ")
+		}
+		prompt += "\n# Allowed Commands\n\nThe execute tool only runs these programs: " + commands +
+			"\nEvery command in a pipeline or command list must be one of them; command substitution is not allowed.\n"
+	}
+
+	if osName == "windows" && allowed("execute") {
 		prompt += `
 # PowerShell Notes
 
@@ -357,33 +599,42 @@ func buildFilesystemSystemPrompt(baseDir string) string {
 }
 
 // BuildMiddlewares creates the agent middleware stack:
-//   - filesystem: file tools (ls, read_file, write_file, edit_file, glob, grep, execute)
+//   - filesystem: file tools (ls, read_file, write_file, edit_file, patch_file, glob, grep, execute),
+//     sandboxed to the workspace
 //   - reduction: clears old tool results + offloads large results to filesystem
 //   - skill: on-demand skill loading from SKILL.md files
-func BuildMiddlewares(ctx context.Context) []adk.AgentMiddleware {
+//
+// allowIDs is the agent's tool allow-list (empty allows all): middleware tools outside it are removed,
+// and a middleware left without tools is not added.
+func BuildMiddlewares(ctx context.Context, workspace WorkspaceConfig, allowIDs []string) []adk.AgentMiddleware {
 	var middlewares []adk.AgentMiddleware
+	allowed := toolAllowed(allowIDs)
 
+	policy := &filesystem.ShellPolicy{
+		BlockedCommands: blockedCommands,
+		AllowlistMode:   workspace.CommandAllowlist,
+		AllowedCommands: workspace.AllowedCommands,
+	}
+	if workspace.Root != "" {
+		policy.TrustedDirs = []string{workspace.Root}
+	}
 	fsBackend, err := filesystem.NewLocalBackend(&filesystem.LocalBackendConfig{
-		ShellPolicy: &filesystem.ShellPolicy{
-			BlockedCommands: []string{
-				"rm -rf /", "rm -rf /*", "mkfs", "dd if=",
-				":(){:|:&};:", "format c:", "format d:",
-			},
-		},
+		BaseDir:       workspace.Root,
+		ReadOnlyPaths: workspace.ReadOnlyPaths,
+		ShellPolicy:   policy,
 	})
 	if err != nil {
 		log.Printf("[agent] failed to create local filesystem backend: %v", err)
-		reductionMw, err := reduction.NewToolResultMiddleware(ctx, &reduction.ToolResultConfig{Backend: nil})
-		if err == nil {
+		if reductionMw, ok := buildReductionMiddleware(ctx, nil); ok {
 			middlewares = append(middlewares, reductionMw)
 		}
-		if skillMw, ok := buildSkillMiddleware(ctx); ok {
+		if skillMw, ok := buildSkillMiddleware(ctx, allowed); ok {
 			middlewares = append(middlewares, skillMw)
 		}
 		return middlewares
 	}
 
-	customSystemPrompt := buildFilesystemSystemPrompt(fsBackend.BaseDir())
+	customSystemPrompt := buildFilesystemSystemPrompt(fsBackend.BaseDir(), workspace, allowed)
 
 	filesystemMw, err := fsmw.NewMiddleware(ctx, &fsmw.Config{
 		Backend:                          fsBackend,
@@ -416,35 +667,68 @@ func BuildMiddlewares(ctx context.Context) []adk.AgentMiddleware {
 			filesystemMw.AdditionalTools = append(filesystemMw.AdditionalTools, patchTool)
 		}
 
-		middlewares = append(middlewares, filesystemMw)
+		filesystemMw.AdditionalTools = filterAllowedTools(ctx, filesystemMw.AdditionalTools, allowIDs)
+		if len(filesystemMw.AdditionalTools) > 0 {
+			middlewares = append(middlewares, filesystemMw)
+		}
 	}
 
-	reductionMw, err := reduction.NewToolResultMiddleware(ctx, &reduction.ToolResultConfig{
-		Backend: fsBackend,
-	})
-	if err != nil {
-		log.Printf("[agent] failed to create reduction middleware: %v", err)
-	} else {
+	// Large results are offloaded to files the model reads back with read_file.
+	var offloadBackend reduction.Backend
+	if allowed("read_file") {
+		offloadBackend = fsBackend
+	}
+	if reductionMw, ok := buildReductionMiddleware(ctx, offloadBackend); ok {
 		middlewares = append(middlewares, reductionMw)
 	}
 
-	if skillMw, ok := buildSkillMiddleware(ctx); ok {
+	if skillMw, ok := buildSkillMiddleware(ctx, allowed); ok {
 		middlewares = append(middlewares, skillMw)
 	}
 
 	return middlewares
 }
 
-// buildSkillMiddleware creates the skill middleware.
-// Skills are stored under $HOME/.agents/skills/<skill-name>/SKILL.md.
-func buildSkillMiddleware(ctx context.Context) (adk.AgentMiddleware, bool) {
+// buildReductionMiddleware creates the tool result reduction middleware.
+// Without a backend, large results cannot be offloaded and old results are only cleared.
+func buildReductionMiddleware(ctx context.Context, backend reduction.Backend) (adk.AgentMiddleware, bool) {
+	reductionMw, err := reduction.NewToolResultMiddleware(ctx, &reduction.ToolResultConfig{Backend: backend})
+	if err != nil {
+		log.Printf("[agent] failed to create reduction middleware: %v", err)
+		return adk.AgentMiddleware{}, false
+	}
+	if backend == nil {
+		// The offloading wrapper writes to the backend unconditionally.
+		reductionMw.WrapToolCall = compose.ToolMiddleware{}
+	}
+	return reductionMw, true
+}
+
+// SkillsDir returns the directory skills are loaded from: $HOME/.agents/skills.
+func SkillsDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".agents", "skills"), nil
+}
+
+// skillToolName is the name of the tool the skill middleware adds.
+const skillToolName = "skill"
+
+// buildSkillMiddleware creates the skill middleware, unless the skill tool is not allowed.
+// Skills are stored under $HOME/.agents/skills/<skill-name>/SKILL.md.
+func buildSkillMiddleware(ctx context.Context, allowed func(name string) bool) (adk.AgentMiddleware, bool) {
+	if !allowed(skillToolName) {
+		return adk.AgentMiddleware{}, false
+	}
+
+	skillsDir, err := SkillsDir()
 	if err != nil {
 		log.Printf("[agent] failed to get home dir for skills: %v", err)
 		return adk.AgentMiddleware{}, false
 	}
 
-	skillsDir := filepath.Join(homeDir, ".agents", "skills")
 	if err := os.MkdirAll(skillsDir, 0o755); err != nil {
 		log.Printf("[agent] failed to create skills directory %s: %v", skillsDir, err)
 		return adk.AgentMiddleware{}, false
@@ -456,7 +740,8 @@ func buildSkillMiddleware(ctx context.Context) (adk.AgentMiddleware, bool) {
 		return adk.AgentMiddleware{}, false
 	}
 
-	skillMw, err := skill.New(ctx, &skill.Config{Backend: skillBackend, UseChinese: true})
+	name := skillToolName
+	skillMw, err := skill.New(ctx, &skill.Config{Backend: skillBackend, SkillToolName: &name, UseChinese: true})
 	if err != nil {
 		log.Printf("[agent] failed to create skill middleware: %v", err)
 		return adk.AgentMiddleware{}, false
@@ -0,0 +1,501 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A small JSON Schema validator covering the keywords used for structured output:
+// type, enum, const, properties, required, additionalProperties, patternProperties,
+// items, prefixItems, string/number/array/object bounds, pattern, allOf, anyOf, oneOf,
+// not and local $ref (#/$defs/..., #/definitions/...). Annotations such as format,
+// title and description are ignored.
+
+const (
+	// maxSchemaErrors limits the errors reported for one value (they are sent back to the model)
+	maxSchemaErrors = 10
+	// maxRefDepth guards against recursive schema references
+	maxRefDepth = 64
+)
+
+var schemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// checkSchema verifies that a schema only uses valid types, patterns and resolvable references.
+func checkSchema(root map[string]any, node any, path string) error {
+	s, ok := node.(map[string]any)
+	if !ok {
+		if _, isBool := node.(bool); isBool {
+			return nil
+		}
+		return fmt.Errorf("%s: a schema must be an object or a boolean", path)
+	}
+
+	if ref, ok := s["$ref"]; ok {
+		refStr, isStr := ref.(string)
+		if !isStr {
+			return fmt.Errorf("%s: $ref must be a string", path)
+		}
+		if _, err := resolveRef(root, refStr); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if t, ok := s["type"]; ok {
+		names, err := typeList(t)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, name := range names {
+			if !schemaTypes[name] {
+				return fmt.Errorf("%s: unknown type %q", path, name)
+			}
+		}
+	}
+	if p, ok := s["pattern"]; ok {
+		pattern, isStr := p.(string)
+		if !isStr {
+			return fmt.Errorf("%s: pattern must be a string", path)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", path, err)
+		}
+	}
+	if req, ok := s["required"]; ok {
+		list, isList := req.([]any)
+		if !isList {
+			return fmt.Errorf("%s: required must be an array", path)
+		}
+		for _, name := range list {
+			if _, isStr := name.(string); !isStr {
+				return fmt.Errorf("%s: required must only contain strings", path)
+			}
+		}
+	}
+	if e, ok := s["enum"]; ok {
+		if _, isList := e.([]any); !isList {
+			return fmt.Errorf("%s: enum must be an array", path)
+		}
+	}
+
+	// Sub-schemas keyed by name
+	for _, kw := range []string{"properties", "$defs", "definitions", "patternProperties"} {
+		m, ok := s[kw]
+		if !ok {
+			continue
+		}
+		children, isMap := m.(map[string]any)
+		if !isMap {
+			return fmt.Errorf("%s: %s must be an object", path, kw)
+		}
+		for _, name := range sortedKeys(children) {
+			if kw == "patternProperties" {
+				if _, err := regexp.Compile(name); err != nil {
+					return fmt.Errorf("%s/%s: invalid pattern: %w", path, kw, err)
+				}
+			}
+			if err := checkSchema(root, children[name], path+"/"+kw+"/"+escapePointer(name)); err != nil {
+				return err
+			}
+		}
+	}
+	// Sub-schema lists
+	for _, kw := range []string{"allOf", "anyOf", "oneOf", "prefixItems"} {
+		l, ok := s[kw]
+		if !ok {
+			continue
+		}
+		list, isList := l.([]any)
+		if !isList || len(list) == 0 {
+			return fmt.Errorf("%s: %s must be a non-empty array", path, kw)
+		}
+		for i, child := range list {
+			if err := checkSchema(root, child, fmt.Sprintf("%s/%s/%d", path, kw, i)); err != nil {
+				return err
+			}
+		}
+	}
+	// Single sub-schemas ("items" may also be a tuple in older drafts)
+	for _, kw := range []string{"items", "additionalProperties", "additionalItems", "not"} {
+		child, ok := s[kw]
+		if !ok {
+			continue
+		}
+		if list, isList := child.([]any); isList && kw == "items" {
+			for i, item := range list {
+				if err := checkSchema(root, item, fmt.Sprintf("%s/items/%d", path, i)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := checkSchema(root, child, path+"/"+kw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSchema validates a decoded JSON value against a schema.
+func validateSchema(root map[string]any, value any) error {
+	v := &schemaValidator{root: root}
+	v.validate(root, value, "$", 0)
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(v.errs, "; "))
+}
+
+type schemaValidator struct {
+	root map[string]any
+	errs []string
+}
+
+func (v *schemaValidator) fail(path, format string, args ...any) {
+	if len(v.errs) < maxSchemaErrors {
+		v.errs = append(v.errs, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+// matches reports whether value matches schema without recording errors.
+func (v *schemaValidator) matches(schema, value any, depth int) bool {
+	sub := &schemaValidator{root: v.root}
+	sub.validate(schema, value, "$", depth)
+	return len(sub.errs) == 0
+}
+
+func (v *schemaValidator) validate(node, value any, path string, depth int) {
+	s, ok := node.(map[string]any)
+	if !ok {
+		if allowed, isBool := node.(bool); isBool && !allowed {
+			v.fail(path, "no value is allowed here")
+		}
+		return
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		if depth >= maxRefDepth {
+			v.fail(path, "schema references are nested too deeply")
+			return
+		}
+		target, err := resolveRef(v.root, ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		v.validate(target, value, path, depth+1)
+	}
+
+	if t, ok := s["type"]; ok {
+		names, _ := typeList(t)
+		if !matchesType(names, value) {
+			v.fail(path, "expected %s, got %s", strings.Join(names, " or "), jsonType(value))
+			return
+		}
+	}
+	if enum, ok := s["enum"].([]any); ok && !containsValue(enum, value) {
+		v.fail(path, "must be one of %s", compactJSON(enum))
+	}
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, value) {
+		v.fail(path, "must be %s", compactJSON(c))
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		v.validateObject(s, val, path, depth)
+	case []any:
+		v.validateArray(s, val, path, depth)
+	case string:
+		v.validateString(s, val, path)
+	case float64:
+		v.validateNumber(s, val, path)
+	}
+
+	if list, ok := s["allOf"].([]any); ok {
+		for _, sub := range list {
+			v.validate(sub, value, path, depth+1)
+		}
+	}
+	if list, ok := s["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range list {
+			if v.matches(sub, value, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "does not match any of the allowed schemas")
+		}
+	}
+	if list, ok := s["oneOf"].([]any); ok {
+		count := 0
+		for _, sub := range list {
+			if v.matches(sub, value, depth+1) {
+				count++
+			}
+		}
+		if count != 1 {
+			v.fail(path, "must match exactly one of the allowed schemas (matched %d)", count)
+		}
+	}
+	if not, ok := s["not"]; ok && v.matches(not, value, depth+1) {
+		v.fail(path, "must not match the excluded schema")
+	}
+}
+
+func (v *schemaValidator) validateObject(s map[string]any, obj map[string]any, path string, depth int) {
+	if required, ok := s["required"].([]any); ok {
+		for _, r := range required {
+			if name, _ := r.(string); name != "" {
+				if _, present := obj[name]; !present {
+					v.fail(path, "missing required property %q", name)
+				}
+			}
+		}
+	}
+	if n, ok := number(s["minProperties"]); ok && float64(len(obj)) < n {
+		v.fail(path, "must have at least %v properties", n)
+	}
+	if n, ok := number(s["maxProperties"]); ok && float64(len(obj)) > n {
+		v.fail(path, "must have at most %v properties", n)
+	}
+
+	properties, _ := s["properties"].(map[string]any)
+	patterns, _ := s["patternProperties"].(map[string]any)
+	additional, hasAdditional := s["additionalProperties"]
+	for _, key := range sortedKeys(obj) {
+		childPath := propertyPath(path, key)
+		known := false
+		if prop, ok := properties[key]; ok {
+			known = true
+			v.validate(prop, obj[key], childPath, depth+1)
+		}
+		for pattern, prop := range patterns {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(key) {
+				known = true
+				v.validate(prop, obj[key], childPath, depth+1)
+			}
+		}
+		if known || !hasAdditional {
+			continue
+		}
+		if allowed, isBool := additional.(bool); isBool {
+			if !allowed {
+				v.fail(path, "property %q is not allowed", key)
+			}
+			continue
+		}
+		v.validate(additional, obj[key], childPath, depth+1)
+	}
+}
+
+func (v *schemaValidator) validateArray(s map[string]any, arr []any, path string, depth int) {
+	if n, ok := number(s["minItems"]); ok && float64(len(arr)) < n {
+		v.fail(path, "must have at least %v items", n)
+	}
+	if n, ok := number(s["maxItems"]); ok && float64(len(arr)) > n {
+		v.fail(path, "must have at most %v items", n)
+	}
+	if unique, _ := s["uniqueItems"].(bool); unique {
+		for i := 1; i < len(arr); i++ {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(arr[i], arr[j]) {
+					v.fail(path, "items %d and %d are equal", j, i)
+				}
+			}
+		}
+	}
+
+	// Tuple items (prefixItems, or an items array in older drafts), then the schema for the rest
+	prefix, _ := s["prefixItems"].([]any)
+	rest, hasRest := s["items"]
+	if tuple, isTuple := rest.([]any); isTuple {
+		prefix = tuple
+		rest, hasRest = s["additionalItems"]
+	}
+	for i, item := range arr {
+		itemPath := path + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case i < len(prefix):
+			v.validate(prefix[i], item, itemPath, depth+1)
+		case hasRest:
+			v.validate(rest, item, itemPath, depth+1)
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(s map[string]any, str, path string) {
+	length := float64(utf8.RuneCountInString(str))
+	if n, ok := number(s["minLength"]); ok && length < n {
+		v.fail(path, "must be at least %v characters long", n)
+	}
+	if n, ok := number(s["maxLength"]); ok && length > n {
+		v.fail(path, "must be at most %v characters long", n)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(str) {
+			v.fail(path, "must match the pattern %q", pattern)
+		}
+	}
+}
+
+func (v *schemaValidator) validateNumber(s map[string]any, n float64, path string) {
+	if limit, ok := number(s["minimum"]); ok && n < limit {
+		v.fail(path, "must be >= %v", limit)
+	}
+	if limit, ok := number(s["maximum"]); ok && n > limit {
+		v.fail(path, "must be <= %v", limit)
+	}
+	if limit, ok := number(s["exclusiveMinimum"]); ok && n <= limit {
+		v.fail(path, "must be > %v", limit)
+	}
+	if limit, ok := number(s["exclusiveMaximum"]); ok && n >= limit {
+		v.fail(path, "must be < %v", limit)
+	}
+	if m, ok := number(s["multipleOf"]); ok && m > 0 {
+		if q := n / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "must be a multiple of %v", m)
+		}
+	}
+}
+
+// resolveRef resolves a local reference ("#" or a JSON pointer such as "#/$defs/item").
+func resolveRef(root map[string]any, ref string) (any, error) {
+	if ref == "#" {
+		return root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported reference %q (only local references are supported)", ref)
+	}
+	var node any = root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("unresolved reference %q", ref)
+			}
+			node = child
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("unresolved reference %q", ref)
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("unresolved reference %q", ref)
+		}
+	}
+	return node, nil
+}
+
+func typeList(t any) ([]string, error) {
+	switch tt := t.(type) {
+	case string:
+		return []string{tt}, nil
+	case []any:
+		names := make([]string, 0, len(tt))
+		for _, item := range tt {
+			name, ok := item.(string)
+			if !ok {
+				return nil, errors.New("type must be a string or an array of strings")
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	default:
+		return nil, errors.New("type must be a string or an array of strings")
+	}
+}
+
+func matchesType(names []string, value any) bool {
+	actual := jsonType(value)
+	for _, name := range names {
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type of a decoded value (whole numbers are integers).
+func jsonType(value any) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if val == math.Trunc(val) && !math.IsInf(val, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func containsValue(list []any, value any) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func number(v any) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
+
+func compactJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// propertyPath appends an object key to a value path ($.a.b, or $["a b"] for other keys).
+func propertyPath(path, key string) string {
+	for _, r := range key {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return path + "[" + strconv.Quote(key) + "]"
+		}
+	}
+	if key == "" {
+		return path + `[""]`
+	}
+	return path + "." + key
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func mustDecode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("decode %s: %v", s, err)
+	}
+	return v
+}
+
+func TestValidateSchemaKeywords(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		value   string
+		wantErr string // empty: the value is valid
+	}{
+		// type
+		{"type string", `{"type":"string"}`, `"a"`, ""},
+		{"type mismatch", `{"type":"string"}`, `1`, `$: expected string, got integer`},
+		{"type integer rejects fraction", `{"type":"integer"}`, `1.5`, `$: expected integer, got number`},
+		{"type number accepts integer", `{"type":"number"}`, `2`, ""},
+		{"type list", `{"type":["string","null"]}`, `null`, ""},
+		{"type list mismatch", `{"type":["string","null"]}`, `true`, `$: expected string or null, got boolean`},
+
+		// enum / const
+		{"enum", `{"enum":["a","b"]}`, `"b"`, ""},
+		{"enum mismatch", `{"enum":["a","b"]}`, `"c"`, `$: must be one of ["a","b"]`},
+		{"enum object", `{"enum":[{"k":1}]}`, `{"k":1}`, ""},
+		{"const", `{"const":3}`, `3`, ""},
+		{"const mismatch", `{"const":3}`, `4`, `$: must be 3`},
+
+		// properties / required / additionalProperties / patternProperties
+		{"properties", `{"properties":{"a":{"type":"string"}}}`, `{"a":"x"}`, ""},
+		{"properties mismatch", `{"properties":{"a":{"type":"string"}}}`, `{"a":1}`, `$.a: expected string, got integer`},
+		{"property path quoting", `{"properties":{"a b":{"type":"string"}}}`, `{"a b":1}`, `$["a b"]: expected string, got integer`},
+		{"required", `{"required":["a"]}`, `{"a":null}`, ""},
+		{"required missing", `{"required":["a"]}`, `{}`, `$: missing required property "a"`},
+		{"additionalProperties false", `{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`, `$: property "b" is not allowed`},
+		{"additionalProperties schema", `{"additionalProperties":{"type":"integer"}}`, `{"x":"y"}`, `$.x: expected integer, got string`},
+		{"additionalProperties absent", `{"properties":{"a":{}}}`, `{"b":2}`, ""},
+		{"patternProperties", `{"patternProperties":{"^n_":{"type":"number"}},"additionalProperties":false}`, `{"n_1":1}`, ""},
+		{"patternProperties mismatch", `{"patternProperties":{"^n_":{"type":"number"}}}`, `{"n_1":"x"}`, `$.n_1: expected number, got string`},
+		{"patternProperties not additional", `{"patternProperties":{"^n_":{}},"additionalProperties":false}`, `{"x":1}`, `$: property "x" is not allowed`},
+		{"minProperties", `{"minProperties":2}`, `{"a":1}`, `$: must have at least 2 properties`},
+		{"maxProperties", `{"maxProperties":1}`, `{"a":1,"b":2}`, `$: must have at most 1 properties`},
+
+		// items / prefixItems / array bounds
+		{"items", `{"items":{"type":"integer"}}`, `[1,2]`, ""},
+		{"items mismatch", `{"items":{"type":"integer"}}`, `[1,"x"]`, `$[1]: expected integer, got string`},
+		{"prefixItems", `{"prefixItems":[{"type":"string"},{"type":"integer"}],"items":false}`, `["a",1]`, ""},
+		{"prefixItems mismatch", `{"prefixItems":[{"type":"string"}]}`, `[1]`, `$[0]: expected string, got integer`},
+		{"prefixItems rest", `{"prefixItems":[{"type":"string"}],"items":false}`, `["a",1]`, `$[1]: no value is allowed here`},
+		{"tuple items with additionalItems", `{"items":[{"type":"string"}],"additionalItems":{"type":"boolean"}}`, `["a",true,1]`, `$[2]: expected boolean, got integer`},
+		{"minItems", `{"minItems":1}`, `[]`, `$: must have at least 1 items`},
+		{"maxItems", `{"maxItems":1}`, `[1,2]`, `$: must have at most 1 items`},
+		{"uniqueItems", `{"uniqueItems":true}`, `[1,{"a":1},{"a":1}]`, `$: items 1 and 2 are equal`},
+		{"uniqueItems ok", `{"uniqueItems":true}`, `[1,2]`, ""},
+
+		// strings
+		{"minLength counts runes", `{"minLength":2}`, `"中文"`, ""},
+		{"minLength", `{"minLength":2}`, `"a"`, `$: must be at least 2 characters long`},
+		{"maxLength", `{"maxLength":1}`, `"ab"`, `$: must be at most 1 characters long`},
+		{"pattern", `{"pattern":"^[a-z]+$"}`, `"abc"`, ""},
+		{"pattern mismatch", `{"pattern":"^[a-z]+$"}`, `"ab1"`, `$: must match the pattern "^[a-z]+$"`},
+
+		// numbers
+		{"minimum", `{"minimum":1}`, `0`, `$: must be >= 1`},
+		{"maximum", `{"maximum":1}`, `2`, `$: must be <= 1`},
+		{"exclusiveMinimum", `{"exclusiveMinimum":1}`, `1`, `$: must be > 1`},
+		{"exclusiveMaximum", `{"exclusiveMaximum":1}`, `1`, `$: must be < 1`},
+		{"multipleOf", `{"multipleOf":0.1}`, `0.3`, ""},
+		{"multipleOf mismatch", `{"multipleOf":2}`, `3`, `$: must be a multiple of 2`},
+
+		// combinators
+		{"allOf", `{"allOf":[{"type":"integer"},{"minimum":2}]}`, `1`, `$: must be >= 2`},
+		{"anyOf", `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `1`, ""},
+		{"anyOf mismatch", `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `true`, `$: does not match any of the allowed schemas`},
+		{"oneOf", `{"oneOf":[{"type":"string"},{"type":"integer"}]}`, `"a"`, ""},
+		{"oneOf both", `{"oneOf":[{"type":"number"},{"type":"integer"}]}`, `1`, `$: must match exactly one of the allowed schemas (matched 2)`},
+		{"not", `{"not":{"type":"null"}}`, `null`, `$: must not match the excluded schema`},
+		{"boolean schema true", `{"properties":{"a":true}}`, `{"a":1}`, ""},
+		{"boolean schema false", `{"properties":{"a":false}}`, `{"a":1}`, `$.a: no value is allowed here`},
+
+		// $ref
+		{"ref to $defs", `{"$defs":{"id":{"type":"integer"}},"properties":{"a":{"$ref":"#/$defs/id"}}}`, `{"a":"x"}`, `$.a: expected integer, got string`},
+		{"ref to definitions", `{"definitions":{"id":{"type":"integer"}},"items":{"$ref":"#/definitions/id"}}`, `[1,2]`, ""},
+		{"ref escaped pointer", `{"$defs":{"a/b":{"type":"string"}},"$ref":"#/$defs/a~1b"}`, `1`, `$: expected string, got integer`},
+		{
+			"recursive ref",
+			`{"$defs":{"node":{"type":"object","required":["name"],"properties":{"name":{"type":"string"},"children":{"type":"array","items":{"$ref":"#/$defs/node"}}}}},"$ref":"#/$defs/node"}`,
+			`{"name":"root","children":[{"name":"a","children":[{"name":"b"}]},{"name":"c"}]}`,
+			"",
+		},
+		{
+			"recursive ref mismatch deep",
+			`{"$defs":{"node":{"type":"object","required":["name"],"properties":{"name":{"type":"string"},"children":{"type":"array","items":{"$ref":"#/$defs/node"}}}}},"$ref":"#/$defs/node"}`,
+			`{"name":"root","children":[{"name":"a","children":[{"id":1}]}]}`,
+			`$.children[0].children[0]: missing required property "name"`,
+		},
+		{"ref to root", `{"type":"object","properties":{"next":{"$ref":"#"}},"additionalProperties":false}`, `{"next":{"next":{"x":1}}}`, `$.next.next: property "x" is not allowed`},
+		{"self-referencing ref", `{"$defs":{"loop":{"$ref":"#/$defs/loop"}},"$ref":"#/$defs/loop"}`, `1`, `$: schema references are nested too deeply`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := mustDecode(t, tt.schema).(map[string]any)
+			if err := checkSchema(root, root, "#"); err != nil {
+				t.Fatalf("checkSchema: %v", err)
+			}
+			err := validateSchema(root, mustDecode(t, tt.value))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error %q, got none", tt.wantErr)
+			}
+			if err.Error() != tt.wantErr {
+				t.Fatalf("error = %q, want %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSchemaRejectsInvalidSchemas(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{"unknown type", `{"type":"strng"}`, `#: unknown type "strng"`},
+		{"type not string", `{"type":1}`, `#: type must be a string or an array of strings`},
+		{"bad pattern", `{"properties":{"a":{"pattern":"("}}}`, `#/properties/a: invalid pattern`},
+		{"bad patternProperties key", `{"patternProperties":{"(":{}}}`, `#/patternProperties: invalid pattern`},
+		{"required not array", `{"required":"a"}`, `#: required must be an array`},
+		{"required not strings", `{"required":[1]}`, `#: required must only contain strings`},
+		{"enum not array", `{"enum":"a"}`, `#: enum must be an array`},
+		{"properties not object", `{"properties":[]}`, `#: properties must be an object`},
+		{"empty anyOf", `{"anyOf":[]}`, `#: anyOf must be a non-empty array`},
+		{"schema not object", `{"items":1}`, `#/items: a schema must be an object or a boolean`},
+		{"unresolved ref", `{"properties":{"a":{"$ref":"#/$defs/missing"}}}`, `#/properties/a: unresolved reference "#/$defs/missing"`},
+		{"remote ref", `{"$ref":"https://example.com/schema.json"}`, `only local references are supported`},
+		{"nested error path", `{"$defs":{"x":{"items":[{"type":"bogus"}]}}}`, `#/$defs/x/items/0: unknown type "bogus"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := mustDecode(t, tt.schema).(map[string]any)
+			err := checkSchema(root, root, "#")
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %q, want it to contain %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidateSchemaErrorOutput checks the message sent back to the model: every problem is
+// listed with its path, joined by "; ", and the list is capped at maxSchemaErrors.
+func TestValidateSchemaErrorOutput(t *testing.T) {
+	root := mustDecode(t, `{
+		"type": "object",
+		"required": ["title", "tags"],
+		"properties": {
+			"title": {"type": "string", "minLength": 3},
+			"score": {"type": "number", "maximum": 10},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		},
+		"additionalProperties": false
+	}`).(map[string]any)
+
+	err := validateSchema(root, mustDecode(t, `{"title":"ab","score":11,"extra":true}`))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	want := `$: missing required property "tags"; ` +
+		`$: property "extra" is not allowed; ` +
+		`$.score: must be <= 10; ` +
+		`$.title: must be at least 3 characters long`
+	if err.Error() != want {
+		t.Fatalf("error = %q\nwant    %q", err.Error(), want)
+	}
+
+	var items []string
+	for i := 0; i < maxSchemaErrors+5; i++ {
+		items = append(items, "1")
+	}
+	err = validateSchema(root, mustDecode(t, `{"title":"abc","tags":[`+strings.Join(items, ",")+`]}`))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := len(strings.Split(err.Error(), "; ")); got != maxSchemaErrors {
+		t.Fatalf("got %d errors, want %d", got, maxSchemaErrors)
+	}
+}
+
+func TestResponseFormatValidate(t *testing.T) {
+	format, err := ParseResponseFormat(`{"title":"Answer Card","type":"object","required":["answer"],"properties":{"answer":{"type":"string"}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.Name != "Answer_Card" {
+		t.Fatalf("name = %q", format.Name)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr string
+	}{
+		{"plain", `{"answer": "ok"}`, `{"answer":"ok"}`, ""},
+		{"code fence", "```json\n{\"answer\": \"ok\"}\n```", `{"answer":"ok"}`, ""},
+		{"surrounding text", "Here it is: {\"answer\": \"ok\"} done", `{"answer":"ok"}`, ""},
+		{"empty", "  ", "", "the answer is empty"},
+		{"not json", "no json here", "", "the answer is not valid JSON"},
+		{"schema mismatch", `{"answer": 1}`, "", `$.answer: expected string, got integer`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := format.Validate(tt.content)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, raw := range []string{`[]`, `{"type":"array"}`, `{"type":"object","properties":{"a":{"type":"nope"}}}`} {
+		if _, err := ParseResponseFormat(raw); err == nil {
+			t.Errorf("ParseResponseFormat(%s): expected an error", raw)
+		}
+	}
+}
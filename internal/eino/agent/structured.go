@@ -0,0 +1,330 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
+)
+
+// ResponseFormat constrains the final answer of an agent to a JSON value matching a JSON Schema.
+// Providers with native support (OpenAI response_format, Gemini responseSchema, Ollama format)
+// receive the schema directly; Claude is forced to answer through a tool whose input is the schema.
+// OpenAI-compatible providers that reject the json_schema format rely on the instruction alone.
+// In every case the answer is validated against the schema afterwards.
+type ResponseFormat struct {
+	Name   string             // schema name for providers that require one (derived from the schema title)
+	Raw    json.RawMessage    // the schema document as configured
+	Schema *jsonschema.Schema // typed schema for providers that take one
+
+	doc map[string]any // decoded schema used for validation
+}
+
+// ParseResponseFormat parses and checks a JSON Schema used as response format.
+// The root schema must describe an object, which every provider accepts.
+func ParseResponseFormat(raw string) (*ResponseFormat, error) {
+	raw = strings.TrimSpace(raw)
+	var doc any
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return nil, errors.New("the schema must be a JSON object")
+	}
+	if t, _ := root["type"].(string); t != "object" {
+		return nil, errors.New(`the root schema must have "type": "object"`)
+	}
+	if err := checkSchema(root, root, "#"); err != nil {
+		return nil, err
+	}
+
+	var typed jsonschema.Schema
+	if err := json.Unmarshal([]byte(raw), &typed); err != nil {
+		return nil, fmt.Errorf("unsupported schema: %w", err)
+	}
+
+	title, _ := root["title"].(string)
+	return &ResponseFormat{
+		Name:   schemaName(title),
+		Raw:    json.RawMessage(raw),
+		Schema: &typed,
+		doc:    root,
+	}, nil
+}
+
+// schemaName turns a schema title into a name accepted by OpenAI (^[a-zA-Z0-9_-]{1,64}$).
+func schemaName(title string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(title) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		case r == ' ' || r == '.':
+			b.WriteByte('_')
+		}
+		if b.Len() >= 64 {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "response"
+	}
+	return b.String()
+}
+
+// Instruction returns the system instruction section that describes the required answer format.
+func (f *ResponseFormat) Instruction() string {
+	return "\n\n# Response Format\n" +
+		"Your final answer must be a single JSON value that matches the JSON Schema below. " +
+		"Do not add any other text or Markdown code fences around it.\n" +
+		"```json\n" + string(f.Raw) + "\n```\n"
+}
+
+// Validate checks that content is a JSON value matching the schema and returns it compacted.
+// A Markdown code fence or short text around the JSON value is tolerated.
+func (f *ResponseFormat) Validate(content string) (string, error) {
+	data := extractJSON(content)
+	if data == "" {
+		return "", errors.New("the answer is empty")
+	}
+	var value any
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return "", fmt.Errorf("the answer is not valid JSON: %w", err)
+	}
+	if err := validateSchema(f.doc, value); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(data)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// extractJSON strips a Markdown code fence or text around the JSON value of an answer.
+func extractJSON(content string) string {
+	s := strings.TrimSpace(content)
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s, "```")
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			s = s[i+1:] // language tag
+		}
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+	}
+	if json.Valid([]byte(s)) {
+		return s
+	}
+	// Text before or after the value: take the outermost object or array
+	start := strings.IndexAny(s, "{[")
+	if start < 0 {
+		return s
+	}
+	closing := "}"
+	if s[start] == '[' {
+		closing = "]"
+	}
+	if end := strings.LastIndex(s, closing); end > start {
+		return s[start : end+1]
+	}
+	return s
+}
+
+// responseFormatUnsupported remembers the provider models ("provider/model") that rejected
+// a json_schema response format, so later requests go straight to the fallback.
+var responseFormatUnsupported sync.Map
+
+// responseFormatRejectedHints are found in the errors of providers that do not accept
+// a json_schema response format (e.g. "response_format type is unavailable").
+var responseFormatRejectedHints = []string{"response_format", "json_schema", "response format"}
+
+// isResponseFormatRejected reports whether a request failed because of its response format.
+func isResponseFormatRejected(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, hint := range responseFormatRejectedHints {
+		if strings.Contains(msg, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// responseFormatFallbackModel sends requests with the native response format and repeats them
+// without it when the provider rejects the format. The schema stays in the system instruction
+// and the answer is validated afterwards, so the fallback only loses the provider-side constraint.
+type responseFormatFallbackModel struct {
+	key    string
+	native model.ToolCallingChatModel // with the json_schema response format
+	plain  model.ToolCallingChatModel // without a response format
+}
+
+func newResponseFormatFallbackModel(key string, native, plain model.ToolCallingChatModel) *responseFormatFallbackModel {
+	return &responseFormatFallbackModel{key: key, native: native, plain: plain}
+}
+
+func (m *responseFormatFallbackModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	native, err := m.native.WithTools(tools)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := m.plain.WithTools(tools)
+	if err != nil {
+		return nil, err
+	}
+	return newResponseFormatFallbackModel(m.key, native, plain), nil
+}
+
+// useNative reports whether the provider model has not rejected the response format yet.
+func (m *responseFormatFallbackModel) useNative() bool {
+	_, rejected := responseFormatUnsupported.Load(m.key)
+	return !rejected
+}
+
+// rejected records a rejected response format and reports whether the request should be repeated.
+func (m *responseFormatFallbackModel) rejected(err error) bool {
+	if !isResponseFormatRejected(err) {
+		return false
+	}
+	log.Printf("[agent] %s rejected the json_schema response format, using instruction and validation only: %v", m.key, err)
+	responseFormatUnsupported.Store(m.key, true)
+	return true
+}
+
+func (m *responseFormatFallbackModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	if m.useNative() {
+		msg, err := m.native.Generate(ctx, input, opts...)
+		if !m.rejected(err) {
+			return msg, err
+		}
+	}
+	return m.plain.Generate(ctx, input, opts...)
+}
+
+// Stream falls back when the request is rejected; a stream that has already started is not repeated.
+func (m *responseFormatFallbackModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	if m.useNative() {
+		sr, err := m.native.Stream(ctx, input, opts...)
+		if !m.rejected(err) {
+			return sr, err
+		}
+	}
+	return m.plain.Stream(ctx, input, opts...)
+}
+
+// structuredOutputToolName is the tool Claude is forced to call to return a structured answer.
+const structuredOutputToolName = "structured_output"
+
+// forcedOutputModel implements the response format for providers without native structured output.
+// It binds a structured_output tool whose parameters are the schema and forces a tool call on
+// every request: the model either calls a real tool or answers through structured_output, whose
+// arguments are returned as the content of a plain answer.
+type forcedOutputModel struct {
+	inner  model.ToolCallingChatModel
+	tools  []*schema.ToolInfo
+	output *schema.ToolInfo
+}
+
+func newForcedOutputModel(inner model.ToolCallingChatModel, format *ResponseFormat) *forcedOutputModel {
+	return &forcedOutputModel{
+		inner: inner,
+		output: &schema.ToolInfo{
+			Name:        structuredOutputToolName,
+			Desc:        "Give your final answer to the user. The arguments are the answer and must match the required response format. Call this tool once when you are done; do not answer with plain text.",
+			ParamsOneOf: schema.NewParamsOneOfByJSONSchema(format.Schema),
+		},
+	}
+}
+
+func (m *forcedOutputModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	bound := *m
+	bound.tools = tools
+	return &bound, nil
+}
+
+func (m *forcedOutputModel) bind() (model.ToolCallingChatModel, error) {
+	tools := make([]*schema.ToolInfo, 0, len(m.tools)+1)
+	tools = append(tools, m.tools...)
+	tools = append(tools, m.output)
+	return m.inner.WithTools(tools)
+}
+
+func (m *forcedOutputModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	cm, err := m.bind()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := cm.Generate(ctx, input, append(opts, model.WithToolChoice(schema.ToolChoiceForced))...)
+	if err != nil {
+		return nil, err
+	}
+	return unwrapStructuredOutput(msg), nil
+}
+
+// Stream collects the response before returning it: the structured answer only exists once the
+// tool call arguments are complete, so it is delivered as a single chunk.
+func (m *forcedOutputModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	cm, err := m.bind()
+	if err != nil {
+		return nil, err
+	}
+	sr, err := cm.Stream(ctx, input, append(opts, model.WithToolChoice(schema.ToolChoiceForced))...)
+	if err != nil {
+		return nil, err
+	}
+	defer sr.Close()
+
+	var chunks []*schema.Message
+	for {
+		chunk, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) == 0 {
+		return schema.StreamReaderFromArray([]*schema.Message{}), nil
+	}
+	msg, err := schema.ConcatMessages(chunks)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{unwrapStructuredOutput(msg)}), nil
+}
+
+// unwrapStructuredOutput turns a structured_output tool call into a plain answer.
+// Other tool calls of the same message are dropped: the model has decided to answer.
+func unwrapStructuredOutput(msg *schema.Message) *schema.Message {
+	if msg == nil {
+		return nil
+	}
+	for _, tc := range msg.ToolCalls {
+		if tc.Function.Name != structuredOutputToolName {
+			continue
+		}
+		out := *msg
+		out.Content = tc.Function.Arguments
+		out.ToolCalls = nil
+		if msg.ResponseMeta != nil {
+			meta := *msg.ResponseMeta
+			meta.FinishReason = "stop"
+			out.ResponseMeta = &meta
+		}
+		return &out
+	}
+	return msg
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// fakeChatModel answers with content or fails with err and counts its calls.
+type fakeChatModel struct {
+	content string
+	err     error
+	calls   int
+}
+
+func (m *fakeChatModel) WithTools([]*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+func (m *fakeChatModel) Generate(context.Context, []*schema.Message, ...model.Option) (*schema.Message, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return schema.AssistantMessage(m.content, nil), nil
+}
+
+func (m *fakeChatModel) Stream(context.Context, []*schema.Message, ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{schema.AssistantMessage(m.content, nil)}), nil
+}
+
+func TestIsResponseFormatRejected(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("status code: 400, message: response_format type is unavailable"), true},
+		{errors.New("Invalid parameter: 'json_schema' is not supported with this model"), true},
+		{errors.New("This model does not support Response Format"), true},
+		{errors.New("status code: 429, rate limit exceeded"), false},
+	}
+	for _, tt := range tests {
+		if got := isResponseFormatRejected(tt.err); got != tt.want {
+			t.Errorf("isResponseFormatRejected(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestResponseFormatFallbackModel(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("native accepted", func(t *testing.T) {
+		native := &fakeChatModel{content: "native"}
+		plain := &fakeChatModel{content: "plain"}
+		m := newResponseFormatFallbackModel(t.Name(), native, plain)
+		msg, err := m.Generate(ctx, nil)
+		if err != nil || msg.Content != "native" || plain.calls != 0 {
+			t.Fatalf("msg=%v err=%v plain calls=%d", msg, err, plain.calls)
+		}
+	})
+
+	t.Run("rejected format falls back and is remembered", func(t *testing.T) {
+		native := &fakeChatModel{err: errors.New("response_format json_schema is not supported")}
+		plain := &fakeChatModel{content: "plain"}
+		m := newResponseFormatFallbackModel(t.Name(), native, plain)
+		msg, err := m.Generate(ctx, nil)
+		if err != nil || msg.Content != "plain" {
+			t.Fatalf("msg=%v err=%v", msg, err)
+		}
+		sr, err := m.Stream(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk, err := sr.Recv(); err != nil || chunk.Content != "plain" {
+			t.Fatalf("chunk=%v err=%v", chunk, err)
+		}
+		if native.calls != 1 || plain.calls != 2 {
+			t.Fatalf("native calls=%d plain calls=%d, want 1 and 2", native.calls, plain.calls)
+		}
+	})
+
+	t.Run("other errors are returned", func(t *testing.T) {
+		native := &fakeChatModel{err: errors.New("connection refused")}
+		plain := &fakeChatModel{content: "plain"}
+		m := newResponseFormatFallbackModel(t.Name(), native, plain)
+		if _, err := m.Generate(ctx, nil); err == nil || plain.calls != 0 {
+			t.Fatalf("err=%v plain calls=%d", err, plain.calls)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package chatmodel
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"time"
 
 	"github.com/cloudwego/eino-ext/components/model/claude"
@@ -11,10 +12,14 @@ import (
 	"github.com/cloudwego/eino-ext/components/model/openai"
 	"github.com/cloudwego/eino/components/model"
 	"google.golang.org/genai"
+
+	"chatclaw/internal/eino/ratelimit"
 )
 
 // ProviderConfig 创建 ChatModel 所需的配置
 type ProviderConfig struct {
+	// ProviderID 供应商 ID（用于按供应商限流，可选）
+	ProviderID string
 	// ProviderType 供应商类型（openai, azure, ollama, gemini, anthropic）
 	ProviderType string
 	// APIKey 供应商的 API 密钥
@@ -52,11 +57,17 @@ func NewChatModel(ctx context.Context, cfg *ProviderConfig) (model.ChatModel, er
 	}
 }
 
+// httpClient 经过供应商限流的 HTTP 客户端；流式响应时长不固定，不设置请求超时
+func httpClient(cfg *ProviderConfig) *http.Client {
+	return ratelimit.NewHTTPClient(ratelimit.ProviderKey(cfg.ProviderID, cfg.ProviderType, cfg.APIEndpoint), 0)
+}
+
 // newOpenAIChatModel 创建 OpenAI ChatModel
 func newOpenAIChatModel(ctx context.Context, cfg *ProviderConfig) (model.ChatModel, error) {
 	config := &openai.ChatModelConfig{
-		APIKey: cfg.APIKey,
-		Model:  cfg.ModelID,
+		APIKey:     cfg.APIKey,
+		Model:      cfg.ModelID,
+		HTTPClient: httpClient(cfg),
 	}
 	if cfg.APIEndpoint != "" {
 		config.BaseURL = cfg.APIEndpoint
@@ -86,6 +97,7 @@ func newAzureChatModel(ctx context.Context, cfg *ProviderConfig) (model.ChatMode
 		BaseURL:    cfg.APIEndpoint,
 		ByAzure:    true,
 		APIVersion: extraConfig.APIVersion,
+		HTTPClient: httpClient(cfg),
 	}
 	return openai.NewChatModel(ctx, config)
 }
@@ -98,8 +110,9 @@ func newOllamaChatModel(ctx context.Context, cfg *ProviderConfig) (model.ChatMod
 	}
 
 	config := &ollama.ChatModelConfig{
-		BaseURL: baseURL,
-		Model:   cfg.ModelID,
+		BaseURL:    baseURL,
+		Model:      cfg.ModelID,
+		HTTPClient: httpClient(cfg),
 	}
 	return ollama.NewChatModel(ctx, config)
 }
@@ -107,7 +120,8 @@ func newOllamaChatModel(ctx context.Context, cfg *ProviderConfig) (model.ChatMod
 // newGeminiChatModel 创建 Gemini ChatModel
 func newGeminiChatModel(ctx context.Context, cfg *ProviderConfig) (model.ChatModel, error) {
 	clientConfig := &genai.ClientConfig{
-		APIKey: cfg.APIKey,
+		APIKey:     cfg.APIKey,
+		HTTPClient: httpClient(cfg),
 	}
 	if cfg.APIEndpoint != "" {
 		clientConfig.HTTPOptions = genai.HTTPOptions{
@@ -133,9 +147,10 @@ func newClaudeChatModel(ctx context.Context, cfg *ProviderConfig) (model.ChatMod
 	}
 
 	return claude.NewChatModel(ctx, &claude.Config{
-		APIKey:    cfg.APIKey,
-		Model:     cfg.ModelID,
-		BaseURL:   baseURL,
-		MaxTokens: 4096,
+		APIKey:     cfg.APIKey,
+		Model:      cfg.ModelID,
+		BaseURL:    baseURL,
+		MaxTokens:  4096,
+		HTTPClient: httpClient(cfg),
 	})
 }
@@ -3,47 +3,250 @@ package embedding
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 
 	einoembedding "github.com/cloudwego/eino/components/embedding"
 )
 
+// BatchConfig 向量化批次配置，0 表示使用供应商默认值
+type BatchConfig struct {
+	BatchSize   int `json:"batch_size"`  // 单次请求最多包含的文本数
+	Parallelism int `json:"parallelism"` // 同时进行的请求数
+}
+
+// DefaultBatchConfig 按供应商返回默认批次配置
+// OpenAI / Azure 单次最多 2048 条；通义千问等部分 OpenAI 兼容接口限制为 10 条；
+// 本地 Ollama 没有配额限制，并发请求可以充分利用 GPU
+func DefaultBatchConfig(providerID, providerType string) BatchConfig {
+	switch {
+	case providerID == "openai" || providerType == "azure":
+		return BatchConfig{BatchSize: 2048, Parallelism: 4}
+	case providerType == "ollama":
+		return BatchConfig{BatchSize: 32, Parallelism: 4}
+	default:
+		return BatchConfig{BatchSize: DefaultBatchSize, Parallelism: 2}
+	}
+}
+
+// withDefaults 未配置的字段使用供应商默认值
+func (c BatchConfig) withDefaults(providerID, providerType string) BatchConfig {
+	def := DefaultBatchConfig(providerID, providerType)
+	if c.BatchSize <= 0 {
+		c.BatchSize = def.BatchSize
+	}
+	if c.Parallelism <= 0 {
+		c.Parallelism = def.Parallelism
+	}
+	return c
+}
+
+// learnedBatchSizes 按（供应商、模型）记录自动缩小后的批次大小，之后创建的 embedder 直接使用
+var learnedBatchSizes sync.Map
+
+// growAfterSuccesses 连续这么多个满批次成功后把批次大小翻倍（不超过配置值），
+// 避免一次临时的拒绝（如限流时的 413）让批次永久停留在较小的值
+const growAfterSuccesses = 20
+
 // batchEmbedder wraps an Embedder and enforces a maximum batch size.
 // This is critical for providers that restrict input.contents length (e.g. Qwen <= 10).
+// Batches run concurrently up to parallelism; when the provider rejects a batch as too large
+// the batch size is halved and the failed batch retried; after a run of successful full batches
+// it grows back towards the configured limit.
 type batchEmbedder struct {
-	inner   einoembedding.Embedder
-	maxSize int
+	inner       einoembedding.Embedder
+	key         string
+	parallelism int
+	limit       int
+
+	mu        sync.Mutex
+	maxSize   int
+	successes int
 }
 
 func WrapWithBatchLimit(inner einoembedding.Embedder, maxSize int) einoembedding.Embedder {
+	return wrapWithBatchConfig(inner, "", BatchConfig{BatchSize: maxSize, Parallelism: 1})
+}
+
+// wrapWithBatchConfig 按批次配置包装 embedder，key 用于记录自动缩小后的批次大小
+func wrapWithBatchConfig(inner einoembedding.Embedder, key string, cfg BatchConfig) einoembedding.Embedder {
 	if inner == nil {
 		return nil
 	}
-	if maxSize <= 0 {
+	if cfg.BatchSize <= 0 {
 		return inner
 	}
-	return &batchEmbedder{inner: inner, maxSize: maxSize}
+	size := cfg.BatchSize
+	if key != "" {
+		if v, ok := learnedBatchSizes.Load(key); ok {
+			size = min(size, v.(int))
+		}
+	}
+	return &batchEmbedder{
+		inner:       inner,
+		key:         key,
+		parallelism: max(cfg.Parallelism, 1),
+		limit:       cfg.BatchSize,
+		maxSize:     size,
+	}
+}
+
+func (b *batchEmbedder) batchSize() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.maxSize
+}
+
+// shrink 批次过大时把批次大小减半（至少为 1），返回新的批次大小
+func (b *batchEmbedder) shrink(failed int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.successes = 0
+	// 并发批次可能同时失败，只按失败批次的大小缩小一次
+	if size := max(failed/2, 1); size < b.maxSize {
+		b.maxSize = size
+		b.learn()
+	}
+	return b.maxSize
+}
+
+// grow 记录一次成功的请求；连续 growAfterSuccesses 个满批次成功后把批次大小翻倍（不超过配置值）
+func (b *batchEmbedder) grow(succeeded int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// 不满一批（如最后一批）不能说明当前批次大小可以放大
+	if b.maxSize >= b.limit || succeeded < b.maxSize {
+		return
+	}
+	b.successes++
+	if b.successes < growAfterSuccesses {
+		return
+	}
+	b.successes = 0
+	b.maxSize = min(b.maxSize*2, b.limit)
+	b.learn()
+}
+
+// learn 把当前批次大小记录到 learnedBatchSizes，恢复到配置值时删除记录，调用方需持有 b.mu
+func (b *batchEmbedder) learn() {
+	if b.key == "" {
+		return
+	}
+	if b.maxSize >= b.limit {
+		learnedBatchSizes.Delete(b.key)
+		return
+	}
+	learnedBatchSizes.Store(b.key, b.maxSize)
 }
 
 func (b *batchEmbedder) EmbedStrings(ctx context.Context, texts []string, opts ...einoembedding.Option) ([][]float64, error) {
 	if len(texts) == 0 {
 		return nil, nil
 	}
-	if len(texts) <= b.maxSize {
-		return b.inner.EmbedStrings(ctx, texts, opts...)
+
+	size := b.batchSize()
+	if len(texts) <= size {
+		return b.embedAdaptive(ctx, texts, opts...)
 	}
 
-	out := make([][]float64, 0, len(texts))
-	for i := 0; i < len(texts); i += b.maxSize {
-		end := i + b.maxSize
-		if end > len(texts) {
-			end = len(texts)
+	out := make([][]float64, len(texts))
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, b.parallelism)
+	for i := 0; i < len(texts); i += size {
+		end := min(i+size, len(texts))
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			vecs, err := b.embedAdaptive(ctx, texts[start:end], opts...)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("embed batch [%d:%d]: %w", start, end, err)
+					cancel()
+				})
+				return
+			}
+			copy(out[start:end], vecs)
+		}(i, end)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// embedAdaptive 请求一个批次；供应商以批次过大拒绝时缩小批次后分开重试
+func (b *batchEmbedder) embedAdaptive(ctx context.Context, texts []string, opts ...einoembedding.Option) ([][]float64, error) {
+	vecs, err := b.inner.EmbedStrings(ctx, texts, opts...)
+	if err == nil {
+		if len(vecs) != len(texts) {
+			return nil, fmt.Errorf("embedding count mismatch: got %d, want %d", len(vecs), len(texts))
 		}
-		vecs, err := b.inner.EmbedStrings(ctx, texts[i:end], opts...)
+		b.grow(len(texts))
+		return vecs, nil
+	}
+	if len(texts) <= 1 || !isBatchTooLarge(err) {
+		return nil, err
+	}
+
+	size := b.shrink(len(texts))
+	out := make([][]float64, 0, len(texts))
+	for i := 0; i < len(texts); i += size {
+		end := min(i+size, len(texts))
+		part, err := b.embedAdaptive(ctx, texts[i:end], opts...)
 		if err != nil {
-			return nil, fmt.Errorf("embed batch [%d:%d]: %w", i, end, err)
+			return nil, err
 		}
-		out = append(out, vecs...)
+		out = append(out, part...)
+		// 重试过程中批次可能被进一步缩小
+		size = b.batchSize()
 	}
 	return out, nil
 }
 
+// batchTooLargeHints 供应商拒绝批次过大（条数或 token 数超限）时错误信息中的关键字
+var batchTooLargeHints = []string{
+	"batch size",
+	"batch_size",
+	"too many inputs",
+	"input.contents",
+	"maximum request size",
+	"max_tokens_per_request",
+	"tokens per request",
+	"request too large",
+	"payload too large",
+	"exceeds the limit",
+}
+
+// isBatchTooLarge 判断错误是否由批次过大导致
+func isBatchTooLarge(err error) bool {
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "status code: 413") {
+		return true
+	}
+	for _, hint := range batchTooLargeHints {
+		if strings.Contains(msg, hint) {
+			return true
+		}
+	}
+	return false
+}
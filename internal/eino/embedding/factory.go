@@ -3,11 +3,14 @@ package embedding
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"time"
 
 	ollamaembed "github.com/cloudwego/eino-ext/components/embedding/ollama"
 	openaiembed "github.com/cloudwego/eino-ext/components/embedding/openai"
 	"github.com/cloudwego/eino/components/embedding"
+
+	"chatclaw/internal/eino/ratelimit"
 )
 
 const (
@@ -18,6 +21,8 @@ const (
 
 // ProviderConfig 创建 Embedder 所需的配置
 type ProviderConfig struct {
+	// ProviderID 供应商 ID（用于按供应商限流，可选）
+	ProviderID string
 	// ProviderType 供应商类型（openai, azure, ollama, gemini, anthropic）
 	ProviderType string
 	// APIKey 供应商的 API 密钥
@@ -32,6 +37,8 @@ type ProviderConfig struct {
 	ExtraConfig string
 	// Timeout 请求超时时间
 	Timeout time.Duration
+	// Batch 批次大小和并发数（可选，未配置时按供应商使用默认值）
+	Batch BatchConfig
 }
 
 // NewEmbedder 根据供应商配置创建新的 Embedder
@@ -46,35 +53,47 @@ func NewEmbedder(ctx context.Context, cfg *ProviderConfig) (embedding.Embedder,
 		if err != nil {
 			return nil, err
 		}
-		return WrapWithBatchLimit(emb, DefaultBatchSize), nil
+		return wrapBatch(emb, cfg), nil
 	case "azure":
 		emb, err := newAzureEmbedder(ctx, cfg)
 		if err != nil {
 			return nil, err
 		}
-		return WrapWithBatchLimit(emb, DefaultBatchSize), nil
+		return wrapBatch(emb, cfg), nil
 	case "ollama":
 		emb, err := newOllamaEmbedder(ctx, cfg)
 		if err != nil {
 			return nil, err
 		}
-		return WrapWithBatchLimit(emb, DefaultBatchSize), nil
+		return wrapBatch(emb, cfg), nil
 	default:
 		// 默认使用 OpenAI 兼容 API
 		emb, err := newOpenAIEmbedder(ctx, cfg)
 		if err != nil {
 			return nil, err
 		}
-		return WrapWithBatchLimit(emb, DefaultBatchSize), nil
+		return wrapBatch(emb, cfg), nil
 	}
 }
 
+// wrapBatch 按批次配置包装 embedder（分批、并发、批次过大时自动缩小）
+func wrapBatch(emb embedding.Embedder, cfg *ProviderConfig) embedding.Embedder {
+	key := ratelimit.ProviderKey(cfg.ProviderID, cfg.ProviderType, cfg.APIEndpoint) + "/" + cfg.ModelID
+	return wrapWithBatchConfig(emb, key, cfg.Batch.withDefaults(cfg.ProviderID, cfg.ProviderType))
+}
+
+// httpClient 经过供应商限流的 HTTP 客户端（同一供应商的 embedder 和 chat model 共用限流配额）
+func httpClient(cfg *ProviderConfig) *http.Client {
+	return ratelimit.NewHTTPClient(ratelimit.ProviderKey(cfg.ProviderID, cfg.ProviderType, cfg.APIEndpoint), cfg.Timeout)
+}
+
 // newOpenAIEmbedder 创建 OpenAI Embedder
 func newOpenAIEmbedder(ctx context.Context, cfg *ProviderConfig) (embedding.Embedder, error) {
 	config := &openaiembed.EmbeddingConfig{
-		APIKey:  cfg.APIKey,
-		Model:   cfg.ModelID,
-		Timeout: cfg.Timeout,
+		APIKey:     cfg.APIKey,
+		Model:      cfg.ModelID,
+		Timeout:    cfg.Timeout,
+		HTTPClient: httpClient(cfg),
 	}
 	if cfg.APIEndpoint != "" {
 		config.BaseURL = cfg.APIEndpoint
@@ -110,6 +129,7 @@ func newAzureEmbedder(ctx context.Context, cfg *ProviderConfig) (embedding.Embed
 		ByAzure:    true,
 		APIVersion: extraConfig.APIVersion,
 		Timeout:    cfg.Timeout,
+		HTTPClient: httpClient(cfg),
 	}
 	return openaiembed.NewEmbedder(ctx, config)
 }
@@ -122,9 +142,10 @@ func newOllamaEmbedder(ctx context.Context, cfg *ProviderConfig) (embedding.Embe
 	}
 
 	config := &ollamaembed.EmbeddingConfig{
-		BaseURL: baseURL,
-		Model:   cfg.ModelID,
-		Timeout: cfg.Timeout,
+		BaseURL:    baseURL,
+		Model:      cfg.ModelID,
+		Timeout:    cfg.Timeout,
+		HTTPClient: httpClient(cfg),
 	}
 	return ollamaembed.NewEmbedder(ctx, config)
 }
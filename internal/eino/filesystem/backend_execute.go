@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"time"
@@ -13,15 +15,26 @@ import (
 )
 
 // ShellPolicy defines security constraints for shell command execution.
+//
+// The policy is checked on the command line before it runs; it is not an OS sandbox.
+// A command can still reach files outside the working directory (e.g. "cd /; ..."),
+// so an allowlist of programs is the stricter choice for untrusted agents.
 type ShellPolicy struct {
 	TrustedDirs     []string      // Allowed working directories. Empty = no restriction.
 	BlockedCommands []string      // Rejected command patterns (substring match).
 	DefaultTimeout  time.Duration // Max execution time per command. 0 = 60s default.
+
+	// AllowlistMode only allows commands whose programs are all in AllowedCommands
+	// (e.g. "git", "npm"). Each command of a pipeline or command list is checked;
+	// command substitution is rejected because it cannot be checked, and so are
+	// file redirections (>, >>, <) whose targets are outside the workspace.
+	AllowlistMode   bool
+	AllowedCommands []string
 }
 
 // Execute runs a shell command and returns its output.
 // Shell: powershell on Windows, zsh on macOS, bash on Linux.
-// Working directory: baseDir.
+// Working directory: baseDir (the workspace).
 //
 // The command runs in its own process group so that on timeout or cancellation
 // the entire process tree (including child processes such as `php artisan serve`)
@@ -149,10 +162,168 @@ func (b *LocalBackend) validateCommand(command string) error {
 	if b.policy == nil {
 		return nil
 	}
+	if len(b.policy.TrustedDirs) > 0 && !b.isTrustedDir(b.realBaseDir) {
+		return fmt.Errorf("working directory is not a trusted directory: %s", b.baseDir)
+	}
 	for _, blocked := range b.policy.BlockedCommands {
 		if strings.Contains(command, blocked) {
 			return fmt.Errorf("command contains blocked pattern: %q", blocked)
 		}
 	}
+	if b.policy.AllowlistMode {
+		return b.checkAllowedCommands(command)
+	}
 	return nil
 }
+
+func (b *LocalBackend) isTrustedDir(dir string) bool {
+	for _, trusted := range b.policy.TrustedDirs {
+		real, err := filepath.EvalSymlinks(trusted)
+		if err != nil {
+			continue
+		}
+		if isWithin(real, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandSeparators splits a command line into simple commands (bash and PowerShell).
+var commandSeparators = regexp.MustCompile(`&&|\|\||[;&|\r\n]`)
+
+// checkAllowedCommands checks that every simple command starts with an allowed program.
+func (b *LocalBackend) checkAllowedCommands(command string) error {
+	for _, subst := range []string{"`", "$(", "<(", ">("} {
+		if strings.Contains(command, subst) {
+			return fmt.Errorf("command substitution (%s) is not allowed in allowlist mode", subst)
+		}
+	}
+
+	if err := b.checkRedirections(command); err != nil {
+		return err
+	}
+	// Drop the redirections so that "2>&1" is not split into commands at "&"
+	command = redirectionPattern.ReplaceAllString(command, " ")
+
+	allowed := make(map[string]bool, len(b.policy.AllowedCommands))
+	for _, name := range b.policy.AllowedCommands {
+		allowed[programName(name)] = true
+	}
+
+	checked := 0
+	for _, part := range commandSeparators.Split(command, -1) {
+		fields := strings.Fields(part)
+		// Skip leading environment assignments (FOO=bar cmd)
+		i := 0
+		for i < len(fields) && isEnvAssignment(fields[i]) {
+			i++
+		}
+		if i == len(fields) {
+			continue
+		}
+		name := programName(fields[i])
+		if name == "" {
+			continue
+		}
+		if !allowed[name] {
+			return fmt.Errorf("command %q is not in the allowed commands list", name)
+		}
+		checked++
+	}
+	if checked == 0 {
+		return fmt.Errorf("empty command")
+	}
+	return nil
+}
+
+// redirectionPattern matches a redirection (bash and PowerShell) and its target:
+// an optional fd ("2", "&", "*"), the operator, then a quoted or bare word.
+var redirectionPattern = regexp.MustCompile(`(?:\d+|&|\*)?(>>|>\||>&|<&|<<<|<<-?|<>|>|<)[ \t]*("[^"]*"|'[^']*'|[^\s;&|<>()]*)`)
+
+// nullDevices may be redirected to from anywhere.
+var nullDevices = map[string]bool{"/dev/null": true, "NUL": true, "$null": true}
+
+// checkRedirections checks that file redirections only read and write inside the workspace.
+// Relative targets are resolved against the working directory, which is the workspace.
+func (b *LocalBackend) checkRedirections(command string) error {
+	for _, m := range redirectionPattern.FindAllStringSubmatch(command, -1) {
+		op, target := m[1], strings.Trim(m[2], `"'`)
+		switch op {
+		case "<<", "<<-", "<<<":
+			// Here-documents and here-strings read no file
+			continue
+		case ">&", "<&":
+			// Duplicating a file descriptor (2>&1, >&-)
+			if target == "-" || isDigits(target) {
+				continue
+			}
+		}
+		if target == "" {
+			return fmt.Errorf("redirection %s without a target is not allowed in allowlist mode", op)
+		}
+		if nullDevices[target] {
+			continue
+		}
+		if strings.ContainsAny(target, "$~*?[") {
+			return fmt.Errorf("redirection target %q cannot be checked in allowlist mode", target)
+		}
+		var err error
+		if op == "<" {
+			_, err = b.resolveReadPath(target)
+		} else {
+			_, err = b.resolvePath(target)
+		}
+		if err != nil {
+			return fmt.Errorf("redirection %s %s is not allowed: %w", op, target, err)
+		}
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// programName returns the comparable name of a program: base name without
+// grouping characters, and on Windows lower-cased without executable extension.
+func programName(s string) string {
+	s = strings.TrimLeft(strings.TrimSpace(s), "({!")
+	s = strings.TrimRight(s, ")}")
+	s = strings.Trim(s, `"'`)
+	s = filepath.Base(filepath.ToSlash(s))
+	if s == "." || s == "/" {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		s = strings.ToLower(s)
+		for _, ext := range []string{".exe", ".cmd", ".bat", ".ps1"} {
+			s = strings.TrimSuffix(s, ext)
+		}
+	}
+	return s
+}
+
+func isEnvAssignment(field string) bool {
+	name, _, ok := strings.Cut(field, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
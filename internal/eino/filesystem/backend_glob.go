@@ -13,7 +13,7 @@ import (
 
 // GlobInfo returns file paths matching the glob pattern.
 func (b *LocalBackend) GlobInfo(ctx context.Context, req *filesystem.GlobInfoRequest) ([]filesystem.FileInfo, error) {
-	basePath, err := b.resolvePath(req.Path)
+	basePath, err := b.resolveReadPath(req.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -35,6 +35,10 @@ func (b *LocalBackend) GlobInfo(ctx context.Context, req *filesystem.GlobInfoReq
 
 	var result []filesystem.FileInfo
 	for _, m := range matches {
+		// Patterns such as "../*" or symlinks may match paths outside the workspace
+		if !b.canRead(m) {
+			continue
+		}
 		result = append(result, filesystem.FileInfo{Path: b.toAPIPath(m)})
 	}
 
@@ -17,7 +17,7 @@ import (
 // This method implements the filesystem.Backend interface and is used by the
 // built-in eino grep tool.
 func (b *LocalBackend) GrepRaw(ctx context.Context, req *filesystem.GrepRequest) ([]filesystem.GrepMatch, error) {
-	basePath, err := b.resolvePath(req.Path)
+	basePath, err := b.resolveReadPath(req.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -38,6 +38,10 @@ func (b *LocalBackend) GrepRaw(ctx context.Context, req *filesystem.GrepRequest)
 		if isBinaryFile(path) {
 			return nil
 		}
+		// Symlinked files may point outside the workspace
+		if info.Mode()&os.ModeSymlink != 0 && !b.canRead(path) {
+			return nil
+		}
 		fileMatches, err := grepFile(path, req.Pattern, b)
 		if err != nil {
 			return nil
@@ -107,7 +111,7 @@ type GrepOptions struct {
 // GrepEnhanced performs a grep search with context lines, case-insensitive
 // matching, and output mode control. It returns a formatted string result.
 func (b *LocalBackend) GrepEnhanced(ctx context.Context, opts *GrepOptions) (string, error) {
-	basePath, err := b.resolvePath(opts.Path)
+	basePath, err := b.resolveReadPath(opts.Path)
 	if err != nil {
 		return "", err
 	}
@@ -161,6 +165,10 @@ func (b *LocalBackend) GrepEnhanced(ctx context.Context, opts *GrepOptions) (str
 		if isBinaryFile(path) {
 			return nil
 		}
+		// Symlinked files may point outside the workspace
+		if info.Mode()&os.ModeSymlink != 0 && !b.canRead(path) {
+			return nil
+		}
 
 		// Read the entire file into lines for context support.
 		data, readErr := os.ReadFile(path)
@@ -11,7 +11,7 @@ import (
 
 // LsInfo lists file/directory information at the given path.
 func (b *LocalBackend) LsInfo(ctx context.Context, req *filesystem.LsInfoRequest) ([]filesystem.FileInfo, error) {
-	targetPath, err := b.resolvePath(req.Path)
+	targetPath, err := b.resolveReadPath(req.Path)
 	if err != nil {
 		return nil, err
 	}
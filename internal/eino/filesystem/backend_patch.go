@@ -98,7 +98,7 @@ func (b *LocalBackend) Patch(ctx context.Context, filePath string, ops []PatchOp
 	}
 
 	result := strings.Join(lines, "\n")
-	if err := os.WriteFile(absPath, []byte(result), 0o644); err != nil {
+	if err := writeFile(absPath, []byte(result)); err != nil {
 		return "", fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -12,7 +12,7 @@ import (
 
 // Read reads file content with line-based offset and limit.
 func (b *LocalBackend) Read(ctx context.Context, req *filesystem.ReadRequest) (string, error) {
-	filePath, err := b.resolvePath(req.FilePath)
+	filePath, err := b.resolveReadPath(req.FilePath)
 	if err != nil {
 		return "", err
 	}
@@ -19,7 +19,7 @@ func (b *LocalBackend) Write(ctx context.Context, req *filesystem.WriteRequest)
 	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
-	return os.WriteFile(filePath, []byte(req.Content), 0o644)
+	return writeFile(filePath, []byte(req.Content))
 }
 
 // Edit replaces string occurrences in a file.
@@ -56,5 +56,5 @@ func (b *LocalBackend) Edit(ctx context.Context, req *filesystem.EditRequest) er
 	} else {
 		newContent = strings.Replace(content, req.OldString, req.NewString, 1)
 	}
-	return os.WriteFile(filePath, []byte(newContent), 0o644)
+	return writeFile(filePath, []byte(newContent))
 }
@@ -18,7 +18,7 @@ const GrepToolDesc = `Search for a pattern in files.
 
 Usage:
 - The pattern parameter is the text to search for. Treated as regex; falls back to literal match on invalid regex.
-- The path parameter filters which directory or file to search in (defaults to home directory).
+- The path parameter filters which directory or file to search in (defaults to the workspace directory).
 - The glob parameter accepts a glob pattern to filter which files to search (e.g. "*.go", "*.ts").
 - The ignore_case parameter enables case-insensitive matching.
 - The context_before / context_after parameters show surrounding lines for each match (like grep -B / -A).
@@ -37,7 +37,7 @@ Examples:
 // grepFileInput is the JSON schema for the grep_file tool arguments.
 type grepFileInput struct {
 	Pattern          string `json:"pattern" jsonschema:"description=The search pattern. Treated as regex; falls back to literal match on invalid regex."`
-	Path             string `json:"path,omitempty" jsonschema:"description=Directory or file path to search in. Defaults to home directory if empty."`
+	Path             string `json:"path,omitempty" jsonschema:"description=Directory or file path to search in. Defaults to the workspace directory if empty."`
 	Glob             string `json:"glob,omitempty" jsonschema:"description=Optional filename glob filter (e.g. '*.go' or '*.ts'). Only files matching this pattern are searched."`
 	IgnoreCase       bool   `json:"ignore_case,omitempty" jsonschema:"description=If true performs case-insensitive matching."`
 	ContextBefore    int    `json:"context_before,omitempty" jsonschema:"description=Number of lines to show before each match (like grep -B). Default 0."`
@@ -23,16 +23,22 @@ import (
 )
 
 // LocalBackend implements filesystem.Backend and filesystem.ShellBackend
-// using the real local filesystem, rooted at a base directory (typically user's home).
+// using the real local filesystem, rooted at a base directory (the workspace, typically user's home).
+//
+// All paths are checked after resolving symlinks: tools may read and write inside baseDir,
+// and only read inside readOnlyDirs.
 type LocalBackend struct {
-	baseDir string
-	policy  *ShellPolicy
+	baseDir      string
+	realBaseDir  string   // baseDir with symlinks resolved
+	readOnlyDirs []string // extra readable paths, symlinks resolved
+	policy       *ShellPolicy
 }
 
 // LocalBackendConfig configures the LocalBackend.
 type LocalBackendConfig struct {
-	BaseDir     string       // Root for all filesystem ops. Empty = user home directory.
-	ShellPolicy *ShellPolicy // Security constraints. Nil = no restrictions.
+	BaseDir       string       // Root for all filesystem ops and the execute working directory. Empty = user home directory.
+	ReadOnlyPaths []string     // Extra files or directories the tools may read but not modify. Missing paths are ignored.
+	ShellPolicy   *ShellPolicy // Security constraints. Nil = no restrictions.
 }
 
 // NewLocalBackend creates a new LocalBackend with the given configuration.
@@ -45,6 +51,10 @@ func NewLocalBackend(config *LocalBackendConfig) (*LocalBackend, error) {
 		}
 		baseDir = home
 	}
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve base directory: %w", err)
+	}
 
 	info, err := os.Stat(baseDir)
 	if err != nil {
@@ -53,8 +63,29 @@ func NewLocalBackend(config *LocalBackendConfig) (*LocalBackend, error) {
 	if !info.IsDir() {
 		return nil, fmt.Errorf("base path is not a directory: %s", baseDir)
 	}
+	realBaseDir, err := filepath.EvalSymlinks(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve base directory: %w", err)
+	}
+
+	var readOnlyDirs []string
+	for _, p := range config.ReadOnlyPaths {
+		if p == "" || !filepath.IsAbs(p) {
+			continue
+		}
+		real, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			continue
+		}
+		readOnlyDirs = append(readOnlyDirs, real)
+	}
 
-	return &LocalBackend{baseDir: baseDir, policy: config.ShellPolicy}, nil
+	return &LocalBackend{
+		baseDir:      baseDir,
+		realBaseDir:  realBaseDir,
+		readOnlyDirs: readOnlyDirs,
+		policy:       config.ShellPolicy,
+	}, nil
 }
 
 // BaseDir returns the root directory for all filesystem operations.
@@ -62,19 +93,27 @@ func (b *LocalBackend) BaseDir() string {
 	return b.baseDir
 }
 
-// resolvePath converts a path to an absolute filesystem path.
+// resolvePath converts a path to an absolute filesystem path that may be modified.
 // Absolute OS paths (e.g. "C:\foo", "/home/user/foo") are used directly.
 // Relative paths and "/" are resolved against baseDir.
-// Returns an error if the result escapes baseDir.
+// Returns an error if the result (after resolving symlinks) escapes baseDir.
 func (b *LocalBackend) resolvePath(p string) (string, error) {
-	if p == "" || p == "/" {
-		return b.baseDir, nil
-	}
+	return b.resolve(p, false)
+}
 
+// resolveReadPath is like resolvePath but also accepts paths inside the read-only paths.
+func (b *LocalBackend) resolveReadPath(p string) (string, error) {
+	return b.resolve(p, true)
+}
+
+func (b *LocalBackend) resolve(p string, read bool) (string, error) {
 	var resolved string
-	if filepath.IsAbs(p) {
+	switch {
+	case p == "" || p == "/":
+		resolved = b.baseDir
+	case filepath.IsAbs(p):
 		resolved = p
-	} else {
+	default:
 		cleanPath := strings.TrimPrefix(p, "/")
 		cleanPath = strings.TrimPrefix(cleanPath, "\\")
 		resolved = filepath.Join(b.baseDir, cleanPath)
@@ -84,17 +123,120 @@ func (b *LocalBackend) resolvePath(p string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to resolve path: %w", err)
 	}
-	absBase, err := filepath.Abs(b.baseDir)
+	real, err := realPath(absResolved)
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve base path: %w", err)
+		return "", fmt.Errorf("failed to resolve path: %w", err)
 	}
 
-	rel, err := filepath.Rel(filepath.Clean(absBase), filepath.Clean(absResolved))
-	if err != nil || strings.HasPrefix(rel, "..") {
-		return "", fmt.Errorf("path escapes base directory: %s", p)
+	if isWithin(b.realBaseDir, real) {
+		return absResolved, nil
+	}
+	for _, dir := range b.readOnlyDirs {
+		if isWithin(dir, real) {
+			if read {
+				return absResolved, nil
+			}
+			return "", fmt.Errorf("path is read-only: %s", p)
+		}
 	}
+	return "", fmt.Errorf("path is outside the workspace %s: %s", b.baseDir, p)
+}
 
-	return absResolved, nil
+// canRead reports whether an existing path (e.g. a symlink found while walking a directory)
+// resolves to a location the tools may read.
+func (b *LocalBackend) canRead(fsPath string) bool {
+	real, err := realPath(fsPath)
+	if err != nil {
+		return false
+	}
+	if isWithin(b.realBaseDir, real) {
+		return true
+	}
+	for _, dir := range b.readOnlyDirs {
+		if isWithin(dir, real) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSymlinks bounds the symlinks followed by realPath, so a link loop ends with an error.
+const maxSymlinks = 40
+
+// realPath resolves symlinks in p. Missing trailing components (a file about to be
+// written) are kept as they are, after resolving their deepest existing parent.
+// Dangling symlinks are followed to their target: writing through one would create the target.
+func realPath(p string) (string, error) {
+	return realPathDepth(p, 0)
+}
+
+func realPathDepth(p string, depth int) (string, error) {
+	if depth > maxSymlinks {
+		return "", fmt.Errorf("too many levels of symbolic links: %s", p)
+	}
+	cur, rest := p, ""
+	for {
+		real, err := filepath.EvalSymlinks(cur)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		// EvalSymlinks also fails with "not exist" on a symlink whose target is missing.
+		if info, err := os.Lstat(cur); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(cur)
+			if err != nil {
+				return "", err
+			}
+			if !filepath.IsAbs(target) {
+				parent, err := filepath.EvalSymlinks(filepath.Dir(cur))
+				if err != nil {
+					return "", err
+				}
+				target = filepath.Join(parent, target)
+			}
+			real, err := realPathDepth(target, depth+1)
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(real, rest), nil
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return p, nil
+		}
+		rest = filepath.Join(filepath.Base(cur), rest)
+		cur = parent
+	}
+}
+
+// writeFile writes data to a path returned by resolvePath. The file is opened at its resolved
+// location without following a symlink, so a link swapped in after the workspace check
+// cannot redirect the write outside the workspace.
+func writeFile(fsPath string, data []byte) error {
+	real, err := realPath(fsPath)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(real, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|openNoFollow, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// isWithin reports whether p is root or inside root (both absolute and clean).
+func isWithin(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
 // toAPIPath returns the display path shown to the LLM.
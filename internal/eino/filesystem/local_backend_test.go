@@ -0,0 +1,171 @@
+//go:build !windows
+
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/adk/filesystem"
+)
+
+// newTestBackend creates a workspace and a directory outside it.
+func newTestBackend(t *testing.T, policy *ShellPolicy) (*LocalBackend, string, string) {
+	t.Helper()
+	root := t.TempDir()
+	workspace := filepath.Join(root, "workspace")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{workspace, outside} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := NewLocalBackend(&LocalBackendConfig{BaseDir: workspace, ShellPolicy: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, workspace, outside
+}
+
+func TestWriteRejectsPathsOutsideWorkspace(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(t *testing.T, workspace, outside string)
+		path   string
+		target string // file outside the workspace that must not be created
+	}{
+		{
+			name: "dangling link to a missing file outside",
+			setup: func(t *testing.T, workspace, outside string) {
+				mustSymlink(t, filepath.Join(outside, "created.txt"), filepath.Join(workspace, "link.txt"))
+			},
+			path:   "link.txt",
+			target: "created.txt",
+		},
+		{
+			name: "relative dangling link",
+			setup: func(t *testing.T, workspace, outside string) {
+				mustSymlink(t, "../outside/created.txt", filepath.Join(workspace, "link.txt"))
+			},
+			path:   "link.txt",
+			target: "created.txt",
+		},
+		{
+			name: "dangling link to a missing directory outside",
+			setup: func(t *testing.T, workspace, outside string) {
+				mustSymlink(t, filepath.Join(outside, "dir"), filepath.Join(workspace, "dir"))
+			},
+			path:   "dir/created.txt",
+			target: "dir/created.txt",
+		},
+		{
+			name: "link to a directory outside",
+			setup: func(t *testing.T, workspace, outside string) {
+				mustSymlink(t, outside, filepath.Join(workspace, "out"))
+			},
+			path:   "out/created.txt",
+			target: "created.txt",
+		},
+		{
+			name:   "dot-dot path",
+			setup:  func(t *testing.T, workspace, outside string) {},
+			path:   "../outside/created.txt",
+			target: "created.txt",
+		},
+		{
+			name:   "dot-dot inside a subdirectory",
+			setup:  func(t *testing.T, workspace, outside string) {},
+			path:   "sub/../../outside/created.txt",
+			target: "created.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, workspace, outside := newTestBackend(t, nil)
+			tt.setup(t, workspace, outside)
+
+			err := b.Write(context.Background(), &filesystem.WriteRequest{FilePath: tt.path, Content: "x"})
+			if err == nil || !strings.Contains(err.Error(), "outside the workspace") {
+				t.Fatalf("Write(%s) error = %v, want outside the workspace", tt.path, err)
+			}
+			if _, err := os.Lstat(filepath.Join(outside, tt.target)); !os.IsNotExist(err) {
+				t.Fatalf("%s was created outside the workspace", tt.target)
+			}
+			if _, err := b.Read(context.Background(), &filesystem.ReadRequest{FilePath: tt.path}); err == nil {
+				t.Fatalf("Read(%s) succeeded outside the workspace", tt.path)
+			}
+		})
+	}
+}
+
+func TestWriteFollowsLinksInsideWorkspace(t *testing.T) {
+	b, workspace, _ := newTestBackend(t, nil)
+	mustSymlink(t, "new.txt", filepath.Join(workspace, "link.txt"))
+
+	if err := b.Write(context.Background(), &filesystem.WriteRequest{FilePath: "link.txt", Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(workspace, "new.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("new.txt = %q, %v", data, err)
+	}
+}
+
+func TestRealPathLinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	mustSymlink(t, "b", filepath.Join(dir, "a"))
+	mustSymlink(t, "a", filepath.Join(dir, "b"))
+	if _, err := realPath(filepath.Join(dir, "a")); err == nil {
+		t.Fatal("expected an error for a symlink loop")
+	}
+}
+
+func TestAllowlistRedirections(t *testing.T) {
+	policy := &ShellPolicy{AllowlistMode: true, AllowedCommands: []string{"echo", "cat", "go"}}
+	b, _, outside := newTestBackend(t, policy)
+
+	tests := []struct {
+		command string
+		wantErr string
+	}{
+		{"echo hi > out.txt", ""},
+		{"echo hi >> logs/out.txt", ""},
+		{"cat < in.txt", ""},
+		{"go test ./... 2>&1 | cat", ""},
+		{"go build 2> /dev/null", ""},
+		{"cat <<EOF", ""},
+		{"echo hi > " + filepath.Join(outside, "x"), "outside the workspace"},
+		{"echo hi>>../outside/x", "outside the workspace"},
+		{"echo hi &> ../x", "outside the workspace"},
+		{"cat < /etc/passwd", "outside the workspace"},
+		{`echo hi > "../x"`, "outside the workspace"},
+		{"echo hi > ~/x", "cannot be checked"},
+		{"echo hi > $HOME/x", "cannot be checked"},
+		{"echo hi >", "without a target"},
+		{"go test 2>&1 && rm -rf x", `command "rm" is not in the allowed commands list`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			err := b.validateCommand(tt.command)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func mustSymlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package filesystem
+
+import "syscall"
+
+// openNoFollow makes os.OpenFile fail instead of following a symlink at the last path element.
+const openNoFollow = syscall.O_NOFOLLOW
@@ -0,0 +1,7 @@
+//go:build windows
+
+package filesystem
+
+// openNoFollow is zero on Windows, which has no O_NOFOLLOW; realPath has already
+// resolved the symlinks of the path being opened.
+const openNoFollow = 0
@@ -10,6 +10,12 @@ import (
 	"github.com/cloudwego/eino/schema"
 )
 
+// 元数据键
+const (
+	// MetaKeyRowStart 流式解析时文档第一行的行号（从 0 开始）
+	MetaKeyRowStart = "_row_start"
+)
+
 // Config CSV 解析器配置
 type Config struct {
 	// Comma 字段分隔符，默认为 ','
@@ -20,6 +26,8 @@ type Config struct {
 	RowSeparator string
 	// LazyQuotes 是否允许非标准引号
 	LazyQuotes bool
+	// BlockSize 流式解析时每个文档的大致字节数，默认为 64KB
+	BlockSize int
 }
 
 // Parser CSV 文件解析器
@@ -28,6 +36,7 @@ type Parser struct {
 	columnSeparator string
 	rowSeparator    string
 	lazyQuotes      bool
+	blockSize       int
 }
 
 // NewParser 创建新的 CSV 解析器
@@ -36,6 +45,7 @@ func NewParser(ctx context.Context, config *Config) (*Parser, error) {
 	colSep := "\t"
 	rowSep := "\n"
 	lazyQuotes := true
+	blockSize := 64 * 1024
 
 	if config != nil {
 		if config.Comma != 0 {
@@ -48,6 +58,9 @@ func NewParser(ctx context.Context, config *Config) (*Parser, error) {
 			rowSep = config.RowSeparator
 		}
 		lazyQuotes = config.LazyQuotes
+		if config.BlockSize > 0 {
+			blockSize = config.BlockSize
+		}
 	}
 
 	return &Parser{
@@ -55,6 +68,7 @@ func NewParser(ctx context.Context, config *Config) (*Parser, error) {
 		columnSeparator: colSep,
 		rowSeparator:    rowSep,
 		lazyQuotes:      lazyQuotes,
+		blockSize:       blockSize,
 	}, nil
 }
 
@@ -104,3 +118,68 @@ func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Opt
 		},
 	}, nil
 }
+
+// ParseStream 逐行读取 CSV，每累积约 BlockSize 字节输出一个文档，不需要把整个文件载入内存
+func (p *Parser) ParseStream(ctx context.Context, reader io.Reader, emit func(*schema.Document) error, opts ...parser.Option) error {
+	commonOpts := parser.GetCommonOptions(&parser.Options{}, opts...)
+
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = p.comma
+	csvReader.LazyQuotes = p.lazyQuotes
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
+
+	var (
+		content  strings.Builder
+		rowStart int
+		rows     int
+		columns  int
+	)
+	flush := func() error {
+		if rows == 0 {
+			return nil
+		}
+		metadata := make(map[string]any)
+		if commonOpts.URI != "" {
+			metadata["_source"] = commonOpts.URI
+		}
+		metadata[MetaKeyRowStart] = rowStart
+		metadata["_row_count"] = rows
+		metadata["_column_count"] = columns
+		for k, v := range commonOpts.ExtraMeta {
+			metadata[k] = v
+		}
+		doc := &schema.Document{Content: content.String(), MetaData: metadata}
+		rowStart += rows
+		rows = 0
+		content.Reset()
+		return emit(doc)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if rows > 0 {
+			content.WriteString(p.rowSeparator)
+		}
+		if rowStart == 0 && rows == 0 {
+			columns = len(record)
+		}
+		content.WriteString(strings.Join(record, p.columnSeparator))
+		rows++
+		if content.Len() >= p.blockSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
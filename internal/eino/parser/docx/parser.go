@@ -1,14 +1,17 @@
 package docx
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/xml"
+	"fmt"
 	"io"
-	"os"
+	"strconv"
 	"strings"
 
 	"github.com/cloudwego/eino/components/document/parser"
 	"github.com/cloudwego/eino/schema"
-	"github.com/nguyenthenguyen/docx"
 )
 
 // Config Docx 解析器配置
@@ -18,6 +21,7 @@ type Config struct {
 }
 
 // Parser Microsoft Word (.docx) 文件解析器
+// 标题样式（Heading 1-6 / Title / 大纲级别）会转换为 Markdown 标题，便于按结构分割
 type Parser struct {
 	paragraphSeparator string
 }
@@ -38,32 +42,31 @@ func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Opt
 	// 获取通用选项
 	commonOpts := parser.GetCommonOptions(&parser.Options{}, opts...)
 
-	// 将内容读取到临时文件（docx 库需要文件路径）
-	tmpFile, err := os.CreateTemp("", "docx-*.docx")
+	data, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, err
 	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
 
-	if _, err := io.Copy(tmpFile, reader); err != nil {
-		return nil, err
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("打开 docx 失败: %w", err)
 	}
-	tmpFile.Close()
 
-	// 打开 docx 文件
-	r, err := docx.ReadDocxFile(tmpFile.Name())
+	docXML, err := readZipFile(zr, "word/document.xml")
 	if err != nil {
 		return nil, err
 	}
-	defer r.Close()
 
-	// 提取文本内容
-	docx1 := r.Editable()
-	content := docx1.GetContent()
+	// 样式表可选：用于识别标题样式
+	headingStyles := map[string]int{}
+	if stylesXML, err := readZipFile(zr, "word/styles.xml"); err == nil {
+		headingStyles = parseHeadingStyles(stylesXML)
+	}
 
-	// 清理内容 - 从 XML 中提取纯文本
-	content = extractPlainText(content)
+	content, err := p.extractContent(docXML, headingStyles)
+	if err != nil {
+		return nil, err
+	}
 
 	// 构建元数据
 	metadata := make(map[string]any)
@@ -82,46 +85,179 @@ func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Opt
 	}, nil
 }
 
-// extractPlainText 从 docx XML 内容中提取纯文本
-func extractPlainText(xmlContent string) string {
-	// 简单提取：移除 XML 标签并规范化空白字符
-	var result strings.Builder
-	inTag := false
-	lastWasSpace := false
+// readZipFile 读取 zip 包中的指定文件
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("docx 中缺少 %s", name)
+}
 
-	for _, r := range xmlContent {
-		if r == '<' {
-			inTag = true
+// parseHeadingStyles 解析 styles.xml，返回 styleId -> 标题层级（1-6）
+// 识别规则：样式名为 "heading N" / "Title"，或样式定义了大纲级别（outlineLvl）
+func parseHeadingStyles(data []byte) map[string]int {
+	type outlineLvl struct {
+		Val string `xml:"val,attr"`
+	}
+	type style struct {
+		Type    string `xml:"type,attr"`
+		StyleID string `xml:"styleId,attr"`
+		Name    struct {
+			Val string `xml:"val,attr"`
+		} `xml:"name"`
+		PPr struct {
+			OutlineLvl *outlineLvl `xml:"outlineLvl"`
+		} `xml:"pPr"`
+	}
+	var styles struct {
+		Styles []style `xml:"style"`
+	}
+
+	out := map[string]int{}
+	if err := xml.Unmarshal(data, &styles); err != nil {
+		return out
+	}
+	for _, st := range styles.Styles {
+		if st.Type != "" && st.Type != "paragraph" {
 			continue
 		}
-		if r == '>' {
-			inTag = false
-			// 在某些标签后添加空格
-			if !lastWasSpace {
-				result.WriteRune(' ')
-				lastWasSpace = true
-			}
+		if level := headingLevelFromName(st.Name.Val); level > 0 {
+			out[st.StyleID] = level
 			continue
 		}
-		if !inTag {
-			if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
-				if !lastWasSpace {
-					result.WriteRune(' ')
-					lastWasSpace = true
-				}
-			} else {
-				result.WriteRune(r)
-				lastWasSpace = false
+		if st.PPr.OutlineLvl != nil {
+			if lvl, err := strconv.Atoi(st.PPr.OutlineLvl.Val); err == nil && lvl >= 0 && lvl < 6 {
+				out[st.StyleID] = lvl + 1
 			}
 		}
 	}
+	return out
+}
+
+// headingLevelFromName 根据样式名/样式 ID 推断标题层级，无法识别时返回 0
+func headingLevelFromName(name string) int {
+	n := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", ""))
+	if n == "title" {
+		return 1
+	}
+	if strings.HasPrefix(n, "heading") {
+		if lvl, err := strconv.Atoi(strings.TrimPrefix(n, "heading")); err == nil && lvl >= 1 && lvl <= 6 {
+			return lvl
+		}
+	}
+	return 0
+}
+
+// extractContent 从 document.xml 中提取文本，标题段落转换为 Markdown 标题
+func (p *Parser) extractContent(data []byte, headingStyles map[string]int) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	var (
+		paragraphs []string
+		text       strings.Builder
+		level      int
+		inText     bool
+		cells      []string
+		inCell     int
+	)
 
-	// 清理多余的空白
-	text := strings.TrimSpace(result.String())
-	// 将多个空格替换为单个空格
-	for strings.Contains(text, "  ") {
-		text = strings.ReplaceAll(text, "  ", " ")
+	finishParagraph := func() {
+		line := strings.TrimSpace(text.String())
+		text.Reset()
+		lvl := level
+		level = 0
+		if line == "" {
+			return
+		}
+		if inCell > 0 {
+			cells = append(cells, line)
+			return
+		}
+		if lvl > 0 {
+			line = strings.Repeat("#", lvl) + " " + strings.Join(strings.Fields(line), " ")
+		}
+		paragraphs = append(paragraphs, line)
 	}
 
-	return text
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("解析 document.xml 失败: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				text.Reset()
+				level = 0
+			case "pStyle":
+				if lvl, ok := headingStyles[attrValue(t, "val")]; ok {
+					level = lvl
+				} else if lvl := headingLevelFromName(attrValue(t, "val")); lvl > 0 {
+					level = lvl
+				}
+			case "outlineLvl":
+				if level == 0 {
+					if lvl, err := strconv.Atoi(attrValue(t, "val")); err == nil && lvl >= 0 && lvl < 6 {
+						level = lvl + 1
+					}
+				}
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			case "tc":
+				inCell++
+			case "tr":
+				cells = cells[:0]
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				finishParagraph()
+			case "tc":
+				if inCell > 0 {
+					inCell--
+				}
+			case "tr":
+				// 表格行：单元格用 " | " 连接为一行
+				if len(cells) > 0 {
+					paragraphs = append(paragraphs, strings.Join(cells, " | "))
+				}
+				cells = cells[:0]
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+
+	return strings.Join(paragraphs, p.paragraphSeparator), nil
+}
+
+// attrValue 读取元素属性（忽略命名空间前缀）
+func attrValue(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
 }
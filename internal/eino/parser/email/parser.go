@@ -0,0 +1,423 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudwego/eino/components/document/parser"
+	"github.com/cloudwego/eino/schema"
+	"golang.org/x/text/encoding/htmlindex"
+
+	htmlparser "chatclaw/internal/eino/parser/html"
+)
+
+// 元数据键
+const (
+	MetaKeyMessage    = "message"
+	MetaKeySubject    = "subject"
+	MetaKeyFrom       = "from"
+	MetaKeyDate       = "date"
+	MetaKeyAttachment = "attachment"
+)
+
+// maxNestingDepth 嵌套邮件（message/rfc822）和 multipart 的最大递归深度
+const maxNestingDepth = 5
+
+// Config 邮件解析器配置
+type Config struct {
+	// ParseAttachment 解析附件的回调（通常是按扩展名选择解析器的 ExtParser），为空时忽略附件
+	ParseAttachment func(ctx context.Context, name string, r io.Reader) ([]*schema.Document, error)
+}
+
+// Parser 邮件解析器（.eml 单封邮件 / .mbox 邮箱归档）
+// 每封邮件输出一个文档（邮件头 + 正文），附件按各自格式解析后作为独立文档输出
+type Parser struct {
+	html            *htmlparser.Parser
+	parseAttachment func(ctx context.Context, name string, r io.Reader) ([]*schema.Document, error)
+}
+
+// NewParser 创建新的邮件解析器
+func NewParser(ctx context.Context, config *Config) (*Parser, error) {
+	h, err := htmlparser.NewParser(ctx, &htmlparser.Config{})
+	if err != nil {
+		return nil, err
+	}
+	p := &Parser{html: h}
+	if config != nil {
+		p.parseAttachment = config.ParseAttachment
+	}
+	return p, nil
+}
+
+// Parse 解析邮件并返回文档列表
+func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Option) ([]*schema.Document, error) {
+	commonOpts := parser.GetCommonOptions(&parser.Options{}, opts...)
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := splitMbox(data)
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("没有找到邮件内容")
+	}
+
+	var docs []*schema.Document
+	for i, raw := range messages {
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			if len(messages) == 1 {
+				return nil, fmt.Errorf("解析邮件失败: %w", err)
+			}
+			log.Printf("[Email] skip message %d: %v", i+1, err)
+			continue
+		}
+
+		baseMeta := make(map[string]any)
+		if commonOpts.URI != "" {
+			baseMeta["_source"] = commonOpts.URI
+		}
+		if len(messages) > 1 {
+			baseMeta[MetaKeyMessage] = i + 1
+		}
+		if subject := decodeHeader(msg.Header.Get("Subject")); subject != "" {
+			baseMeta[MetaKeySubject] = subject
+		}
+		if from := decodeHeader(msg.Header.Get("From")); from != "" {
+			baseMeta[MetaKeyFrom] = from
+		}
+		if date := msg.Header.Get("Date"); date != "" {
+			baseMeta[MetaKeyDate] = date
+		}
+		for k, v := range commonOpts.ExtraMeta {
+			baseMeta[k] = v
+		}
+
+		e := &extraction{}
+		p.readMessage(ctx, msg, e, 0)
+
+		messageDoc := &schema.Document{
+			Content:  strings.TrimSpace(e.body.String()),
+			MetaData: copyMeta(baseMeta),
+		}
+		if messageDoc.Content != "" {
+			docs = append(docs, messageDoc)
+		}
+
+		for _, att := range e.attachments {
+			meta := copyMeta(baseMeta)
+			for k, v := range att.MetaData {
+				if _, exists := meta[k]; !exists {
+					meta[k] = v
+				}
+			}
+			att.MetaData = meta
+			docs = append(docs, att)
+		}
+	}
+
+	return docs, nil
+}
+
+// extraction 单封邮件的解析结果
+type extraction struct {
+	body        strings.Builder
+	attachments []*schema.Document
+}
+
+// readMessage 输出邮件头并解析邮件体
+func (p *Parser) readMessage(ctx context.Context, msg *mail.Message, e *extraction, depth int) {
+	for _, key := range []string{"From", "To", "Cc", "Date", "Subject"} {
+		if v := decodeHeader(msg.Header.Get(key)); v != "" {
+			fmt.Fprintf(&e.body, "%s: %s\n", key, v)
+		}
+	}
+	e.body.WriteString("\n")
+
+	p.readPart(ctx, msg.Header, msg.Body, e, depth)
+}
+
+// partHeader MIME 头部的最小接口（mail.Header 和 multipart.Part.Header 都满足）
+type partHeader interface {
+	Get(key string) string
+}
+
+// readPart 递归解析 MIME 部分
+func (p *Parser) readPart(ctx context.Context, header partHeader, body io.Reader, e *extraction, depth int) {
+	if depth > maxNestingDepth {
+		return
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType == "" {
+		mediaType = "text/plain"
+		params = map[string]string{}
+	}
+	mediaType = strings.ToLower(mediaType)
+
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := decodeHeader(dispParams["filename"])
+	if filename == "" {
+		filename = decodeHeader(params["name"])
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		boundary := params["boundary"]
+		if boundary == "" {
+			return
+		}
+		mr := multipart.NewReader(body, boundary)
+
+		// multipart/alternative：优先纯文本，其次 HTML
+		if mediaType == "multipart/alternative" {
+			p.readAlternative(ctx, mr, e, depth)
+			return
+		}
+		for {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				break
+			}
+			p.readPart(ctx, part.Header, part, e, depth+1)
+		}
+		return
+
+	case mediaType == "message/rfc822":
+		msg, err := mail.ReadMessage(decodeTransfer(header, body))
+		if err != nil {
+			return
+		}
+		e.body.WriteString("\n---------- 附带邮件 ----------\n")
+		p.readMessage(ctx, msg, e, depth+1)
+		return
+	}
+
+	isAttachment := strings.EqualFold(disposition, "attachment") || filename != ""
+	if isAttachment {
+		p.readAttachment(ctx, filename, mediaType, decodeTransfer(header, body), e)
+		return
+	}
+
+	switch mediaType {
+	case "text/plain":
+		e.body.WriteString(decodeText(header, body, params["charset"]))
+		e.body.WriteString("\n")
+	case "text/html":
+		e.body.WriteString(p.htmlText(ctx, decodeText(header, body, params["charset"])))
+		e.body.WriteString("\n")
+	}
+}
+
+// readAlternative 从 multipart/alternative 中选择一个最合适的版本
+func (p *Parser) readAlternative(ctx context.Context, mr *multipart.Reader, e *extraction, depth int) {
+	var plain, html string
+	for {
+		part, err := mr.NextRawPart()
+		if err != nil {
+			break
+		}
+		mediaType, params, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch strings.ToLower(mediaType) {
+		case "text/plain":
+			if plain == "" {
+				plain = decodeText(part.Header, part, params["charset"])
+			}
+		case "text/html":
+			if html == "" {
+				html = decodeText(part.Header, part, params["charset"])
+			}
+		default:
+			if strings.HasPrefix(strings.ToLower(mediaType), "multipart/") && plain == "" && html == "" {
+				p.readPart(ctx, part.Header, part, e, depth+1)
+				return
+			}
+		}
+	}
+
+	if strings.TrimSpace(plain) != "" {
+		e.body.WriteString(plain)
+		e.body.WriteString("\n")
+		return
+	}
+	if html != "" {
+		e.body.WriteString(p.htmlText(ctx, html))
+		e.body.WriteString("\n")
+	}
+}
+
+// readAttachment 解析附件（通过回调按扩展名选择解析器），失败时只记录日志
+func (p *Parser) readAttachment(ctx context.Context, filename, mediaType string, r io.Reader, e *extraction) {
+	if p.parseAttachment == nil {
+		return
+	}
+	if filename == "" {
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			filename = "attachment" + exts[0]
+		} else {
+			return
+		}
+	}
+	filename = filepath.Base(filename)
+
+	attDocs, err := p.parseAttachment(ctx, filename, r)
+	if err != nil {
+		log.Printf("[Email] skip attachment %s: %v", filename, err)
+		return
+	}
+	for _, d := range attDocs {
+		if d == nil || strings.TrimSpace(d.Content) == "" {
+			continue
+		}
+		if d.MetaData == nil {
+			d.MetaData = make(map[string]any)
+		}
+		d.MetaData[MetaKeyAttachment] = filename
+		e.attachments = append(e.attachments, d)
+	}
+}
+
+// htmlText 把 HTML 正文转换为纯文本
+func (p *Parser) htmlText(ctx context.Context, s string) string {
+	docs, err := p.html.Parse(ctx, strings.NewReader(s))
+	if err != nil || len(docs) == 0 {
+		return ""
+	}
+	return docs[0].Content
+}
+
+// decodeTransfer 按 Content-Transfer-Encoding 解码
+func decodeTransfer(header partHeader, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// decodeText 解码传输编码并按 charset 转换为 UTF-8
+func decodeText(header partHeader, body io.Reader, charset string) string {
+	data, err := io.ReadAll(decodeTransfer(header, body))
+	if err != nil && len(data) == 0 {
+		return ""
+	}
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+		return string(data)
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return string(data)
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+// wordDecoder 解码 RFC 2047 编码的邮件头（支持 GBK 等非 UTF-8 字符集）
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, err
+		}
+		return enc.NewDecoder().Reader(input), nil
+	},
+}
+
+// decodeHeader 解码邮件头，失败时返回原值
+func decodeHeader(v string) string {
+	if v == "" {
+		return ""
+	}
+	decoded, err := wordDecoder.DecodeHeader(v)
+	if err != nil {
+		return strings.TrimSpace(v)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// newlineStripper 去掉 base64 内容中的换行，避免解码失败
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		count, err := n.r.Read(p)
+		out := p[:0]
+		for _, b := range p[:count] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				out = append(out, b)
+			}
+		}
+		if len(out) > 0 || err != nil {
+			return len(out), err
+		}
+	}
+}
+
+// splitMbox 拆分 mbox 文件（以 "From " 开头的行分隔邮件）；普通 eml 文件返回单个元素
+func splitMbox(data []byte) [][]byte {
+	if !bytes.HasPrefix(data, []byte("From ")) {
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil
+		}
+		return [][]byte{data}
+	}
+
+	var (
+		messages [][]byte
+		cur      bytes.Buffer
+	)
+	flush := func() {
+		if len(bytes.TrimSpace(cur.Bytes())) > 0 {
+			messages = append(messages, append([]byte(nil), cur.Bytes()...))
+		}
+		cur.Reset()
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if bytes.HasPrefix(line, []byte("From ")) {
+			flush()
+			continue
+		}
+		// mboxrd 转义：">From " -> "From "
+		if bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) && line[0] == '>' {
+			line = line[1:]
+		}
+		cur.Write(line)
+		cur.WriteByte('\n')
+	}
+	flush()
+
+	return messages
+}
+
+// copyMeta 浅拷贝元数据
+func copyMeta(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m)+2)
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
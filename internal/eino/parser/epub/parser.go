@@ -0,0 +1,203 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/cloudwego/eino/components/document/parser"
+	"github.com/cloudwego/eino/schema"
+
+	htmlparser "chatclaw/internal/eino/parser/html"
+)
+
+// 元数据键
+const (
+	MetaKeyChapter       = "chapter"
+	MetaKeyChapterTitle  = "chapter_title"
+	MetaKeyBookTitle     = "book_title"
+	MetaKeyTotalChapters = "total_chapters"
+)
+
+// Config Epub 解析器配置
+type Config struct{}
+
+// Parser EPUB 电子书解析器
+// 按 spine 顺序读取章节（XHTML），每个章节输出一个文档
+type Parser struct {
+	html *htmlparser.Parser
+}
+
+// NewParser 创建新的 Epub 解析器
+func NewParser(ctx context.Context, config *Config) (*Parser, error) {
+	h, err := htmlparser.NewParser(ctx, &htmlparser.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return &Parser{html: h}, nil
+}
+
+// container META-INF/container.xml
+type container struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// opfPackage OPF 包文件
+type opfPackage struct {
+	Title    []string `xml:"metadata>title"`
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef  string `xml:"idref,attr"`
+		Linear string `xml:"linear,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// Parse 解析 epub 文件并返回文档列表（每个章节一个文档）
+func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Option) ([]*schema.Document, error) {
+	commonOpts := parser.GetCommonOptions(&parser.Options{}, opts...)
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("打开 epub 失败: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	containerXML, err := readFile(files, "META-INF/container.xml")
+	if err != nil {
+		return nil, err
+	}
+	var c container
+	if err := xml.Unmarshal(containerXML, &c); err != nil {
+		return nil, fmt.Errorf("解析 container.xml 失败: %w", err)
+	}
+	if len(c.Rootfiles) == 0 || c.Rootfiles[0].FullPath == "" {
+		return nil, fmt.Errorf("epub 中缺少 OPF 文件")
+	}
+
+	opfPath := c.Rootfiles[0].FullPath
+	opfXML, err := readFile(files, opfPath)
+	if err != nil {
+		return nil, err
+	}
+	var pkg opfPackage
+	if err := xml.Unmarshal(opfXML, &pkg); err != nil {
+		return nil, fmt.Errorf("解析 OPF 失败: %w", err)
+	}
+
+	// manifest id -> zip 内路径
+	baseDir := path.Dir(opfPath)
+	items := make(map[string]string, len(pkg.Manifest))
+	for _, it := range pkg.Manifest {
+		if !isHTMLMediaType(it.MediaType) {
+			continue
+		}
+		href := it.Href
+		if u, err := url.PathUnescape(href); err == nil {
+			href = u
+		}
+		items[it.ID] = path.Clean(path.Join(baseDir, href))
+	}
+
+	var chapters []string
+	for _, ref := range pkg.Spine {
+		if strings.EqualFold(ref.Linear, "no") {
+			continue
+		}
+		if chapterPath, ok := items[ref.IDRef]; ok {
+			chapters = append(chapters, chapterPath)
+		}
+	}
+	if len(chapters) == 0 {
+		return nil, fmt.Errorf("epub 中没有章节")
+	}
+
+	bookTitle := ""
+	if len(pkg.Title) > 0 {
+		bookTitle = strings.TrimSpace(pkg.Title[0])
+	}
+
+	docs := make([]*schema.Document, 0, len(chapters))
+	for i, chapterPath := range chapters {
+		chapterData, err := readFile(files, chapterPath)
+		if err != nil {
+			// 个别章节缺失时跳过
+			continue
+		}
+		parsed, err := p.html.Parse(ctx, bytes.NewReader(chapterData))
+		if err != nil {
+			return nil, fmt.Errorf("解析章节 %s 失败: %w", chapterPath, err)
+		}
+
+		for _, d := range parsed {
+			if strings.TrimSpace(d.Content) == "" {
+				continue
+			}
+
+			metadata := make(map[string]any)
+			if commonOpts.URI != "" {
+				metadata["_source"] = commonOpts.URI
+			}
+			metadata[MetaKeyChapter] = i + 1
+			metadata[MetaKeyTotalChapters] = len(chapters)
+			if title, _ := d.MetaData[htmlparser.MetaKeyTitle].(string); title != "" {
+				metadata[MetaKeyChapterTitle] = title
+			}
+			if bookTitle != "" {
+				metadata[MetaKeyBookTitle] = bookTitle
+			}
+			for k, v := range commonOpts.ExtraMeta {
+				metadata[k] = v
+			}
+
+			docs = append(docs, &schema.Document{
+				Content:  d.Content,
+				MetaData: metadata,
+			})
+		}
+	}
+
+	return docs, nil
+}
+
+// isHTMLMediaType 判断 manifest 条目是否为章节内容
+func isHTMLMediaType(mediaType string) bool {
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case "application/xhtml+xml", "text/html", "application/x-dtbook+xml":
+		return true
+	}
+	return false
+}
+
+// readFile 读取 zip 包中的文件
+func readFile(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("epub 中缺少 %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
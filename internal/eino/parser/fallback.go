@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/cloudwego/eino/components/document/parser"
+	"github.com/cloudwego/eino/schema"
+)
+
+// binarySniffLen 判断是否为二进制文件时检查的字节数
+const binarySniffLen = 8 * 1024
+
+// textFallbackParser 未注册扩展名的兜底解析器：按纯文本解析，
+// 但拒绝二进制文件（避免把乱码写入索引）
+type textFallbackParser struct {
+	text parser.Parser
+}
+
+// Parse 实现 parser.Parser 接口
+func (p *textFallbackParser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Option) ([]*schema.Document, error) {
+	br := bufio.NewReaderSize(reader, binarySniffLen)
+	head, _ := br.Peek(binarySniffLen)
+	if looksBinary(head) {
+		return nil, fmt.Errorf("不支持的文件格式：无法识别为文本文件")
+	}
+	return p.text.Parse(ctx, br, opts...)
+}
+
+// looksBinary 判断数据是否为二进制：包含 NUL 字节，或控制字符比例过高
+// （不按 UTF-8 校验，GBK 等本地编码的文本文件不会被误判）
+func looksBinary(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+
+	control := 0
+	for _, b := range data {
+		switch {
+		case b == 0:
+			return true
+		case b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' && b != '\v' && b != 0x1b:
+			control++
+		}
+	}
+	return control*10 > len(data)
+}
@@ -0,0 +1,255 @@
+package html
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/cloudwego/eino/components/document/parser"
+	"github.com/cloudwego/eino/schema"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 元数据键（与 eino-ext html 解析器保持一致）
+const (
+	MetaKeyTitle   = "_title"
+	MetaKeyDesc    = "_description"
+	MetaKeyLang    = "_language"
+	MetaKeyCharset = "_charset"
+	MetaKeySource  = "_source"
+)
+
+// Config HTML 解析器配置
+type Config struct{}
+
+// Parser HTML 文件解析器
+// 将 <h1>-<h6> 转换为 Markdown 标题、块级元素转换为段落，便于按结构分割
+type Parser struct{}
+
+// NewParser 创建新的 HTML 解析器
+func NewParser(ctx context.Context, config *Config) (*Parser, error) {
+	return &Parser{}, nil
+}
+
+// Parse 解析 HTML 并返回文档列表
+func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Option) ([]*schema.Document, error) {
+	commonOpts := parser.GetCommonOptions(&parser.Options{}, opts...)
+
+	root, err := html.Parse(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := extractMeta(root)
+	if commonOpts.URI != "" {
+		metadata[MetaKeySource] = commonOpts.URI
+	}
+	for k, v := range commonOpts.ExtraMeta {
+		metadata[k] = v
+	}
+
+	body := findElement(root, atom.Body)
+	if body == nil {
+		body = root
+	}
+
+	w := &blockWriter{}
+	w.walk(body)
+	w.flush()
+
+	return []*schema.Document{
+		{
+			Content:  strings.Join(w.blocks, "\n\n"),
+			MetaData: metadata,
+		},
+	}, nil
+}
+
+// skipTags 不输出内容的元素
+var skipTags = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Head:     true,
+	atom.Svg:      true,
+	atom.Iframe:   true,
+}
+
+// blockTags 块级元素：前后断开段落
+var blockTags = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Header: true, atom.Footer: true, atom.Main: true, atom.Aside: true,
+	atom.Nav: true, atom.Blockquote: true, atom.Pre: true, atom.Ul: true,
+	atom.Ol: true, atom.Li: true, atom.Table: true, atom.Tr: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Figure: true,
+	atom.Figcaption: true, atom.Form: true, atom.Hr: true,
+}
+
+// headingLevels h 标签对应的标题层级
+var headingLevels = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+// blockWriter 把 DOM 树输出为段落列表
+type blockWriter struct {
+	blocks []string
+	cur    strings.Builder
+	pre    int // 处于 <pre> 中时保留原始空白
+	cells  []string
+}
+
+func (w *blockWriter) flush() {
+	text := w.cur.String()
+	w.cur.Reset()
+	if w.pre == 0 {
+		text = strings.Join(strings.Fields(text), " ")
+	}
+	text = strings.TrimSpace(text)
+	if text != "" {
+		w.blocks = append(w.blocks, text)
+	}
+}
+
+func (w *blockWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.cur.WriteString(n.Data)
+		return
+	case html.ElementNode:
+		if skipTags[n.DataAtom] {
+			return
+		}
+
+		if level, ok := headingLevels[n.DataAtom]; ok {
+			w.flush()
+			title := strings.Join(strings.Fields(textContent(n)), " ")
+			if title != "" {
+				w.blocks = append(w.blocks, strings.Repeat("#", level)+" "+title)
+			}
+			return
+		}
+
+		switch n.DataAtom {
+		case atom.Br:
+			w.cur.WriteString("\n")
+			return
+		case atom.Tr:
+			// 表格行：单元格用 " | " 连接为一行
+			w.flush()
+			var cells []string
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode && (c.DataAtom == atom.Td || c.DataAtom == atom.Th) {
+					cells = append(cells, strings.Join(strings.Fields(textContent(c)), " "))
+				}
+			}
+			if line := strings.Trim(strings.Join(cells, " | "), " |"); line != "" {
+				w.blocks = append(w.blocks, line)
+			}
+			return
+		case atom.Li:
+			w.flush()
+			w.cur.WriteString("- ")
+		case atom.Pre:
+			w.flush()
+			w.pre++
+			defer func() { w.flush(); w.pre-- }()
+		}
+
+		block := blockTags[n.DataAtom]
+		if block && n.DataAtom != atom.Li {
+			w.flush()
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			w.walk(c)
+		}
+		if block {
+			w.flush()
+		}
+		return
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+}
+
+// textContent 返回节点下所有文本（跳过脚本/样式）
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && skipTags[n.DataAtom] {
+			return
+		}
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// findElement 查找第一个指定类型的元素
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// extractMeta 提取 title/description/language/charset
+func extractMeta(root *html.Node) map[string]any {
+	meta := map[string]any{}
+
+	if el := findElement(root, atom.Html); el != nil {
+		if lang := attr(el, "lang"); lang != "" {
+			meta[MetaKeyLang] = lang
+		}
+	}
+	if el := findElement(root, atom.Title); el != nil {
+		if title := strings.TrimSpace(textContent(el)); title != "" {
+			meta[MetaKeyTitle] = title
+		}
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Meta {
+			if c := attr(n, "charset"); c != "" {
+				meta[MetaKeyCharset] = c
+			}
+			if strings.EqualFold(attr(n, "name"), "description") {
+				if d := attr(n, "content"); d != "" {
+					meta[MetaKeyDesc] = d
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	return meta
+}
+
+// attr 读取元素属性
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,369 @@
+package odf
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/eino/components/document/parser"
+	"github.com/cloudwego/eino/schema"
+)
+
+// MetaKeySheet 表格文档（.ods）的工作表名称
+const MetaKeySheet = "sheet"
+
+// maxRepeated 单元格/行重复次数上限（ods 常用超大重复数填充空白区域）
+const maxRepeated = 256
+
+const (
+	mimeText        = "application/vnd.oasis.opendocument.text"
+	mimeSpreadsheet = "application/vnd.oasis.opendocument.spreadsheet"
+)
+
+// Config ODF 解析器配置
+type Config struct {
+	// ToSheets 表格文档是否每个工作表输出一个文档，默认合并为一个文档
+	ToSheets bool
+}
+
+// Parser OpenDocument 文件解析器（.odt 文本文档 / .ods 电子表格）
+// 文本文档的标题会转换为 Markdown 标题，便于按结构分割
+type Parser struct {
+	toSheets bool
+}
+
+// NewParser 创建新的 ODF 解析器
+func NewParser(ctx context.Context, config *Config) (*Parser, error) {
+	p := &Parser{}
+	if config != nil {
+		p.toSheets = config.ToSheets
+	}
+	return p, nil
+}
+
+// Parse 解析 odt/ods 文件并返回文档列表
+func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Option) ([]*schema.Document, error) {
+	commonOpts := parser.GetCommonOptions(&parser.Options{}, opts...)
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("打开 OpenDocument 文件失败: %w", err)
+	}
+
+	contentXML, err := readZipFile(zr, "content.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	newMeta := func() map[string]any {
+		metadata := make(map[string]any)
+		if commonOpts.URI != "" {
+			metadata["_source"] = commonOpts.URI
+		}
+		for k, v := range commonOpts.ExtraMeta {
+			metadata[k] = v
+		}
+		return metadata
+	}
+
+	mimetype := ""
+	if m, err := readZipFile(zr, "mimetype"); err == nil {
+		mimetype = strings.TrimSpace(string(m))
+	}
+
+	switch mimetype {
+	case mimeSpreadsheet:
+		sheets, err := extractSheets(contentXML)
+		if err != nil {
+			return nil, err
+		}
+		if p.toSheets {
+			docs := make([]*schema.Document, 0, len(sheets))
+			for _, sh := range sheets {
+				metadata := newMeta()
+				metadata[MetaKeySheet] = sh.name
+				docs = append(docs, &schema.Document{
+					Content:  sh.content,
+					MetaData: metadata,
+				})
+			}
+			return docs, nil
+		}
+		parts := make([]string, 0, len(sheets))
+		for _, sh := range sheets {
+			parts = append(parts, fmt.Sprintf("## %s\n\n%s", sh.name, sh.content))
+		}
+		return []*schema.Document{
+			{
+				Content:  strings.Join(parts, "\n\n"),
+				MetaData: newMeta(),
+			},
+		}, nil
+	case mimeText, "":
+		content, err := extractText(contentXML)
+		if err != nil {
+			return nil, err
+		}
+		return []*schema.Document{
+			{
+				Content:  content,
+				MetaData: newMeta(),
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("不支持的 OpenDocument 类型: %s", mimetype)
+	}
+}
+
+// extractText 从 odt 的 content.xml 中提取文本，text:h 转换为 Markdown 标题
+func extractText(data []byte) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	var (
+		paragraphs []string
+		text       strings.Builder
+		level      int
+		depth      int // 段落嵌套深度（text:p 内可能嵌套 text:note 等）
+		cells      []string
+		inCell     int
+		skip       int
+	)
+
+	finishParagraph := func() {
+		line := strings.TrimSpace(text.String())
+		text.Reset()
+		lvl := level
+		level = 0
+		if line == "" {
+			return
+		}
+		if inCell > 0 {
+			cells = append(cells, line)
+			return
+		}
+		if lvl > 0 {
+			line = strings.Repeat("#", lvl) + " " + strings.Join(strings.Fields(line), " ")
+		}
+		paragraphs = append(paragraphs, line)
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("解析 content.xml 失败: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 {
+				skip++
+				continue
+			}
+			switch t.Name.Local {
+			case "p", "h":
+				if depth == 0 {
+					text.Reset()
+					level = 0
+					if t.Name.Local == "h" {
+						level = 1
+						if lvl, err := strconv.Atoi(attrValue(t, "outline-level")); err == nil && lvl >= 1 {
+							level = min(lvl, 6)
+						}
+					}
+				}
+				depth++
+			case "s":
+				n := 1
+				if c, err := strconv.Atoi(attrValue(t, "c")); err == nil && c > 0 {
+					n = min(c, maxRepeated)
+				}
+				text.WriteString(strings.Repeat(" ", n))
+			case "tab":
+				text.WriteString("\t")
+			case "line-break":
+				text.WriteString("\n")
+			case "table-cell":
+				inCell++
+			case "table-row":
+				cells = cells[:0]
+			case "tracked-changes", "annotation", "note-citation":
+				// 修订记录、批注、脚注编号不输出
+				skip = 1
+			}
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			switch t.Name.Local {
+			case "p", "h":
+				if depth > 0 {
+					depth--
+				}
+				if depth == 0 {
+					finishParagraph()
+				}
+			case "table-cell":
+				if inCell > 0 {
+					inCell--
+				}
+			case "table-row":
+				// 表格行：单元格用 " | " 连接为一行
+				if len(cells) > 0 {
+					paragraphs = append(paragraphs, strings.Join(cells, " | "))
+				}
+				cells = cells[:0]
+			}
+		case xml.CharData:
+			if skip == 0 && depth > 0 {
+				text.Write(t)
+			}
+		}
+	}
+
+	return strings.Join(paragraphs, "\n\n"), nil
+}
+
+// sheet 电子表格中的一个工作表
+type sheet struct {
+	name    string
+	content string
+}
+
+// extractSheets 从 ods 的 content.xml 中提取工作表，单元格以制表符分隔、行以换行分隔
+func extractSheets(data []byte) ([]sheet, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	var (
+		sheets    []sheet
+		name      string
+		rows      []string
+		row       []string
+		rowRepeat int
+		cellRep   int
+		cell      strings.Builder
+		inCell    bool
+		inPara    bool
+	)
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析 content.xml 失败: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table":
+				name = attrValue(t, "name")
+				rows = rows[:0]
+			case "table-row":
+				row = row[:0]
+				rowRepeat = repeatCount(attrValue(t, "number-rows-repeated"))
+			case "table-cell", "covered-table-cell":
+				inCell = true
+				cell.Reset()
+				cellRep = repeatCount(attrValue(t, "number-columns-repeated"))
+			case "p":
+				if inCell {
+					if inPara || cell.Len() > 0 {
+						cell.WriteString(" ")
+					}
+					inPara = true
+				}
+			case "s":
+				if inCell {
+					cell.WriteString(" ")
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				inPara = false
+			case "table-cell", "covered-table-cell":
+				value := strings.TrimSpace(cell.String())
+				for i := 0; i < cellRep; i++ {
+					row = append(row, value)
+				}
+				inCell = false
+			case "table-row":
+				// 去掉行尾空单元格，跳过空行
+				end := len(row)
+				for end > 0 && row[end-1] == "" {
+					end--
+				}
+				if end > 0 {
+					line := strings.Join(row[:end], "\t")
+					for i := 0; i < rowRepeat; i++ {
+						rows = append(rows, line)
+					}
+				}
+			case "table":
+				if len(rows) > 0 {
+					sheets = append(sheets, sheet{
+						name:    name,
+						content: strings.Join(rows, "\n"),
+					})
+				}
+				rows = rows[:0]
+			}
+		case xml.CharData:
+			if inCell && inPara {
+				cell.Write(t)
+			}
+		}
+	}
+
+	return sheets, nil
+}
+
+// repeatCount 解析重复次数属性，限制在 [1, maxRepeated]
+func repeatCount(v string) int {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return min(n, maxRepeated)
+}
+
+// readZipFile 读取 zip 包中的指定文件
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("OpenDocument 文件中缺少 %s", name)
+}
+
+// attrValue 读取元素属性（忽略命名空间前缀）
+func attrValue(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -13,9 +13,16 @@ import (
 	"github.com/ledongthuc/pdf"
 )
 
+// 元数据键
+const (
+	MetaKeyPage       = "page"
+	MetaKeyTotalPages = "total_pages"
+)
+
 // Config PDF 解析器配置
 type Config struct {
 	// ToPages 是否按页面分割文档，默认为 false
+	// 按页输出时没有可提取文本的页面（如扫描页）也会输出一个空内容文档，便于调用方识别
 	ToPages bool
 	// PageSeparator 页面分隔符，仅在 ToPages=false 时使用，默认为 "\n\n"
 	PageSeparator string
@@ -49,22 +56,12 @@ func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Opt
 	commonOpts := parser.GetCommonOptions(&parser.Options{}, opts...)
 
 	// 将内容读取到临时文件（pdf 库需要文件路径）
-	tmpFile, err := os.CreateTemp("", "pdf-*.pdf")
+	tmpName, err := copyToTemp(reader)
 	if err != nil {
-		return nil, fmt.Errorf("create temp file: %w", err)
+		return nil, err
 	}
-	tmpName := tmpFile.Name()
 	defer os.Remove(tmpName)
 
-	if _, err := io.Copy(tmpFile, reader); err != nil {
-		tmpFile.Close()
-		return nil, fmt.Errorf("copy to temp file: %w", err)
-	}
-	// Close explicitly before pdf.Open (some systems require file to be closed before reading)
-	if err := tmpFile.Close(); err != nil {
-		return nil, fmt.Errorf("close temp file: %w", err)
-	}
-
 	// 打开 PDF 文件
 	f, r, err := pdf.Open(tmpName)
 	if err != nil {
@@ -102,16 +99,16 @@ func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Opt
 
 			text, err := extractPageText(page)
 			if err != nil {
-				// 单页解析失败，跳过该页
-				continue
+				// 单页解析失败，按无文本页处理
+				text = ""
 			}
 
 			pageMeta := make(map[string]any)
 			for k, v := range baseMeta {
 				pageMeta[k] = v
 			}
-			pageMeta["page"] = pageNum
-			pageMeta["total_pages"] = numPages
+			pageMeta[MetaKeyPage] = pageNum
+			pageMeta[MetaKeyTotalPages] = numPages
 
 			docs = append(docs, &schema.Document{
 				Content:  text,
@@ -140,7 +137,7 @@ func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Opt
 		allText.WriteString(text)
 	}
 
-	baseMeta["total_pages"] = numPages
+	baseMeta[MetaKeyTotalPages] = numPages
 	return []*schema.Document{
 		{
 			Content:  allText.String(),
@@ -149,6 +146,86 @@ func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Opt
 	}, nil
 }
 
+// PageCount 读取 PDF 文件的页数（只解析文档结构，不提取文本）
+func PageCount(path string) (int, error) {
+	f, r, err := pdf.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open pdf: %w", err)
+	}
+	defer f.Close()
+	return r.NumPage(), nil
+}
+
+// ParseStream 逐页解析 PDF，每页输出一个文档（无论 ToPages 配置），不需要把所有页面的文本同时保存在内存中
+func (p *Parser) ParseStream(ctx context.Context, reader io.Reader, emit func(*schema.Document) error, opts ...parser.Option) error {
+	commonOpts := parser.GetCommonOptions(&parser.Options{}, opts...)
+
+	tmpName, err := copyToTemp(reader)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpName)
+
+	f, r, err := pdf.Open(tmpName)
+	if err != nil {
+		return fmt.Errorf("open pdf: %w", err)
+	}
+	defer f.Close()
+
+	numPages := r.NumPage()
+	for pageNum := 1; pageNum <= numPages; pageNum++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page := r.Page(pageNum)
+		if page.V.IsNull() {
+			continue
+		}
+
+		text, err := extractPageText(page)
+		if err != nil {
+			// 单页解析失败，按无文本页处理
+			text = ""
+		}
+
+		pageMeta := make(map[string]any)
+		if commonOpts.URI != "" {
+			pageMeta["_source"] = commonOpts.URI
+		}
+		for k, v := range commonOpts.ExtraMeta {
+			pageMeta[k] = v
+		}
+		pageMeta[MetaKeyPage] = pageNum
+		pageMeta[MetaKeyTotalPages] = numPages
+
+		if err := emit(&schema.Document{Content: text, MetaData: pageMeta}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyToTemp 将内容写入临时文件并返回文件路径，调用方负责删除
+func copyToTemp(reader io.Reader) (string, error) {
+	tmpFile, err := os.CreateTemp("", "pdf-*.pdf")
+	if err != nil {
+		return "", fmt.Errorf("create temp file: %w", err)
+	}
+	tmpName := tmpFile.Name()
+
+	if _, err := io.Copy(tmpFile, reader); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return "", fmt.Errorf("copy to temp file: %w", err)
+	}
+	// Close explicitly before pdf.Open (some systems require file to be closed before reading)
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpName)
+		return "", fmt.Errorf("close temp file: %w", err)
+	}
+	return tmpName, nil
+}
+
 // extractPageText 从单个页面提取文本
 func extractPageText(page pdf.Page) (string, error) {
 	var buf bytes.Buffer
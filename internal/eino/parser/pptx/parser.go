@@ -0,0 +1,307 @@
+package pptx
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/eino/components/document/parser"
+	"github.com/cloudwego/eino/schema"
+)
+
+// 元数据键
+const (
+	MetaKeySlide       = "slide"
+	MetaKeyTotalSlides = "total_slides"
+)
+
+// Config Pptx 解析器配置
+type Config struct {
+	// SkipNotes 是否忽略演讲者备注，默认包含备注
+	SkipNotes bool
+}
+
+// Parser Microsoft PowerPoint (.pptx) 文件解析器
+// 每张幻灯片输出一个文档（幻灯片文本 + 备注）
+type Parser struct {
+	skipNotes bool
+}
+
+// NewParser 创建新的 Pptx 解析器
+func NewParser(ctx context.Context, config *Config) (*Parser, error) {
+	p := &Parser{}
+	if config != nil {
+		p.skipNotes = config.SkipNotes
+	}
+	return p, nil
+}
+
+var slideNameRe = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// Parse 解析 pptx 文件并返回文档列表（每张幻灯片一个文档）
+func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Option) ([]*schema.Document, error) {
+	commonOpts := parser.GetCommonOptions(&parser.Options{}, opts...)
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("打开 pptx 失败: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	slides := slideOrder(files)
+	if len(slides) == 0 {
+		return nil, fmt.Errorf("pptx 中没有幻灯片")
+	}
+
+	docs := make([]*schema.Document, 0, len(slides))
+	for i, slidePath := range slides {
+		slideXML, err := readFile(files, slidePath)
+		if err != nil {
+			return nil, err
+		}
+		paragraphs, err := extractParagraphs(slideXML)
+		if err != nil {
+			return nil, fmt.Errorf("解析幻灯片 %d 失败: %w", i+1, err)
+		}
+
+		var notes []string
+		if !p.skipNotes {
+			if notesPath := notesSlidePath(files, slidePath); notesPath != "" {
+				if notesXML, err := readFile(files, notesPath); err == nil {
+					notes, _ = extractParagraphs(notesXML)
+					notes = dropSlideNumbers(notes)
+				}
+			}
+		}
+
+		var b strings.Builder
+		b.WriteString(strings.Join(paragraphs, "\n"))
+		if len(notes) > 0 {
+			if b.Len() > 0 {
+				b.WriteString("\n\n")
+			}
+			b.WriteString("备注：\n")
+			b.WriteString(strings.Join(notes, "\n"))
+		}
+		content := strings.TrimSpace(b.String())
+		if content == "" {
+			continue
+		}
+
+		metadata := make(map[string]any)
+		if commonOpts.URI != "" {
+			metadata["_source"] = commonOpts.URI
+		}
+		metadata[MetaKeySlide] = i + 1
+		metadata[MetaKeyTotalSlides] = len(slides)
+		for k, v := range commonOpts.ExtraMeta {
+			metadata[k] = v
+		}
+
+		docs = append(docs, &schema.Document{
+			Content:  content,
+			MetaData: metadata,
+		})
+	}
+
+	return docs, nil
+}
+
+// slideOrder 返回幻灯片路径（按 presentation.xml 中的顺序，失败时按文件编号排序）
+func slideOrder(files map[string]*zip.File) []string {
+	if ordered := presentationSlideOrder(files); len(ordered) > 0 {
+		return ordered
+	}
+
+	type numbered struct {
+		n    int
+		path string
+	}
+	var list []numbered
+	for name := range files {
+		if m := slideNameRe.FindStringSubmatch(name); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			list = append(list, numbered{n: n, path: name})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].n < list[j].n })
+
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = s.path
+	}
+	return out
+}
+
+// presentationSlideOrder 读取 presentation.xml 的 sldIdLst 和关系文件获取幻灯片顺序
+func presentationSlideOrder(files map[string]*zip.File) []string {
+	presXML, err := readFile(files, "ppt/presentation.xml")
+	if err != nil {
+		return nil
+	}
+	rels := readRels(files, "ppt/_rels/presentation.xml.rels", "ppt")
+	if len(rels) == 0 {
+		return nil
+	}
+
+	var ids []string
+	dec := xml.NewDecoder(bytes.NewReader(presXML))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "sldId" {
+			for _, a := range se.Attr {
+				if a.Name.Local == "id" && a.Name.Space != "" {
+					ids = append(ids, a.Value)
+				}
+			}
+		}
+	}
+
+	var out []string
+	for _, id := range ids {
+		if target, ok := rels[id]; ok {
+			if _, exists := files[target.path]; exists {
+				out = append(out, target.path)
+			}
+		}
+	}
+	return out
+}
+
+// notesSlidePath 根据幻灯片关系文件查找对应的备注页
+func notesSlidePath(files map[string]*zip.File, slidePath string) string {
+	dir, name := path.Split(slidePath)
+	rels := readRels(files, path.Join(dir, "_rels", name+".rels"), strings.TrimSuffix(dir, "/"))
+	for _, r := range rels {
+		if strings.HasSuffix(r.relType, "/notesSlide") {
+			return r.path
+		}
+	}
+	return ""
+}
+
+type relTarget struct {
+	path    string
+	relType string
+}
+
+// readRels 读取关系文件，返回 Id -> 目标（已解析为 zip 内路径）
+func readRels(files map[string]*zip.File, relsPath, baseDir string) map[string]relTarget {
+	data, err := readFile(files, relsPath)
+	if err != nil {
+		return nil
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Type   string `xml:"Type,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xml.Unmarshal(data, &rels); err != nil {
+		return nil
+	}
+	out := make(map[string]relTarget, len(rels.Relationships))
+	for _, r := range rels.Relationships {
+		target := r.Target
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Clean(path.Join(baseDir, target))
+		}
+		out[r.ID] = relTarget{path: target, relType: r.Type}
+	}
+	return out
+}
+
+// extractParagraphs 提取 DrawingML 中的段落文本（a:p / a:t）
+func extractParagraphs(data []byte) ([]string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		paragraphs []string
+		cur        strings.Builder
+		inText     bool
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				cur.Reset()
+			case "t":
+				inText = true
+			case "br":
+				cur.WriteString("\n")
+			case "tab":
+				cur.WriteString("\t")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if line := strings.TrimSpace(cur.String()); line != "" {
+					paragraphs = append(paragraphs, line)
+				}
+				cur.Reset()
+			}
+		case xml.CharData:
+			if inText {
+				cur.Write(t)
+			}
+		}
+	}
+	return paragraphs, nil
+}
+
+// dropSlideNumbers 去掉备注页中的页码占位文本
+func dropSlideNumbers(lines []string) []string {
+	out := lines[:0]
+	for _, l := range lines {
+		if _, err := strconv.Atoi(l); err == nil {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// readFile 读取 zip 包中的文件
+func readFile(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("pptx 中缺少 %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -2,13 +2,20 @@ package parser
 
 import (
 	"context"
+	"io"
 
-	"github.com/cloudwego/eino-ext/components/document/parser/html"
 	"github.com/cloudwego/eino/components/document/parser"
+	"github.com/cloudwego/eino/schema"
 
 	csvparser "chatclaw/internal/eino/parser/csv"
 	docxparser "chatclaw/internal/eino/parser/docx"
+	emailparser "chatclaw/internal/eino/parser/email"
+	epubparser "chatclaw/internal/eino/parser/epub"
+	htmlparser "chatclaw/internal/eino/parser/html"
+	odfparser "chatclaw/internal/eino/parser/odf"
 	pdfparser "chatclaw/internal/eino/parser/pdf"
+	pptxparser "chatclaw/internal/eino/parser/pptx"
+	rtfparser "chatclaw/internal/eino/parser/rtf"
 	xlsxparser "chatclaw/internal/eino/parser/xlsx"
 )
 
@@ -18,15 +25,16 @@ func NewDocumentParser(ctx context.Context) (parser.Parser, error) {
 	// 创建文本解析器（用于 txt, md 文件）
 	textParser := parser.TextParser{}
 
-	// 创建 HTML 解析器
-	htmlParser, err := html.NewParser(ctx, &html.Config{})
+	// 创建 HTML 解析器（h 标签转换为 Markdown 标题，便于结构化分割）
+	htmlParser, err := htmlparser.NewParser(ctx, &htmlparser.Config{})
 	if err != nil {
 		return nil, err
 	}
 
 	// 创建 PDF 解析器（使用自定义解析器，支持中文）
+	// 按页输出，分割时保留页边界，分段可以记录页码
 	pdfParser, err := pdfparser.NewParser(ctx, &pdfparser.Config{
-		ToPages: false,
+		ToPages: true,
 	})
 	if err != nil {
 		return nil, err
@@ -50,8 +58,41 @@ func NewDocumentParser(ctx context.Context) (parser.Parser, error) {
 		return nil, err
 	}
 
+	// 每张幻灯片一个文档（包含备注）
+	pptxParser, err := pptxparser.NewParser(ctx, &pptxparser.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个章节一个文档
+	epubParser, err := epubparser.NewParser(ctx, &epubparser.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	odfParser, err := odfparser.NewParser(ctx, &odfparser.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	rtfParser, err := rtfparser.NewParser(ctx, &rtfparser.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// 邮件附件交给 ExtParser 按扩展名递归解析（ExtParser 创建后再绑定）
+	var extParser *parser.ExtParser
+	emailParser, err := emailparser.NewParser(ctx, &emailparser.Config{
+		ParseAttachment: func(ctx context.Context, name string, r io.Reader) ([]*schema.Document, error) {
+			return extParser.Parse(ctx, r, parser.WithURI(name))
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	// 创建 ExtParser，注册所有解析器
-	extParser, err := parser.NewExtParser(ctx, &parser.ExtParserConfig{
+	extParser, err = parser.NewExtParser(ctx, &parser.ExtParserConfig{
 		Parsers: map[string]parser.Parser{
 			// PDF 文件
 			".pdf": pdfParser,
@@ -61,13 +102,24 @@ func NewDocumentParser(ctx context.Context) (parser.Parser, error) {
 			// Microsoft Office 文件
 			".docx": docxParser,
 			".xlsx": xlsxParser,
+			".pptx": pptxParser,
+			// OpenDocument 文件
+			".odt": odfParser,
+			".ods": odfParser,
+			// 电子书 / 富文本
+			".epub": epubParser,
+			".rtf":  rtfParser,
+			// 邮件
+			".eml":  emailParser,
+			".mbox": emailParser,
 			// 文本文件
 			".txt": textParser,
 			".md":  textParser,
 			// CSV 文件
 			".csv": csvParser,
 		},
-		FallbackParser: textParser,
+		// 未知扩展名按文本解析，但拒绝二进制文件
+		FallbackParser: &textFallbackParser{text: textParser},
 	})
 	if err != nil {
 		return nil, err
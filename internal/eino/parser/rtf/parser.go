@@ -0,0 +1,351 @@
+package rtf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/components/document/parser"
+	"github.com/cloudwego/eino/schema"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// Config RTF 解析器配置
+type Config struct{}
+
+// Parser RTF (Rich Text Format) 文件解析器
+// 只提取正文文本，字体表、样式表、图片等目标组会被跳过
+type Parser struct{}
+
+// NewParser 创建新的 RTF 解析器
+func NewParser(ctx context.Context, config *Config) (*Parser, error) {
+	return &Parser{}, nil
+}
+
+// Parse 解析 rtf 文件并返回文档列表
+func (p *Parser) Parse(ctx context.Context, reader io.Reader, opts ...parser.Option) ([]*schema.Document, error) {
+	commonOpts := parser.GetCommonOptions(&parser.Options{}, opts...)
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(`{\rtf`)) {
+		return nil, fmt.Errorf("不是有效的 RTF 文件")
+	}
+
+	content := normalizeText(extractText(data))
+
+	metadata := make(map[string]any)
+	if commonOpts.URI != "" {
+		metadata["_source"] = commonOpts.URI
+	}
+	for k, v := range commonOpts.ExtraMeta {
+		metadata[k] = v
+	}
+
+	return []*schema.Document{
+		{
+			Content:  content,
+			MetaData: metadata,
+		},
+	}, nil
+}
+
+// skipDestinations 不包含正文的目标组
+var skipDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true,
+	"pict": true, "object": true, "header": true, "footer": true,
+	"headerl": true, "headerr": true, "headerf": true, "footerl": true,
+	"footerr": true, "footerf": true, "listtable": true, "listoverridetable": true,
+	"revtbl": true, "rsidtbl": true, "generator": true, "xmlnstbl": true,
+	"themedata": true, "colorschememapping": true, "latentstyles": true,
+	"datastore": true, "filetbl": true, "fldinst": true,
+}
+
+// groupState 每个 {} 组的状态（进入组时继承，退出组时恢复）
+type groupState struct {
+	skip bool // 是否处于被跳过的目标组
+	uc   int  // \ucN：\uN 之后需要跳过的替代字符数
+}
+
+// rtfReader RTF 文本提取器
+type rtfReader struct {
+	data    []byte
+	pos     int
+	out     strings.Builder
+	stack   []groupState
+	state   groupState
+	pending []byte // 尚未解码的 \'hh 字节
+	enc     encoding.Encoding
+	skipN   int // \uN 之后待跳过的替代字符数
+}
+
+// extractText 从 RTF 数据中提取纯文本
+func extractText(data []byte) string {
+	r := &rtfReader{
+		data:  data,
+		state: groupState{uc: 1},
+		enc:   charmap.Windows1252,
+	}
+	r.run()
+	return r.out.String()
+}
+
+func (r *rtfReader) run() {
+	for r.pos < len(r.data) {
+		c := r.data[r.pos]
+		switch c {
+		case '{':
+			r.flushBytes()
+			r.stack = append(r.stack, r.state)
+			r.pos++
+			// 可忽略的目标组 {\*\dest ...}
+			if bytes.HasPrefix(r.data[r.pos:], []byte(`\*`)) {
+				r.state.skip = true
+			}
+		case '}':
+			r.flushBytes()
+			if n := len(r.stack); n > 0 {
+				r.state = r.stack[n-1]
+				r.stack = r.stack[:n-1]
+			}
+			r.skipN = 0
+			r.pos++
+		case '\\':
+			r.controlWord()
+		case '\r', '\n':
+			r.pos++
+		default:
+			r.pos++
+			if r.skipN > 0 {
+				r.skipN--
+				continue
+			}
+			if r.state.skip {
+				continue
+			}
+			// 非 ASCII 原始字节同样按代码页解码
+			if c >= 0x80 {
+				r.pending = append(r.pending, c)
+				continue
+			}
+			r.flushBytes()
+			r.out.WriteByte(c)
+		}
+	}
+	r.flushBytes()
+}
+
+// controlWord 处理以反斜杠开头的控制字/控制符号
+func (r *rtfReader) controlWord() {
+	r.pos++ // 跳过 '\'
+	if r.pos >= len(r.data) {
+		return
+	}
+
+	c := r.data[r.pos]
+	if !isLetter(c) {
+		r.pos++
+		switch c {
+		case '\'':
+			// \'hh 代码页字节
+			if r.pos+2 <= len(r.data) {
+				if b, err := strconv.ParseUint(string(r.data[r.pos:r.pos+2]), 16, 8); err == nil {
+					r.pos += 2
+					if r.skipN > 0 {
+						r.skipN--
+						return
+					}
+					if !r.state.skip {
+						r.pending = append(r.pending, byte(b))
+					}
+					return
+				}
+			}
+		case '\\', '{', '}':
+			r.emit(string(c))
+		case '~':
+			r.emit(" ")
+		case '_':
+			r.emit("-")
+		case '\r', '\n':
+			r.emit("\n")
+		}
+		return
+	}
+
+	start := r.pos
+	for r.pos < len(r.data) && isLetter(r.data[r.pos]) {
+		r.pos++
+	}
+	word := string(r.data[start:r.pos])
+
+	hasParam := false
+	param := 0
+	if r.pos < len(r.data) && (r.data[r.pos] == '-' || isDigit(r.data[r.pos])) {
+		pstart := r.pos
+		r.pos++
+		for r.pos < len(r.data) && isDigit(r.data[r.pos]) {
+			r.pos++
+		}
+		if n, err := strconv.Atoi(string(r.data[pstart:r.pos])); err == nil {
+			param = n
+			hasParam = true
+		}
+	}
+	// 控制字后的一个空格属于控制字本身
+	if r.pos < len(r.data) && r.data[r.pos] == ' ' {
+		r.pos++
+	}
+
+	if skipDestinations[word] {
+		r.state.skip = true
+		return
+	}
+
+	switch word {
+	case "ansicpg":
+		if hasParam {
+			if enc := codepageEncoding(param); enc != nil {
+				r.enc = enc
+			}
+		}
+	case "uc":
+		if hasParam && param >= 0 {
+			r.state.uc = param
+		}
+	case "u":
+		if hasParam {
+			if param < 0 {
+				param += 65536
+			}
+			r.emit(string(rune(param)))
+			r.skipN = r.state.uc
+		}
+	case "par", "line", "sect", "page":
+		r.emit("\n")
+	case "row":
+		r.emit("\n")
+	case "tab", "cell":
+		r.emit("\t")
+	case "emdash":
+		r.emit("—")
+	case "endash":
+		r.emit("–")
+	case "bullet":
+		r.emit("•")
+	case "lquote":
+		r.emit("‘")
+	case "rquote":
+		r.emit("’")
+	case "ldblquote":
+		r.emit("“")
+	case "rdblquote":
+		r.emit("”")
+	case "bin":
+		// 二进制数据：跳过 N 字节
+		if hasParam && param > 0 {
+			r.pos = min(r.pos+param, len(r.data))
+		}
+	}
+}
+
+// emit 输出文本（跳过的目标组中不输出）
+func (r *rtfReader) emit(s string) {
+	r.flushBytes()
+	if !r.state.skip {
+		r.out.WriteString(s)
+	}
+}
+
+// flushBytes 按当前代码页解码累积的 \'hh 字节
+func (r *rtfReader) flushBytes() {
+	if len(r.pending) == 0 {
+		return
+	}
+	decoded, err := r.enc.NewDecoder().Bytes(r.pending)
+	if err != nil || !utf8.Valid(decoded) {
+		decoded, _ = charmap.Windows1252.NewDecoder().Bytes(r.pending)
+	}
+	r.out.Write(decoded)
+	r.pending = r.pending[:0]
+}
+
+// codepageEncoding 根据 \ansicpgN 返回对应编码
+func codepageEncoding(cp int) encoding.Encoding {
+	switch cp {
+	case 936:
+		return simplifiedchinese.GBK
+	case 950:
+		return traditionalchinese.Big5
+	case 932:
+		return japanese.ShiftJIS
+	case 949:
+		return korean.EUCKR
+	case 1250:
+		return charmap.Windows1250
+	case 1251:
+		return charmap.Windows1251
+	case 1252:
+		return charmap.Windows1252
+	case 1253:
+		return charmap.Windows1253
+	case 1254:
+		return charmap.Windows1254
+	case 1255:
+		return charmap.Windows1255
+	case 1256:
+		return charmap.Windows1256
+	case 1257:
+		return charmap.Windows1257
+	case 1258:
+		return charmap.Windows1258
+	case 874:
+		return charmap.Windows874
+	case 437:
+		return charmap.CodePage437
+	case 850:
+		return charmap.CodePage850
+	case 10000:
+		return charmap.Macintosh
+	}
+	return nil
+}
+
+// normalizeText 合并多余空行并去掉行尾空白
+func normalizeText(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank := false
+	for _, l := range lines {
+		l = strings.TrimRight(l, " \t ")
+		if l == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		out = append(out, l)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/cloudwego/eino/components/document/parser"
+	"github.com/cloudwego/eino/schema"
+
+	csvparser "chatclaw/internal/eino/parser/csv"
+	pdfparser "chatclaw/internal/eino/parser/pdf"
+)
+
+// defaultStreamBlockSize 流式解析时每个文档的大致字节数
+const defaultStreamBlockSize = 64 * 1024
+
+// StreamParser 流式解析器：边读取边输出文档，超大文件不需要一次性载入内存
+// emit 返回错误时解析立即停止并返回该错误
+type StreamParser interface {
+	ParseStream(ctx context.Context, reader io.Reader, emit func(*schema.Document) error, opts ...parser.Option) error
+}
+
+// Streamable 判断该扩展名（如 ".pdf"）的文件是否支持流式解析，与 NewStreamParsers 返回的格式一致
+func Streamable(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".pdf", ".csv", ".txt":
+		return true
+	}
+	return false
+}
+
+// NewStreamParsers 创建支持流式解析的解析器（按扩展名）
+// 未列出的格式（docx、xlsx 等压缩包格式）需要完整读取后才能解析，超过流式处理阈值时由调用方拒绝
+func NewStreamParsers(ctx context.Context) (map[string]StreamParser, error) {
+	pdfParser, err := pdfparser.NewParser(ctx, &pdfparser.Config{
+		ToPages: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	csvParser, err := csvparser.NewParser(ctx, &csvparser.Config{
+		BlockSize: defaultStreamBlockSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Markdown 不在此列：按块切开会丢失标题层级，影响标题路径分割
+	textParser := &textStreamParser{blockSize: defaultStreamBlockSize}
+
+	return map[string]StreamParser{
+		".pdf": pdfParser,
+		".csv": csvParser,
+		".txt": textParser,
+	}, nil
+}
+
+// textStreamParser 按行读取纯文本，累积到 blockSize 后在段落边界（空行）输出一个文档；
+// 一直没有空行时在 2 倍 blockSize 处按行边界切开
+type textStreamParser struct {
+	blockSize int
+}
+
+// ParseStream 实现 StreamParser 接口
+func (p *textStreamParser) ParseStream(ctx context.Context, reader io.Reader, emit func(*schema.Document) error, opts ...parser.Option) error {
+	commonOpts := parser.GetCommonOptions(&parser.Options{}, opts...)
+
+	newDoc := func(content string) *schema.Document {
+		meta := make(map[string]any)
+		meta[parser.MetaKeySource] = commonOpts.URI
+		for k, v := range commonOpts.ExtraMeta {
+			meta[k] = v
+		}
+		return &schema.Document{Content: content, MetaData: meta}
+	}
+
+	br := bufio.NewReaderSize(reader, p.blockSize)
+	var block strings.Builder
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		block.WriteString(line)
+
+		paragraphEnd := strings.TrimSpace(line) == ""
+		if (block.Len() >= p.blockSize && paragraphEnd) || block.Len() >= 2*p.blockSize {
+			if emitErr := emit(newDoc(block.String())); emitErr != nil {
+				return emitErr
+			}
+			block.Reset()
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if strings.TrimSpace(block.String()) != "" {
+		return emit(newDoc(block.String()))
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+
+	"chatclaw/internal/eino/chatmodel"
+	"chatclaw/internal/eino/raptor"
+	"chatclaw/internal/eino/splitter"
+)
+
+const (
+	// contextDocMaxRunes 生成上下文时传给 LLM 的文档最大长度（超出时截取片段附近的窗口）
+	contextDocMaxRunes = 20000
+	// contextConcurrency 并发生成上下文的请求数
+	contextConcurrency = 4
+)
+
+// contextPrompt 上下文增强提示词（参考 Contextual Retrieval）
+const contextPrompt = `<document>
+%s
+</document>
+
+以下是需要放入整篇文档上下文中理解的片段：
+<chunk>
+%s
+</chunk>
+
+请给出一段简短的上下文说明（50-100 字），说明该片段在整篇文档中的位置、所属主题和背景，以便提升检索效果。
+要求：
+1. 使用与文档相同的语言
+2. 只输出上下文说明本身，不要复述片段内容，不要输出其他内容`
+
+// embeddingText 返回用于向量化/分词的文本：有上下文前缀时拼接在原文前面
+func embeddingText(prefix, content string) string {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return content
+	}
+	return prefix + "\n\n" + content
+}
+
+// headingPathPrefix 根据分块元数据中的标题路径生成前缀
+func headingPathPrefix(meta map[string]any) string {
+	path, _ := meta[splitter.MetaKeyHeadingPath].(string)
+	if strings.TrimSpace(path) == "" {
+		return ""
+	}
+	return path
+}
+
+// enrichNodesWithContext 使用 LLM 为每个 level-0 节点生成上下文前缀（写入 ContextPrefix）
+// 单个片段生成失败不会中断流程，只是该片段不带前缀。
+func (p *Processor) enrichNodesWithContext(
+	ctx context.Context,
+	libraryConfig *LibraryConfig,
+	docs []*schema.Document,
+	nodes []*raptor.DocumentNode,
+	getProviderInfo func(providerID string) (*ProviderInfo, error),
+	onProgress func(int),
+) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	providerInfo, err := getProviderInfo(libraryConfig.ContextLLMProviderID)
+	if err != nil {
+		return fmt.Errorf("获取供应商信息: %w", err)
+	}
+
+	llm, err := chatmodel.NewChatModel(ctx, &chatmodel.ProviderConfig{
+		ProviderID:   libraryConfig.ContextLLMProviderID,
+		ProviderType: providerInfo.ProviderType,
+		APIKey:       providerInfo.APIKey,
+		APIEndpoint:  providerInfo.APIEndpoint,
+		ModelID:      libraryConfig.ContextLLMModelID,
+		ExtraConfig:  providerInfo.ExtraConfig,
+	})
+	if err != nil {
+		return fmt.Errorf("创建聊天模型: %w", err)
+	}
+
+	parts := make([]string, 0, len(docs))
+	for _, d := range docs {
+		if d != nil && strings.TrimSpace(d.Content) != "" {
+			parts = append(parts, d.Content)
+		}
+	}
+	docText := strings.Join(parts, "\n\n")
+
+	// 文档过长时每个片段只带上所在位置附近的窗口：整篇文档只转换一次 rune，片段位置按顺序一次定位
+	var (
+		docRunes []rune
+		centers  []int
+	)
+	if utf8.RuneCountInString(docText) > contextDocMaxRunes {
+		docRunes = []rune(docText)
+		centers = chunkCenters(docText, nodes)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		done   int32
+		failed int32
+		sem    = make(chan struct{}, contextConcurrency)
+	)
+	for i, n := range nodes {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, n *raptor.DocumentNode) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			window := docText
+			if docRunes != nil {
+				window = documentWindow(docRunes, centers[i], contextDocMaxRunes)
+			}
+			prefix, err := generateChunkContext(ctx, llm, window, n.Content)
+			if err != nil {
+				atomic.AddInt32(&failed, 1)
+				log.Printf("[Context] generate context failed for chunk %d: %v", n.ChunkOrder, err)
+			} else if prefix != "" {
+				// 保留已有前缀（如标题路径），LLM 生成的上下文追加在后面
+				n.ContextPrefix = embeddingText(n.ContextPrefix, prefix)
+			}
+
+			finished := atomic.AddInt32(&done, 1)
+			if onProgress != nil {
+				onProgress(int(finished) * 100 / len(nodes))
+			}
+		}(i, n)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		log.Printf("[Context] %d/%d chunks have no context prefix", failed, len(nodes))
+	}
+	return nil
+}
+
+// generateChunkContext 调用 LLM 为单个片段生成上下文说明，docWindow 为整篇文档或片段附近的窗口
+func generateChunkContext(ctx context.Context, llm model.ChatModel, docWindow, chunk string) (string, error) {
+	prompt := fmt.Sprintf(contextPrompt, docWindow, chunk)
+	resp, err := llm.Generate(ctx, []*schema.Message{schema.UserMessage(prompt)})
+	if err != nil {
+		return "", fmt.Errorf("LLM 生成失败: %w", err)
+	}
+	if resp == nil {
+		return "", fmt.Errorf("LLM 返回为空")
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
+
+// chunkCenters 依次定位每个节点在文档中的位置，返回节点中点的 rune 偏移。
+// 与 assignPageRanges 一样使用移动的游标（节点按文档顺序排列，相邻节点可能重叠），rune 偏移随游标累加，
+// 整篇文档只扫描一遍；定位不到的节点沿用上一个节点的位置
+func chunkCenters(docText string, nodes []*raptor.DocumentNode) []int {
+	centers := make([]int, len(nodes))
+	cursor, lastByte, lastRune, center := 0, 0, 0, 0
+	for i, n := range nodes {
+		if pos, _ := locateChunk(docText, n.Content, cursor); pos >= 0 {
+			lastRune += utf8.RuneCountInString(docText[lastByte:pos])
+			lastByte = pos
+			center = lastRune + utf8.RuneCountInString(n.Content)/2
+			cursor = pos + 1
+		}
+		centers[i] = center
+	}
+	return centers
+}
+
+// documentWindow 截取以 center（rune 偏移）为中心、最多 maxRunes 个字符的文档窗口，避免超出模型上下文
+func documentWindow(docRunes []rune, center, maxRunes int) string {
+	if len(docRunes) <= maxRunes {
+		return string(docRunes)
+	}
+	start := max(center-maxRunes/2, 0)
+	end := start + maxRunes
+	if end > len(docRunes) {
+		end = len(docRunes)
+		start = end - maxRunes
+	}
+	return string(docRunes[start:end])
+}
@@ -0,0 +1,304 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/uptrace/bun"
+
+	"chatclaw/internal/sqlite/vecstore"
+)
+
+const (
+	// defaultEmbeddingCacheMaxMB 向量缓存默认容量（settings.embedding_cache_max_mb 未配置时使用）
+	defaultEmbeddingCacheMaxMB = 512
+	// embeddingCacheEvictRatio 超出容量时淘汰到容量的该比例，避免每次写入都触发淘汰
+	embeddingCacheEvictRatio = 0.9
+	// embeddingCacheEvictBatch 每轮淘汰的条目数
+	embeddingCacheEvictBatch = 1000
+)
+
+// EmbeddingStats 向量化统计：本次处理请求了多少段文本，其中多少命中缓存
+type EmbeddingStats struct {
+	Total     int `json:"total"`
+	CacheHits int `json:"cache_hits"`
+}
+
+// EmbeddingCacheUsage 向量缓存占用情况
+type EmbeddingCacheUsage struct {
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+	MaxMB   int   `json:"max_mb"`
+}
+
+// cachedEmbedder 按（嵌入模型、维度、规范化文本哈希）缓存向量：
+// 重新上传修改过的文档、调整分段后重新处理、同一文件导入多个知识库时，未变化的分段不再调用供应商接口。
+type cachedEmbedder struct {
+	db        *bun.DB
+	inner     embedding.Embedder
+	modelKey  string
+	dimension int
+	maxBytes  int64
+	onStats   func(EmbeddingStats)
+
+	mu    sync.Mutex
+	stats EmbeddingStats
+	dirty bool // 写入过新条目，结束时需要检查容量
+}
+
+// withEmbeddingCache 为 embedder 加上向量缓存；缓存容量为 0 时直接返回原 embedder
+func (p *Processor) withEmbeddingCache(ctx context.Context, inner embedding.Embedder, config *EmbeddingConfig) embedding.Embedder {
+	if inner == nil || config == nil {
+		return inner
+	}
+	maxMB := embeddingCacheMaxMB(ctx, p.db)
+	if maxMB <= 0 {
+		return inner
+	}
+	return &cachedEmbedder{
+		db:        p.db,
+		inner:     inner,
+		modelKey:  config.ProviderID + "/" + config.ModelID,
+		dimension: config.Dimension,
+		maxBytes:  int64(maxMB) << 20,
+		onStats:   p.OnEmbeddingStats,
+	}
+}
+
+// embeddingCacheMaxMB 读取缓存容量设置（MB）
+func embeddingCacheMaxMB(ctx context.Context, db *bun.DB) int {
+	var value sql.NullString
+	if err := db.NewSelect().
+		TableExpr("settings").
+		Column("value").
+		Where("key = ?", "embedding_cache_max_mb").
+		Scan(ctx, &value); err != nil || !value.Valid {
+		return defaultEmbeddingCacheMaxMB
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value.String))
+	if err != nil {
+		return defaultEmbeddingCacheMaxMB
+	}
+	return n
+}
+
+// normalizeEmbeddingText 规范化文本：去掉首尾空白并合并连续空白，仅空白差异的分段共用缓存
+func normalizeEmbeddingText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func (c *cachedEmbedder) cacheKey(text string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00", c.modelKey, c.dimension)
+	h.Write([]byte(normalizeEmbeddingText(text)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *cachedEmbedder) EmbedStrings(ctx context.Context, texts []string, opts ...embedding.Option) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(texts))
+	for i, t := range texts {
+		keys[i] = c.cacheKey(t)
+	}
+
+	cached, err := c.lookup(ctx, keys)
+	if err != nil {
+		// 缓存读取失败不影响向量化
+		log.Printf("[EmbeddingCache] lookup failed: %v", err)
+		cached = nil
+	}
+
+	out := make([][]float64, len(texts))
+	hits := 0
+	// 同一批次中相同的文本只请求一次
+	missTexts := make([]string, 0, len(texts))
+	missKeys := make([]string, 0, len(texts))
+	missIndex := make(map[string]int, len(texts))
+	for i, k := range keys {
+		if v, ok := cached[k]; ok {
+			out[i] = v
+			hits++
+			continue
+		}
+		if _, ok := missIndex[k]; !ok {
+			missIndex[k] = len(missTexts)
+			missTexts = append(missTexts, texts[i])
+			missKeys = append(missKeys, k)
+		}
+	}
+
+	if len(missTexts) > 0 {
+		vecs, err := c.inner.EmbedStrings(ctx, missTexts, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if len(vecs) != len(missTexts) {
+			return nil, fmt.Errorf("embedding count mismatch: got %d, want %d", len(vecs), len(missTexts))
+		}
+		for i, k := range keys {
+			if out[i] == nil {
+				out[i] = vecs[missIndex[k]]
+			}
+		}
+		if err := c.store(ctx, missKeys, vecs); err != nil {
+			log.Printf("[EmbeddingCache] store failed: %v", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.stats.Total += len(texts)
+	c.stats.CacheHits += hits
+	stats := c.stats
+	c.mu.Unlock()
+	if c.onStats != nil {
+		c.onStats(stats)
+	}
+	return out, nil
+}
+
+// lookup 批量读取缓存，命中的条目刷新最近使用时间
+func (c *cachedEmbedder) lookup(ctx context.Context, keys []string) (map[string][]float64, error) {
+	type row struct {
+		Key    string `bun:"key"`
+		Vector []byte `bun:"vector"`
+	}
+	rows := make([]row, 0, len(keys))
+	if err := c.db.NewSelect().
+		TableExpr("embedding_cache").
+		Column("key", "vector").
+		Where("key IN (?)", bun.In(keys)).
+		Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string][]float64, len(rows))
+	hitKeys := make([]string, 0, len(rows))
+	for _, r := range rows {
+		vec := vecstore.Decode(r.Vector)
+		if len(vec) == 0 || (c.dimension > 0 && len(vec) != c.dimension) {
+			continue
+		}
+		out[r.Key] = vec
+		hitKeys = append(hitKeys, r.Key)
+	}
+
+	if len(hitKeys) > 0 {
+		if _, err := c.db.NewUpdate().
+			TableExpr("embedding_cache").
+			Set("last_used_at = ?", time.Now().UTC().Format(time.DateTime)).
+			Set("hits = hits + 1").
+			Where("key IN (?)", bun.In(hitKeys)).
+			Exec(ctx); err != nil {
+			log.Printf("[EmbeddingCache] touch failed: %v", err)
+		}
+	}
+	return out, nil
+}
+
+// store 写入新向量
+func (c *cachedEmbedder) store(ctx context.Context, keys []string, vecs [][]float64) error {
+	now := time.Now().UTC().Format(time.DateTime)
+	err := c.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		for i, k := range keys {
+			blob := vecstore.Encode(vecs[i])
+			if _, err := tx.NewRaw(
+				"INSERT OR REPLACE INTO embedding_cache (key, model_key, dimension, vector, size, created_at, last_used_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				k, c.modelKey, c.dimension, blob, len(blob)+len(k), now, now,
+			).Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// finish 处理结束时按容量淘汰最久未使用的条目
+func (c *cachedEmbedder) finish(ctx context.Context) {
+	c.mu.Lock()
+	dirty := c.dirty
+	c.dirty = false
+	c.mu.Unlock()
+	if !dirty {
+		return
+	}
+	if err := evictEmbeddingCache(ctx, c.db, c.maxBytes); err != nil {
+		log.Printf("[EmbeddingCache] evict failed: %v", err)
+	}
+}
+
+// finishEmbeddingCache 如果 embedder 带有缓存，执行容量检查
+func finishEmbeddingCache(ctx context.Context, e embedding.Embedder) {
+	if c, ok := e.(*cachedEmbedder); ok {
+		c.finish(ctx)
+	}
+}
+
+// evictEmbeddingCache 缓存超过 maxBytes 时按最近使用时间淘汰，直到低于容量的 90%
+func evictEmbeddingCache(ctx context.Context, db *bun.DB, maxBytes int64) error {
+	var total int64
+	if err := db.NewRaw("SELECT COALESCE(SUM(size), 0) FROM embedding_cache").Scan(ctx, &total); err != nil {
+		return err
+	}
+	if total <= maxBytes {
+		return nil
+	}
+
+	target := int64(float64(maxBytes) * embeddingCacheEvictRatio)
+	for total > target {
+		var freed sql.NullInt64
+		if err := db.NewRaw(
+			"SELECT SUM(size) FROM (SELECT size FROM embedding_cache ORDER BY last_used_at ASC LIMIT ?)",
+			embeddingCacheEvictBatch,
+		).Scan(ctx, &freed); err != nil {
+			return err
+		}
+		if !freed.Valid || freed.Int64 == 0 {
+			return nil
+		}
+		if _, err := db.NewRaw(
+			"DELETE FROM embedding_cache WHERE key IN (SELECT key FROM embedding_cache ORDER BY last_used_at ASC LIMIT ?)",
+			embeddingCacheEvictBatch,
+		).Exec(ctx); err != nil {
+			return err
+		}
+		total -= freed.Int64
+	}
+	log.Printf("[EmbeddingCache] evicted to %d bytes (max %d)", total, maxBytes)
+	return nil
+}
+
+// GetEmbeddingCacheUsage 返回向量缓存的条目数和占用空间
+func GetEmbeddingCacheUsage(ctx context.Context, db *bun.DB) (*EmbeddingCacheUsage, error) {
+	usage := &EmbeddingCacheUsage{MaxMB: embeddingCacheMaxMB(ctx, db)}
+	if err := db.NewRaw("SELECT COUNT(*), COALESCE(SUM(size), 0) FROM embedding_cache").
+		Scan(ctx, &usage.Entries, &usage.Bytes); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// ClearEmbeddingCache 清空向量缓存
+func ClearEmbeddingCache(ctx context.Context, db *bun.DB) error {
+	_, err := db.NewRaw("DELETE FROM embedding_cache").Exec(ctx)
+	return err
+}
+
+var _ embedding.Embedder = (*cachedEmbedder)(nil)
@@ -0,0 +1,190 @@
+package processor
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/components/document"
+	"github.com/cloudwego/eino/schema"
+
+	pdfparser "chatclaw/internal/eino/parser/pdf"
+	"chatclaw/internal/eino/raptor"
+)
+
+// metaKeyPageEnd 分段跨页时的结束页码（起始页码仍使用 pdfparser.MetaKeyPage）
+const metaKeyPageEnd = "page_end"
+
+// pageSeparator 拼接分页文本时使用的分隔符（按段落分隔，分割器可以在页边界处切开）
+const pageSeparator = "\n\n"
+
+// locatePrefixRunes 分段内容与原文不完全一致时（如语义分割重新拼接了句子），按开头若干字符定位
+const locatePrefixRunes = 32
+
+// pageFromMeta 读取元数据中的页码（PDF 按页解析时写入），没有页码时返回 0
+func pageFromMeta(meta map[string]any) int {
+	return intFromMeta(meta, pdfparser.MetaKeyPage)
+}
+
+// pageEndFromMeta 读取分段的结束页码，没有时与起始页码相同
+func pageEndFromMeta(meta map[string]any) int {
+	if end := intFromMeta(meta, metaKeyPageEnd); end > 0 {
+		return end
+	}
+	return pageFromMeta(meta)
+}
+
+func intFromMeta(meta map[string]any, key string) int {
+	switch v := meta[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// splitOCRCandidates 去掉没有可提取文本的分页文档，返回剩余文档和这些页的页码（OCR 候选页）
+func splitOCRCandidates(docs []*schema.Document) ([]*schema.Document, []int) {
+	var (
+		kept  = make([]*schema.Document, 0, len(docs))
+		pages []int
+	)
+	for _, d := range docs {
+		if d == nil {
+			continue
+		}
+		if page := pageFromMeta(d.MetaData); page > 0 && strings.TrimSpace(d.Content) == "" {
+			pages = append(pages, page)
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept, pages
+}
+
+// pageSpan 拼接文本中一页内容的起始位置
+type pageSpan struct {
+	offset int
+	page   int
+}
+
+// splitAcrossPages 分割文档：分页文档（PDF）先拼接成整篇再分割，分段可以跨页、段落不会在页边界被切断，
+// 再把分段在拼接文本中的位置映射回页码范围；没有页码的文档直接分割
+func splitAcrossPages(ctx context.Context, sp document.Transformer, docs []*schema.Document) ([]*schema.Document, error) {
+	joined, spans := joinPages(docs)
+	if joined == nil {
+		return sp.Transform(ctx, docs)
+	}
+	chunks, err := sp.Transform(ctx, []*schema.Document{joined})
+	if err != nil {
+		return nil, err
+	}
+	assignPageRanges(joined.Content, spans, chunks)
+	return chunks, nil
+}
+
+// joinPages 把分页文档按顺序拼接成一个文档，返回每页的起始位置；有任一文档没有页码时返回 nil
+func joinPages(docs []*schema.Document) (*schema.Document, []pageSpan) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	var (
+		sb    strings.Builder
+		spans = make([]pageSpan, 0, len(docs))
+	)
+	for i, d := range docs {
+		page := pageFromMeta(d.MetaData)
+		if page <= 0 {
+			return nil, nil
+		}
+		if i > 0 {
+			sb.WriteString(pageSeparator)
+		}
+		spans = append(spans, pageSpan{offset: sb.Len(), page: page})
+		sb.WriteString(d.Content)
+	}
+
+	meta := maps.Clone(docs[0].MetaData)
+	delete(meta, pdfparser.MetaKeyPage)
+	return &schema.Document{ID: docs[0].ID, Content: sb.String(), MetaData: meta}, spans
+}
+
+// assignPageRanges 在拼接文本中依次定位每个分段，把覆盖的页码范围写入分段元数据。
+// 分段之间可能有重叠，下一个分段从上一个分段的起始位置之后开始查找；定位不到时沿用上一个分段的结束页
+func assignPageRanges(text string, spans []pageSpan, chunks []*schema.Document) {
+	pageAt := func(offset int) int {
+		i := sort.Search(len(spans), func(i int) bool { return spans[i].offset > offset }) - 1
+		return spans[max(i, 0)].page
+	}
+
+	cursor, lastEnd := 0, spans[0].page
+	for _, c := range chunks {
+		start, end := lastEnd, lastEnd
+		if pos, n := locateChunk(text, c.Content, cursor); pos >= 0 {
+			start, end = pageAt(pos), pageAt(pos+max(n-1, 0))
+			cursor = pos + 1
+		}
+		lastEnd = end
+
+		// 分割器可能让多个分段共享同一个元数据 map
+		c.MetaData = maps.Clone(c.MetaData)
+		if c.MetaData == nil {
+			c.MetaData = map[string]any{}
+		}
+		c.MetaData[pdfparser.MetaKeyPage] = start
+		c.MetaData[metaKeyPageEnd] = end
+	}
+}
+
+// locateChunk 从 from 开始查找分段内容，返回位置和在原文中覆盖的长度；找不到时返回 -1
+func locateChunk(text, content string, from int) (int, int) {
+	content = strings.TrimSpace(content)
+	if content == "" || from >= len(text) {
+		return -1, 0
+	}
+	if i := strings.Index(text[from:], content); i >= 0 {
+		return from + i, len(content)
+	}
+	prefix := content
+	if utf8.RuneCountInString(prefix) > locatePrefixRunes {
+		prefix = string([]rune(prefix)[:locatePrefixRunes])
+	}
+	if i := strings.Index(text[from:], prefix); i >= 0 {
+		return from + i, len(content)
+	}
+	return -1, 0
+}
+
+// propagatePageRanges 把子节点的页码范围合并到 RAPTOR 摘要节点上（摘要覆盖所有子节点的页码）
+func propagatePageRanges(nodes []*raptor.DocumentNode) {
+	byID := make(map[int64]*raptor.DocumentNode, len(nodes))
+	maxLevel := 0
+	for _, n := range nodes {
+		byID[n.ID] = n
+		maxLevel = max(maxLevel, n.Level)
+	}
+
+	// 按层级从低到高合并，保证上层摘要拿到完整范围
+	for level := 0; level < maxLevel; level++ {
+		for _, n := range nodes {
+			if n.Level != level || n.ParentID == nil || n.PageStart <= 0 {
+				continue
+			}
+			parent, ok := byID[*n.ParentID]
+			if !ok {
+				continue
+			}
+			if parent.PageStart <= 0 || n.PageStart < parent.PageStart {
+				parent.PageStart = n.PageStart
+			}
+			if n.PageEnd > parent.PageEnd {
+				parent.PageEnd = n.PageEnd
+			}
+		}
+	}
+}
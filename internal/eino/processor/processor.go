@@ -3,6 +3,7 @@ package processor
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -14,6 +15,7 @@ import (
 	"time"
 	"unicode/utf8"
 
+	"github.com/cloudwego/eino/components/document"
 	"github.com/cloudwego/eino/components/document/parser"
 	"github.com/cloudwego/eino/components/embedding"
 	"github.com/cloudwego/eino/schema"
@@ -25,6 +27,7 @@ import (
 	"chatclaw/internal/eino/raptor"
 	"chatclaw/internal/eino/splitter"
 	"chatclaw/internal/fts/tokenizer"
+	"chatclaw/internal/sqlite/vecstore"
 )
 
 // Phase represents a high-level stage of the document pipeline.
@@ -35,6 +38,7 @@ const (
 	PhaseParsing   Phase = "parsing"
 	PhaseSplitting Phase = "splitting"
 	PhaseEmbedding Phase = "embedding"
+	PhaseContext   Phase = "context"
 	PhaseRaptor    Phase = "raptor"
 	PhasePersist   Phase = "persist"
 )
@@ -49,6 +53,18 @@ type PhaseError struct {
 func (e *PhaseError) Error() string { return e.Err.Error() }
 func (e *PhaseError) Unwrap() error { return e.Err }
 
+// Retryable reports whether the failure is worth retrying.
+// Parsing/splitting failures come from the file itself and fail the same way again;
+// embedding, enrichment and persistence mostly fail on provider or database hiccups.
+func (e *PhaseError) Retryable() bool {
+	switch e.Phase {
+	case PhaseParsing, PhaseSplitting:
+		return false
+	default:
+		return true
+	}
+}
+
 func wrapPhase(phase Phase, err error) error {
 	if err == nil {
 		return nil
@@ -66,6 +82,9 @@ type DocumentNode struct {
 	Level         int       `bun:"level,notnull"`
 	ParentID      *int64    `bun:"parent_id"`
 	ChunkOrder    int       `bun:"chunk_order,notnull"`
+	ContextPrefix string    `bun:"context_prefix,notnull"` // 上下文增强前缀（不参与展示）
+	PageStart     int       `bun:"page_start,notnull"`     // 页码范围（0 表示无页码）
+	PageEnd       int       `bun:"page_end,notnull"`
 	Vector        []float64 `bun:"-"` // 不存储在此表中
 }
 
@@ -77,6 +96,8 @@ type LibraryConfig struct {
 	SemanticSegmentationEnabled bool
 	RaptorLLMProviderID         string
 	RaptorLLMModelID            string
+	ContextLLMProviderID        string // 上下文增强（为每个分段生成上下文前缀）使用的 LLM
+	ContextLLMModelID           string
 }
 
 // EmbeddingConfig 包含全局嵌入配置
@@ -88,6 +109,8 @@ type EmbeddingConfig struct {
 	APIKey       string
 	APIEndpoint  string
 	ExtraConfig  string
+	// Batch 批次大小和并发数（settings.provider_embedding_batch 中该供应商的配置，未配置为 0）
+	Batch einoembed.BatchConfig
 }
 
 // ProviderInfo 包含供应商信息
@@ -102,13 +125,25 @@ type ProviderInfo struct {
 type ProcessResult struct {
 	WordTotal  int
 	SplitTotal int
-	Error      error
+	// OCRCandidatePages 没有可提取文本的页码（如扫描页），需要 OCR 才能入库
+	OCRCandidatePages []int
+	// SkippedSteps 因流式处理而跳过的步骤（SkippedStepContext / SkippedStepRaptor）
+	SkippedSteps []string
+	Error        error
 }
 
 // Processor 处理文档的解析、分割和嵌入
 type Processor struct {
 	db     *bun.DB
 	parser parser.Parser
+	// streamParsers 支持流式解析的格式（大文件流式处理时使用）
+	streamParsers map[string]einoparser.StreamParser
+
+	// OnEmbeddingStats 可选：每批向量化后回调累计的缓存命中情况，用于进度展示
+	OnEmbeddingStats func(stats EmbeddingStats)
+
+	// embedGroupSize 每次交给 embedder 的文本数（createEmbedder 时按批次大小 × 并发数确定）
+	embedGroupSize int
 }
 
 // ReembedDocumentNodes 仅对已有的 document_nodes 重新向量化（不重新解析/分段）
@@ -130,11 +165,13 @@ func (p *Processor) ReembedDocumentNodes(
 	if err != nil {
 		return fmt.Errorf("创建 embedder 失败: %w", err)
 	}
+	embedder = p.withEmbeddingCache(ctx, embedder, embeddingConfig)
+	defer finishEmbeddingCache(ctx, embedder)
 
 	nodes := make([]*DocumentNode, 0, 256)
 	if err := p.db.NewSelect().
 		Model(&nodes).
-		Column("id", "library_id", "document_id", "content", "level", "parent_id", "chunk_order").
+		Column("id", "library_id", "document_id", "content", "level", "parent_id", "chunk_order", "context_prefix").
 		Where("document_id = ?", docID).
 		OrderExpr("id ASC").
 		Scan(ctx); err != nil {
@@ -145,7 +182,7 @@ func (p *Processor) ReembedDocumentNodes(
 		return errors.New("no document nodes")
 	}
 
-	return p.embedNodes(ctx, nodes, embedder, onProgress)
+	return wrapPhase(PhaseEmbedding, p.embedNodes(ctx, nodes, embedder, onProgress))
 }
 
 // NewProcessor 创建新的文档处理器
@@ -158,9 +195,15 @@ func NewProcessor(db *bun.DB) (*Processor, error) {
 		return nil, fmt.Errorf("创建文档解析器失败: %w", err)
 	}
 
+	streamParsers, err := einoparser.NewStreamParsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("创建流式解析器失败: %w", err)
+	}
+
 	return &Processor{
-		db:     db,
-		parser: docParser,
+		db:            db,
+		parser:        docParser,
+		streamParsers: streamParsers,
 	}, nil
 }
 
@@ -174,6 +217,18 @@ func (p *Processor) ProcessDocument(
 	getProviderInfo func(providerID string) (*ProviderInfo, error),
 	onProgress func(phase string, progress int),
 ) (*ProcessResult, error) {
+	// 大文件（或页数很多的 PDF）按批流式处理，避免整篇文档的解析结果、分段和向量同时留在内存中；
+	// 不支持流式解析的大文件在读取前拒绝
+	if fileInfo, err := os.Stat(localPath); err == nil {
+		if err := CheckFileSize(localPath, fileInfo.Size()); err != nil {
+			result := &ProcessResult{Error: wrapPhase(PhaseParsing, err)}
+			return result, result.Error
+		}
+		if shouldStream(localPath, fileInfo) {
+			return p.processDocumentStreaming(ctx, docID, localPath, fileInfo, libraryConfig, embeddingConfig, onProgress)
+		}
+	}
+
 	result := &ProcessResult{}
 
 	// 阶段 1：解析文档
@@ -187,7 +242,17 @@ func (p *Processor) ProcessDocument(
 		return result, result.Error
 	}
 
+	// 没有可提取文本的页面不参与分割，记录为 OCR 候选页
+	docs, result.OCRCandidatePages = splitOCRCandidates(docs)
+	if len(result.OCRCandidatePages) > 0 {
+		log.Printf("[Parse] %d pages have no extractable text: %v", len(result.OCRCandidatePages), result.OCRCandidatePages)
+	}
+
 	if len(docs) == 0 {
+		if len(result.OCRCandidatePages) > 0 {
+			result.Error = wrapPhase(PhaseParsing, fmt.Errorf("未从文档中提取到文本（%d 页没有可提取的文本，可能是扫描件，需要 OCR）", len(result.OCRCandidatePages)))
+			return result, result.Error
+		}
 		result.Error = wrapPhase(PhaseParsing, errors.New("未从文档中提取到内容"))
 		return result, result.Error
 	}
@@ -221,7 +286,10 @@ func (p *Processor) ProcessDocument(
 	raptorEnabled := libraryConfig != nil &&
 		libraryConfig.RaptorLLMProviderID != "" &&
 		libraryConfig.RaptorLLMModelID != ""
-	log.Printf("[Split] semanticEnabled=%v, raptorEnabled=%v", semanticEnabled, raptorEnabled)
+	contextEnabled := libraryConfig != nil &&
+		libraryConfig.ContextLLMProviderID != "" &&
+		libraryConfig.ContextLLMModelID != ""
+	log.Printf("[Split] semanticEnabled=%v, raptorEnabled=%v, contextEnabled=%v", semanticEnabled, raptorEnabled, contextEnabled)
 	splitStart := time.Now()
 	if semanticEnabled {
 		ext := strings.ToLower(filepath.Ext(localPath))
@@ -269,32 +337,45 @@ func (p *Processor) ProcessDocument(
 	// - 先在内存中生成 level-0 节点与向量
 	// - 可选：构建 RAPTOR 摘要节点（level 1/2）与向量
 	// - 最后用一个事务写入 document_nodes + doc_vec（避免处理中间态）
-	level0 := make([]*raptor.DocumentNode, 0, len(chunks))
-	for i, chunk := range chunks {
-		level0 = append(level0, &raptor.DocumentNode{
-			ID:            int64(i + 1), // temp id
-			LibraryID:     libraryConfig.ID,
-			DocumentID:    docID,
-			Content:       chunk.Content,
-			ContentTokens: tokenizeContent(chunk.Content),
-			Level:         0,
-			ParentID:      nil,
-			ChunkOrder:    i,
-		})
-	}
+	level0 := level0Nodes(docID, libraryConfig.ID, chunks, 0)
 	result.SplitTotal = len(level0)
 
 	if onProgress != nil {
 		onProgress("parsing", 100)
 	}
 
+	// 阶段 3：可选上下文增强（为每个分段生成上下文前缀，向量化和分词使用增强后的文本）
+	if contextEnabled {
+		log.Printf("[Context] Starting context enrichment for %d level-0 nodes", len(level0))
+		contextStart := time.Now()
+		if onProgress != nil {
+			onProgress("enriching", 0)
+		}
+		if err := p.enrichNodesWithContext(ctx, libraryConfig, docs, level0, getProviderInfo, func(progress int) {
+			if onProgress != nil {
+				onProgress("enriching", progress)
+			}
+		}); err != nil {
+			result.Error = wrapPhase(PhaseContext, fmt.Errorf("上下文增强失败: %w", err))
+			return result, result.Error
+		}
+		for _, n := range level0 {
+			n.ContentTokens = tokenizeContent(embeddingText(n.ContextPrefix, n.Content))
+		}
+		log.Printf("[Context] Completed in %v", time.Since(contextStart))
+	}
+
+	// 向量化（level-0 与 RAPTOR 摘要）先查向量缓存，分割使用的 embedder 不走缓存
+	nodeEmbedder := p.withEmbeddingCache(ctx, embedder, embeddingConfig)
+	defer finishEmbeddingCache(ctx, nodeEmbedder)
+
 	// 阶段 4：嵌入 level-0 节点（内存中）
 	log.Printf("[Embedding] Starting embedding for %d level-0 nodes", len(level0))
 	embedStart := time.Now()
 	if onProgress != nil {
 		onProgress("embedding", 10)
 	}
-	if err := embedRaptorNodes(ctx, level0, embedder, func(progress int) {
+	if err := embedRaptorNodes(ctx, level0, nodeEmbedder, p.groupSize(), func(progress int) {
 		if onProgress != nil {
 			onProgress("embedding", 10+progress*70/100)
 		}
@@ -313,13 +394,14 @@ func (p *Processor) ProcessDocument(
 	if raptorEnabled {
 		log.Printf("[RAPTOR] Starting RAPTOR tree building for %d nodes", len(allNodes))
 		raptorStart := time.Now()
-		planned, err := p.buildRaptorPlan(ctx, libraryConfig, allNodes, embedder, getProviderInfo)
+		planned, err := p.buildRaptorPlan(ctx, libraryConfig, allNodes, nodeEmbedder, getProviderInfo)
 		if err != nil {
 			log.Printf("[RAPTOR] FAILED: %v", err)
 			result.Error = wrapPhase(PhaseRaptor, fmt.Errorf("RAPTOR 构建失败: %w", err))
 			return result, result.Error
 		}
 		allNodes = planned
+		propagatePageRanges(allNodes)
 		log.Printf("[RAPTOR] Completed in %v, total nodes: %d", time.Since(raptorStart), len(allNodes))
 	}
 
@@ -366,7 +448,6 @@ func (p *Processor) parseDocument(ctx context.Context, localPath string) ([]*sch
 }
 
 // splitDocument 将文档分割成块
-// 分割器选择优先级：Markdown Header Splitter > Semantic Splitter > Recursive Splitter
 func (p *Processor) splitDocument(
 	ctx context.Context,
 	docs []*schema.Document,
@@ -374,6 +455,22 @@ func (p *Processor) splitDocument(
 	libraryConfig *LibraryConfig,
 	embedder embedding.Embedder,
 ) ([]*schema.Document, error) {
+	docSplitter, err := p.newSplitter(ctx, localPath, libraryConfig, embedder)
+	if err != nil {
+		return nil, err
+	}
+
+	return splitAcrossPages(ctx, docSplitter, docs)
+}
+
+// newSplitter 按知识库配置创建分割器
+// 分割器选择优先级：Markdown Header Splitter > Semantic Splitter > Recursive Splitter
+func (p *Processor) newSplitter(
+	ctx context.Context,
+	localPath string,
+	libraryConfig *LibraryConfig,
+	embedder embedding.Embedder,
+) (document.Transformer, error) {
 	cfg := &splitter.Config{
 		FilePath:     localPath, // 传入文件路径，用于判断是否使用 Markdown 分割器
 		ChunkSize:    libraryConfig.ChunkSize,
@@ -388,12 +485,32 @@ func (p *Processor) splitDocument(
 		cfg.SemanticMinChunkSize = 300
 	}
 
-	docSplitter, err := splitter.NewSplitter(ctx, cfg)
-	if err != nil {
-		return nil, err
-	}
+	return splitter.NewSplitter(ctx, cfg)
+}
 
-	return docSplitter.Transform(ctx, docs)
+// level0Nodes 将分段转换为 level-0 节点（内存中），chunk_order 从 startOrder 开始
+func level0Nodes(docID, libraryID int64, chunks []*schema.Document, startOrder int) []*raptor.DocumentNode {
+	nodes := make([]*raptor.DocumentNode, 0, len(chunks))
+	for i, chunk := range chunks {
+		order := startOrder + i
+		// 结构化分割的标题路径作为前缀参与向量化和分词（展示内容保持原文）
+		prefix := headingPathPrefix(chunk.MetaData)
+		page, pageEnd := pageFromMeta(chunk.MetaData), pageEndFromMeta(chunk.MetaData)
+		nodes = append(nodes, &raptor.DocumentNode{
+			ID:            int64(order + 1), // temp id
+			LibraryID:     libraryID,
+			DocumentID:    docID,
+			Content:       chunk.Content,
+			ContentTokens: tokenizeContent(embeddingText(prefix, chunk.Content)),
+			Level:         0,
+			ParentID:      nil,
+			ChunkOrder:    order,
+			ContextPrefix: prefix,
+			PageStart:     page,
+			PageEnd:       pageEnd,
+		})
+	}
+	return nodes
 }
 
 // storeNodes 将文档块作为节点存储到数据库
@@ -446,17 +563,39 @@ func (p *Processor) storeNodes(ctx context.Context, docID, libraryID int64, chun
 
 // createEmbedder 根据配置创建 embedding.Embedder
 func (p *Processor) createEmbedder(ctx context.Context, config *EmbeddingConfig) (embedding.Embedder, error) {
+	p.embedGroupSize = embedGroupSize(config)
 	return einoembed.NewEmbedder(ctx, &einoembed.ProviderConfig{
+		ProviderID:   config.ProviderID,
 		ProviderType: config.ProviderType,
 		APIKey:       config.APIKey,
 		APIEndpoint:  config.APIEndpoint,
 		ModelID:      config.ModelID,
 		Dimension:    config.Dimension,
 		ExtraConfig:  config.ExtraConfig,
+		Batch:        config.Batch,
 	})
 }
 
+// maxEmbedGroupSize 每次交给 embedder 的最大文本数
+const maxEmbedGroupSize = 512
+
+// embedGroupSize 每次交给 embedder 的文本数：足够 embedder 按批次并发请求，又能及时报告进度
+// 上限 maxEmbedGroupSize，避免单组向量占用过多内存、一次事务写入过多
+func embedGroupSize(config *EmbeddingConfig) int {
+	def := einoembed.DefaultBatchConfig(config.ProviderID, config.ProviderType)
+	batchSize := config.Batch.BatchSize
+	if batchSize <= 0 {
+		batchSize = def.BatchSize
+	}
+	parallelism := config.Batch.Parallelism
+	if parallelism <= 0 {
+		parallelism = def.Parallelism
+	}
+	return min(batchSize*parallelism, maxEmbedGroupSize)
+}
+
 // embedNodes 为节点生成嵌入向量并存储
+// 每组向量在一个事务中写入
 func (p *Processor) embedNodes(ctx context.Context, nodes []*DocumentNode, embedder embedding.Embedder, onProgress func(int)) error {
 	if len(nodes) == 0 {
 		log.Printf("[Embedding] No nodes to embed")
@@ -465,9 +604,8 @@ func (p *Processor) embedNodes(ctx context.Context, nodes []*DocumentNode, embed
 
 	log.Printf("[Embedding] Starting embedding for %d nodes", len(nodes))
 
-	// 批量嵌入以提高效率
-	// 注意：通义千问等部分 API 限制 batch size 最大为 10
-	batchSize := 10
+	// 分组交给 embedder，由 embedder 按供应商的批次大小拆分并发请求
+	batchSize := p.groupSize()
 	storedCount := 0
 	for i := 0; i < len(nodes); i += batchSize {
 		end := i + batchSize
@@ -479,7 +617,7 @@ func (p *Processor) embedNodes(ctx context.Context, nodes []*DocumentNode, embed
 		// 收集批量嵌入的内容
 		contents := make([]string, len(batch))
 		for j, node := range batch {
-			contents[j] = node.Content
+			contents[j] = embeddingText(node.ContextPrefix, node.Content)
 		}
 
 		log.Printf("[Embedding] Processing batch %d-%d/%d", i+1, end, len(nodes))
@@ -502,12 +640,13 @@ func (p *Processor) embedNodes(ctx context.Context, nodes []*DocumentNode, embed
 		for j, node := range batch {
 			if j < len(vectors) {
 				node.Vector = vectors[j]
-				if err := p.storeVector(ctx, node.ID, vectors[j]); err != nil {
-					return fmt.Errorf("存储节点 %d 的向量: %w", node.ID, err)
-				}
-				storedCount++
 			}
 		}
+		n, err := p.storeVectors(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("存储批次（从 %d 开始）的向量: %w", i, err)
+		}
+		storedCount += n
 
 		// 报告进度
 		if onProgress != nil {
@@ -520,23 +659,58 @@ func (p *Processor) embedNodes(ctx context.Context, nodes []*DocumentNode, embed
 	return nil
 }
 
-// storeVector 将向量存储到 doc_vec 表
-func (p *Processor) storeVector(ctx context.Context, nodeID int64, vector []float64) error {
-	// 将 []float64 转换为适合 sqlite-vec 的格式
-	// doc_vec 表使用 vec0 扩展
-	vecStr := formatVector(vector)
+// groupSize 每次交给 embedder 的文本数（未创建 embedder 时使用默认批次大小）
+func (p *Processor) groupSize() int {
+	if p.embedGroupSize > 0 {
+		return p.embedGroupSize
+	}
+	return einoembed.DefaultBatchSize
+}
 
-	_, err := p.db.NewRaw(
-		"INSERT INTO doc_vec (id, content) VALUES (?, ?)",
-		nodeID, vecStr,
-	).Exec(ctx)
+// storeVectors 在一个事务中写入一组节点的向量，返回写入的数量
+func (p *Processor) storeVectors(ctx context.Context, nodes []*DocumentNode) (int, error) {
+	stored := 0
+	err := p.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		stored = 0
+		q, _, err := vecstore.Schema(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if len(node.Vector) == 0 {
+				continue
+			}
+			if err := vecstore.Store(ctx, tx, q, node.ID, node.LibraryID, node.Level, node.Vector); err != nil {
+				return fmt.Errorf("节点 %d: %w", node.ID, err)
+			}
+			stored++
+		}
+		return nil
+	})
 	if err != nil {
-		// 如果插入失败，尝试更新
-		_, err = p.db.NewRaw(
-			"UPDATE doc_vec SET content = ? WHERE id = ?",
-			vecStr, nodeID,
-		).Exec(ctx)
+		log.Printf("[Vector] FAILED to store %d vectors: %v", len(nodes), err)
+		return 0, err
 	}
+	return stored, nil
+}
+
+// storeVector 将向量存储到 doc_vec 表
+func (p *Processor) storeVector(ctx context.Context, nodeID int64, vector []float64) error {
+	// doc_vec 表使用 vec0 扩展，library_id / level 从节点读取（用于 KNN 内过滤）
+	err := p.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var node struct {
+			LibraryID int64 `bun:"library_id"`
+			Level     int   `bun:"level"`
+		}
+		if err := tx.NewRaw("SELECT library_id, level FROM document_nodes WHERE id = ?", nodeID).Scan(ctx, &node); err != nil {
+			return err
+		}
+		q, _, err := vecstore.Schema(ctx, tx)
+		if err != nil {
+			return err
+		}
+		return vecstore.Store(ctx, tx, q, nodeID, node.LibraryID, node.Level, vector)
+	})
 
 	// 调试日志：输出向量存储结果
 	if err != nil {
@@ -548,15 +722,6 @@ func (p *Processor) storeVector(ctx context.Context, nodeID int64, vector []floa
 	return err
 }
 
-// formatVector 将向量格式化为 sqlite-vec 存储格式
-func formatVector(vec []float64) string {
-	parts := make([]string, len(vec))
-	for i, v := range vec {
-		parts[i] = fmt.Sprintf("%f", v)
-	}
-	return "[" + strings.Join(parts, ",") + "]"
-}
-
 // buildRaptorTree 构建 RAPTOR 树结构
 func (p *Processor) buildRaptorTree(
 	ctx context.Context,
@@ -574,6 +739,7 @@ func (p *Processor) buildRaptorTree(
 
 	// 创建 LLM 聊天模型
 	llm, err := chatmodel.NewChatModel(ctx, &chatmodel.ProviderConfig{
+		ProviderID:   libraryConfig.RaptorLLMProviderID,
 		ProviderType: providerInfo.ProviderType,
 		APIKey:       providerInfo.APIKey,
 		APIEndpoint:  providerInfo.APIEndpoint,
@@ -671,15 +837,18 @@ func tokenizeContent(content string) string {
 }
 
 // embedRaptorNodes embeds contents for raptor nodes (in-memory, no DB writes).
-func embedRaptorNodes(ctx context.Context, nodes []*raptor.DocumentNode, embedder embedding.Embedder, onProgress func(int)) error {
+// batchSize is the number of texts handed to the embedder per call (it splits them per provider limits).
+func embedRaptorNodes(ctx context.Context, nodes []*raptor.DocumentNode, embedder embedding.Embedder, batchSize int, onProgress func(int)) error {
 	if len(nodes) == 0 {
 		return nil
 	}
 	if embedder == nil {
 		return errors.New("embedder is nil")
 	}
+	if batchSize <= 0 {
+		batchSize = einoembed.DefaultBatchSize
+	}
 
-	batchSize := 10
 	for i := 0; i < len(nodes); i += batchSize {
 		end := i + batchSize
 		if end > len(nodes) {
@@ -689,7 +858,7 @@ func embedRaptorNodes(ctx context.Context, nodes []*raptor.DocumentNode, embedde
 
 		contents := make([]string, len(batch))
 		for j, n := range batch {
-			contents[j] = n.Content
+			contents[j] = embeddingText(n.ContextPrefix, n.Content)
 		}
 
 		vecs, err := embedder.EmbedStrings(ctx, contents)
@@ -725,6 +894,7 @@ func (p *Processor) buildRaptorPlan(
 
 	// 创建 LLM 聊天模型
 	llm, err := chatmodel.NewChatModel(ctx, &chatmodel.ProviderConfig{
+		ProviderID:   libraryConfig.RaptorLLMProviderID,
 		ProviderType: providerInfo.ProviderType,
 		APIKey:       providerInfo.APIKey,
 		APIEndpoint:  providerInfo.APIEndpoint,
@@ -777,32 +947,19 @@ func (p *Processor) persistNodesAndVectors(ctx context.Context, docID int64, nod
 			return err
 		}
 
+		q, _, err := vecstore.Schema(ctx, tx)
+		if err != nil {
+			return err
+		}
+
 		idMap := make(map[int64]int64, len(sorted)) // tempID -> dbID
 
 		for _, n := range sorted {
-			res, err := tx.NewRaw(
-				"INSERT INTO document_nodes (library_id, document_id, content, content_tokens, level, chunk_order) VALUES (?, ?, ?, ?, ?, ?)",
-				n.LibraryID, n.DocumentID, n.Content, n.ContentTokens, n.Level, n.ChunkOrder,
-			).Exec(ctx)
-			if err != nil {
-				return err
-			}
-			dbID, err := res.LastInsertId()
+			dbID, err := insertNodeWithVector(ctx, tx, q, n)
 			if err != nil {
 				return err
 			}
 			idMap[n.ID] = dbID
-
-			// store vector if exists
-			if len(n.Vector) > 0 {
-				vecStr := formatVector(n.Vector)
-				if _, err := tx.NewRaw("INSERT INTO doc_vec (id, content) VALUES (?, ?)", dbID, vecStr).Exec(ctx); err != nil {
-					// fallback update
-					if _, err2 := tx.NewRaw("UPDATE doc_vec SET content = ? WHERE id = ?", vecStr, dbID).Exec(ctx); err2 != nil {
-						return err
-					}
-				}
-			}
 		}
 
 		// update parent relationships
@@ -824,12 +981,37 @@ func (p *Processor) persistNodesAndVectors(ctx context.Context, docID int64, nod
 	})
 }
 
+// insertNodeWithVector inserts a node (and its vector if present) within tx and returns the new id.
+// q is the quantization of the current doc_vec table (see vecstore.Schema).
+func insertNodeWithVector(ctx context.Context, tx bun.Tx, q vecstore.Quantization, n *raptor.DocumentNode) (int64, error) {
+	res, err := tx.NewRaw(
+		"INSERT INTO document_nodes (library_id, document_id, content, content_tokens, level, chunk_order, context_prefix, page_start, page_end) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		n.LibraryID, n.DocumentID, n.Content, n.ContentTokens, n.Level, n.ChunkOrder, n.ContextPrefix, n.PageStart, n.PageEnd,
+	).Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	dbID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// store vector if exists
+	if len(n.Vector) > 0 {
+		if err := vecstore.Store(ctx, tx, q, dbID, n.LibraryID, n.Level, n.Vector); err != nil {
+			return 0, err
+		}
+	}
+	return dbID, nil
+}
+
 // GetLibraryConfig 从数据库获取知识库配置
 func GetLibraryConfig(ctx context.Context, db *bun.DB, libraryID int64) (*LibraryConfig, error) {
 	var config LibraryConfig
 	err := db.NewSelect().
 		TableExpr("library").
-		Column("id", "chunk_size", "chunk_overlap", "semantic_segmentation_enabled", "raptor_llm_provider_id", "raptor_llm_model_id").
+		Column("id", "chunk_size", "chunk_overlap", "semantic_segmentation_enabled", "raptor_llm_provider_id", "raptor_llm_model_id",
+			"context_llm_provider_id", "context_llm_model_id").
 		Where("id = ?", libraryID).
 		Scan(ctx, &config)
 	if err != nil {
@@ -847,16 +1029,17 @@ func GetEmbeddingConfig(ctx context.Context, db *bun.DB) (*EmbeddingConfig, erro
 		Key   string         `bun:"key"`
 		Value sql.NullString `bun:"value"`
 	}
-	rows := make([]settingRow, 0, 3)
+	rows := make([]settingRow, 0, 4)
 	err := db.NewSelect().
 		TableExpr("settings").
 		Column("key", "value").
-		Where("key IN (?)", bun.In([]string{"embedding_provider_id", "embedding_model_id", "embedding_dimension"})).
+		Where("key IN (?)", bun.In([]string{"embedding_provider_id", "embedding_model_id", "embedding_dimension", "provider_embedding_batch"})).
 		Scan(ctx, &rows)
 	if err != nil {
 		return nil, err
 	}
 
+	var batchConfigs map[string]einoembed.BatchConfig
 	for _, r := range rows {
 		if !r.Value.Valid {
 			continue
@@ -870,8 +1053,12 @@ func GetEmbeddingConfig(ctx context.Context, db *bun.DB) (*EmbeddingConfig, erro
 			if dim, err := strconv.Atoi(strings.TrimSpace(r.Value.String)); err == nil && dim > 0 {
 				config.Dimension = dim
 			}
+		case "provider_embedding_batch":
+			// 非法 JSON 视为未配置
+			_ = json.Unmarshal([]byte(r.Value.String), &batchConfigs)
 		}
 	}
+	config.Batch = batchConfigs[config.ProviderID]
 
 	if config.ProviderID == "" || config.ModelID == "" {
 		return nil, errors.New("嵌入模型未配置")
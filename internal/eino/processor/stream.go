@@ -0,0 +1,458 @@
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/components/document/parser"
+	"github.com/cloudwego/eino/schema"
+	"github.com/uptrace/bun"
+
+	einoparser "chatclaw/internal/eino/parser"
+	pdfparser "chatclaw/internal/eino/parser/pdf"
+	"chatclaw/internal/eino/raptor"
+	"chatclaw/internal/sqlite/vecstore"
+)
+
+const (
+	// streamingMinFileSize 文件达到该大小时走流式处理
+	streamingMinFileSize = 32 << 20
+	// streamingMinPages PDF 达到该页数时走流式处理（文字为主的 PDF 页数多但文件可能不大）
+	streamingMinPages = 500
+	// streamBatchChars 每批送去分割的文本量（字节），决定单批占用的内存
+	streamBatchChars = 256 * 1024
+	// streamQueueSize 解析最多领先向量化的批次数，超过后解析阻塞等待（背压）
+	streamQueueSize = 2
+)
+
+// sourceBatch 一批待分割的解析结果
+type sourceBatch struct {
+	index    int
+	docs     []*schema.Document
+	position float64 // 该批次末尾在整个文件中的位置（0~1），用于报告进度
+}
+
+// ingestCheckpoint 流式入库断点：前 BatchCount 批解析结果（共 ChunkCount 个分段）已向量化并入库
+type ingestCheckpoint struct {
+	Signature  string
+	BatchCount int
+	ChunkCount int
+}
+
+// 流式处理时跳过的步骤（需要整篇文档），记录在处理结果中提示用户
+const (
+	SkippedStepContext = "context_enrichment"
+	SkippedStepRaptor  = "raptor"
+)
+
+// shouldStream 判断文档是否按批流式处理：文件足够大，或 PDF 页数足够多
+func shouldStream(localPath string, fileInfo os.FileInfo) bool {
+	if fileInfo.Size() >= streamingMinFileSize {
+		return true
+	}
+	if strings.ToLower(filepath.Ext(localPath)) != ".pdf" {
+		return false
+	}
+	pages, err := pdfparser.PageCount(localPath)
+	if err != nil {
+		// 读取失败时按普通流程处理，由解析阶段报告错误
+		return false
+	}
+	return pages >= streamingMinPages
+}
+
+// ErrTooLargeToParse 文件达到流式处理阈值，但格式不支持流式解析：整篇解析会把文件完整读入内存，因此拒绝处理
+var ErrTooLargeToParse = errors.New("file is too large to parse without streaming")
+
+// MaxNonStreamableFileSize 不支持流式解析的格式（docx、xlsx、pptx、html、epub、md 等）允许的最大文件大小
+const MaxNonStreamableFileSize = streamingMinFileSize
+
+// CheckFileSize 检查文件能否在有限内存内处理：超过 MaxNonStreamableFileSize 的文件必须是支持流式解析的格式
+func CheckFileSize(localPath string, size int64) error {
+	ext := strings.ToLower(filepath.Ext(localPath))
+	if size >= MaxNonStreamableFileSize && !einoparser.Streamable(ext) {
+		return fmt.Errorf("%w: %s file of %d bytes", ErrTooLargeToParse, ext, size)
+	}
+	return nil
+}
+
+// countingReader 统计已读取的字节数
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// processDocumentStreaming 大文件流式处理：解析 → 分割 → 向量化 → 入库按批进行，内存占用只与批次大小有关。
+// 每批入库与断点更新在同一事务中完成，任务中断（崩溃、退出、失败重试）后跳过已入库的批次继续处理。
+// 上下文增强和 RAPTOR 需要整篇文档，流式处理时不执行，跳过的步骤记录在 ProcessResult.SkippedSteps 中。
+func (p *Processor) processDocumentStreaming(
+	ctx context.Context,
+	docID int64,
+	localPath string,
+	fileInfo os.FileInfo,
+	libraryConfig *LibraryConfig,
+	embeddingConfig *EmbeddingConfig,
+	onProgress func(phase string, progress int),
+) (*ProcessResult, error) {
+	result := &ProcessResult{}
+	log.Printf("[Stream] docID=%d size=%d, processing in batches", docID, fileInfo.Size())
+	if libraryConfig.ContextLLMModelID != "" {
+		result.SkippedSteps = append(result.SkippedSteps, SkippedStepContext)
+	}
+	if libraryConfig.RaptorLLMModelID != "" {
+		result.SkippedSteps = append(result.SkippedSteps, SkippedStepRaptor)
+	}
+	if len(result.SkippedSteps) > 0 {
+		log.Printf("[Stream] docID=%d skipped for streamed documents: %v", docID, result.SkippedSteps)
+	}
+
+	if onProgress != nil {
+		onProgress("parsing", 10)
+	}
+
+	embedder, err := p.createEmbedder(ctx, embeddingConfig)
+	if err != nil {
+		result.Error = wrapPhase(PhaseParsing, fmt.Errorf("创建 embedder 失败: %w", err))
+		return result, result.Error
+	}
+	nodeEmbedder := p.withEmbeddingCache(ctx, embedder, embeddingConfig)
+	defer finishEmbeddingCache(ctx, nodeEmbedder)
+
+	docSplitter, err := p.newSplitter(ctx, localPath, libraryConfig, embedder)
+	if err != nil {
+		result.Error = wrapPhase(PhaseSplitting, fmt.Errorf("分割失败: %w", err))
+		return result, result.Error
+	}
+
+	checkpoint, err := p.loadIngestCheckpoint(ctx, docID, ingestSignature(fileInfo, libraryConfig, embeddingConfig))
+	if err != nil {
+		result.Error = wrapPhase(PhasePersist, fmt.Errorf("读取处理断点失败: %w", err))
+		return result, result.Error
+	}
+	if checkpoint.BatchCount > 0 {
+		log.Printf("[Stream] docID=%d resuming after batch %d (%d chunks already stored)", docID, checkpoint.BatchCount, checkpoint.ChunkCount)
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		result.Error = wrapPhase(PhaseParsing, fmt.Errorf("解析失败: 打开文件: %w", err))
+		return result, result.Error
+	}
+	defer file.Close()
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 解析在独立协程中进行，通过有界通道交给分割/向量化，向量化跟不上时解析暂停
+	batches := make(chan *sourceBatch, streamQueueSize)
+	var parseErr error
+	go func() {
+		defer close(batches)
+		parseErr = p.streamSourceBatches(streamCtx, localPath, &countingReader{r: file}, fileInfo.Size(), batches)
+	}()
+
+	report := func(position float64) {
+		if onProgress != nil {
+			onProgress("embedding", 5+int(position*94))
+		}
+	}
+
+	chunkCount := checkpoint.ChunkCount
+	lastPosition := 0.0
+	// carry 上一批末尾的文本，拼到下一批开头，使批次边界处的分段之间也有重叠
+	var carry *schema.Document
+	var procErr error
+	for batch := range batches {
+		for _, d := range batch.docs {
+			result.WordTotal += utf8.RuneCountInString(d.Content)
+		}
+		docs, pages := splitOCRCandidates(batch.docs)
+		result.OCRCandidatePages = append(result.OCRCandidatePages, pages...)
+		prevCarry := carry
+		carry = batchTail(docs, libraryConfig.ChunkOverlap)
+
+		// 已入库的批次只统计字数和 OCR 候选页
+		if batch.index < checkpoint.BatchCount {
+			lastPosition = batch.position
+			continue
+		}
+		docs = withCarry(prevCarry, docs)
+
+		var nodes []*raptor.DocumentNode
+		if len(docs) > 0 {
+			chunks, err := splitAcrossPages(streamCtx, docSplitter, docs)
+			if err != nil {
+				procErr = wrapPhase(PhaseSplitting, fmt.Errorf("分割失败: %w", err))
+				break
+			}
+			nodes = level0Nodes(docID, libraryConfig.ID, chunks, chunkCount)
+
+			from, to := lastPosition, batch.position
+			if err := embedRaptorNodes(streamCtx, nodes, nodeEmbedder, p.groupSize(), func(progress int) {
+				report(from + (to-from)*float64(progress)/100)
+			}); err != nil {
+				procErr = wrapPhase(PhaseEmbedding, fmt.Errorf("嵌入失败: %w", err))
+				break
+			}
+		}
+
+		if err := p.commitIngestBatch(streamCtx, docID, batch.index+1, chunkCount+len(nodes), nodes); err != nil {
+			procErr = wrapPhase(PhasePersist, fmt.Errorf("入库失败: %w", err))
+			break
+		}
+		chunkCount += len(nodes)
+		lastPosition = batch.position
+		report(lastPosition)
+	}
+
+	// 出错提前退出时停止解析并等待解析协程结束
+	cancel()
+	for range batches {
+	}
+	if procErr == nil && parseErr != nil {
+		procErr = wrapPhase(PhaseParsing, fmt.Errorf("解析失败: %w", parseErr))
+	}
+	if procErr != nil {
+		result.Error = procErr
+		return result, result.Error
+	}
+
+	if len(result.OCRCandidatePages) > 0 {
+		log.Printf("[Parse] %d pages have no extractable text: %v", len(result.OCRCandidatePages), result.OCRCandidatePages)
+	}
+	if chunkCount == 0 {
+		if len(result.OCRCandidatePages) > 0 {
+			result.Error = wrapPhase(PhaseParsing, fmt.Errorf("未从文档中提取到文本（%d 页没有可提取的文本，可能是扫描件，需要 OCR）", len(result.OCRCandidatePages)))
+			return result, result.Error
+		}
+		result.Error = wrapPhase(PhaseParsing, errors.New("未从文档中提取到内容"))
+		return result, result.Error
+	}
+	result.SplitTotal = chunkCount
+
+	// 处理完成，删除断点
+	if _, err := p.db.NewDelete().
+		TableExpr("document_ingest_checkpoints").
+		Where("document_id = ?", docID).
+		Exec(ctx); err != nil {
+		log.Printf("[Stream] WARNING: delete checkpoint failed docID=%d error=%v", docID, err)
+	}
+
+	if onProgress != nil {
+		onProgress("embedding", 100)
+	}
+
+	if err := p.updateDocumentStats(ctx, docID, result.WordTotal, result.SplitTotal); err != nil {
+		log.Printf("[Processor] WARNING: update document stats failed docID=%d error=%v", docID, err)
+	}
+
+	log.Printf("[Stream] docID=%d completed: %d words, %d chunks", docID, result.WordTotal, result.SplitTotal)
+	return result, nil
+}
+
+// batchTail 取一批文档末尾约 overlap 个字符作为下一批的开头（从词边界开始），没有重叠配置时返回 nil
+func batchTail(docs []*schema.Document, overlap int) *schema.Document {
+	if overlap <= 0 {
+		return nil
+	}
+	for i := len(docs) - 1; i >= 0; i-- {
+		content := strings.TrimSpace(docs[i].Content)
+		if content == "" {
+			continue
+		}
+		runes := []rune(content)
+		if len(runes) > overlap {
+			tail := string(runes[len(runes)-overlap:])
+			if j := strings.IndexAny(tail, " \t\n"); j >= 0 && j < len(tail)-1 {
+				tail = tail[j+1:]
+			}
+			content = tail
+		}
+		return &schema.Document{ID: docs[i].ID, Content: content, MetaData: docs[i].MetaData}
+	}
+	return nil
+}
+
+// withCarry 把上一批的末尾文本放到本批开头：分页文档作为单独一页（保留原页码，分段页码范围仍然准确），
+// 其他文档拼到第一个文档前
+func withCarry(carry *schema.Document, docs []*schema.Document) []*schema.Document {
+	if carry == nil || len(docs) == 0 {
+		return docs
+	}
+	if pageFromMeta(carry.MetaData) > 0 && pageFromMeta(docs[0].MetaData) > 0 {
+		return append([]*schema.Document{carry}, docs...)
+	}
+	first := *docs[0]
+	first.Content = carry.Content + pageSeparator + first.Content
+	return append([]*schema.Document{&first}, docs[1:]...)
+}
+
+// streamSourceBatches 流式解析文件，按 streamBatchChars 聚合成批次发送到 out（out 满时阻塞）
+// 不支持流式解析的格式在 ProcessDocument 中已被 CheckFileSize 拒绝，这里不再回退到整篇解析
+func (p *Processor) streamSourceBatches(ctx context.Context, localPath string, reader *countingReader, size int64, out chan<- *sourceBatch) error {
+	batch := &sourceBatch{}
+	batchChars := 0
+
+	send := func() error {
+		next := &sourceBatch{index: batch.index + 1}
+		select {
+		case out <- batch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		batch = next
+		batchChars = 0
+		return nil
+	}
+	emitAt := func(doc *schema.Document, position float64) error {
+		batch.docs = append(batch.docs, doc)
+		batch.position = min(position, 1)
+		batchChars += len(doc.Content)
+		if batchChars >= streamBatchChars {
+			return send()
+		}
+		return nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(localPath))
+	sp, ok := p.streamParsers[ext]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTooLargeToParse, ext)
+	}
+	err := sp.ParseStream(ctx, reader, func(doc *schema.Document) error {
+		return emitAt(doc, streamPosition(doc, reader.n.Load(), size))
+	}, parser.WithURI(localPath))
+	if err != nil {
+		return err
+	}
+
+	if len(batch.docs) > 0 {
+		return send()
+	}
+	return nil
+}
+
+// streamPosition 估算文档在文件中的位置：分页文档按页码，其他按已读取的字节数
+func streamPosition(doc *schema.Document, read, size int64) float64 {
+	if page := pageFromMeta(doc.MetaData); page > 0 {
+		if total, ok := doc.MetaData[pdfparser.MetaKeyTotalPages].(int); ok && total > 0 {
+			return float64(page) / float64(total)
+		}
+	}
+	if size <= 0 {
+		return 0
+	}
+	return float64(read) / float64(size)
+}
+
+// ingestSignature 断点签名：文件或影响分段/向量的配置变化后，旧断点作废
+func ingestSignature(fileInfo os.FileInfo, libraryConfig *LibraryConfig, embeddingConfig *EmbeddingConfig) string {
+	return fmt.Sprintf("size=%d;mtime=%d;chunk=%d/%d;semantic=%v;embedding=%s/%s/%d",
+		fileInfo.Size(), fileInfo.ModTime().UnixNano(),
+		libraryConfig.ChunkSize, libraryConfig.ChunkOverlap, libraryConfig.SemanticSegmentationEnabled,
+		embeddingConfig.ProviderID, embeddingConfig.ModelID, embeddingConfig.Dimension)
+}
+
+// loadIngestCheckpoint 读取断点并清理断点之后的残留节点；
+// 没有断点、签名不一致或已入库的节点与断点对不上时，清空该文档的节点从头开始
+func (p *Processor) loadIngestCheckpoint(ctx context.Context, docID int64, signature string) (*ingestCheckpoint, error) {
+	var cp ingestCheckpoint
+	err := p.db.NewSelect().
+		TableExpr("document_ingest_checkpoints").
+		Column("signature", "batch_count", "chunk_count").
+		Where("document_id = ?", docID).
+		Scan(ctx, &cp)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if err == nil && cp.Signature == signature && cp.BatchCount > 0 {
+		var stored int
+		if err := p.db.NewSelect().
+			TableExpr("document_nodes").
+			ColumnExpr("COUNT(*)").
+			Where("document_id = ?", docID).
+			Where("level = 0").
+			Where("chunk_order < ?", cp.ChunkCount).
+			Scan(ctx, &stored); err != nil {
+			return nil, err
+		}
+		if stored == cp.ChunkCount {
+			err := p.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+				return deleteNodesFrom(ctx, tx, docID, cp.ChunkCount)
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &cp, nil
+		}
+	}
+
+	now := time.Now().UTC().Format(time.DateTime)
+	err = p.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := deleteNodesFrom(ctx, tx, docID, 0); err != nil {
+			return err
+		}
+		_, err := tx.NewRaw(
+			"INSERT OR REPLACE INTO document_ingest_checkpoints (document_id, signature, batch_count, chunk_count, created_at, updated_at) VALUES (?, ?, 0, 0, ?, ?)",
+			docID, signature, now, now,
+		).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ingestCheckpoint{Signature: signature}, nil
+}
+
+// deleteNodesFrom 删除文档中 chunk_order >= fromChunk 的节点及其向量（以及所有摘要节点）
+func deleteNodesFrom(ctx context.Context, tx bun.Tx, docID int64, fromChunk int) error {
+	// doc_vec has no FK cascade
+	if _, err := tx.NewRaw(
+		"DELETE FROM doc_vec WHERE id IN (SELECT id FROM document_nodes WHERE document_id = ? AND (chunk_order >= ? OR level > 0))",
+		docID, fromChunk,
+	).Exec(ctx); err != nil {
+		return err
+	}
+	_, err := tx.NewRaw(
+		"DELETE FROM document_nodes WHERE document_id = ? AND (chunk_order >= ? OR level > 0)",
+		docID, fromChunk,
+	).Exec(ctx)
+	return err
+}
+
+// commitIngestBatch 在一个事务中写入一批节点和向量并推进断点
+func (p *Processor) commitIngestBatch(ctx context.Context, docID int64, batchCount, chunkCount int, nodes []*raptor.DocumentNode) error {
+	return p.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		q, _, err := vecstore.Schema(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			if _, err := insertNodeWithVector(ctx, tx, q, n); err != nil {
+				return err
+			}
+		}
+		_, err = tx.NewRaw(
+			"UPDATE document_ingest_checkpoints SET batch_count = ?, chunk_count = ?, updated_at = ? WHERE document_id = ?",
+			batchCount, chunkCount, time.Now().UTC().Format(time.DateTime), docID,
+		).Exec(ctx)
+		return err
+	})
+}
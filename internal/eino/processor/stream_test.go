@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLargeFile 创建一个刚好超过流式处理阈值的文件；content 为空时创建稀疏文件
+func writeLargeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if content == "" {
+		if err := f.Truncate(streamingMinFileSize + 1); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	for written := 0; written <= streamingMinFileSize; written += len(content) {
+		if _, err := f.WriteString(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// TestProcessDocumentRejectsLargeNonStreamableFiles 超过阈值、不支持流式解析的格式在读取前被拒绝，
+// 不会回退到整篇解析
+func TestProcessDocumentRejectsLargeNonStreamableFiles(t *testing.T) {
+	p, err := NewProcessor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"large.docx", "large.xlsx", "large.pptx", "large.html", "large.epub", "large.md"} {
+		t.Run(name, func(t *testing.T) {
+			path := writeLargeFile(t, name, "")
+			result, err := p.ProcessDocument(context.Background(), 1, path, &LibraryConfig{}, &EmbeddingConfig{}, nil, nil)
+			if !errors.Is(err, ErrTooLargeToParse) {
+				t.Fatalf("error = %v, want ErrTooLargeToParse", err)
+			}
+			var pe *PhaseError
+			if !errors.As(err, &pe) || pe.Phase != PhaseParsing || pe.Retryable() {
+				t.Fatalf("error = %#v, want a non-retryable parsing error", err)
+			}
+			if result == nil || result.Error != err {
+				t.Fatalf("result.Error = %v, want %v", result, err)
+			}
+		})
+	}
+}
+
+func TestCheckFileSize(t *testing.T) {
+	tests := []struct {
+		path    string
+		size    int64
+		wantErr bool
+	}{
+		{"small.docx", MaxNonStreamableFileSize - 1, false},
+		{"large.docx", MaxNonStreamableFileSize, true},
+		{"large.MD", MaxNonStreamableFileSize + 1, true},
+		{"large.pdf", MaxNonStreamableFileSize * 4, false},
+		{"large.csv", MaxNonStreamableFileSize * 4, false},
+		{"large.TXT", MaxNonStreamableFileSize * 4, false},
+	}
+	for _, tt := range tests {
+		err := CheckFileSize(tt.path, tt.size)
+		if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrTooLargeToParse)) {
+			t.Errorf("CheckFileSize(%s, %d) = %v, wantErr %v", tt.path, tt.size, err, tt.wantErr)
+		}
+	}
+}
+
+// TestStreamSourceBatchesLargeText 超过阈值的文本文件边读边分批：第一批送出时文件还没有读完
+func TestStreamSourceBatchesLargeText(t *testing.T) {
+	p, err := NewProcessor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeLargeFile(t, "large.txt", strings.Repeat("streaming keeps memory bounded. ", 32)+"\n\n")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckFileSize(path, info.Size()); err != nil || !shouldStream(path, info) {
+		t.Fatalf("large .txt should be streamed: check=%v stream=%v", err, shouldStream(path, info))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reader := &countingReader{r: f}
+
+	// 不读取通道，解析在第一批之后阻塞（背压）
+	batches := make(chan *sourceBatch)
+	done := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- p.streamSourceBatches(ctx, path, reader, info.Size(), batches) }()
+
+	first := <-batches
+	if first.index != 0 || len(first.docs) == 0 {
+		t.Fatalf("unexpected first batch: index=%d docs=%d", first.index, len(first.docs))
+	}
+	if read := reader.n.Load(); read >= info.Size() {
+		t.Fatalf("read %d of %d bytes before the first batch was consumed", read, info.Size())
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("streamSourceBatches error = %v, want context.Canceled", err)
+	}
+}
@@ -21,6 +21,11 @@ type DocumentNode struct {
 	ParentID      *int64
 	ChunkOrder    int
 	Vector        []float64
+	// ContextPrefix 上下文增强前缀（仅 level-0 节点，用于向量化和分词，不参与展示）
+	ContextPrefix string
+	// PageStart/PageEnd 节点覆盖的页码范围（从 1 开始，0 表示无页码）
+	PageStart int
+	PageEnd   int
 }
 
 // Config RAPTOR 构建器的配置
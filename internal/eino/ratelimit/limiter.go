@@ -0,0 +1,243 @@
+// Package ratelimit 按供应商限制模型调用的频率和并发：每分钟请求数、每分钟 token 数、最大并发，
+// 并在收到 429 / Retry-After 时让同一供应商的所有请求一起暂停。
+package ratelimit
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// window 限流统计窗口
+const window = time.Minute
+
+// Limits 单个供应商的限流配置，0 表示不限制
+type Limits struct {
+	RPM            int `json:"rpm"`             // 每分钟请求数
+	TPM            int `json:"tpm"`             // 每分钟 token 数（按请求体大小估算）
+	MaxConcurrency int `json:"max_concurrency"` // 最大并发请求数（流式响应在读取结束前一直占用）
+}
+
+// State 供应商当前的限流状态
+type State struct {
+	ProviderID         string     `json:"provider_id"`
+	Limits             Limits     `json:"limits"`
+	InFlight           int        `json:"in_flight"`            // 正在进行的请求数
+	Waiting            int        `json:"waiting"`              // 排队等待的请求数
+	RequestsLastMinute int        `json:"requests_last_minute"` // 最近一分钟的请求数
+	TokensLastMinute   int        `json:"tokens_last_minute"`   // 最近一分钟估算的 token 数
+	ThrottledUntil     *time.Time `json:"throttled_until,omitempty"`
+	RateLimitedTotal   int64      `json:"rate_limited_total"` // 累计收到的限流响应数
+}
+
+type usage struct {
+	at     time.Time
+	tokens int
+}
+
+// Limiter 单个供应商的限流器，同一供应商的所有 embedder / chat model 共用
+type Limiter struct {
+	id string
+
+	mu           sync.Mutex
+	limits       Limits
+	inFlight     int
+	waiting      int
+	recent       []usage // 最近一分钟的请求
+	blockedUntil time.Time
+	rateLimited  int64
+	notify       chan struct{} // 状态变化（释放并发、调整配置）时关闭，唤醒等待者
+}
+
+func newLimiter(id string) *Limiter {
+	return &Limiter{id: id, notify: make(chan struct{})}
+}
+
+// wakeLocked 唤醒所有等待者重新检查（调用方持有锁）
+func (l *Limiter) wakeLocked() {
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// pruneLocked 移除统计窗口外的请求（调用方持有锁）
+func (l *Limiter) pruneLocked(now time.Time) {
+	i := 0
+	for i < len(l.recent) && now.Sub(l.recent[i].at) >= window {
+		i++
+	}
+	if i > 0 {
+		l.recent = append(l.recent[:0], l.recent[i:]...)
+	}
+}
+
+// waitLocked 计算还需等待多久才能发出请求；0 表示可以立即发出，-1 表示需等待并发释放
+func (l *Limiter) waitLocked(now time.Time, tokens int) time.Duration {
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+	if l.limits.MaxConcurrency > 0 && l.inFlight >= l.limits.MaxConcurrency {
+		return -1
+	}
+	if l.limits.RPM > 0 && len(l.recent) >= l.limits.RPM {
+		return l.recent[0].at.Add(window).Sub(now)
+	}
+	if l.limits.TPM > 0 && len(l.recent) > 0 {
+		used := 0
+		for _, u := range l.recent {
+			used += u.tokens
+		}
+		// 单个请求超过 TPM 时，等窗口清空后放行，避免永久阻塞
+		if used+tokens > l.limits.TPM {
+			return l.recent[0].at.Add(window).Sub(now)
+		}
+	}
+	return 0
+}
+
+// Acquire 等待直到可以发出一个估算为 tokens 的请求，返回的 release 在请求结束时调用
+func (l *Limiter) Acquire(ctx context.Context, tokens int) (release func(), err error) {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.pruneLocked(now)
+		wait := l.waitLocked(now, tokens)
+		if wait == 0 {
+			l.inFlight++
+			l.recent = append(l.recent, usage{at: now, tokens: tokens})
+			l.mu.Unlock()
+
+			var once sync.Once
+			return func() {
+				once.Do(func() {
+					l.mu.Lock()
+					l.inFlight--
+					l.wakeLocked()
+					l.mu.Unlock()
+				})
+			}, nil
+		}
+		notify := l.notify
+		l.waiting++
+		l.mu.Unlock()
+
+		var (
+			timer *time.Timer
+			fired <-chan time.Time
+		)
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			fired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-fired:
+		case <-notify:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Throttle 收到限流响应后暂停该供应商的所有请求 d 时长
+func (l *Limiter) Throttle(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rateLimited++
+	if until := time.Now().Add(d); until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// SetLimits 更新限流配置，立即对等待中的请求生效
+func (l *Limiter) SetLimits(limits Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits = limits
+	l.wakeLocked()
+}
+
+// State 返回当前限流状态
+func (l *Limiter) State() State {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.pruneLocked(now)
+
+	st := State{
+		ProviderID:         l.id,
+		Limits:             l.limits,
+		InFlight:           l.inFlight,
+		Waiting:            l.waiting,
+		RequestsLastMinute: len(l.recent),
+		RateLimitedTotal:   l.rateLimited,
+	}
+	for _, u := range l.recent {
+		st.TokensLastMinute += u.tokens
+	}
+	if now.Before(l.blockedUntil) {
+		until := l.blockedUntil
+		st.ThrottledUntil = &until
+	}
+	return st
+}
+
+var (
+	mu       sync.Mutex
+	limiters = make(map[string]*Limiter)
+)
+
+// ProviderKey 限流器的键：优先使用供应商 ID，未提供时按供应商类型和地址区分
+func ProviderKey(providerID, providerType, endpoint string) string {
+	if providerID != "" {
+		return providerID
+	}
+	return providerType + "@" + endpoint
+}
+
+// Get 返回供应商的限流器（不存在时创建一个不限制的）
+func Get(providerID string) *Limiter {
+	mu.Lock()
+	defer mu.Unlock()
+
+	l, ok := limiters[providerID]
+	if !ok {
+		l = newLimiter(providerID)
+		limiters[providerID] = l
+	}
+	return l
+}
+
+// Configure 设置供应商的限流配置
+func Configure(providerID string, limits Limits) {
+	Get(providerID).SetLimits(limits)
+}
+
+// States 返回所有供应商的限流状态（按供应商 ID 排序）
+func States() []State {
+	mu.Lock()
+	list := make([]*Limiter, 0, len(limiters))
+	for _, l := range limiters {
+		list = append(list, l)
+	}
+	mu.Unlock()
+
+	out := make([]State, 0, len(list))
+	for _, l := range list {
+		out = append(out, l.State())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ProviderID < out[j].ProviderID })
+	return out
+}
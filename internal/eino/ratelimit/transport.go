@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxRetries 收到限流响应后最多自动重试的次数
+	maxRetries = 4
+	// maxRetryAfter Retry-After 的上限，避免异常响应让供应商长时间不可用
+	maxRetryAfter = 5 * time.Minute
+)
+
+// NewHTTPClient 创建经过供应商限流的 HTTP 客户端，用于 embedder / chat model 的 HTTPClient 配置
+// timeout 只计算真正请求的时间，不包含排队等待限流的时间；0 表示不限制
+func NewHTTPClient(providerID string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &transport{
+			base:    http.DefaultTransport,
+			limiter: Get(providerID),
+			timeout: timeout,
+		},
+	}
+}
+
+// transport 在发送请求前向限流器申请配额；收到 429 时按 Retry-After 暂停整个供应商并重试
+type transport struct {
+	base    http.RoundTripper
+	limiter *Limiter
+	timeout time.Duration
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tokens := estimateTokens(req)
+
+	for attempt := 0; ; attempt++ {
+		release, err := t.limiter.Acquire(req.Context(), tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		r := req
+		if attempt > 0 {
+			r = req.Clone(req.Context())
+			if req.GetBody != nil {
+				if r.Body, err = req.GetBody(); err != nil {
+					release()
+					return nil, err
+				}
+			}
+		}
+		cancel := context.CancelFunc(func() {})
+		if t.timeout > 0 {
+			var ctx context.Context
+			ctx, cancel = context.WithTimeout(r.Context(), t.timeout)
+			r = r.WithContext(ctx)
+		}
+
+		resp, err := t.base.RoundTrip(r)
+		if err != nil {
+			cancel()
+			release()
+			return nil, err
+		}
+
+		if !isRateLimited(resp) {
+			// 流式响应读取结束（关闭 body）后才释放并发占用
+			resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() {
+				cancel()
+				release()
+			}}
+			return resp, nil
+		}
+
+		delay := retryAfter(resp.Header, attempt)
+		t.limiter.Throttle(delay)
+
+		canRetry := attempt < maxRetries && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+		if !canRetry {
+			resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() {
+				cancel()
+				release()
+			}}
+			return resp, nil
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		cancel()
+		release()
+	}
+}
+
+// isRateLimited 429，或带 Retry-After 的 503
+func isRateLimited(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		return resp.Header.Get("Retry-After") != ""
+	default:
+		return false
+	}
+}
+
+// retryAfter 解析 Retry-After（秒数或 HTTP 日期）及 OpenAI 的 retry-after-ms；缺失时指数退避
+func retryAfter(h http.Header, attempt int) time.Duration {
+	var d time.Duration
+	if v := strings.TrimSpace(h.Get("Retry-After-Ms")); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			d = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if v := strings.TrimSpace(h.Get("Retry-After")); d == 0 && v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+			d = time.Duration(secs * float64(time.Second))
+		} else if at, err := http.ParseTime(v); err == nil {
+			d = time.Until(at)
+		}
+	}
+	if d <= 0 {
+		d = time.Second << min(attempt, 5)
+	}
+	return min(d, maxRetryAfter)
+}
+
+// estimateTokens 按请求体大小粗略估算 token 数（约 4 字节一个 token）
+func estimateTokens(req *http.Request) int {
+	if req.ContentLength <= 0 {
+		return 0
+	}
+	return int(req.ContentLength/4) + 1
+}
+
+// releaseBody 关闭时释放限流占用
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
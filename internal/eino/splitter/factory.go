@@ -5,7 +5,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/cloudwego/eino-ext/components/document/transformer/splitter/markdown"
 	"github.com/cloudwego/eino-ext/components/document/transformer/splitter/recursive"
 	"github.com/cloudwego/eino-ext/components/document/transformer/splitter/semantic"
 	"github.com/cloudwego/eino/components/document"
@@ -47,8 +46,21 @@ var DefaultSeparators = []string{
 	"",     // 逐字符分割
 }
 
+// structuredExts 使用结构化（按标题）分割的文件类型
+// docx/odt/html/epub 解析器会把标题样式 / h 标签转换为 Markdown 标题
+var structuredExts = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".docx":     true,
+	".odt":      true,
+	".html":     true,
+	".htm":      true,
+	".epub":     true,
+}
+
 // NewSplitter 根据配置创建新的文档分割器
-// 优先级：Markdown Header Splitter > Semantic Splitter > Recursive Splitter
+// 优先级：结构化分割（Markdown/DOCX/HTML 标题）> Semantic Splitter > Recursive Splitter
+// 结构化分割中超长章节使用递归分割，无标题的文档回退到语义/递归分割。
 func NewSplitter(ctx context.Context, cfg *Config) (document.Transformer, error) {
 	if cfg == nil {
 		cfg = &Config{
@@ -62,15 +74,27 @@ func NewSplitter(ctx context.Context, cfg *Config) (document.Transformer, error)
 		return len([]rune(s))
 	}
 
-	// 检查是否为 Markdown 文件，使用专门的 Header Splitter
-	if cfg.FilePath != "" {
-		ext := strings.ToLower(filepath.Ext(cfg.FilePath))
-		if ext == ".md" || ext == ".markdown" {
-			return NewMarkdownSplitter(ctx)
-		}
+	// Apply defaults if values are not set
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = 512
+	}
+	if cfg.ChunkOverlap < 0 {
+		cfg.ChunkOverlap = 50
+	}
+
+	recursiveSplitter, err := recursive.NewSplitter(ctx, &recursive.Config{
+		ChunkSize:   cfg.ChunkSize,
+		OverlapSize: cfg.ChunkOverlap,
+		Separators:  DefaultSeparators,
+		LenFunc:     lenFunc,
+		KeepType:    recursive.KeepTypeEnd,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// 如果提供了语义嵌入模型，使用语义分割
+	// 如果提供了语义嵌入模型，使用语义分割，否则默认使用递归分割
+	fallback := recursiveSplitter
 	if cfg.SemanticEmbedder != nil {
 		percentile := cfg.SemanticPercentile
 		if percentile <= 0 || percentile > 1 {
@@ -81,7 +105,7 @@ func NewSplitter(ctx context.Context, cfg *Config) (document.Transformer, error)
 			minChunkSize = 100
 		}
 
-		return semantic.NewSplitter(ctx, &semantic.Config{
+		fallback, err = semantic.NewSplitter(ctx, &semantic.Config{
 			Embedding:    cfg.SemanticEmbedder,
 			BufferSize:   2,
 			MinChunkSize: minChunkSize,
@@ -89,24 +113,20 @@ func NewSplitter(ctx context.Context, cfg *Config) (document.Transformer, error)
 			Percentile:   percentile,
 			LenFunc:      lenFunc,
 		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// 默认使用递归分割
-	// Apply defaults if values are not set
-	if cfg.ChunkSize <= 0 {
-		cfg.ChunkSize = 512
-	}
-	if cfg.ChunkOverlap < 0 {
-		cfg.ChunkOverlap = 50
+	// 检查是否为带标题结构的文件，使用结构化分割
+	if cfg.FilePath != "" {
+		ext := strings.ToLower(filepath.Ext(cfg.FilePath))
+		if structuredExts[ext] {
+			return newStructuredSplitter(cfg.ChunkSize, recursiveSplitter, fallback, lenFunc), nil
+		}
 	}
 
-	return recursive.NewSplitter(ctx, &recursive.Config{
-		ChunkSize:   cfg.ChunkSize,
-		OverlapSize: cfg.ChunkOverlap,
-		Separators:  DefaultSeparators,
-		LenFunc:     lenFunc,
-		KeepType:    recursive.KeepTypeEnd,
-	})
+	return fallback, nil
 }
 
 // NewRecursiveSplitter 使用给定配置创建递归分割器
@@ -124,17 +144,3 @@ func NewSemanticSplitter(ctx context.Context, embedder embedding.Embedder, perce
 		SemanticPercentile: percentile,
 	})
 }
-
-// NewMarkdownSplitter 创建 Markdown Header 分割器
-// 按标题层级（#, ##, ###）进行结构化分割
-func NewMarkdownSplitter(ctx context.Context) (document.Transformer, error) {
-	return markdown.NewHeaderSplitter(ctx, &markdown.HeaderConfig{
-		Headers: map[string]string{
-			"#":    "h1",
-			"##":   "h2",
-			"###":  "h3",
-			"####": "h4",
-		},
-		TrimHeaders: false, // 保留标题行在内容中
-	})
-}
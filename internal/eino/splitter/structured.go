@@ -0,0 +1,237 @@
+package splitter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cloudwego/eino/components/document"
+	"github.com/cloudwego/eino/schema"
+)
+
+// MetaKeyHeadingPath 分块所属的标题路径（如 "第一章 > 1.1 概述"），用于展示和向量化
+const MetaKeyHeadingPath = "heading_path"
+
+// HeadingPathSeparator 标题路径的分隔符
+const HeadingPathSeparator = " > "
+
+// maxHeadingLevel 参与结构化分割的最大标题层级
+const maxHeadingLevel = 6
+
+// atxHeadingRe 匹配 Markdown ATX 标题（# 到 ######）
+var atxHeadingRe = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.+?)[ \t]*#*[ \t]*$`)
+
+// fenceRe 匹配代码块围栏（``` 或 ~~~）
+var fenceRe = regexp.MustCompile("^ {0,3}(```|~~~)")
+
+// section 表示按标题切出的一个章节
+type section struct {
+	headings []string // 各层级标题（索引 0 为 h1），未出现的层级为空
+	text     string   // 章节内容（包含标题行）
+	hasBody  bool     // 除标题行外是否还有正文
+}
+
+// structuredSplitter 结构化分割器：先按标题切分章节，超长章节再按 ChunkSize/ChunkOverlap 递归切分，
+// 并把标题路径写入元数据。没有任何标题的文档交给 fallback 分割器处理。
+type structuredSplitter struct {
+	chunkSize int
+	recursive document.Transformer
+	fallback  document.Transformer
+	lenFunc   func(string) int
+}
+
+// newStructuredSplitter 创建结构化分割器
+func newStructuredSplitter(chunkSize int, recursive, fallback document.Transformer, lenFunc func(string) int) *structuredSplitter {
+	return &structuredSplitter{
+		chunkSize: chunkSize,
+		recursive: recursive,
+		fallback:  fallback,
+		lenFunc:   lenFunc,
+	}
+}
+
+// Transform 实现 document.Transformer 接口
+func (s *structuredSplitter) Transform(ctx context.Context, docs []*schema.Document, opts ...document.TransformerOption) ([]*schema.Document, error) {
+	var out []*schema.Document
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+
+		sections := splitSections(doc.Content)
+		if sections == nil {
+			// 没有标题：按普通文本分割
+			chunks, err := s.fallback.Transform(ctx, []*schema.Document{doc}, opts...)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, chunks...)
+			continue
+		}
+
+		for _, sec := range s.mergeSections(sections) {
+			// 只有标题没有正文的章节不单独成块（标题会体现在子章节的路径中）
+			if !sec.hasBody {
+				continue
+			}
+
+			meta := copyMeta(doc.MetaData)
+			var path []string
+			for i, h := range sec.headings {
+				if h == "" {
+					continue
+				}
+				meta[fmt.Sprintf("h%d", i+1)] = h
+				path = append(path, h)
+			}
+			if len(path) > 0 {
+				meta[MetaKeyHeadingPath] = strings.Join(path, HeadingPathSeparator)
+			}
+
+			secDoc := &schema.Document{
+				ID:       doc.ID,
+				Content:  sec.text,
+				MetaData: meta,
+			}
+
+			if s.lenFunc(sec.text) <= s.chunkSize {
+				out = append(out, secDoc)
+				continue
+			}
+
+			// 超长章节：递归切分，子块继承章节元数据
+			chunks, err := s.recursive.Transform(ctx, []*schema.Document{secDoc}, opts...)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range chunks {
+				if strings.TrimSpace(c.Content) == "" {
+					continue
+				}
+				if c.MetaData == nil {
+					c.MetaData = copyMeta(meta)
+				}
+				out = append(out, c)
+			}
+		}
+	}
+	return out, nil
+}
+
+// splitSections 按 Markdown 标题切分文本；没有识别到标题时返回 nil
+func splitSections(text string) []section {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var (
+		sections []section
+		headings = make([]string, maxHeadingLevel)
+		buf      []string
+		hasBody  bool
+		inFence  string
+		found    bool
+	)
+
+	flush := func() {
+		content := strings.TrimSpace(strings.Join(buf, "\n"))
+		if content != "" {
+			sections = append(sections, section{
+				headings: append([]string(nil), headings...),
+				text:     content,
+				hasBody:  hasBody,
+			})
+		}
+		buf = buf[:0]
+		hasBody = false
+	}
+
+	for _, line := range lines {
+		// 代码块中的 # 不是标题
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			if inFence == "" {
+				inFence = m[1]
+			} else if inFence == m[1] {
+				inFence = ""
+			}
+		}
+
+		if inFence == "" {
+			if m := atxHeadingRe.FindStringSubmatch(line); m != nil {
+				found = true
+				flush()
+				level := len(m[1])
+				headings[level-1] = strings.TrimSpace(m[2])
+				for i := level; i < maxHeadingLevel; i++ {
+					headings[i] = ""
+				}
+				buf = append(buf, line)
+				continue
+			}
+		}
+
+		buf = append(buf, line)
+		if strings.TrimSpace(line) != "" {
+			hasBody = true
+		}
+	}
+	flush()
+
+	if !found {
+		return nil
+	}
+	return sections
+}
+
+// mergeSections 合并相邻的短章节，避免大量只有一两行的分块：
+// 有共同上级标题的相邻章节在合并后不超过 chunkSize 时合为一块，标题路径取它们的公共前缀
+func (s *structuredSplitter) mergeSections(sections []section) []section {
+	var out []section
+	for _, sec := range sections {
+		if n := len(out); n > 0 {
+			last := &out[n-1]
+			common := commonHeadings(last.headings, sec.headings)
+			if hasHeading(common) {
+				text := last.text + "\n\n" + sec.text
+				if s.lenFunc(text) <= s.chunkSize {
+					last.text = text
+					last.headings = common
+					last.hasBody = last.hasBody || sec.hasBody
+					continue
+				}
+			}
+		}
+		out = append(out, sec)
+	}
+	return out
+}
+
+// commonHeadings 返回两个标题路径的公共前缀（不同的层级及其下级置空）
+func commonHeadings(a, b []string) []string {
+	out := make([]string, len(a))
+	for i := range a {
+		if a[i] != b[i] {
+			break
+		}
+		out[i] = a[i]
+	}
+	return out
+}
+
+// hasHeading 标题路径中是否有任一层级的标题
+func hasHeading(headings []string) bool {
+	for _, h := range headings {
+		if h != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// copyMeta 浅拷贝元数据
+func copyMeta(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m)+4)
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
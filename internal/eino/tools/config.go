@@ -55,4 +55,7 @@ const (
 	ToolIDSequentialThinking = "sequential_thinking"
 	ToolIDWikipedia          = "wikipedia_search"
 	ToolIDLibraryRetriever   = "library_retriever"
+	ToolIDRemember           = "remember"
+	ToolIDRecall             = "recall"
+	ToolIDForget             = "forget"
 )
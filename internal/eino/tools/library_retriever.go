@@ -10,6 +10,7 @@ import (
 
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/components/tool/utils"
+	"github.com/cloudwego/eino/schema"
 )
 
 // Retrieval level constants for RAPTOR hierarchical structure
@@ -42,6 +43,10 @@ type RetrievalResult struct {
 	Content      string  `json:"content"`
 	Level        int     `json:"level"`
 	Score        float64 `json:"score"`
+	PageStart    int     `json:"page_start,omitempty"`
+	PageEnd      int     `json:"page_end,omitempty"`
+	// Citation is a ready-to-use source reference such as "contract.pdf p.14"
+	Citation string `json:"citation"`
 }
 
 // LibraryRetrieverConfig defines the configuration for the library retriever tool.
@@ -50,6 +55,7 @@ type LibraryRetrieverConfig struct {
 	TopK           int                // Maximum number of results to retrieve
 	MatchThreshold float64            // Minimum score threshold for filtering results
 	Retriever      *retrieval.Service // Retrieval service instance
+	History        []*schema.Message  // Conversation context for query rewriting (optional)
 }
 
 // DefaultLibraryRetrieverConfig returns the default configuration.
@@ -70,6 +76,7 @@ IMPORTANT: Always provide multiple queries (2-5) from different angles to get co
 Usage tips:
 - Use different keywords, synonyms, or phrasings across queries for broader coverage.
 - Adjust level parameter: 0=detailed chunks (default), 1=summary, 2=overview.
+- When quoting results, cite the source using the "citation" field (e.g. "contract.pdf p.14").
 - Only fall back to web search (duckduckgo_search) if the knowledge base returns no relevant results.`
 
 // maxConcurrentQueries limits the number of parallel retrieval goroutines.
@@ -89,6 +96,7 @@ func NewLibraryRetrieverTool(ctx context.Context, config *LibraryRetrieverConfig
 	topK := config.TopK
 	matchThreshold := config.MatchThreshold
 	retriever := config.Retriever
+	history := config.History
 
 	return utils.InferTool(
 		ToolIDLibraryRetriever,
@@ -170,6 +178,7 @@ func NewLibraryRetrieverTool(ctx context.Context, config *LibraryRetrieverConfig
 						Level:      input.Level,
 						TopK:       topK,
 						MinScore:   matchThreshold,
+						History:    history,
 					}
 					results, err := retriever.Search(ctx, searchInput)
 					resultsCh[idx] = queryResult{results: results, err: err}
@@ -202,6 +211,9 @@ func NewLibraryRetrieverTool(ctx context.Context, config *LibraryRetrieverConfig
 							Content:      r.Content,
 							Level:        r.Level,
 							Score:        r.Score,
+							PageStart:    r.PageStart,
+							PageEnd:      r.PageEnd,
+							Citation:     citation(r),
 						})
 					}
 				}
@@ -257,3 +269,11 @@ func NewLibraryRetrieverTool(ctx context.Context, config *LibraryRetrieverConfig
 		},
 	)
 }
+
+// citation builds the source reference for a result, appending the page range when known
+func citation(r retrieval.SearchResult) string {
+	if label := r.PageLabel(); label != "" {
+		return r.DocumentName + " " + label
+	}
+	return r.DocumentName
+}
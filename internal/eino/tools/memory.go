@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"chatclaw/internal/services/memory"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+)
+
+// MemoryToolsConfig defines the configuration for the long-term memory tools.
+type MemoryToolsConfig struct {
+	Store          *memory.Store // Memory store instance
+	AgentID        int64         // Agent whose memories are read and written
+	ConversationID int64         // Conversation recorded as the origin of new memories
+	TopK           int           // Maximum number of memories returned by recall
+}
+
+// RememberInput defines the input parameters for the remember tool.
+type RememberInput struct {
+	Content string `json:"content" jsonschema:"description=The fact to remember as one short self-contained sentence (e.g. 'The user prefers answers in Chinese')."`
+	Scope   string `json:"scope,omitempty" jsonschema:"description=Optional. 'user' for facts about the user that every assistant should know or 'agent' (default) for facts that only matter to this assistant.,enum=agent,enum=user"`
+}
+
+// RememberOutput defines the output of the remember tool.
+type RememberOutput struct {
+	ID      int64  `json:"id,omitempty"`
+	Updated bool   `json:"updated"`
+	Message string `json:"message"`
+}
+
+// RecallInput defines the input parameters for the recall tool.
+type RecallInput struct {
+	Query string `json:"query" jsonschema:"description=What to look up in long-term memory (e.g. 'user's preferred programming language')."`
+}
+
+// RecallOutput defines the output of the recall tool.
+type RecallOutput struct {
+	Memories   []RecalledMemory `json:"memories,omitempty"`
+	TotalCount int              `json:"total_count"`
+	Message    string           `json:"message,omitempty"`
+}
+
+// RecalledMemory represents a single memory returned by recall
+type RecalledMemory struct {
+	ID        int64  `json:"id"`
+	Content   string `json:"content"`
+	Scope     string `json:"scope"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// ForgetInput defines the input parameters for the forget tool.
+type ForgetInput struct {
+	ID int64 `json:"id" jsonschema:"description=The id of the memory to delete as returned by recall or shown in the memory section of the instructions."`
+}
+
+// ForgetOutput defines the output of the forget tool.
+type ForgetOutput struct {
+	Message string `json:"message"`
+}
+
+const rememberDescription = `Save a fact to long-term memory so that it is available in future conversations. Use it when the user shares a lasting preference, personal detail, ongoing project or decision, or explicitly asks you to remember something. Do not save small talk or information that only matters for the current question. If a similar memory exists it is updated instead of duplicated.`
+
+const recallDescription = `Search long-term memory for facts saved in earlier conversations (user preferences, personal details, projects, decisions). The most relevant memories are already listed in the instructions; use this tool to look up anything else.`
+
+const forgetDescription = `Delete a memory that is wrong or outdated, or that the user asks you to forget. To correct a memory, forget the old one and remember the new fact.`
+
+// NewMemoryTools creates the remember, recall and forget tools for one agent.
+func NewMemoryTools(ctx context.Context, config *MemoryToolsConfig) ([]tool.BaseTool, error) {
+	if config == nil || config.Store == nil {
+		return nil, fmt.Errorf("memory store is required")
+	}
+	store := config.Store
+	agentID := config.AgentID
+	conversationID := config.ConversationID
+	topK := config.TopK
+
+	remember, err := utils.InferTool(
+		ToolIDRemember,
+		rememberDescription,
+		func(ctx context.Context, input *RememberInput) (*RememberOutput, error) {
+			mem, updated, err := store.Add(ctx, agentID, input.Scope, input.Content, memory.SourceTool, conversationID)
+			if err != nil {
+				return &RememberOutput{Message: fmt.Sprintf("Failed to save memory: %v", err)}, nil
+			}
+			msg := "Memory saved"
+			if updated {
+				msg = "An existing similar memory was updated"
+			}
+			return &RememberOutput{ID: mem.ID, Updated: updated, Message: msg}, nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	recall, err := utils.InferTool(
+		ToolIDRecall,
+		recallDescription,
+		func(ctx context.Context, input *RecallInput) (*RecallOutput, error) {
+			if input.Query == "" {
+				return &RecallOutput{Message: "A query is required"}, nil
+			}
+			memories, err := store.Search(ctx, agentID, input.Query, topK)
+			if err != nil {
+				return &RecallOutput{Message: fmt.Sprintf("Failed to search memory: %v", err)}, nil
+			}
+			if len(memories) == 0 {
+				return &RecallOutput{Message: "No relevant memories found"}, nil
+			}
+			out := &RecallOutput{TotalCount: len(memories)}
+			for _, m := range memories {
+				out.Memories = append(out.Memories, RecalledMemory{
+					ID:        m.ID,
+					Content:   m.Content,
+					Scope:     m.Scope,
+					UpdatedAt: m.UpdatedAt.Format("2006-01-02"),
+				})
+			}
+			return out, nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	forget, err := utils.InferTool(
+		ToolIDForget,
+		forgetDescription,
+		func(ctx context.Context, input *ForgetInput) (*ForgetOutput, error) {
+			if input.ID <= 0 {
+				return &ForgetOutput{Message: "A valid memory id is required"}, nil
+			}
+			// Only memories visible to this agent can be deleted
+			if err := store.Delete(ctx, input.ID, agentID); err != nil {
+				return &ForgetOutput{Message: fmt.Sprintf("Failed to delete memory %d: %v", input.ID, err)}, nil
+			}
+			return &ForgetOutput{Message: fmt.Sprintf("Memory %d deleted", input.ID)}, nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return []tool.BaseTool{remember, recall, forget}, nil
+}
@@ -2,6 +2,8 @@ package agents
 
 import (
 	"context"
+	"encoding/json"
+	"log"
 	"time"
 
 	"chatclaw/internal/sqlite"
@@ -9,6 +11,54 @@ import (
 	"github.com/uptrace/bun"
 )
 
+// 检索方式
+const (
+	RetrievalModeTool   = "tool"   // 由模型按需调用 library_retriever 工具
+	RetrievalModeAlways = "always" // 每次调用模型前自动检索并注入上下文（适用于不会主动调用工具的模型）
+	RetrievalModeOff    = "off"    // 不检索知识库
+)
+
+// IsValidRetrievalMode 检查检索方式是否合法
+func IsValidRetrievalMode(mode string) bool {
+	switch mode {
+	case RetrievalModeTool, RetrievalModeAlways, RetrievalModeOff:
+		return true
+	}
+	return false
+}
+
+// execute 工具的命令限制方式
+const (
+	CommandModeBlocklist = "blocklist" // 拒绝包含危险片段的命令（默认）；不是沙箱，其他命令仍可访问工作区以外的文件
+	CommandModeAllowlist = "allowlist" // 只允许运行 allowed_commands 中的程序
+)
+
+// IsValidCommandMode 检查命令限制方式是否合法
+func IsValidCommandMode(mode string) bool {
+	return mode == CommandModeBlocklist || mode == CommandModeAllowlist
+}
+
+// 子助手的调用方式
+const (
+	SubAgentModeTool     = "tool"     // 作为工具调用，结果返回给当前助手继续回答
+	SubAgentModeTransfer = "transfer" // 移交对话，由子助手直接回答用户
+)
+
+// maxSubAgents 单个助手最多关联的子助手数量
+const maxSubAgents = 10
+
+// IsValidSubAgentMode 检查子助手调用方式是否合法
+func IsValidSubAgentMode(mode string) bool {
+	return mode == SubAgentModeTool || mode == SubAgentModeTransfer
+}
+
+// SubAgentRef 子助手引用
+// 子助手使用自己的提示词、模型、知识库和工具；只展开一层，子助手自己的子助手不会生效。
+type SubAgentRef struct {
+	AgentID int64  `json:"agent_id"`
+	Mode    string `json:"mode"` // tool / transfer
+}
+
 // Agent 助手 DTO（暴露给前端）
 type Agent struct {
 	ID int64 `json:"id"`
@@ -29,6 +79,39 @@ type Agent struct {
 	RetrievalMatchThreshold   float64 `json:"retrieval_match_threshold"`
 	RetrievalTopK             int     `json:"retrieval_top_k"`
 
+	// 默认关联的知识库（新建会话时继承）和检索方式
+	LibraryIDs    []int64 `json:"library_ids"`
+	RetrievalMode string  `json:"retrieval_mode"` // tool / always / off
+
+	// 工具白名单（工具 ID），为空表示使用全部工具
+	ToolIDs []string `json:"tool_ids"`
+
+	// 子助手（为空表示普通单助手）
+	SubAgents []SubAgentRef `json:"sub_agents"`
+
+	// 长期记忆：启用后提供 remember / recall / forget 工具并在每次运行时注入相关记忆
+	MemoryEnabled     bool `json:"memory_enabled"`
+	MemoryAutoExtract bool `json:"memory_auto_extract"` // 每轮对话后自动提取记忆
+
+	// 结构化输出：回答须符合的 JSON Schema，为空表示普通文本回答
+	ResponseSchema string `json:"response_schema"`
+
+	// 工作区沙箱：文件工具只能修改工作区内的文件，execute 在工作区中运行；为空表示用户主目录
+	WorkspaceDir    string   `json:"workspace_dir"`
+	ReadOnlyPaths   []string `json:"read_only_paths"`  // 额外的只读路径
+	CommandMode     string   `json:"command_mode"`     // blocklist / allowlist
+	AllowedCommands []string `json:"allowed_commands"` // allowlist 模式允许的程序
+
+	// 检索查询改写（query rewrite / multi-query / HyDE）
+	QueryRewriteEnabled      bool   `json:"query_rewrite_enabled"`
+	MultiQueryEnabled        bool   `json:"multi_query_enabled"`
+	HyDEEnabled              bool   `json:"hyde_enabled"`
+	QueryTransformProviderID string `json:"query_transform_provider_id"`
+	QueryTransformModelID    string `json:"query_transform_model_id"`
+
+	// 当前配置的修订号（见 agent_revisions）
+	Revision int `json:"revision"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -56,6 +139,28 @@ type UpdateAgentInput struct {
 	EnableLLMMaxTokens      *bool    `json:"enable_llm_max_tokens"`
 	RetrievalMatchThreshold *float64 `json:"retrieval_match_threshold"`
 	RetrievalTopK           *int     `json:"retrieval_top_k"`
+
+	LibraryIDs    *[]int64 `json:"library_ids"`
+	RetrievalMode *string  `json:"retrieval_mode"`
+
+	ToolIDs   *[]string      `json:"tool_ids"`
+	SubAgents *[]SubAgentRef `json:"sub_agents"`
+
+	MemoryEnabled     *bool `json:"memory_enabled"`
+	MemoryAutoExtract *bool `json:"memory_auto_extract"`
+
+	ResponseSchema *string `json:"response_schema"`
+
+	WorkspaceDir    *string   `json:"workspace_dir"`
+	ReadOnlyPaths   *[]string `json:"read_only_paths"`
+	CommandMode     *string   `json:"command_mode"`
+	AllowedCommands *[]string `json:"allowed_commands"`
+
+	QueryRewriteEnabled      *bool   `json:"query_rewrite_enabled"`
+	MultiQueryEnabled        *bool   `json:"multi_query_enabled"`
+	HyDEEnabled              *bool   `json:"hyde_enabled"`
+	QueryTransformProviderID *string `json:"query_transform_provider_id"`
+	QueryTransformModelID    *string `json:"query_transform_model_id"`
 }
 
 type agentModel struct {
@@ -80,6 +185,30 @@ type agentModel struct {
 	EnableLLMMaxTokens      bool    `bun:"enable_llm_max_tokens,notnull"`
 	RetrievalMatchThreshold float64 `bun:"retrieval_match_threshold,notnull"`
 	RetrievalTopK           int     `bun:"retrieval_top_k,notnull"`
+
+	LibraryIDs    string `bun:"library_ids,notnull"` // JSON array stored as string
+	RetrievalMode string `bun:"retrieval_mode,notnull"`
+
+	ToolIDs   string `bun:"tool_ids,notnull"`   // JSON array stored as string
+	SubAgents string `bun:"sub_agents,notnull"` // JSON array stored as string
+
+	MemoryEnabled     bool `bun:"memory_enabled,notnull"`
+	MemoryAutoExtract bool `bun:"memory_auto_extract,notnull"`
+
+	ResponseSchema string `bun:"response_schema,notnull"`
+
+	WorkspaceDir    string `bun:"workspace_dir,notnull"`
+	ReadOnlyPaths   string `bun:"read_only_paths,notnull"` // JSON array stored as string
+	CommandMode     string `bun:"command_mode,notnull"`
+	AllowedCommands string `bun:"allowed_commands,notnull"` // JSON array stored as string
+
+	QueryRewriteEnabled      bool   `bun:"query_rewrite_enabled,notnull"`
+	MultiQueryEnabled        bool   `bun:"multi_query_enabled,notnull"`
+	HyDEEnabled              bool   `bun:"hyde_enabled,notnull"`
+	QueryTransformProviderID string `bun:"query_transform_provider_id,notnull"`
+	QueryTransformModelID    string `bun:"query_transform_model_id,notnull"`
+
+	Revision int `bun:"revision,notnull"`
 }
 
 // BeforeInsert 在 INSERT 时自动设置 created_at 和 updated_at（字符串格式）
@@ -101,6 +230,18 @@ func (*agentModel) BeforeUpdate(ctx context.Context, query *bun.UpdateQuery) err
 }
 
 func (m *agentModel) toDTO() Agent {
+	// Parse library_ids from JSON string
+	var libraryIDs []int64
+	if m.LibraryIDs != "" && m.LibraryIDs != "[]" {
+		if err := json.Unmarshal([]byte(m.LibraryIDs), &libraryIDs); err != nil {
+			log.Printf("[agents] failed to parse library_ids for agent %d: %v", m.ID, err)
+			libraryIDs = []int64{}
+		}
+	}
+	if libraryIDs == nil {
+		libraryIDs = []int64{}
+	}
+
 	return Agent{
 		ID: m.ID,
 
@@ -120,7 +261,76 @@ func (m *agentModel) toDTO() Agent {
 		RetrievalMatchThreshold: m.RetrievalMatchThreshold,
 		RetrievalTopK:           m.RetrievalTopK,
 
+		LibraryIDs:    libraryIDs,
+		RetrievalMode: m.RetrievalMode,
+
+		ToolIDs:   parseToolIDs(m.ToolIDs),
+		SubAgents: ParseSubAgents(m.SubAgents),
+
+		MemoryEnabled:     m.MemoryEnabled,
+		MemoryAutoExtract: m.MemoryAutoExtract,
+
+		ResponseSchema: m.ResponseSchema,
+
+		WorkspaceDir:    m.WorkspaceDir,
+		ReadOnlyPaths:   parseStringList(m.ReadOnlyPaths, "read_only_paths"),
+		CommandMode:     m.CommandMode,
+		AllowedCommands: parseStringList(m.AllowedCommands, "allowed_commands"),
+
+		QueryRewriteEnabled:      m.QueryRewriteEnabled,
+		MultiQueryEnabled:        m.MultiQueryEnabled,
+		HyDEEnabled:              m.HyDEEnabled,
+		QueryTransformProviderID: m.QueryTransformProviderID,
+		QueryTransformModelID:    m.QueryTransformModelID,
+
+		Revision: m.Revision,
+
 		CreatedAt: m.CreatedAt,
 		UpdatedAt: m.UpdatedAt,
 	}
 }
+
+// parseToolIDs 解析工具白名单 JSON，非法时视为未限制
+func parseToolIDs(raw string) []string {
+	var ids []string
+	if raw != "" && raw != "[]" {
+		if err := json.Unmarshal([]byte(raw), &ids); err != nil {
+			log.Printf("[agents] failed to parse tool_ids: %v", err)
+			ids = nil
+		}
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids
+}
+
+// parseStringList 解析字符串数组 JSON，非法时视为空
+func parseStringList(raw, column string) []string {
+	var list []string
+	if raw != "" && raw != "[]" {
+		if err := json.Unmarshal([]byte(raw), &list); err != nil {
+			log.Printf("[agents] failed to parse %s: %v", column, err)
+			list = nil
+		}
+	}
+	if list == nil {
+		list = []string{}
+	}
+	return list
+}
+
+// ParseSubAgents 解析子助手 JSON，非法时视为没有子助手
+func ParseSubAgents(raw string) []SubAgentRef {
+	var refs []SubAgentRef
+	if raw != "" && raw != "[]" {
+		if err := json.Unmarshal([]byte(raw), &refs); err != nil {
+			log.Printf("[agents] failed to parse sub_agents: %v", err)
+			refs = nil
+		}
+	}
+	if refs == nil {
+		refs = []SubAgentRef{}
+	}
+	return refs
+}
@@ -0,0 +1,502 @@
+package agents
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/user"
+	"reflect"
+	"strings"
+	"time"
+
+	"chatclaw/internal/errs"
+	"chatclaw/internal/sqlite"
+
+	"github.com/uptrace/bun"
+)
+
+// 修订操作
+const (
+	RevisionActionInitial = "initial" // 启用修订历史之前的配置（首次修改时补记）
+	RevisionActionCreate  = "create"
+	RevisionActionUpdate  = "update"
+	RevisionActionRestore = "restore"
+	RevisionActionImport  = "import"
+)
+
+// AgentSnapshot 助手配置快照
+// 不包含图标：图标只影响展示，避免每条修订都保存一份图片。
+type AgentSnapshot struct {
+	Name   string `json:"name"`
+	Prompt string `json:"prompt"`
+
+	DefaultLLMProviderID    string  `json:"default_llm_provider_id"`
+	DefaultLLMModelID       string  `json:"default_llm_model_id"`
+	LLMTemperature          float64 `json:"llm_temperature"`
+	LLMTopP                 float64 `json:"llm_top_p"`
+	LLMMaxContextCount      int     `json:"llm_max_context_count"`
+	LLMMaxTokens            int     `json:"llm_max_tokens"`
+	EnableLLMTemperature    bool    `json:"enable_llm_temperature"`
+	EnableLLMTopP           bool    `json:"enable_llm_top_p"`
+	EnableLLMMaxTokens      bool    `json:"enable_llm_max_tokens"`
+	RetrievalMatchThreshold float64 `json:"retrieval_match_threshold"`
+	RetrievalTopK           int     `json:"retrieval_top_k"`
+
+	LibraryIDs    []int64  `json:"library_ids"`
+	RetrievalMode string   `json:"retrieval_mode"`
+	ToolIDs       []string `json:"tool_ids"`
+
+	SubAgents []SubAgentRef `json:"sub_agents"`
+
+	MemoryEnabled     bool `json:"memory_enabled"`
+	MemoryAutoExtract bool `json:"memory_auto_extract"`
+
+	ResponseSchema string `json:"response_schema"`
+
+	WorkspaceDir    string   `json:"workspace_dir"`
+	ReadOnlyPaths   []string `json:"read_only_paths"`
+	CommandMode     string   `json:"command_mode"`
+	AllowedCommands []string `json:"allowed_commands"`
+
+	QueryRewriteEnabled      bool   `json:"query_rewrite_enabled"`
+	MultiQueryEnabled        bool   `json:"multi_query_enabled"`
+	HyDEEnabled              bool   `json:"hyde_enabled"`
+	QueryTransformProviderID string `json:"query_transform_provider_id"`
+	QueryTransformModelID    string `json:"query_transform_model_id"`
+}
+
+// AgentFieldChange 单个字段的变化（Field 与 Agent DTO 的 JSON 字段名一致）
+type AgentFieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// AgentRevision 助手配置修订 DTO
+type AgentRevision struct {
+	ID           int64              `json:"id"`
+	AgentID      int64              `json:"agent_id"`
+	Revision     int                `json:"revision"`
+	Action       string             `json:"action"`
+	RestoredFrom int                `json:"restored_from"`
+	Author       string             `json:"author"`
+	Snapshot     AgentSnapshot      `json:"snapshot"`
+	Changes      []AgentFieldChange `json:"changes"` // 与上一修订相比
+
+	// 由该修订生成的助手回复数
+	MessageCount int `json:"message_count"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type agentRevisionModel struct {
+	bun.BaseModel `bun:"table:agent_revisions,alias:ar"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	CreatedAt time.Time `bun:"created_at,notnull"`
+
+	AgentID      int64  `bun:"agent_id,notnull"`
+	Revision     int    `bun:"revision,notnull"`
+	Action       string `bun:"action,notnull"`
+	RestoredFrom int    `bun:"restored_from,notnull"`
+	Author       string `bun:"author,notnull"`
+	Snapshot     string `bun:"snapshot,notnull"`
+	Changes      string `bun:"changes,notnull"`
+}
+
+var _ bun.BeforeInsertHook = (*agentRevisionModel)(nil)
+
+func (*agentRevisionModel) BeforeInsert(ctx context.Context, query *bun.InsertQuery) error {
+	query.Value("created_at", "?", sqlite.NowUTC())
+	return nil
+}
+
+func (m *agentRevisionModel) toDTO() (AgentRevision, error) {
+	out := AgentRevision{
+		ID:           m.ID,
+		AgentID:      m.AgentID,
+		Revision:     m.Revision,
+		Action:       m.Action,
+		RestoredFrom: m.RestoredFrom,
+		Author:       m.Author,
+		Changes:      []AgentFieldChange{},
+		CreatedAt:    m.CreatedAt,
+	}
+	if err := json.Unmarshal([]byte(m.Snapshot), &out.Snapshot); err != nil {
+		return out, errs.Wrap("error.agent_revision_read_failed", err)
+	}
+	if m.Changes != "" && m.Changes != "[]" {
+		if err := json.Unmarshal([]byte(m.Changes), &out.Changes); err != nil {
+			return out, errs.Wrap("error.agent_revision_read_failed", err)
+		}
+	}
+	return out, nil
+}
+
+// ListAgentRevisions 列出助手的修订历史（新的在前）
+func (s *AgentsService) ListAgentRevisions(agentID int64) ([]AgentRevision, error) {
+	if agentID <= 0 {
+		return nil, errs.New("error.agent_id_required")
+	}
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 旧助手还没有修订记录时先补记当前配置
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		m, err := loadAgentModel(ctx, tx, agentID)
+		if err != nil {
+			return err
+		}
+		return ensureInitialRevision(ctx, tx, m)
+	}); err != nil {
+		return nil, err
+	}
+
+	models := make([]agentRevisionModel, 0)
+	if err := db.NewSelect().
+		Model(&models).
+		Where("agent_id = ?", agentID).
+		OrderExpr("revision DESC").
+		Scan(ctx); err != nil {
+		return nil, errs.Wrap("error.agent_revision_read_failed", err)
+	}
+
+	// 按修订号统计助手回复数
+	type countRow struct {
+		Revision int `bun:"agent_revision"`
+		Count    int `bun:"cnt"`
+	}
+	var counts []countRow
+	if err := db.NewRaw(`
+SELECT m.agent_revision, COUNT(*) AS cnt FROM messages m
+JOIN conversations c ON c.id = m.conversation_id
+WHERE c.agent_id = ? AND m.role = 'assistant' AND m.agent_revision > 0
+GROUP BY m.agent_revision`, agentID).Scan(ctx, &counts); err != nil {
+		return nil, errs.Wrap("error.agent_revision_read_failed", err)
+	}
+	countByRevision := make(map[int]int, len(counts))
+	for _, c := range counts {
+		countByRevision[c.Revision] = c.Count
+	}
+
+	out := make([]AgentRevision, 0, len(models))
+	for i := range models {
+		dto, err := models[i].toDTO()
+		if err != nil {
+			return nil, err
+		}
+		dto.MessageCount = countByRevision[dto.Revision]
+		out = append(out, dto)
+	}
+	return out, nil
+}
+
+// GetAgentRevision 获取指定修订
+func (s *AgentsService) GetAgentRevision(agentID int64, revision int) (*AgentRevision, error) {
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	m, err := loadRevisionModel(ctx, db, agentID, revision)
+	if err != nil {
+		return nil, err
+	}
+	dto, err := m.toDTO()
+	if err != nil {
+		return nil, err
+	}
+	return &dto, nil
+}
+
+// DiffAgentRevisions 对比两个修订的配置差异（from -> to）
+func (s *AgentsService) DiffAgentRevisions(agentID int64, fromRevision, toRevision int) ([]AgentFieldChange, error) {
+	from, err := s.GetAgentRevision(agentID, fromRevision)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.GetAgentRevision(agentID, toRevision)
+	if err != nil {
+		return nil, err
+	}
+	return diffSnapshots(from.Snapshot, to.Snapshot), nil
+}
+
+// RestoreAgentRevision 将助手配置恢复为指定修订（恢复本身也会记录为一条新修订）
+func (s *AgentsService) RestoreAgentRevision(agentID int64, revision int) (*Agent, error) {
+	rev, err := s.GetAgentRevision(agentID, revision)
+	if err != nil {
+		return nil, err
+	}
+	snap := rev.Snapshot
+	input := UpdateAgentInput{
+		Name:   &snap.Name,
+		Prompt: &snap.Prompt,
+
+		DefaultLLMProviderID: &snap.DefaultLLMProviderID,
+		DefaultLLMModelID:    &snap.DefaultLLMModelID,
+
+		LLMTemperature:          &snap.LLMTemperature,
+		LLMTopP:                 &snap.LLMTopP,
+		LLMMaxContextCount:      &snap.LLMMaxContextCount,
+		LLMMaxTokens:            &snap.LLMMaxTokens,
+		EnableLLMTemperature:    &snap.EnableLLMTemperature,
+		EnableLLMTopP:           &snap.EnableLLMTopP,
+		EnableLLMMaxTokens:      &snap.EnableLLMMaxTokens,
+		RetrievalMatchThreshold: &snap.RetrievalMatchThreshold,
+		RetrievalTopK:           &snap.RetrievalTopK,
+
+		LibraryIDs:    &snap.LibraryIDs,
+		RetrievalMode: &snap.RetrievalMode,
+		ToolIDs:       &snap.ToolIDs,
+		SubAgents:     &snap.SubAgents,
+
+		MemoryEnabled:     &snap.MemoryEnabled,
+		MemoryAutoExtract: &snap.MemoryAutoExtract,
+
+		ResponseSchema: &snap.ResponseSchema,
+
+		WorkspaceDir:    &snap.WorkspaceDir,
+		ReadOnlyPaths:   &snap.ReadOnlyPaths,
+		CommandMode:     &snap.CommandMode,
+		AllowedCommands: &snap.AllowedCommands,
+
+		QueryRewriteEnabled:      &snap.QueryRewriteEnabled,
+		MultiQueryEnabled:        &snap.MultiQueryEnabled,
+		HyDEEnabled:              &snap.HyDEEnabled,
+		QueryTransformProviderID: &snap.QueryTransformProviderID,
+		QueryTransformModelID:    &snap.QueryTransformModelID,
+	}
+	if snap.LibraryIDs == nil {
+		input.LibraryIDs = &[]int64{}
+	}
+	if snap.ToolIDs == nil {
+		input.ToolIDs = &[]string{}
+	}
+	if snap.SubAgents == nil {
+		input.SubAgents = &[]SubAgentRef{}
+	}
+	if snap.ReadOnlyPaths == nil {
+		input.ReadOnlyPaths = &[]string{}
+	}
+	if snap.AllowedCommands == nil {
+		input.AllowedCommands = &[]string{}
+	}
+	if snap.CommandMode == "" {
+		// 修订记录早于工作区沙箱
+		input.CommandMode = nil
+	}
+	return s.updateAgent(agentID, input, RevisionActionRestore, revision)
+}
+
+func loadAgentModel(ctx context.Context, db bun.IDB, id int64) (*agentModel, error) {
+	var m agentModel
+	if err := db.NewSelect().
+		Model(&m).
+		Where("id = ?", id).
+		Limit(1).
+		Scan(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.Newf("error.agent_not_found", map[string]any{"ID": id})
+		}
+		return nil, errs.Wrap("error.agent_read_failed", err)
+	}
+	return &m, nil
+}
+
+func loadRevisionModel(ctx context.Context, db bun.IDB, agentID int64, revision int) (*agentRevisionModel, error) {
+	if agentID <= 0 {
+		return nil, errs.New("error.agent_id_required")
+	}
+	var m agentRevisionModel
+	if err := db.NewSelect().
+		Model(&m).
+		Where("agent_id = ?", agentID).
+		Where("revision = ?", revision).
+		Limit(1).
+		Scan(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.Newf("error.agent_revision_not_found", map[string]any{"Revision": revision})
+		}
+		return nil, errs.Wrap("error.agent_revision_read_failed", err)
+	}
+	return &m, nil
+}
+
+// ensureInitialRevision 为还没有修订记录的助手补记当前配置（修订号沿用 agents.revision）
+func ensureInitialRevision(ctx context.Context, tx bun.Tx, m *agentModel) error {
+	cnt, err := tx.NewSelect().
+		Model((*agentRevisionModel)(nil)).
+		Where("agent_id = ?", m.ID).
+		Count(ctx)
+	if err != nil {
+		return errs.Wrap("error.agent_revision_read_failed", err)
+	}
+	if cnt > 0 {
+		return nil
+	}
+	revision := m.Revision
+	if revision <= 0 {
+		revision = 1
+	}
+	return insertRevision(ctx, tx, m, revision, RevisionActionInitial, 0, nil)
+}
+
+// recordRevision 在修改助手的事务中记录一条修订（before 为 nil 表示新建）
+// 普通修改没有实际变化时不产生新修订。
+func recordRevision(ctx context.Context, tx bun.Tx, before, after *agentModel, action string, restoredFrom int) error {
+	var changes []AgentFieldChange
+	if before != nil {
+		if err := ensureInitialRevision(ctx, tx, before); err != nil {
+			return err
+		}
+		b, a := before.toDTO(), after.toDTO()
+		changes = diffSnapshots(snapshotOf(&b), snapshotOf(&a))
+		if len(changes) == 0 && action == RevisionActionUpdate {
+			return nil
+		}
+	}
+
+	var revision int
+	if err := tx.NewSelect().
+		Model((*agentRevisionModel)(nil)).
+		ColumnExpr("COALESCE(MAX(revision), 0) + 1").
+		Where("agent_id = ?", after.ID).
+		Scan(ctx, &revision); err != nil {
+		return errs.Wrap("error.agent_revision_read_failed", err)
+	}
+	if err := insertRevision(ctx, tx, after, revision, action, restoredFrom, changes); err != nil {
+		return err
+	}
+	if _, err := tx.NewUpdate().
+		Model((*agentModel)(nil)).
+		Set("revision = ?", revision).
+		Where("id = ?", after.ID).
+		Exec(ctx); err != nil {
+		return errs.Wrap("error.agent_update_failed", err)
+	}
+	after.Revision = revision
+	return nil
+}
+
+func insertRevision(ctx context.Context, tx bun.Tx, m *agentModel, revision int, action string, restoredFrom int, changes []AgentFieldChange) error {
+	dto := m.toDTO()
+	snapshot, err := json.Marshal(snapshotOf(&dto))
+	if err != nil {
+		return errs.Wrap("error.agent_update_failed", err)
+	}
+	if changes == nil {
+		changes = []AgentFieldChange{}
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return errs.Wrap("error.agent_update_failed", err)
+	}
+	rev := &agentRevisionModel{
+		AgentID:      m.ID,
+		Revision:     revision,
+		Action:       action,
+		RestoredFrom: restoredFrom,
+		Author:       revisionAuthor(),
+		Snapshot:     string(snapshot),
+		Changes:      string(changesJSON),
+	}
+	if _, err := tx.NewInsert().Model(rev).Exec(ctx); err != nil {
+		return errs.Wrap("error.agent_update_failed", err)
+	}
+	return nil
+}
+
+func snapshotOf(a *Agent) AgentSnapshot {
+	return AgentSnapshot{
+		Name:   a.Name,
+		Prompt: a.Prompt,
+
+		DefaultLLMProviderID:    a.DefaultLLMProviderID,
+		DefaultLLMModelID:       a.DefaultLLMModelID,
+		LLMTemperature:          a.LLMTemperature,
+		LLMTopP:                 a.LLMTopP,
+		LLMMaxContextCount:      a.LLMMaxContextCount,
+		LLMMaxTokens:            a.LLMMaxTokens,
+		EnableLLMTemperature:    a.EnableLLMTemperature,
+		EnableLLMTopP:           a.EnableLLMTopP,
+		EnableLLMMaxTokens:      a.EnableLLMMaxTokens,
+		RetrievalMatchThreshold: a.RetrievalMatchThreshold,
+		RetrievalTopK:           a.RetrievalTopK,
+
+		LibraryIDs:    a.LibraryIDs,
+		RetrievalMode: a.RetrievalMode,
+		ToolIDs:       a.ToolIDs,
+
+		SubAgents: a.SubAgents,
+
+		MemoryEnabled:     a.MemoryEnabled,
+		MemoryAutoExtract: a.MemoryAutoExtract,
+
+		ResponseSchema: a.ResponseSchema,
+
+		WorkspaceDir:    a.WorkspaceDir,
+		ReadOnlyPaths:   a.ReadOnlyPaths,
+		CommandMode:     a.CommandMode,
+		AllowedCommands: a.AllowedCommands,
+
+		QueryRewriteEnabled:      a.QueryRewriteEnabled,
+		MultiQueryEnabled:        a.MultiQueryEnabled,
+		HyDEEnabled:              a.HyDEEnabled,
+		QueryTransformProviderID: a.QueryTransformProviderID,
+		QueryTransformModelID:    a.QueryTransformModelID,
+	}
+}
+
+// diffSnapshots 按字段声明顺序比较两个快照
+func diffSnapshots(old, cur AgentSnapshot) []AgentFieldChange {
+	changes := []AgentFieldChange{}
+	ov, cv := reflect.ValueOf(old), reflect.ValueOf(cur)
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		o, c := ov.Field(i).Interface(), cv.Field(i).Interface()
+		if isEmptySlice(o) && isEmptySlice(c) {
+			continue
+		}
+		if reflect.DeepEqual(o, c) {
+			continue
+		}
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		changes = append(changes, AgentFieldChange{Field: name, Old: o, New: c})
+	}
+	return changes
+}
+
+// isEmptySlice nil 和空切片视为相同
+func isEmptySlice(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Slice && rv.Len() == 0
+}
+
+// revisionAuthor 修订作者：桌面端没有账号体系，使用操作系统用户名
+func revisionAuthor() string {
+	name := ""
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if name == "" {
+		name = os.Getenv("USER")
+	}
+	if name == "" {
+		name = os.Getenv("USERNAME")
+	}
+	if r := []rune(name); len(r) > 128 {
+		name = string(r[:128])
+	}
+	return name
+}
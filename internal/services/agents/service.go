@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"chatclaw/internal/define"
+	einoagent "chatclaw/internal/eino/agent"
 	"chatclaw/internal/errs"
 	"chatclaw/internal/services/i18n"
 	"chatclaw/internal/sqlite"
@@ -131,13 +133,28 @@ func (s *AgentsService) CreateAgent(input CreateAgentInput) (*Agent, error) {
 		EnableLLMMaxTokens:      false,
 		RetrievalMatchThreshold: 0.5,
 		RetrievalTopK:           20,
+
+		LibraryIDs:    "[]",
+		RetrievalMode: RetrievalModeTool,
+		ToolIDs:       "[]",
+		SubAgents:     "[]",
+		Revision:      1,
+
+		ReadOnlyPaths:   "[]",
+		CommandMode:     CommandModeBlocklist,
+		AllowedCommands: "[]",
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	if _, err := db.NewInsert().Model(m).Exec(ctx); err != nil {
-		return nil, errs.Wrap("error.agent_create_failed", err)
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(m).Exec(ctx); err != nil {
+			return errs.Wrap("error.agent_create_failed", err)
+		}
+		return recordRevision(ctx, tx, nil, m, RevisionActionCreate, 0)
+	}); err != nil {
+		return nil, err
 	}
 
 	dto := m.toDTO()
@@ -188,6 +205,11 @@ func (s *AgentsService) ReadIconFile(path string) (string, error) {
 }
 
 func (s *AgentsService) UpdateAgent(id int64, input UpdateAgentInput) (*Agent, error) {
+	return s.updateAgent(id, input, RevisionActionUpdate, 0)
+}
+
+// updateAgent 修改助手配置并记录修订（restoredFrom 仅在 action=restore 时有效）
+func (s *AgentsService) updateAgent(id int64, input UpdateAgentInput, action string, restoredFrom int) (*Agent, error) {
 	if id <= 0 {
 		return nil, errs.New("error.agent_id_required")
 	}
@@ -230,6 +252,27 @@ func (s *AgentsService) UpdateAgent(id int64, input UpdateAgentInput) (*Agent, e
 		}
 	}
 
+	// 查询改写模型：同样允许同时清空（清空时使用会话当前模型）
+	newTransformProviderID := existing.QueryTransformProviderID
+	newTransformModelID := existing.QueryTransformModelID
+	if input.QueryTransformProviderID != nil {
+		newTransformProviderID = strings.TrimSpace(*input.QueryTransformProviderID)
+	}
+	if input.QueryTransformModelID != nil {
+		newTransformModelID = strings.TrimSpace(*input.QueryTransformModelID)
+	}
+	if (input.QueryTransformProviderID != nil) || (input.QueryTransformModelID != nil) {
+		if newTransformProviderID == "" && newTransformModelID == "" {
+			// ok - clear
+		} else if newTransformProviderID == "" || newTransformModelID == "" {
+			return nil, errs.New("error.agent_query_transform_llm_incomplete")
+		} else {
+			if err := ensureLLMModelExists(ctx, db, newTransformProviderID, newTransformModelID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// BeforeUpdate hook 会自动设置 updated_at
 	q := db.NewUpdate().
 		Model((*agentModel)(nil)).
@@ -298,18 +341,112 @@ func (s *AgentsService) UpdateAgent(id int64, input UpdateAgentInput) (*Agent, e
 		}
 		q = q.Set("retrieval_top_k = ?", *input.RetrievalTopK)
 	}
-
-	result, err := q.Exec(ctx)
-	if err != nil {
-		return nil, errs.Wrap("error.agent_update_failed", err)
+	if input.LibraryIDs != nil {
+		libraryIDs, err := serializeLibraryIDs(*input.LibraryIDs)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("library_ids = ?", libraryIDs)
+	}
+	if input.RetrievalMode != nil {
+		mode := strings.TrimSpace(*input.RetrievalMode)
+		if !IsValidRetrievalMode(mode) {
+			return nil, errs.New("error.agent_retrieval_mode_invalid")
+		}
+		q = q.Set("retrieval_mode = ?", mode)
+	}
+	if input.ToolIDs != nil {
+		toolIDs, err := serializeToolIDs(*input.ToolIDs)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("tool_ids = ?", toolIDs)
+	}
+	if input.SubAgents != nil {
+		subAgents, err := serializeSubAgents(ctx, db, id, *input.SubAgents)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("sub_agents = ?", subAgents)
+	}
+	if input.MemoryEnabled != nil {
+		q = q.Set("memory_enabled = ?", *input.MemoryEnabled)
+	}
+	if input.MemoryAutoExtract != nil {
+		q = q.Set("memory_auto_extract = ?", *input.MemoryAutoExtract)
+	}
+	if input.ResponseSchema != nil {
+		responseSchema, err := normalizeResponseSchema(*input.ResponseSchema)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("response_schema = ?", responseSchema)
+	}
+	if input.WorkspaceDir != nil {
+		workspaceDir, err := NormalizeWorkspaceDir(*input.WorkspaceDir)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("workspace_dir = ?", workspaceDir)
+	}
+	if input.ReadOnlyPaths != nil {
+		readOnlyPaths, err := serializeReadOnlyPaths(*input.ReadOnlyPaths)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("read_only_paths = ?", readOnlyPaths)
+	}
+	if input.CommandMode != nil {
+		mode := strings.TrimSpace(*input.CommandMode)
+		if !IsValidCommandMode(mode) {
+			return nil, errs.New("error.agent_command_mode_invalid")
+		}
+		q = q.Set("command_mode = ?", mode)
+	}
+	if input.AllowedCommands != nil {
+		allowedCommands, err := serializeAllowedCommands(*input.AllowedCommands)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("allowed_commands = ?", allowedCommands)
+	}
+	if input.QueryRewriteEnabled != nil {
+		q = q.Set("query_rewrite_enabled = ?", *input.QueryRewriteEnabled)
+	}
+	if input.MultiQueryEnabled != nil {
+		q = q.Set("multi_query_enabled = ?", *input.MultiQueryEnabled)
+	}
+	if input.HyDEEnabled != nil {
+		q = q.Set("hyde_enabled = ?", *input.HyDEEnabled)
+	}
+	if input.QueryTransformProviderID != nil {
+		q = q.Set("query_transform_provider_id = ?", newTransformProviderID)
+	}
+	if input.QueryTransformModelID != nil {
+		q = q.Set("query_transform_model_id = ?", newTransformModelID)
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return nil, errs.Newf("error.agent_not_found", map[string]any{"ID": id})
+	// 修改与修订记录在同一事务中完成
+	var updated *agentModel
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		before, err := loadAgentModel(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := q.Conn(tx).Exec(ctx); err != nil {
+			return errs.Wrap("error.agent_update_failed", err)
+		}
+		updated, err = loadAgentModel(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return recordRevision(ctx, tx, before, updated, action, restoredFrom)
+	}); err != nil {
+		return nil, err
 	}
 
-	return s.GetAgent(id)
+	dto := updated.toDTO()
+	return &dto, nil
 }
 
 func (s *AgentsService) DeleteAgent(id int64) error {
@@ -340,6 +477,167 @@ func (s *AgentsService) DeleteAgent(id int64) error {
 	return nil
 }
 
+// serializeLibraryIDs 校验并序列化知识库 ID（去重，忽略非法 ID）
+func serializeLibraryIDs(ids []int64) (string, error) {
+	out := make([]int64, 0, len(ids))
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if id <= 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", errs.Wrap("error.agent_update_failed", err)
+	}
+	return string(b), nil
+}
+
+// serializeToolIDs 序列化工具白名单（去重，忽略空值）
+func serializeToolIDs(ids []string) (string, error) {
+	out := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", errs.Wrap("error.agent_update_failed", err)
+	}
+	return string(b), nil
+}
+
+// normalizeResponseSchema 校验结构化输出的 JSON Schema（空字符串表示关闭结构化输出）
+func normalizeResponseSchema(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	if _, err := einoagent.ParseResponseFormat(raw); err != nil {
+		return "", errs.Newf("error.agent_response_schema_invalid", map[string]any{"Error": err.Error()})
+	}
+	return raw, nil
+}
+
+// NormalizeWorkspaceDir 校验工作区目录（空字符串表示用户主目录），返回清理后的绝对路径
+func NormalizeWorkspaceDir(dir string) (string, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(dir) {
+		return "", errs.Newf("error.workspace_dir_invalid", map[string]any{"Path": dir})
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return "", errs.Newf("error.workspace_dir_invalid", map[string]any{"Path": dir})
+	}
+	return filepath.Clean(dir), nil
+}
+
+// serializeReadOnlyPaths 校验并序列化只读路径（须为已存在的绝对路径，去重）
+func serializeReadOnlyPaths(paths []string) (string, error) {
+	out := make([]string, 0, len(paths))
+	seen := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			return "", errs.Newf("error.read_only_path_invalid", map[string]any{"Path": p})
+		}
+		if _, err := os.Stat(p); err != nil {
+			return "", errs.Newf("error.read_only_path_invalid", map[string]any{"Path": p})
+		}
+		p = filepath.Clean(p)
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		out = append(out, p)
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", errs.Wrap("error.agent_update_failed", err)
+	}
+	return string(b), nil
+}
+
+// serializeAllowedCommands 序列化 allowlist 模式允许的程序名（去重，忽略空值；不能包含空白）
+func serializeAllowedCommands(cmds []string) (string, error) {
+	out := make([]string, 0, len(cmds))
+	seen := make(map[string]bool, len(cmds))
+	for _, c := range cmds {
+		c = strings.TrimSpace(c)
+		if c == "" || seen[c] {
+			continue
+		}
+		if strings.ContainsAny(c, " \t\r\n") {
+			return "", errs.Newf("error.agent_allowed_command_invalid", map[string]any{"Command": c})
+		}
+		seen[c] = true
+		out = append(out, c)
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", errs.Wrap("error.agent_update_failed", err)
+	}
+	return string(b), nil
+}
+
+// serializeSubAgents 校验并序列化子助手（去重；不能引用自己或不存在的助手）
+func serializeSubAgents(ctx context.Context, db *bun.DB, selfID int64, refs []SubAgentRef) (string, error) {
+	out := make([]SubAgentRef, 0, len(refs))
+	seen := make(map[int64]bool, len(refs))
+	for _, ref := range refs {
+		if seen[ref.AgentID] {
+			continue
+		}
+		if ref.Mode == "" {
+			ref.Mode = SubAgentModeTool
+		}
+		if ref.AgentID <= 0 || ref.AgentID == selfID || !IsValidSubAgentMode(ref.Mode) {
+			return "", errs.Newf("error.agent_sub_agent_invalid", map[string]any{"ID": ref.AgentID})
+		}
+		seen[ref.AgentID] = true
+		out = append(out, ref)
+	}
+	if len(out) > maxSubAgents {
+		return "", errs.Newf("error.agent_sub_agents_too_many", map[string]any{"Max": maxSubAgents})
+	}
+
+	if len(out) > 0 {
+		ids := make([]int64, 0, len(out))
+		for _, ref := range out {
+			ids = append(ids, ref.AgentID)
+		}
+		cnt, err := db.NewSelect().
+			Model((*agentModel)(nil)).
+			Where("id IN (?)", bun.In(ids)).
+			Count(ctx)
+		if err != nil {
+			return "", errs.Wrap("error.agent_read_failed", err)
+		}
+		if cnt != len(ids) {
+			return "", errs.Newf("error.agent_sub_agent_invalid", map[string]any{"ID": ids})
+		}
+	}
+
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", errs.Wrap("error.agent_update_failed", err)
+	}
+	return string(b), nil
+}
+
 func ensureLLMModelExists(ctx context.Context, db *bun.DB, providerID, modelID string) error {
 	providerID = strings.TrimSpace(providerID)
 	modelID = strings.TrimSpace(modelID)
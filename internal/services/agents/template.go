@@ -0,0 +1,676 @@
+package agents
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"chatclaw/internal/define"
+	einoagent "chatclaw/internal/eino/agent"
+	"chatclaw/internal/errs"
+
+	"github.com/uptrace/bun"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateVersion 当前助手模板格式版本（格式不兼容时递增）
+const TemplateVersion = 1
+
+const (
+	// 模板文件大小上限（包含内嵌的图标和技能文件）
+	maxTemplateSize = 2 * 1024 * 1024
+	// 单个技能目录的大小上限（只打包文本文件）
+	maxSkillSize = 512 * 1024
+)
+
+// AgentTemplate 可分享的助手模板
+// 模型以符号引用（供应商 ID/类型 + 模型 ID）保存，导入时映射到本机已配置的供应商；
+// 知识库、子助手、记忆内容和工作区路径属于本机数据，不随模板导出（只导出是否启用记忆和命令限制）。
+type AgentTemplate struct {
+	Version     int    `json:"version" yaml:"version"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Prompt      string `json:"prompt" yaml:"prompt"`
+	Icon        string `json:"icon,omitempty" yaml:"icon,omitempty"` // data URL
+
+	Model      *TemplateModelRef  `json:"model,omitempty" yaml:"model,omitempty"`
+	Parameters TemplateParameters `json:"parameters" yaml:"parameters"`
+	Retrieval  TemplateRetrieval  `json:"retrieval" yaml:"retrieval"`
+	Memory     TemplateMemory     `json:"memory" yaml:"memory"`
+
+	// 结构化输出的 JSON Schema，为空表示普通文本回答
+	ResponseSchema string `json:"response_schema,omitempty" yaml:"response_schema,omitempty"`
+
+	// execute 工具的命令限制（blocklist / allowlist），为空表示 blocklist
+	CommandMode     string   `json:"command_mode,omitempty" yaml:"command_mode,omitempty"`
+	AllowedCommands []string `json:"allowed_commands,omitempty" yaml:"allowed_commands,omitempty"`
+
+	// 工具白名单，为空表示使用全部工具
+	Tools  []string        `json:"tools,omitempty" yaml:"tools,omitempty"`
+	Skills []TemplateSkill `json:"skills,omitempty" yaml:"skills,omitempty"`
+}
+
+// TemplateModelRef 模型的符号引用
+type TemplateModelRef struct {
+	Provider     string `json:"provider" yaml:"provider"`           // 导出时的供应商 ID（内置供应商在各机器上一致）
+	ProviderType string `json:"provider_type" yaml:"provider_type"` // openai / anthropic / ...，供应商 ID 不存在时按类型匹配
+	Model        string `json:"model" yaml:"model"`
+}
+
+// TemplateParameters 模型参数
+type TemplateParameters struct {
+	Temperature       float64 `json:"temperature" yaml:"temperature"`
+	TopP              float64 `json:"top_p" yaml:"top_p"`
+	MaxContextCount   int     `json:"max_context_count" yaml:"max_context_count"`
+	MaxTokens         int     `json:"max_tokens" yaml:"max_tokens"`
+	EnableTemperature bool    `json:"enable_temperature" yaml:"enable_temperature"`
+	EnableTopP        bool    `json:"enable_top_p" yaml:"enable_top_p"`
+	EnableMaxTokens   bool    `json:"enable_max_tokens" yaml:"enable_max_tokens"`
+}
+
+// TemplateRetrieval 检索设置
+type TemplateRetrieval struct {
+	Mode                string            `json:"mode" yaml:"mode"`
+	TopK                int               `json:"top_k" yaml:"top_k"`
+	MatchThreshold      float64           `json:"match_threshold" yaml:"match_threshold"`
+	QueryRewrite        bool              `json:"query_rewrite" yaml:"query_rewrite"`
+	MultiQuery          bool              `json:"multi_query" yaml:"multi_query"`
+	HyDE                bool              `json:"hyde" yaml:"hyde"`
+	QueryTransformModel *TemplateModelRef `json:"query_transform_model,omitempty" yaml:"query_transform_model,omitempty"`
+}
+
+// TemplateMemory 长期记忆设置
+type TemplateMemory struct {
+	Enabled     bool `json:"enabled" yaml:"enabled"`
+	AutoExtract bool `json:"auto_extract" yaml:"auto_extract"`
+}
+
+// TemplateSkill 打包的技能（相对路径 -> 文件内容）
+type TemplateSkill struct {
+	Name  string            `json:"name" yaml:"name"`
+	Files map[string]string `json:"files" yaml:"files"`
+}
+
+type ExportAgentInput struct {
+	ID     int64    `json:"id"`
+	Format string   `json:"format"` // json（默认）/ yaml
+	Skills []string `json:"skills"` // 需要打包的技能名称（$HOME/.agents/skills 下的目录）
+	Path   string   `json:"path"`   // 非空时写入该文件
+}
+
+type ImportAgentInput struct {
+	Path    string `json:"path"`    // 模板文件路径
+	Content string `json:"content"` // Path 为空时使用的模板内容
+}
+
+// ImportAgentResult 导入结果
+type ImportAgentResult struct {
+	Agent *Agent `json:"agent"`
+
+	// 本机找不到对应模型的符号引用（助手已创建，需要用户手动选择模型）
+	UnresolvedModels []TemplateModelRef `json:"unresolved_models"`
+	InstalledSkills  []string           `json:"installed_skills"`
+	SkippedSkills    []string           `json:"skipped_skills"` // 本机已存在同名技能，未覆盖
+}
+
+// AgentTemplateInfo 模板库中的模板
+type AgentTemplateInfo struct {
+	File        string `json:"file"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Error       string `json:"error"` // 解析失败时的原因
+}
+
+// ExportAgent 将助手导出为模板，返回模板内容（指定 Path 时同时写入文件）
+func (s *AgentsService) ExportAgent(input ExportAgentInput) (string, error) {
+	agent, err := s.GetAgent(input.ID)
+	if err != nil {
+		return "", err
+	}
+	db, err := s.db()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tpl := AgentTemplate{
+		Version: TemplateVersion,
+		Name:    agent.Name,
+		Prompt:  agent.Prompt,
+		Icon:    agent.Icon,
+		Parameters: TemplateParameters{
+			Temperature:       agent.LLMTemperature,
+			TopP:              agent.LLMTopP,
+			MaxContextCount:   agent.LLMMaxContextCount,
+			MaxTokens:         agent.LLMMaxTokens,
+			EnableTemperature: agent.EnableLLMTemperature,
+			EnableTopP:        agent.EnableLLMTopP,
+			EnableMaxTokens:   agent.EnableLLMMaxTokens,
+		},
+		Retrieval: TemplateRetrieval{
+			Mode:           agent.RetrievalMode,
+			TopK:           agent.RetrievalTopK,
+			MatchThreshold: agent.RetrievalMatchThreshold,
+			QueryRewrite:   agent.QueryRewriteEnabled,
+			MultiQuery:     agent.MultiQueryEnabled,
+			HyDE:           agent.HyDEEnabled,
+		},
+		Memory: TemplateMemory{
+			Enabled:     agent.MemoryEnabled,
+			AutoExtract: agent.MemoryAutoExtract,
+		},
+		ResponseSchema:  agent.ResponseSchema,
+		CommandMode:     agent.CommandMode,
+		AllowedCommands: agent.AllowedCommands,
+		Tools:           agent.ToolIDs,
+	}
+	if tpl.Model, err = modelRef(ctx, db, agent.DefaultLLMProviderID, agent.DefaultLLMModelID); err != nil {
+		return "", err
+	}
+	if tpl.Retrieval.QueryTransformModel, err = modelRef(ctx, db, agent.QueryTransformProviderID, agent.QueryTransformModelID); err != nil {
+		return "", err
+	}
+
+	if len(input.Skills) > 0 {
+		skillsDir, err := einoagent.SkillsDir()
+		if err != nil {
+			return "", errs.Wrap("error.agent_template_read_failed", err)
+		}
+		for _, name := range input.Skills {
+			sk, err := readSkill(skillsDir, name)
+			if err != nil {
+				return "", err
+			}
+			tpl.Skills = append(tpl.Skills, *sk)
+		}
+	}
+
+	var out []byte
+	switch strings.ToLower(strings.TrimSpace(input.Format)) {
+	case "", "json":
+		out, err = json.MarshalIndent(tpl, "", "  ")
+	case "yaml", "yml":
+		out, err = yaml.Marshal(tpl)
+	default:
+		return "", errs.New("error.agent_template_format_invalid")
+	}
+	if err != nil {
+		return "", errs.Wrap("error.agent_template_invalid", err)
+	}
+
+	if path := strings.TrimSpace(input.Path); path != "" {
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return "", errs.Wrap("error.agent_template_write_failed", err)
+		}
+	}
+	return string(out), nil
+}
+
+// ImportAgent 从模板创建新助手
+func (s *AgentsService) ImportAgent(input ImportAgentInput) (*ImportAgentResult, error) {
+	content := []byte(input.Content)
+	if path := strings.TrimSpace(input.Path); path != "" {
+		b, err := readTemplateFile(path)
+		if err != nil {
+			return nil, err
+		}
+		content = b
+	}
+	tpl, err := parseTemplate(content)
+	if err != nil {
+		return nil, err
+	}
+	return s.importTemplate(tpl)
+}
+
+// GetAgentTemplatesDir 获取内置模板库目录（团队可将统一的模板文件放在此处）
+func (s *AgentsService) GetAgentTemplatesDir() (string, error) {
+	cfgDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errs.Wrap("error.agent_template_read_failed", err)
+	}
+	return filepath.Join(cfgDir, define.AppID, "agent-templates"), nil
+}
+
+// ListAgentTemplates 列出模板库中的模板（.json / .yaml / .yml）
+func (s *AgentsService) ListAgentTemplates() ([]AgentTemplateInfo, error) {
+	dir, err := s.GetAgentTemplatesDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errs.Wrap("error.agent_template_read_failed", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errs.Wrap("error.agent_template_read_failed", err)
+	}
+
+	out := make([]AgentTemplateInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !isTemplateFile(e.Name()) {
+			continue
+		}
+		info := AgentTemplateInfo{File: e.Name()}
+		b, err := readTemplateFile(filepath.Join(dir, e.Name()))
+		if err == nil {
+			var tpl *AgentTemplate
+			if tpl, err = parseTemplate(b); err == nil {
+				info.Name = tpl.Name
+				info.Description = tpl.Description
+			}
+		}
+		if err != nil {
+			info.Error = err.Error()
+		}
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].File < out[j].File })
+	return out, nil
+}
+
+// ImportAgentTemplate 从模板库导入模板（file 为模板库中的文件名）
+func (s *AgentsService) ImportAgentTemplate(file string) (*ImportAgentResult, error) {
+	file = strings.TrimSpace(file)
+	if file == "" || file != filepath.Base(file) || !isTemplateFile(file) {
+		return nil, errs.New("error.agent_template_file_invalid")
+	}
+	dir, err := s.GetAgentTemplatesDir()
+	if err != nil {
+		return nil, err
+	}
+	return s.ImportAgent(ImportAgentInput{Path: filepath.Join(dir, file)})
+}
+
+func (s *AgentsService) importTemplate(tpl *AgentTemplate) (*ImportAgentResult, error) {
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := &ImportAgentResult{
+		UnresolvedModels: []TemplateModelRef{},
+		InstalledSkills:  []string{},
+		SkippedSkills:    []string{},
+	}
+
+	providerID, modelID, err := resolveModelRef(ctx, db, tpl.Model)
+	if err != nil {
+		return nil, err
+	}
+	if tpl.Model != nil && providerID == "" {
+		result.UnresolvedModels = append(result.UnresolvedModels, *tpl.Model)
+	}
+	transformProviderID, transformModelID, err := resolveModelRef(ctx, db, tpl.Retrieval.QueryTransformModel)
+	if err != nil {
+		return nil, err
+	}
+	if tpl.Retrieval.QueryTransformModel != nil && transformProviderID == "" {
+		result.UnresolvedModels = append(result.UnresolvedModels, *tpl.Retrieval.QueryTransformModel)
+	}
+
+	toolIDs, err := serializeToolIDs(tpl.Tools)
+	if err != nil {
+		return nil, err
+	}
+	responseSchema, err := normalizeResponseSchema(tpl.ResponseSchema)
+	if err != nil {
+		return nil, err
+	}
+	allowedCommands, err := serializeAllowedCommands(tpl.AllowedCommands)
+	if err != nil {
+		return nil, err
+	}
+
+	p := tpl.Parameters
+	r := tpl.Retrieval
+	m := &agentModel{
+		Name:   tpl.Name,
+		Prompt: tpl.Prompt,
+		Icon:   tpl.Icon,
+
+		DefaultLLMProviderID:    providerID,
+		DefaultLLMModelID:       modelID,
+		LLMTemperature:          p.Temperature,
+		LLMTopP:                 p.TopP,
+		LLMMaxContextCount:      p.MaxContextCount,
+		LLMMaxTokens:            p.MaxTokens,
+		EnableLLMTemperature:    p.EnableTemperature,
+		EnableLLMTopP:           p.EnableTopP,
+		EnableLLMMaxTokens:      p.EnableMaxTokens,
+		RetrievalMatchThreshold: r.MatchThreshold,
+		RetrievalTopK:           r.TopK,
+
+		LibraryIDs:    "[]",
+		RetrievalMode: r.Mode,
+		ToolIDs:       toolIDs,
+		SubAgents:     "[]",
+
+		MemoryEnabled:     tpl.Memory.Enabled,
+		MemoryAutoExtract: tpl.Memory.AutoExtract,
+
+		ResponseSchema: responseSchema,
+
+		ReadOnlyPaths:   "[]",
+		CommandMode:     tpl.CommandMode,
+		AllowedCommands: allowedCommands,
+
+		QueryRewriteEnabled:      r.QueryRewrite,
+		MultiQueryEnabled:        r.MultiQuery,
+		HyDEEnabled:              r.HyDE,
+		QueryTransformProviderID: transformProviderID,
+		QueryTransformModelID:    transformModelID,
+
+		Revision: 1,
+	}
+
+	// 先安装技能：技能目录写入失败时不创建助手
+	if len(tpl.Skills) > 0 {
+		skillsDir, err := einoagent.SkillsDir()
+		if err != nil {
+			return nil, errs.Wrap("error.agent_template_write_failed", err)
+		}
+		for _, sk := range tpl.Skills {
+			installed, err := installSkill(skillsDir, sk)
+			if err != nil {
+				return nil, err
+			}
+			if installed {
+				result.InstalledSkills = append(result.InstalledSkills, sk.Name)
+			} else {
+				result.SkippedSkills = append(result.SkippedSkills, sk.Name)
+			}
+		}
+	}
+
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(m).Exec(ctx); err != nil {
+			return errs.Wrap("error.agent_import_failed", err)
+		}
+		return recordRevision(ctx, tx, nil, m, RevisionActionImport, 0)
+	}); err != nil {
+		return nil, err
+	}
+
+	dto := m.toDTO()
+	result.Agent = &dto
+	return result, nil
+}
+
+// parseTemplate 解析并校验模板（以 { 开头按 JSON 解析，否则按 YAML 解析），缺省字段使用新建助手的默认值
+func parseTemplate(content []byte) (*AgentTemplate, error) {
+	if len(content) > maxTemplateSize {
+		return nil, errs.New("error.agent_template_invalid")
+	}
+	trimmed := strings.TrimSpace(string(content))
+	if trimmed == "" {
+		return nil, errs.New("error.agent_template_invalid")
+	}
+
+	tpl := AgentTemplate{
+		Parameters: TemplateParameters{
+			Temperature:     0.5,
+			TopP:            1.0,
+			MaxContextCount: 50,
+			MaxTokens:       1000,
+		},
+		Retrieval: TemplateRetrieval{
+			Mode:           RetrievalModeTool,
+			TopK:           20,
+			MatchThreshold: 0.5,
+		},
+	}
+	var err error
+	if strings.HasPrefix(trimmed, "{") {
+		err = json.Unmarshal([]byte(trimmed), &tpl)
+	} else {
+		err = yaml.Unmarshal([]byte(trimmed), &tpl)
+	}
+	if err != nil {
+		return nil, errs.Wrap("error.agent_template_invalid", err)
+	}
+
+	if tpl.Version <= 0 || tpl.Version > TemplateVersion {
+		return nil, errs.Newf("error.agent_template_version_unsupported", map[string]any{"Version": tpl.Version})
+	}
+
+	// 与 CreateAgent / UpdateAgent 相同的约束
+	tpl.Name = strings.TrimSpace(tpl.Name)
+	if tpl.Name == "" {
+		return nil, errs.New("error.agent_name_required")
+	}
+	if len([]rune(tpl.Name)) > 100 {
+		return nil, errs.New("error.agent_name_too_long")
+	}
+	tpl.Prompt = strings.TrimSpace(tpl.Prompt)
+	if len([]rune(tpl.Prompt)) > 1000 {
+		return nil, errs.New("error.agent_prompt_too_long")
+	}
+	tpl.Icon = strings.TrimSpace(tpl.Icon)
+	if len(tpl.Icon) > 250_000 {
+		return nil, errs.New("error.agent_icon_too_large")
+	}
+	if tpl.Icon != "" && !strings.HasPrefix(tpl.Icon, "data:image/") {
+		return nil, errs.New("error.agent_icon_invalid")
+	}
+	if tpl.Retrieval.Mode == "" {
+		tpl.Retrieval.Mode = RetrievalModeTool
+	}
+	if !IsValidRetrievalMode(tpl.Retrieval.Mode) {
+		return nil, errs.New("error.agent_retrieval_mode_invalid")
+	}
+	tpl.CommandMode = strings.TrimSpace(tpl.CommandMode)
+	if tpl.CommandMode == "" {
+		tpl.CommandMode = CommandModeBlocklist
+	}
+	if !IsValidCommandMode(tpl.CommandMode) {
+		return nil, errs.New("error.agent_command_mode_invalid")
+	}
+	if tpl.Retrieval.MatchThreshold < 0 || tpl.Retrieval.MatchThreshold > 1 {
+		return nil, errs.New("error.agent_retrieval_match_threshold_invalid")
+	}
+	if tpl.Retrieval.TopK <= 0 {
+		return nil, errs.New("error.agent_retrieval_topk_invalid")
+	}
+	for _, sk := range tpl.Skills {
+		if !isValidSkillName(sk.Name) || len(sk.Files) == 0 {
+			return nil, errs.Newf("error.agent_template_skill_invalid", map[string]any{"Name": sk.Name})
+		}
+		for rel := range sk.Files {
+			if _, ok := cleanSkillPath(rel); !ok {
+				return nil, errs.Newf("error.agent_template_skill_invalid", map[string]any{"Name": sk.Name})
+			}
+		}
+	}
+	return &tpl, nil
+}
+
+func readTemplateFile(path string) ([]byte, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, errs.Wrap("error.agent_template_read_failed", err)
+	}
+	if st.Size() > maxTemplateSize {
+		return nil, errs.New("error.agent_template_invalid")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errs.Wrap("error.agent_template_read_failed", err)
+	}
+	return b, nil
+}
+
+func isTemplateFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return !strings.HasPrefix(name, ".")
+	}
+	return false
+}
+
+// modelRef 生成模型的符号引用（未设置模型时返回 nil）
+func modelRef(ctx context.Context, db *bun.DB, providerID, modelID string) (*TemplateModelRef, error) {
+	if providerID == "" || modelID == "" {
+		return nil, nil
+	}
+	var providerType string
+	err := db.NewSelect().
+		Table("providers").
+		Column("type").
+		Where("provider_id = ?", providerID).
+		Limit(1).
+		Scan(ctx, &providerType)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, errs.Wrap("error.agent_read_failed", err)
+	}
+	return &TemplateModelRef{Provider: providerID, ProviderType: providerType, Model: modelID}, nil
+}
+
+// resolveModelRef 将符号引用映射到本机的供应商：
+// 优先同 ID 的供应商，其次同类型的供应商（如自定义的 OpenAI 兼容服务），启用的优先；找不到时返回空
+func resolveModelRef(ctx context.Context, db *bun.DB, ref *TemplateModelRef) (string, string, error) {
+	if ref == nil || strings.TrimSpace(ref.Model) == "" {
+		return "", "", nil
+	}
+	modelID := strings.TrimSpace(ref.Model)
+
+	var providerID string
+	err := db.NewRaw(`
+SELECT m.provider_id FROM models m
+JOIN providers p ON p.provider_id = m.provider_id
+WHERE m.model_id = ? AND m.type = 'llm'
+ORDER BY (p.provider_id = ?) DESC, (p.type = ?) DESC, p.enabled DESC, p.sort_order ASC
+LIMIT 1`, modelID, strings.TrimSpace(ref.Provider), strings.TrimSpace(ref.ProviderType)).
+		Scan(ctx, &providerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", errs.Wrap("error.agent_llm_model_check_failed", err)
+	}
+	return providerID, modelID, nil
+}
+
+// isValidSkillName 技能名称只能是单层目录名
+func isValidSkillName(name string) bool {
+	if name == "" || name == "." || name == ".." || len(name) > 100 {
+		return false
+	}
+	return !strings.ContainsAny(name, `/\:`)
+}
+
+// cleanSkillPath 规范化技能内的相对路径，拒绝绝对路径和越出技能目录的路径
+func cleanSkillPath(rel string) (string, bool) {
+	rel = filepath.ToSlash(strings.TrimSpace(rel))
+	if rel == "" || strings.HasPrefix(rel, "/") || strings.Contains(rel, ":") {
+		return "", false
+	}
+	clean := filepath.Clean(filepath.FromSlash(rel))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return clean, true
+}
+
+// readSkill 读取技能目录下的文本文件（跳过隐藏文件和二进制文件）
+func readSkill(skillsDir, name string) (*TemplateSkill, error) {
+	name = strings.TrimSpace(name)
+	if !isValidSkillName(name) {
+		return nil, errs.Newf("error.agent_template_skill_invalid", map[string]any{"Name": name})
+	}
+	root := filepath.Join(skillsDir, name)
+	if _, err := os.Stat(filepath.Join(root, "SKILL.md")); err != nil {
+		return nil, errs.Newf("error.agent_template_skill_not_found", map[string]any{"Name": name})
+	}
+
+	sk := &TemplateSkill{Name: name, Files: map[string]string{}}
+	total := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != root {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !utf8.Valid(b) {
+			return nil
+		}
+		total += len(b)
+		if total > maxSkillSize {
+			return errs.Newf("error.agent_template_skill_invalid", map[string]any{"Name": name})
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		sk.Files[filepath.ToSlash(rel)] = string(b)
+		return nil
+	})
+	if err != nil {
+		var e *errs.I18nError
+		if errors.As(err, &e) {
+			return nil, err
+		}
+		return nil, errs.Wrap("error.agent_template_read_failed", err)
+	}
+	return sk, nil
+}
+
+// installSkill 安装模板中的技能；本机已存在同名技能时不覆盖，返回 false
+func installSkill(skillsDir string, sk TemplateSkill) (bool, error) {
+	root := filepath.Join(skillsDir, sk.Name)
+	if _, err := os.Stat(root); err == nil {
+		return false, nil
+	}
+
+	// 先写入临时目录再重命名，避免留下不完整的技能
+	if err := os.MkdirAll(skillsDir, 0o755); err != nil {
+		return false, errs.Wrap("error.agent_template_write_failed", err)
+	}
+	tmp, err := os.MkdirTemp(skillsDir, "."+sk.Name+"-")
+	if err != nil {
+		return false, errs.Wrap("error.agent_template_write_failed", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for rel, content := range sk.Files {
+		clean, ok := cleanSkillPath(rel)
+		if !ok {
+			return false, errs.Newf("error.agent_template_skill_invalid", map[string]any{"Name": sk.Name})
+		}
+		dst := filepath.Join(tmp, clean)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return false, errs.Wrap("error.agent_template_write_failed", err)
+		}
+		if err := os.WriteFile(dst, []byte(content), 0o644); err != nil {
+			return false, errs.Wrap("error.agent_template_write_failed", err)
+		}
+	}
+	if err := os.Rename(tmp, root); err != nil {
+		return false, errs.Wrap("error.agent_template_write_failed", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"chatclaw/internal/services/retrieval"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// autoRetrievalMarker starts the knowledge base section appended to the system message.
+// Everything after it is replaced on every LLM call, so the injection stays idempotent.
+const autoRetrievalMarker = "# Knowledge Base Context\n"
+
+// autoRetrievalPreamble tells the model how to use the injected excerpts.
+const autoRetrievalPreamble = "The following excerpts were retrieved automatically from the user's private knowledge base for the latest question. " +
+	"Use them when they are relevant and cite the source shown in brackets (e.g. [contract.pdf p.14]). " +
+	"Ignore them if they are unrelated to the question.\n"
+
+// autoRetriever implements retrieval mode "always": before every LLM call it searches the
+// attached libraries with the latest user message and injects the results into the system message.
+// Results are cached per user message, so the tool-call iterations of one turn do not search again.
+type autoRetriever struct {
+	logger     *slog.Logger
+	service    *retrieval.Service
+	libraryIDs []int64
+	topK       int
+	minScore   float64
+	history    []*schema.Message
+
+	lastQuery   string
+	lastContext string
+}
+
+func newAutoRetriever(logger *slog.Logger, service *retrieval.Service, extras AgentExtras, topK int, history []*schema.Message) *autoRetriever {
+	if topK <= 0 {
+		topK = 10
+	}
+	return &autoRetriever{
+		logger:     logger,
+		service:    service,
+		libraryIDs: extras.LibraryIDs,
+		topK:       topK,
+		minScore:   extras.MatchThreshold,
+		history:    history,
+	}
+}
+
+// inject is an einoagent.MessageModifierFunc
+func (r *autoRetriever) inject(ctx context.Context, messages []*schema.Message) []*schema.Message {
+	query := lastUserQuery(messages)
+	if query == "" {
+		return messages
+	}
+	if query != r.lastQuery {
+		r.lastQuery = query
+		r.lastContext = r.search(ctx, query)
+	}
+
+	out := make([]*schema.Message, len(messages))
+	copy(out, messages)
+
+	if len(out) > 0 && out[0].Role == schema.System {
+		// Copy the message so the original instruction is never modified in place
+		sys := *out[0]
+		if i := strings.Index(sys.Content, autoRetrievalMarker); i >= 0 {
+			sys.Content = strings.TrimRight(sys.Content[:i], "\n")
+		}
+		if r.lastContext != "" {
+			if sys.Content != "" {
+				sys.Content += "\n\n"
+			}
+			sys.Content += autoRetrievalMarker + r.lastContext
+		}
+		out[0] = &sys
+		return out
+	}
+
+	if r.lastContext == "" {
+		return out
+	}
+	return append([]*schema.Message{schema.SystemMessage(autoRetrievalMarker + r.lastContext)}, out...)
+}
+
+// search retrieves the context for a query; errors are logged and yield no context
+func (r *autoRetriever) search(ctx context.Context, query string) string {
+	results, err := r.service.Search(ctx, retrieval.SearchInput{
+		LibraryIDs: r.libraryIDs,
+		Query:      query,
+		TopK:       r.topK,
+		MinScore:   r.minScore,
+		History:    r.history,
+	})
+	if err != nil {
+		r.logger.Warn("[chat] auto retrieval failed", "error", err)
+		return ""
+	}
+	r.logger.Info("[chat] auto retrieval", "query", truncateRunes(query, 100), "results", len(results))
+	if len(results) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(autoRetrievalPreamble)
+	for i, res := range results {
+		source := res.DocumentName
+		if label := res.PageLabel(); label != "" {
+			source += " " + label
+		}
+		fmt.Fprintf(&b, "\n[%d] [%s]\n%s\n", i+1, source, strings.TrimSpace(res.Content))
+	}
+	return b.String()
+}
+
+// lastUserQuery returns the content of the latest user message (skipping the continue prompt)
+func lastUserQuery(messages []*schema.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == schema.User && messages[i].Content != continuePrompt {
+			return strings.TrimSpace(messages[i].Content)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,296 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"chatclaw/internal/errs"
+
+	"github.com/uptrace/bun"
+)
+
+// branchPreviewMaxRunes is the max rune length of a branch preview in ListBranches.
+const branchPreviewMaxRunes = 80
+
+// messageTree is an in-memory view of all messages in a conversation.
+// User/assistant messages form the tree via parent_id; tool messages hang off
+// the assistant message that produced them.
+type messageTree struct {
+	byID     map[int64]*messageModel
+	children map[int64][]*messageModel // parent_id -> non-tool children (ordered by id)
+	tools    map[int64][]*messageModel // assistant id -> tool messages (ordered by id)
+	latestID int64                     // newest non-tool message
+}
+
+// loadMessageTree loads every message of the conversation and indexes it as a tree
+func loadMessageTree(ctx context.Context, db *bun.DB, conversationID int64) (*messageTree, error) {
+	var models []messageModel
+	if err := db.NewSelect().
+		Model(&models).
+		Where("conversation_id = ?", conversationID).
+		OrderExpr("id ASC").
+		Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	t := &messageTree{
+		byID:     make(map[int64]*messageModel, len(models)),
+		children: make(map[int64][]*messageModel),
+		tools:    make(map[int64][]*messageModel),
+	}
+	for i := range models {
+		m := &models[i]
+		t.byID[m.ID] = m
+		if m.Role == RoleTool {
+			t.tools[m.ParentID] = append(t.tools[m.ParentID], m)
+			continue
+		}
+		t.children[m.ParentID] = append(t.children[m.ParentID], m)
+		t.latestID = m.ID
+	}
+	return t, nil
+}
+
+// siblings returns the branches a message belongs to (same parent and role)
+func (t *messageTree) siblings(m *messageModel) []*messageModel {
+	var out []*messageModel
+	for _, c := range t.children[m.ParentID] {
+		if c.Role == m.Role {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// deepestLeaf follows the newest child from the given message down to a leaf
+func (t *messageTree) deepestLeaf(id int64) int64 {
+	for {
+		kids := t.children[id]
+		if len(kids) == 0 {
+			return id
+		}
+		id = kids[len(kids)-1].ID
+	}
+}
+
+// path returns the messages from the root to leafID (including tool messages),
+// in chronological order
+func (t *messageTree) path(leafID int64) []*messageModel {
+	var out []*messageModel
+	seen := make(map[int64]bool)
+	for id := leafID; id != 0; {
+		m, ok := t.byID[id]
+		if !ok || seen[id] {
+			break
+		}
+		seen[id] = true
+		out = append(out, m)
+		out = append(out, t.tools[id]...)
+		id = m.ParentID
+	}
+	// IDs grow along a branch, so sorting by id restores chronological order
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// activeLeafID returns the leaf of the conversation's active branch.
+// Falls back to the newest message when none is recorded (or it was removed).
+func activeLeafID(ctx context.Context, db *bun.DB, conversationID int64, t *messageTree) (int64, error) {
+	var leafID int64
+	if err := db.NewSelect().
+		Table("conversations").
+		Column("active_leaf_id").
+		Where("id = ?", conversationID).
+		Scan(ctx, &leafID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if m, ok := t.byID[leafID]; ok && m.Role != RoleTool {
+		return leafID, nil
+	}
+	return t.latestID, nil
+}
+
+// setActiveLeaf records the leaf of the conversation's active branch
+func setActiveLeaf(ctx context.Context, db bun.IDB, conversationID, leafID int64) error {
+	_, err := db.NewUpdate().
+		Table("conversations").
+		Set("active_leaf_id = ?", leafID).
+		Where("id = ?", conversationID).
+		Exec(ctx)
+	return err
+}
+
+// currentLeafID returns the active leaf, used as the parent for the next message
+func currentLeafID(ctx context.Context, db *bun.DB, conversationID int64) (int64, error) {
+	t, err := loadMessageTree(ctx, db, conversationID)
+	if err != nil {
+		return 0, err
+	}
+	return activeLeafID(ctx, db, conversationID, t)
+}
+
+// loadActivePath returns the messages on the conversation's active branch
+func loadActivePath(ctx context.Context, db *bun.DB, conversationID int64) ([]*messageModel, *messageTree, error) {
+	t, err := loadMessageTree(ctx, db, conversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	leafID, err := activeLeafID(ctx, db, conversationID, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t.path(leafID), t, nil
+}
+
+// ListBranches returns the sibling branches of a message (alternative edits of a
+// user message, or alternative answers of an assistant message)
+func (s *ChatService) ListBranches(conversationID, messageID int64) ([]BranchInfo, error) {
+	if conversationID <= 0 {
+		return nil, errs.New("error.chat_conversation_id_required")
+	}
+	if messageID <= 0 {
+		return nil, errs.New("error.chat_message_id_required")
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	path, t, err := loadActivePath(ctx, db, conversationID)
+	if err != nil {
+		return nil, errs.Wrap("error.chat_messages_failed", err)
+	}
+	m, ok := t.byID[messageID]
+	if !ok || m.Role == RoleTool {
+		return nil, errs.New("error.chat_message_not_found")
+	}
+
+	onPath := make(map[int64]bool, len(path))
+	for _, p := range path {
+		onPath[p.ID] = true
+	}
+
+	siblings := t.siblings(m)
+	out := make([]BranchInfo, 0, len(siblings))
+	for i, sib := range siblings {
+		out = append(out, BranchInfo{
+			MessageID:     sib.ID,
+			Index:         i + 1,
+			Preview:       truncateRunes(sib.Content, branchPreviewMaxRunes),
+			Active:        onPath[sib.ID],
+			CreatedAt:     sib.CreatedAt,
+			Status:        sib.Status,
+			ProviderID:    sib.ProviderID,
+			ModelID:       sib.ModelID,
+			InputTokens:   sib.InputTokens,
+			OutputTokens:  sib.OutputTokens,
+			LatencyMs:     sib.LatencyMs,
+			AgentRevision: sib.AgentRevision,
+		})
+	}
+	return out, nil
+}
+
+// SwitchBranch makes the branch containing the given message active and returns
+// the messages of the new active path. The newest continuation of that branch is shown.
+func (s *ChatService) SwitchBranch(input SwitchBranchInput) ([]Message, error) {
+	if input.ConversationID <= 0 {
+		return nil, errs.New("error.chat_conversation_id_required")
+	}
+	if input.MessageID <= 0 {
+		return nil, errs.New("error.chat_message_id_required")
+	}
+
+	// Switching while generating would attach the new answer to the wrong branch
+	if _, ok := s.activeGenerations.Load(input.ConversationID); ok {
+		return nil, errs.New("error.chat_generation_in_progress")
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t, err := loadMessageTree(ctx, db, input.ConversationID)
+	if err != nil {
+		return nil, errs.Wrap("error.chat_messages_failed", err)
+	}
+	m, ok := t.byID[input.MessageID]
+	if !ok || m.Role == RoleTool {
+		return nil, errs.New("error.chat_message_not_found")
+	}
+
+	leafID := t.deepestLeaf(m.ID)
+	if err := setActiveLeaf(ctx, db, input.ConversationID, leafID); err != nil {
+		return nil, errs.Wrap("error.chat_branch_switch_failed", err)
+	}
+
+	return messagesWithBranchInfo(t.path(leafID), t), nil
+}
+
+// SetPreferredVariant marks an assistant answer as the preferred variant of its user turn.
+// Only the preferred variant is shown and fed into the context of later turns.
+func (s *ChatService) SetPreferredVariant(input SwitchBranchInput) ([]Message, error) {
+	if input.ConversationID <= 0 {
+		return nil, errs.New("error.chat_conversation_id_required")
+	}
+	if input.MessageID <= 0 {
+		return nil, errs.New("error.chat_message_id_required")
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role string
+	if err := db.NewSelect().
+		Model((*messageModel)(nil)).
+		Column("role").
+		Where("id = ?", input.MessageID).
+		Where("conversation_id = ?", input.ConversationID).
+		Scan(ctx, &role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.New("error.chat_message_not_found")
+		}
+		return nil, errs.Wrap("error.chat_message_read_failed", err)
+	}
+	if role != RoleAssistant {
+		return nil, errs.New("error.chat_message_not_found")
+	}
+
+	return s.SwitchBranch(input)
+}
+
+// messagesWithBranchInfo converts path messages to DTOs with sibling position filled in
+func messagesWithBranchInfo(path []*messageModel, t *messageTree) []Message {
+	messages := make([]Message, len(path))
+	for i, m := range path {
+		messages[i] = m.toDTO()
+		if m.Role == RoleTool {
+			continue
+		}
+		siblings := t.siblings(m)
+		messages[i].SiblingCount = len(siblings)
+		for j, sib := range siblings {
+			if sib.ID == m.ID {
+				messages[i].SiblingIndex = j + 1
+				break
+			}
+		}
+	}
+	return messages
+}
@@ -0,0 +1,119 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	einoagent "chatclaw/internal/eino/agent"
+	"chatclaw/internal/eino/chatmodel"
+	"chatclaw/internal/eino/tools"
+	"chatclaw/internal/services/memory"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/uptrace/bun"
+)
+
+const (
+	// memoryInjectTopK is the number of relevant memories injected into the instruction on each run
+	memoryInjectTopK = 8
+	// memoryExtractTimeout bounds the automatic extraction pass after a turn
+	memoryExtractTimeout = 2 * time.Minute
+)
+
+// memoryInstruction introduces the memories appended to the system instruction.
+const memoryInstruction = "\n\n# Long-term Memory\n" +
+	"These facts were remembered from earlier conversations. Use them when they are relevant. " +
+	"They may be outdated: the user's current messages take precedence. " +
+	"Use the remember tool to save new lasting facts, and the forget tool (with the id in brackets) to delete wrong or outdated ones.\n"
+
+// setupMemory gives a memory-enabled agent the remember/recall/forget tools and
+// appends the memories relevant to the latest user message to its instruction.
+func (s *ChatService) setupMemory(ctx context.Context, db *bun.DB, agentConfig *einoagent.Config, agentExtras AgentExtras, conversationID int64, messages []*schema.Message) []tool.BaseTool {
+	if !agentExtras.MemoryEnabled || agentExtras.AgentID <= 0 {
+		return nil
+	}
+
+	// An auto-continued run reuses the config of the previous run: replace its memory section
+	if i := strings.Index(agentConfig.Instruction, memoryInstruction); i >= 0 {
+		agentConfig.Instruction = agentConfig.Instruction[:i]
+	}
+
+	store := memory.OpenStore(ctx, db)
+	if query := lastUserQuery(messages); query != "" {
+		memories, err := store.Search(ctx, agentExtras.AgentID, query, memoryInjectTopK)
+		if err != nil {
+			s.app.Logger.Warn("[chat] memory search failed", "agent", agentExtras.AgentID, "error", err)
+		} else if len(memories) > 0 {
+			agentConfig.Instruction += formatMemories(memories)
+			s.app.Logger.Info("[chat] memories injected", "agent", agentExtras.AgentID, "count", len(memories))
+		}
+	}
+
+	memoryTools, err := tools.NewMemoryTools(ctx, &tools.MemoryToolsConfig{
+		Store:          store,
+		AgentID:        agentExtras.AgentID,
+		ConversationID: conversationID,
+		TopK:           memoryInjectTopK,
+	})
+	if err != nil {
+		s.app.Logger.Warn("[chat] failed to create memory tools", "agent", agentExtras.AgentID, "error", err)
+		return nil
+	}
+	return memoryTools
+}
+
+// formatMemories renders memories as the instruction section, with ids for the forget tool
+func formatMemories(memories []memory.Memory) string {
+	var b strings.Builder
+	b.WriteString(memoryInstruction)
+	for _, m := range memories {
+		fmt.Fprintf(&b, "- [%d] %s\n", m.ID, m.Content)
+	}
+	return b.String()
+}
+
+// extractMemories runs the automatic extraction pass for a finished turn.
+// It runs in the background with the conversation model; failures are only logged.
+func (s *ChatService) extractMemories(db *bun.DB, conversationID int64, agentConfig einoagent.Config, providerConfig einoagent.ProviderConfig, agentExtras AgentExtras, userContent, answer string) {
+	ctx, cancel := context.WithTimeout(context.Background(), memoryExtractTimeout)
+	defer cancel()
+
+	llm, err := chatmodel.NewChatModel(ctx, &chatmodel.ProviderConfig{
+		ProviderID:   providerConfig.ProviderID,
+		ProviderType: providerConfig.Type,
+		APIKey:       providerConfig.APIKey,
+		APIEndpoint:  providerConfig.APIEndpoint,
+		ModelID:      agentConfig.ModelID,
+		ExtraConfig:  providerConfig.ExtraConfig,
+		Timeout:      memoryExtractTimeout,
+	})
+	if err != nil {
+		s.app.Logger.Warn("[chat] memory extraction: create model failed", "conv", conversationID, "error", err)
+		return
+	}
+
+	store := memory.OpenStore(ctx, db)
+	known, err := store.Search(ctx, agentExtras.AgentID, userContent, memoryInjectTopK)
+	if err != nil {
+		s.app.Logger.Warn("[chat] memory extraction: search failed", "conv", conversationID, "error", err)
+	}
+
+	items, err := memory.Extract(ctx, llm, known, userContent, answer)
+	if err != nil {
+		s.app.Logger.Warn("[chat] memory extraction failed", "conv", conversationID, "error", err)
+		return
+	}
+
+	saved := 0
+	for _, item := range items {
+		if _, _, err := store.Add(ctx, agentExtras.AgentID, item.Scope, item.Content, memory.SourceExtracted, conversationID); err != nil {
+			s.app.Logger.Warn("[chat] memory extraction: save failed", "conv", conversationID, "error", err)
+			continue
+		}
+		saved++
+	}
+	s.app.Logger.Info("[chat] memory extraction", "conv", conversationID, "agent", agentExtras.AgentID, "extracted", len(items), "saved", saved)
+}
@@ -38,14 +38,31 @@ type Message struct {
 	Error           string    `json:"error,omitempty"`
 	InputTokens     int       `json:"input_tokens"`
 	OutputTokens    int       `json:"output_tokens"`
+	LatencyMs       int64     `json:"latency_ms"` // assistant only: time from request to final answer
 	FinishReason    string    `json:"finish_reason,omitempty"`
 	ToolCalls       string    `json:"tool_calls,omitempty"`
 	ToolCallID      string    `json:"tool_call_id,omitempty"`
 	ToolCallName    string    `json:"tool_call_name,omitempty"`
 	ThinkingContent string    `json:"thinking_content,omitempty"`
 	Segments        string    `json:"segments,omitempty"` // JSON array for interleaved content/tool-call order
+	AgentRevision   int       `json:"agent_revision"`     // assistant only: agent revision that produced the answer (0 = unknown)
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
+
+	// Conversation tree: messages sharing a parent (and role) are alternative branches
+	ParentID     int64 `json:"parent_id"`
+	SiblingIndex int   `json:"sibling_index"` // 1-based position among siblings
+	SiblingCount int   `json:"sibling_count"`
+
+	// Tool results of a sub-agent called as a tool: the sub-agent that ran the tool.
+	// ToolCalls then holds the sub-agent's call, which is not part of the parent's tool history.
+	AgentID   int64  `json:"agent_id,omitempty"`
+	AgentName string `json:"agent_name,omitempty"`
+
+	// Structured output (agents with a response schema): the validated JSON answer,
+	// or why the answer does not match the schema after the repair attempts
+	StructuredOutput string `json:"structured_output,omitempty"`
+	StructuredError  string `json:"structured_error,omitempty"`
 }
 
 // SendMessageInput input for sending a message
@@ -63,6 +80,45 @@ type EditAndResendInput struct {
 	TabID          string `json:"tab_id"`
 }
 
+// SwitchBranchInput input for switching to another branch of the conversation tree
+type SwitchBranchInput struct {
+	ConversationID int64 `json:"conversation_id"`
+	MessageID      int64 `json:"message_id"` // any message of the target branch
+}
+
+// RegenerateMessageInput input for generating an alternative answer to a user turn
+type RegenerateMessageInput struct {
+	ConversationID int64  `json:"conversation_id"`
+	MessageID      int64  `json:"message_id"`            // the assistant answer to regenerate, or its user message
+	ProviderID     string `json:"provider_id,omitempty"` // optional: defaults to the conversation model
+	ModelID        string `json:"model_id,omitempty"`
+	TabID          string `json:"tab_id"`
+}
+
+// ContinueGenerationInput input for resuming an interrupted or truncated answer
+type ContinueGenerationInput struct {
+	ConversationID int64  `json:"conversation_id"`
+	MessageID      int64  `json:"message_id"` // the assistant message to continue
+	TabID          string `json:"tab_id"`
+}
+
+// BranchInfo describes one sibling branch of a message.
+// For assistant messages each branch is an answer variant; model and usage are filled in for comparison.
+type BranchInfo struct {
+	MessageID     int64     `json:"message_id"`
+	Index         int       `json:"index"` // 1-based
+	Preview       string    `json:"preview"`
+	Active        bool      `json:"active"` // on the currently displayed path
+	CreatedAt     time.Time `json:"created_at"`
+	Status        string    `json:"status"`
+	ProviderID    string    `json:"provider_id,omitempty"`
+	ModelID       string    `json:"model_id,omitempty"`
+	InputTokens   int       `json:"input_tokens"`
+	OutputTokens  int       `json:"output_tokens"`
+	LatencyMs     int64     `json:"latency_ms"`
+	AgentRevision int       `json:"agent_revision"`
+}
+
 // SendMessageResult result of sending a message
 type SendMessageResult struct {
 	RequestID string `json:"request_id"`
@@ -85,12 +141,20 @@ type messageModel struct {
 	Error           string    `bun:"error,notnull"`
 	InputTokens     int       `bun:"input_tokens,notnull"`
 	OutputTokens    int       `bun:"output_tokens,notnull"`
+	LatencyMs       int64     `bun:"latency_ms,notnull"`
 	FinishReason    string    `bun:"finish_reason,notnull"`
 	ToolCalls       string    `bun:"tool_calls,notnull"`
 	ToolCallID      string    `bun:"tool_call_id,notnull"`
 	ToolCallName    string    `bun:"tool_call_name,notnull"`
 	ThinkingContent string    `bun:"thinking_content,notnull"`
 	Segments        string    `bun:"segments,notnull"`
+	ParentID        int64     `bun:"parent_id,notnull"`
+	AgentRevision   int       `bun:"agent_revision,notnull"`
+	AgentID         int64     `bun:"agent_id,notnull"`
+	AgentName       string    `bun:"agent_name,notnull"`
+
+	StructuredOutput string `bun:"structured_output,notnull"`
+	StructuredError  string `bun:"structured_error,notnull"`
 }
 
 var _ bun.BeforeInsertHook = (*messageModel)(nil)
@@ -121,14 +185,24 @@ func (m *messageModel) toDTO() Message {
 		Error:           m.Error,
 		InputTokens:     m.InputTokens,
 		OutputTokens:    m.OutputTokens,
+		LatencyMs:       m.LatencyMs,
 		FinishReason:    m.FinishReason,
 		ToolCalls:       m.ToolCalls,
 		ToolCallID:      m.ToolCallID,
 		ToolCallName:    m.ToolCallName,
 		ThinkingContent: m.ThinkingContent,
 		Segments:        m.Segments,
+		AgentRevision:   m.AgentRevision,
+		AgentID:         m.AgentID,
+		AgentName:       m.AgentName,
 		CreatedAt:       m.CreatedAt,
 		UpdatedAt:       m.UpdatedAt,
+		ParentID:        m.ParentID,
+		SiblingIndex:    1,
+		SiblingCount:    1,
+
+		StructuredOutput: m.StructuredOutput,
+		StructuredError:  m.StructuredError,
 	}
 }
 
@@ -142,6 +216,13 @@ type ChatEvent struct {
 	Ts             int64  `json:"ts"`
 }
 
+// AgentSource identifies the sub-agent that produced an event or segment (empty for the conversation agent)
+type AgentSource struct {
+	AgentID   int64  `json:"agent_id,omitempty"`
+	AgentName string `json:"agent_name,omitempty"`
+	Internal  bool   `json:"internal,omitempty"` // output of a sub-agent called as a tool, not part of the answer text
+}
+
 // ChatStartEvent event sent when generation starts
 type ChatStartEvent struct {
 	ChatEvent
@@ -151,18 +232,21 @@ type ChatStartEvent struct {
 // ChatChunkEvent event sent for content chunks
 type ChatChunkEvent struct {
 	ChatEvent
+	AgentSource
 	Delta string `json:"delta"`
 }
 
 // ChatThinkingEvent event sent for thinking content
 type ChatThinkingEvent struct {
 	ChatEvent
+	AgentSource
 	Delta string `json:"delta"`
 }
 
 // ChatToolEvent event sent for tool calls and results
 type ChatToolEvent struct {
 	ChatEvent
+	AgentSource
 	Type       string `json:"type"` // "call" or "result"
 	ToolCallID string `json:"tool_call_id"`
 	ToolName   string `json:"tool_name"`
@@ -175,6 +259,11 @@ type ChatCompleteEvent struct {
 	ChatEvent
 	Status       string `json:"status"`
 	FinishReason string `json:"finish_reason"`
+
+	// Content replaces the streamed answer when it was rewritten after streaming (repaired structured output)
+	Content          string `json:"content,omitempty"`
+	StructuredOutput string `json:"structured_output,omitempty"`
+	StructuredError  string `json:"structured_error,omitempty"`
 }
 
 // ChatStoppedEvent event sent when generation is stopped
@@ -0,0 +1,169 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"chatclaw/internal/errs"
+
+	"github.com/uptrace/bun"
+	"github.com/wailsapp/wails/v3/pkg/application"
+)
+
+// FinishReasonInterrupted marks answers whose generation was cut off by an app quit or crash
+const FinishReasonInterrupted = "interrupted"
+
+const (
+	// maxAutoContinue caps automatic continuations of answers truncated by the token limit
+	maxAutoContinue = 3
+	// progressSaveInterval is how often a streaming answer is persisted
+	progressSaveInterval = 2 * time.Second
+)
+
+// continuePrompt is appended to the context when resuming a partial answer
+const continuePrompt = "Your previous answer was interrupted. Continue it exactly from where it stopped. " +
+	"Do not repeat what was already written and do not add any preamble."
+
+// generationResume continues an existing assistant message instead of creating a new one
+type generationResume struct {
+	message          *messageModel
+	autoContinueLeft int
+}
+
+// isLengthFinish reports whether the provider stopped because of the output token limit
+func isLengthFinish(reason string) bool {
+	return reason == "length" || reason == "max_tokens"
+}
+
+// ServiceStartup recovers generations that were interrupted by the previous run of the app
+func (s *ChatService) ServiceStartup(ctx context.Context, options application.ServiceOptions) error {
+	s.recoverInterruptedGenerations()
+	return nil
+}
+
+// recoverInterruptedGenerations marks messages left streaming/pending by a crash or forced quit
+// as cancelled. The partial content and segments saved during streaming are kept, and the
+// "interrupted" finish reason lets the UI offer ContinueGeneration.
+func (s *ChatService) recoverInterruptedGenerations() {
+	db, err := s.db()
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := db.NewUpdate().
+		Model((*messageModel)(nil)).
+		Set("status = ?", StatusCancelled).
+		Set("finish_reason = ?", FinishReasonInterrupted).
+		Where("status IN (?)", bun.In([]string{StatusStreaming, StatusPending})).
+		Exec(ctx)
+	if err != nil {
+		s.app.Logger.Error("[chat] recover interrupted generations failed", "error", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		s.app.Logger.Info("[chat] recovered interrupted generations", "count", n)
+	}
+}
+
+// getMessageModel loads a single message by ID
+func (s *ChatService) getMessageModel(db *bun.DB, messageID int64) (*messageModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var m messageModel
+	if err := db.NewSelect().
+		Model(&m).
+		Where("id = ?", messageID).
+		Scan(ctx); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ContinueGeneration resumes an interrupted or truncated assistant answer in place.
+// The model is asked to continue from the partial answer and the new text is appended to it.
+func (s *ChatService) ContinueGeneration(input ContinueGenerationInput) (*SendMessageResult, error) {
+	if input.ConversationID <= 0 {
+		return nil, errs.New("error.chat_conversation_id_required")
+	}
+	if input.MessageID <= 0 {
+		return nil, errs.New("error.chat_message_id_required")
+	}
+
+	s.app.Logger.Info("[chat] ContinueGeneration", "conv", input.ConversationID, "tab", input.TabID, "msg", input.MessageID)
+
+	gen, genCtx, err := s.reserveGeneration(input.ConversationID, input.TabID)
+	if err != nil {
+		return nil, err
+	}
+	started := false
+	defer func() {
+		if !started {
+			s.releaseGeneration(input.ConversationID, gen)
+		}
+	}()
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tree, err := loadMessageTree(ctx, db, input.ConversationID)
+	if err != nil {
+		return nil, errs.Wrap("error.chat_message_read_failed", err)
+	}
+	msg, ok := tree.byID[input.MessageID]
+	if !ok || msg.Role != RoleAssistant {
+		return nil, errs.New("error.chat_message_not_found")
+	}
+	// Only the last answer of a branch can be continued; later turns were built on the partial text
+	if len(tree.children[msg.ID]) > 0 || msg.Status == StatusStreaming || msg.Status == StatusPending {
+		return nil, errs.New("error.chat_message_not_resumable")
+	}
+
+	// Failed answers are excluded from the context; keep the partial text as a cancelled answer
+	if msg.Status == StatusError {
+		if _, err := db.NewUpdate().
+			Model((*messageModel)(nil)).
+			Set("status = ?", StatusCancelled).
+			Set("error = ?", "").
+			Where("id = ?", msg.ID).
+			Exec(ctx); err != nil {
+			return nil, errs.Wrap("error.chat_message_update_failed", err)
+		}
+		msg.Status = StatusCancelled
+	}
+
+	// Continue with the model that wrote the partial answer (only when both halves were recorded)
+	providerID, modelID := msg.ProviderID, msg.ModelID
+	if providerID == "" || modelID == "" {
+		providerID, modelID = "", ""
+	}
+	agentConfig, providerConfig, agentExtras, err := s.getAgentAndProviderConfig(ctx, db, input.ConversationID, providerID, modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setActiveLeaf(ctx, db, input.ConversationID, msg.ID); err != nil {
+		return nil, errs.Wrap("error.chat_branch_switch_failed", err)
+	}
+
+	started = true
+	go func() {
+		defer close(gen.done)
+		defer s.tryDeleteGeneration(input.ConversationID, gen)
+		s.runGenerationWithExistingHistory(genCtx, db, input.ConversationID, input.TabID, gen.requestID, agentConfig, providerConfig, agentExtras,
+			&generationResume{message: msg, autoContinueLeft: maxAutoContinue})
+	}()
+
+	return &SendMessageResult{
+		RequestID: gen.requestID,
+		MessageID: msg.ID,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"chatclaw/internal/errs"
+)
+
+// backgroundTabID is the tab of generations started without a chat tab (e.g. scheduled runs)
+const backgroundTabID = "background"
+
+// RunResult is the answer of a generation started by RunMessage
+type RunResult struct {
+	ConversationID   int64  `json:"conversation_id"`
+	MessageID        int64  `json:"message_id"`
+	Status           string `json:"status"`
+	Content          string `json:"content"`
+	Error            string `json:"error,omitempty"`
+	StructuredOutput string `json:"structured_output,omitempty"`
+}
+
+// RunMessage sends a message to a conversation and waits for the answer.
+// It runs the same generation as SendMessage (events are emitted with the "background" tab);
+// cancelling ctx stops the generation and returns the partial answer.
+func (s *ChatService) RunMessage(ctx context.Context, conversationID int64, content string) (*RunResult, error) {
+	res, err := s.SendMessage(SendMessageInput{
+		ConversationID: conversationID,
+		Content:        content,
+		TabID:          backgroundTabID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The generation may already be finished and unregistered
+	if existing, ok := s.activeGenerations.Load(conversationID); ok {
+		gen := existing.(*activeGeneration)
+		if gen.requestID == res.RequestID {
+			select {
+			case <-gen.done:
+			case <-ctx.Done():
+				gen.cancel()
+				<-gen.done
+			}
+		}
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+	dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	leafID, err := currentLeafID(dbCtx, db, conversationID)
+	if err != nil {
+		return nil, errs.Wrap("error.chat_messages_failed", err)
+	}
+	msg, err := s.getMessageModel(db, leafID)
+	if err != nil {
+		return nil, errs.Wrap("error.chat_messages_failed", err)
+	}
+	if msg.Role != RoleAssistant {
+		// The generation failed before the answer placeholder was created
+		return nil, errs.Wrap("error.chat_messages_failed", fmt.Errorf("no answer for message %d", msg.ID))
+	}
+
+	return &RunResult{
+		ConversationID:   conversationID,
+		MessageID:        msg.ID,
+		Status:           msg.Status,
+		Content:          msg.Content,
+		Error:            msg.Error,
+		StructuredOutput: msg.StructuredOutput,
+	}, nil
+}
@@ -13,10 +13,12 @@ import (
 	"time"
 
 	einoagent "chatclaw/internal/eino/agent"
+	"chatclaw/internal/eino/chatmodel"
 	einoembed "chatclaw/internal/eino/embedding"
 	"chatclaw/internal/eino/processor"
 	"chatclaw/internal/eino/tools"
 	"chatclaw/internal/errs"
+	"chatclaw/internal/services/agents"
 	"chatclaw/internal/services/retrieval"
 	"chatclaw/internal/sqlite"
 
@@ -112,7 +114,7 @@ func (s *ChatService) db() (*bun.DB, error) {
 	return db, nil
 }
 
-// GetMessages returns all messages for a conversation
+// GetMessages returns the messages on the active branch of a conversation
 func (s *ChatService) GetMessages(conversationID int64) ([]Message, error) {
 	if conversationID <= 0 {
 		return nil, errs.New("error.chat_conversation_id_required")
@@ -126,20 +128,12 @@ func (s *ChatService) GetMessages(conversationID int64) ([]Message, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var models []messageModel
-	if err := db.NewSelect().
-		Model(&models).
-		Where("conversation_id = ?", conversationID).
-		OrderExpr("created_at ASC, id ASC").
-		Scan(ctx); err != nil {
+	// Only the active branch of the conversation tree is returned
+	path, tree, err := loadActivePath(ctx, db, conversationID)
+	if err != nil {
 		return nil, errs.Wrap("error.chat_messages_failed", err)
 	}
-
-	messages := make([]Message, len(models))
-	for i := range models {
-		messages[i] = models[i].toDTO()
-	}
-	return messages, nil
+	return messagesWithBranchInfo(path, tree), nil
 }
 
 // SendMessage sends a message and starts a ReAct generation loop
@@ -154,14 +148,17 @@ func (s *ChatService) SendMessage(input SendMessageInput) (*SendMessageResult, e
 
 	s.app.Logger.Info("[chat] SendMessage", "conv", input.ConversationID, "tab", input.TabID, "content_len", len(content))
 
-	// Check if there's already an active generation for this conversation
-	if existing, ok := s.activeGenerations.Load(input.ConversationID); ok {
-		gen := existing.(*activeGeneration)
-		if gen.tabID != input.TabID {
-			return nil, errs.New("error.chat_generation_in_progress_other_tab")
-		}
-		return nil, errs.New("error.chat_generation_in_progress")
+	// Register the generation first so two quick sends cannot both start one
+	gen, genCtx, err := s.reserveGeneration(input.ConversationID, input.TabID)
+	if err != nil {
+		return nil, err
 	}
+	started := false
+	defer func() {
+		if !started {
+			s.releaseGeneration(input.ConversationID, gen)
+		}
+	}()
 
 	db, err := s.db()
 	if err != nil {
@@ -171,40 +168,27 @@ func (s *ChatService) SendMessage(input SendMessageInput) (*SendMessageResult, e
 	ctx := context.Background()
 
 	// Get conversation and agent info
-	agentConfig, providerConfig, agentExtras, err := s.getAgentAndProviderConfig(ctx, db, input.ConversationID)
+	agentConfig, providerConfig, agentExtras, err := s.getAgentAndProviderConfig(ctx, db, input.ConversationID, "", "")
 	if err != nil {
 		return nil, err
 	}
 
-	// Generate request ID
-	requestID := uuid.New().String()
-
-	// Create cancellable context for generation
-	genCtx, cancel := context.WithCancel(ctx)
-
-	// Register active generation
-	gen := &activeGeneration{
-		cancel:    cancel,
-		requestID: requestID,
-		tabID:     input.TabID,
-		done:      make(chan struct{}),
-	}
-	s.activeGenerations.Store(input.ConversationID, gen)
-
 	// Start generation in goroutine
+	started = true
 	go func() {
 		defer close(gen.done)
 		defer s.tryDeleteGeneration(input.ConversationID, gen)
-		s.runGeneration(genCtx, db, input.ConversationID, input.TabID, requestID, content, agentConfig, providerConfig, agentExtras)
+		s.runGeneration(genCtx, db, input.ConversationID, input.TabID, gen.requestID, content, agentConfig, providerConfig, agentExtras)
 	}()
 
 	return &SendMessageResult{
-		RequestID: requestID,
+		RequestID: gen.requestID,
 		MessageID: 0, // Will be sent via event
 	}, nil
 }
 
-// EditAndResend edits a message and resends
+// EditAndResend resends an edited copy of a user message as a new branch.
+// The original message and everything after it stay available via SwitchBranch.
 func (s *ChatService) EditAndResend(input EditAndResendInput) (*SendMessageResult, error) {
 	if input.ConversationID <= 0 {
 		return nil, errs.New("error.chat_conversation_id_required")
@@ -223,8 +207,8 @@ func (s *ChatService) EditAndResend(input EditAndResendInput) (*SendMessageResul
 	if existing, ok := s.activeGenerations.Load(input.ConversationID); ok {
 		oldGen := existing.(*activeGeneration)
 		oldGen.cancel()
-		s.activeGenerations.Delete(input.ConversationID)
-		// Wait for old goroutine to finish (with timeout to avoid deadlock)
+		// Wait for old goroutine to finish (with timeout to avoid deadlock); it unregisters itself on exit
+		// so the reservation below succeeds
 		select {
 		case <-oldGen.done:
 			// Old generation finished cleanly
@@ -236,6 +220,17 @@ func (s *ChatService) EditAndResend(input EditAndResendInput) (*SendMessageResul
 		}
 	}
 
+	gen, genCtx, err := s.reserveGeneration(input.ConversationID, input.TabID)
+	if err != nil {
+		return nil, err
+	}
+	started := false
+	defer func() {
+		if !started {
+			s.releaseGeneration(input.ConversationID, gen)
+		}
+	}()
+
 	db, err := s.db()
 	if err != nil {
 		return nil, err
@@ -258,51 +253,120 @@ func (s *ChatService) EditAndResend(input EditAndResendInput) (*SendMessageResul
 		return nil, errs.Wrap("error.chat_message_read_failed", err)
 	}
 
-	// Delete all messages after this one
-	if err := s.deleteMessagesAfter(ctx, db, input.ConversationID, input.MessageID, false); err != nil {
+	// Resolve the agent and provider before touching the tree, so a bad config leaves no orphan branch
+	agentConfig, providerConfig, agentExtras, err := s.getAgentAndProviderConfig(ctx, db, input.ConversationID, "", "")
+	if err != nil {
 		return nil, err
 	}
 
-	// Update the message content
-	if _, err := db.NewUpdate().
-		Model((*messageModel)(nil)).
-		Set("content = ?", content).
-		Where("id = ?", input.MessageID).
-		Exec(ctx); err != nil {
-		return nil, errs.Wrap("error.chat_message_update_failed", err)
+	// Keep the original message and its answers: the edit becomes a sibling branch
+	edited := &messageModel{
+		ConversationID: input.ConversationID,
+		Role:           RoleUser,
+		Content:        content,
+		Status:         StatusSuccess,
+		ToolCalls:      "[]",
+		ParentID:       msg.ParentID,
+	}
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(edited).Exec(ctx); err != nil {
+			return errs.Wrap("error.chat_message_save_failed", err)
+		}
+		if err := setActiveLeaf(ctx, tx, input.ConversationID, edited.ID); err != nil {
+			return errs.Wrap("error.chat_branch_switch_failed", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Start generation in goroutine (don't insert user message, it's already there)
+	started = true
+	go func() {
+		defer close(gen.done)
+		defer s.tryDeleteGeneration(input.ConversationID, gen)
+		s.runGenerationWithExistingHistory(genCtx, db, input.ConversationID, input.TabID, gen.requestID, agentConfig, providerConfig, agentExtras, nil)
+	}()
+
+	return &SendMessageResult{
+		RequestID: gen.requestID,
+		MessageID: edited.ID,
+	}, nil
+}
+
+// RegenerateMessage generates another answer for the same user turn, optionally with a
+// different provider/model. The new answer is stored as a variant (sibling) of the existing
+// answers and becomes the active one; earlier variants are kept for comparison.
+func (s *ChatService) RegenerateMessage(input RegenerateMessageInput) (*SendMessageResult, error) {
+	if input.ConversationID <= 0 {
+		return nil, errs.New("error.chat_conversation_id_required")
+	}
+	if input.MessageID <= 0 {
+		return nil, errs.New("error.chat_message_id_required")
 	}
 
-	// Get agent and provider config
-	agentConfig, providerConfig, agentExtras, err := s.getAgentAndProviderConfig(ctx, db, input.ConversationID)
+	s.app.Logger.Info("[chat] RegenerateMessage", "conv", input.ConversationID, "tab", input.TabID, "msg", input.MessageID, "provider", input.ProviderID, "model", input.ModelID)
+
+	// A provider without its model (or the reverse) would pair the override with the conversation's other half
+	providerID := strings.TrimSpace(input.ProviderID)
+	modelID := strings.TrimSpace(input.ModelID)
+	if (providerID == "") != (modelID == "") {
+		return nil, errs.New("error.chat_model_override_incomplete")
+	}
+
+	gen, genCtx, err := s.reserveGeneration(input.ConversationID, input.TabID)
 	if err != nil {
 		return nil, err
 	}
+	started := false
+	defer func() {
+		if !started {
+			s.releaseGeneration(input.ConversationID, gen)
+		}
+	}()
 
-	// Generate request ID
-	requestID := uuid.New().String()
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
 
-	// Create cancellable context for generation
-	genCtx, genCancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	// Register active generation
-	gen := &activeGeneration{
-		cancel:    genCancel,
-		requestID: requestID,
-		tabID:     input.TabID,
-		done:      make(chan struct{}),
+	tree, err := loadMessageTree(ctx, db, input.ConversationID)
+	if err != nil {
+		return nil, errs.Wrap("error.chat_message_read_failed", err)
 	}
-	s.activeGenerations.Store(input.ConversationID, gen)
 
-	// Start generation in goroutine (don't insert user message, it's already there)
+	// Resolve the user turn being answered
+	userMsg, ok := tree.byID[input.MessageID]
+	if ok && userMsg.Role == RoleAssistant {
+		userMsg, ok = tree.byID[userMsg.ParentID]
+	}
+	if !ok || userMsg.Role != RoleUser {
+		return nil, errs.New("error.chat_message_not_found")
+	}
+
+	agentConfig, providerConfig, agentExtras, err := s.getAgentAndProviderConfig(ctx, db, input.ConversationID, providerID, modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The new answer is attached to the active leaf, so point it at the user turn
+	if err := setActiveLeaf(ctx, db, input.ConversationID, userMsg.ID); err != nil {
+		return nil, errs.Wrap("error.chat_branch_switch_failed", err)
+	}
+
+	started = true
 	go func() {
 		defer close(gen.done)
 		defer s.tryDeleteGeneration(input.ConversationID, gen)
-		s.runGenerationWithExistingHistory(genCtx, db, input.ConversationID, input.TabID, requestID, agentConfig, providerConfig, agentExtras)
+		s.runGenerationWithExistingHistory(genCtx, db, input.ConversationID, input.TabID, gen.requestID, agentConfig, providerConfig, agentExtras, nil)
 	}()
 
 	return &SendMessageResult{
-		RequestID: requestID,
-		MessageID: input.MessageID,
+		RequestID: gen.requestID,
+		MessageID: 0, // Will be sent via event
 	}, nil
 }
 
@@ -323,29 +387,31 @@ func (s *ChatService) StopGeneration(conversationID int64) error {
 	return nil
 }
 
-// deleteMessagesAfter deletes all messages after the given message ID
-// archive parameter is reserved for future use
-func (s *ChatService) deleteMessagesAfter(ctx context.Context, db *bun.DB, conversationID, messageID int64, archive bool) error {
-	// TODO: If archive is true, move messages to an archive table instead of deleting
-	_, err := db.NewDelete().
-		Model((*messageModel)(nil)).
-		Where("conversation_id = ?", conversationID).
-		Where("id > ?", messageID).
-		Exec(ctx)
-	if err != nil {
-		return errs.Wrap("error.chat_messages_delete_failed", err)
-	}
-	return nil
-}
-
 // AgentExtras contains additional agent configuration not in einoagent.Config
 type AgentExtras struct {
+	AgentID        int64
+	SubAgents      []agents.SubAgentRef // sub-agents of the conversation agent
 	LibraryIDs     []int64
 	MatchThreshold float64
+	RetrievalMode  string // agents.RetrievalModeTool / Always / Off
+	AgentRevision  int    // agent configuration revision, recorded on assistant messages
+
+	// Long-term memory: memory tools + injected memories, and extraction after each turn
+	MemoryEnabled     bool
+	MemoryAutoExtract bool
+
+	// Conversation workspace overriding the agent workspaces (also applied to sub-agents)
+	WorkspaceDir string
+
+	// Query transformation before retrieval (empty provider/model means use the chat model)
+	QueryTransform           retrieval.QueryTransformOptions
+	QueryTransformProviderID string
+	QueryTransformModelID    string
 }
 
-// getAgentAndProviderConfig gets the agent and provider configuration for a conversation
-func (s *ChatService) getAgentAndProviderConfig(ctx context.Context, db *bun.DB, conversationID int64) (einoagent.Config, einoagent.ProviderConfig, AgentExtras, error) {
+// getAgentAndProviderConfig gets the agent and provider configuration for a conversation.
+// providerOverride/modelOverride (both set or both empty) take precedence over the conversation settings.
+func (s *ChatService) getAgentAndProviderConfig(ctx context.Context, db *bun.DB, conversationID int64, providerOverride, modelOverride string) (einoagent.Config, einoagent.ProviderConfig, AgentExtras, error) {
 	// Get conversation
 	type conversationRow struct {
 		AgentID        int64  `bun:"agent_id"`
@@ -353,11 +419,12 @@ func (s *ChatService) getAgentAndProviderConfig(ctx context.Context, db *bun.DB,
 		LLMModelID     string `bun:"llm_model_id"`
 		LibraryIDs     string `bun:"library_ids"`
 		EnableThinking bool   `bun:"enable_thinking"`
+		WorkspaceDir   string `bun:"workspace_dir"`
 	}
 	var conv conversationRow
 	if err := db.NewSelect().
 		Table("conversations").
-		Column("agent_id", "llm_provider_id", "llm_model_id", "library_ids", "enable_thinking").
+		Column("agent_id", "llm_provider_id", "llm_model_id", "library_ids", "enable_thinking", "workspace_dir").
 		Where("id = ?", conversationID).
 		Scan(ctx, &conv); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -366,8 +433,8 @@ func (s *ChatService) getAgentAndProviderConfig(ctx context.Context, db *bun.DB,
 		return einoagent.Config{}, einoagent.ProviderConfig{}, AgentExtras{}, errs.Wrap("error.chat_conversation_read_failed", err)
 	}
 
-	// Parse conversation-level library_ids JSON array
-	var convLibraryIDs []int64
+	// Parse conversation-level library_ids JSON array (non-nil: the conversation decides, even when empty)
+	convLibraryIDs := []int64{}
 	if conv.LibraryIDs != "" && conv.LibraryIDs != "[]" {
 		if err := json.Unmarshal([]byte(conv.LibraryIDs), &convLibraryIDs); err != nil {
 			s.app.Logger.Warn("[chat] failed to parse library_ids", "conv", conversationID, "error", err)
@@ -376,6 +443,45 @@ func (s *ChatService) getAgentAndProviderConfig(ctx context.Context, db *bun.DB,
 		}
 	}
 
+	// Explicit override > conversation > agent default.
+	// The override replaces the provider and model together, never one of them.
+	if (providerOverride == "") != (modelOverride == "") {
+		return einoagent.Config{}, einoagent.ProviderConfig{}, AgentExtras{}, errs.New("error.chat_model_override_incomplete")
+	}
+	providerID := conv.LLMProviderID
+	modelID := conv.LLMModelID
+	if providerOverride != "" {
+		providerID = providerOverride
+		modelID = modelOverride
+	}
+
+	return s.loadAgentConfig(ctx, db, agentConfigInput{
+		AgentID:        conv.AgentID,
+		ProviderID:     providerID,
+		ModelID:        modelID,
+		LibraryIDs:     convLibraryIDs,
+		EnableThinking: conv.EnableThinking,
+		WorkspaceDir:   conv.WorkspaceDir,
+	})
+}
+
+// agentConfigInput selects the agent to load and the model to run it with.
+type agentConfigInput struct {
+	AgentID int64
+
+	// Preferred model; the agent default is used when empty, then the fallback
+	ProviderID         string
+	ModelID            string
+	FallbackProviderID string
+	FallbackModelID    string
+
+	LibraryIDs     []int64 // nil means the agent's default libraries
+	EnableThinking bool
+	WorkspaceDir   string // non-empty overrides the agent's workspace root
+}
+
+// loadAgentConfig builds the eino config of an agent (conversation agent or sub-agent).
+func (s *ChatService) loadAgentConfig(ctx context.Context, db *bun.DB, in agentConfigInput) (einoagent.Config, einoagent.ProviderConfig, AgentExtras, error) {
 	// Get agent
 	type agentRow struct {
 		Name                    string  `bun:"name"`
@@ -391,6 +497,23 @@ func (s *ChatService) getAgentAndProviderConfig(ctx context.Context, db *bun.DB,
 		LLMMaxContextCount      int     `bun:"llm_max_context_count"`
 		RetrievalTopK           int     `bun:"retrieval_top_k"`
 		RetrievalMatchThreshold float64 `bun:"retrieval_match_threshold"`
+		QueryRewriteEnabled     bool    `bun:"query_rewrite_enabled"`
+		MultiQueryEnabled       bool    `bun:"multi_query_enabled"`
+		HyDEEnabled             bool    `bun:"hyde_enabled"`
+		QueryTransformProvider  string  `bun:"query_transform_provider_id"`
+		QueryTransformModel     string  `bun:"query_transform_model_id"`
+		RetrievalMode           string  `bun:"retrieval_mode"`
+		ToolIDs                 string  `bun:"tool_ids"`
+		Revision                int     `bun:"revision"`
+		LibraryIDs              string  `bun:"library_ids"`
+		SubAgents               string  `bun:"sub_agents"`
+		MemoryEnabled           bool    `bun:"memory_enabled"`
+		MemoryAutoExtract       bool    `bun:"memory_auto_extract"`
+		ResponseSchema          string  `bun:"response_schema"`
+		WorkspaceDir            string  `bun:"workspace_dir"`
+		ReadOnlyPaths           string  `bun:"read_only_paths"`
+		CommandMode             string  `bun:"command_mode"`
+		AllowedCommands         string  `bun:"allowed_commands"`
 	}
 	var agent agentRow
 	if err := db.NewSelect().
@@ -398,8 +521,12 @@ func (s *ChatService) getAgentAndProviderConfig(ctx context.Context, db *bun.DB,
 		Column("name", "prompt", "default_llm_provider_id", "default_llm_model_id",
 			"llm_temperature", "llm_top_p", "llm_max_tokens",
 			"enable_llm_temperature", "enable_llm_top_p", "enable_llm_max_tokens",
-			"llm_max_context_count", "retrieval_top_k", "retrieval_match_threshold").
-		Where("id = ?", conv.AgentID).
+			"llm_max_context_count", "retrieval_top_k", "retrieval_match_threshold",
+			"query_rewrite_enabled", "multi_query_enabled", "hyde_enabled",
+			"query_transform_provider_id", "query_transform_model_id", "retrieval_mode", "tool_ids", "revision", "library_ids", "sub_agents",
+			"memory_enabled", "memory_auto_extract", "response_schema",
+			"workspace_dir", "read_only_paths", "command_mode", "allowed_commands").
+		Where("id = ?", in.AgentID).
 		Scan(ctx, &agent); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return einoagent.Config{}, einoagent.ProviderConfig{}, AgentExtras{}, errs.New("error.chat_agent_not_found")
@@ -407,15 +534,18 @@ func (s *ChatService) getAgentAndProviderConfig(ctx context.Context, db *bun.DB,
 		return einoagent.Config{}, einoagent.ProviderConfig{}, AgentExtras{}, errs.Wrap("error.chat_agent_read_failed", err)
 	}
 
-	// Determine which provider/model to use (conversation overrides agent default)
-	providerID := conv.LLMProviderID
-	modelID := conv.LLMModelID
+	// Determine which provider/model to use (preferred > agent default > fallback)
+	providerID := in.ProviderID
+	modelID := in.ModelID
 	if providerID == "" {
 		providerID = agent.DefaultLLMProviderID
 	}
 	if modelID == "" {
 		modelID = agent.DefaultLLMModelID
 	}
+	if providerID == "" || modelID == "" {
+		providerID, modelID = in.FallbackProviderID, in.FallbackModelID
+	}
 
 	if providerID == "" || modelID == "" {
 		return einoagent.Config{}, einoagent.ProviderConfig{}, AgentExtras{}, errs.New("error.chat_model_not_configured")
@@ -461,7 +591,44 @@ func (s *ChatService) getAgentAndProviderConfig(ctx context.Context, db *bun.DB,
 		EnableMaxTokens: agent.EnableLLMMaxTokens,
 		ContextCount:    agent.LLMMaxContextCount,
 		RetrievalTopK:   agent.RetrievalTopK,
-		EnableThinking:  conv.EnableThinking,
+		EnableThinking:  in.EnableThinking,
+	}
+
+	// Tool allow-list (JSON array); empty or invalid means all tools
+	if agent.ToolIDs != "" && agent.ToolIDs != "[]" {
+		if err := json.Unmarshal([]byte(agent.ToolIDs), &agentConfig.ToolIDs); err != nil {
+			s.app.Logger.Warn("[chat] failed to parse agent tool_ids", "agent", in.AgentID, "error", err)
+			agentConfig.ToolIDs = nil
+		}
+	}
+
+	// Structured output; an invalid schema (saved before validation existed) is ignored
+	if strings.TrimSpace(agent.ResponseSchema) != "" {
+		format, err := einoagent.ParseResponseFormat(agent.ResponseSchema)
+		if err != nil {
+			s.app.Logger.Warn("[chat] failed to parse agent response_schema", "agent", in.AgentID, "error", err)
+		} else {
+			agentConfig.ResponseFormat = format
+		}
+	}
+
+	// Workspace sandbox of the filesystem and execute tools (empty root = user home directory)
+	agentConfig.Workspace = einoagent.WorkspaceConfig{
+		Root:             agent.WorkspaceDir,
+		CommandAllowlist: agent.CommandMode == agents.CommandModeAllowlist,
+	}
+	if in.WorkspaceDir != "" {
+		agentConfig.Workspace.Root = in.WorkspaceDir
+	}
+	if agent.ReadOnlyPaths != "" && agent.ReadOnlyPaths != "[]" {
+		if err := json.Unmarshal([]byte(agent.ReadOnlyPaths), &agentConfig.Workspace.ReadOnlyPaths); err != nil {
+			s.app.Logger.Warn("[chat] failed to parse agent read_only_paths", "agent", in.AgentID, "error", err)
+		}
+	}
+	if agent.AllowedCommands != "" && agent.AllowedCommands != "[]" {
+		if err := json.Unmarshal([]byte(agent.AllowedCommands), &agentConfig.Workspace.AllowedCommands); err != nil {
+			s.app.Logger.Warn("[chat] failed to parse agent allowed_commands", "agent", in.AgentID, "error", err)
+		}
 	}
 
 	providerConfig := einoagent.ProviderConfig{
@@ -472,19 +639,75 @@ func (s *ChatService) getAgentAndProviderConfig(ctx context.Context, db *bun.DB,
 		ExtraConfig: provider.ExtraConfig,
 	}
 
-	// Use conversation-level library_ids for retrieval
-	if len(convLibraryIDs) > 0 {
-		s.app.Logger.Info("[chat] using library_ids", "library_ids", convLibraryIDs)
+	// Use conversation-level library_ids for retrieval; sub-agents search their own libraries
+	libraryIDs := in.LibraryIDs
+	if libraryIDs == nil && agent.LibraryIDs != "" && agent.LibraryIDs != "[]" {
+		if err := json.Unmarshal([]byte(agent.LibraryIDs), &libraryIDs); err != nil {
+			s.app.Logger.Warn("[chat] failed to parse agent library_ids", "agent", in.AgentID, "error", err)
+			libraryIDs = nil
+		}
+	}
+	if len(libraryIDs) > 0 {
+		s.app.Logger.Info("[chat] using library_ids", "agent", in.AgentID, "library_ids", libraryIDs)
+	}
+
+	retrievalMode := agent.RetrievalMode
+	if !agents.IsValidRetrievalMode(retrievalMode) {
+		retrievalMode = agents.RetrievalModeTool
 	}
 
 	extras := AgentExtras{
-		LibraryIDs:     convLibraryIDs,
+		AgentID:        in.AgentID,
+		SubAgents:      agents.ParseSubAgents(agent.SubAgents),
+		LibraryIDs:     libraryIDs,
 		MatchThreshold: agent.RetrievalMatchThreshold,
+		RetrievalMode:  retrievalMode,
+		AgentRevision:  agent.Revision,
+
+		MemoryEnabled:     agent.MemoryEnabled,
+		MemoryAutoExtract: agent.MemoryEnabled && agent.MemoryAutoExtract,
+
+		WorkspaceDir: in.WorkspaceDir,
+
+		QueryTransform: retrieval.QueryTransformOptions{
+			Rewrite:    agent.QueryRewriteEnabled,
+			MultiQuery: agent.MultiQueryEnabled,
+			HyDE:       agent.HyDEEnabled,
+		},
+		QueryTransformProviderID: agent.QueryTransformProvider,
+		QueryTransformModelID:    agent.QueryTransformModel,
 	}
 
 	return agentConfig, providerConfig, extras, nil
 }
 
+// reserveGeneration atomically registers a new generation for the conversation, failing when
+// another one is already active. releaseGeneration must be called if the generation goroutine is never started.
+func (s *ChatService) reserveGeneration(conversationID int64, tabID string) (*activeGeneration, context.Context, error) {
+	genCtx, cancel := context.WithCancel(context.Background())
+	gen := &activeGeneration{
+		cancel:    cancel,
+		requestID: uuid.New().String(),
+		tabID:     tabID,
+		done:      make(chan struct{}),
+	}
+	if existing, loaded := s.activeGenerations.LoadOrStore(conversationID, gen); loaded {
+		cancel()
+		if existing.(*activeGeneration).tabID != tabID {
+			return nil, nil, errs.New("error.chat_generation_in_progress_other_tab")
+		}
+		return nil, nil, errs.New("error.chat_generation_in_progress")
+	}
+	return gen, genCtx, nil
+}
+
+// releaseGeneration drops a reserved generation whose goroutine was never started.
+func (s *ChatService) releaseGeneration(conversationID int64, gen *activeGeneration) {
+	gen.cancel()
+	close(gen.done)
+	s.tryDeleteGeneration(conversationID, gen)
+}
+
 // tryDeleteGeneration removes the generation from the map only if it is still the active one.
 // This prevents a finishing old goroutine from deleting a newer generation's entry.
 func (s *ChatService) tryDeleteGeneration(conversationID int64, gen *activeGeneration) {
@@ -521,29 +744,43 @@ func (s *ChatService) runGeneration(ctx context.Context, db *bun.DB, conversatio
 		})
 	}
 
-	// Insert user message
+	dbCtx, dbCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	parentID, err := currentLeafID(dbCtx, db, conversationID)
+	if err != nil {
+		dbCancel()
+		emitError("error.chat_message_save_failed", nil)
+		return
+	}
+
+	// Insert user message as a child of the active branch
 	userMsg := &messageModel{
 		ConversationID: conversationID,
 		Role:           RoleUser,
 		Content:        userContent,
 		Status:         StatusSuccess,
 		ToolCalls:      "[]",
+		ParentID:       parentID,
 	}
 
-	dbCtx, dbCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	if _, err := db.NewInsert().Model(userMsg).Exec(dbCtx); err != nil {
 		dbCancel()
 		emitError("error.chat_message_save_failed", nil)
 		return
 	}
+	if err := setActiveLeaf(dbCtx, db, conversationID, userMsg.ID); err != nil {
+		dbCancel()
+		emitError("error.chat_message_save_failed", nil)
+		return
+	}
 	dbCancel()
 
 	// Run generation with existing history
-	s.runGenerationWithExistingHistory(ctx, db, conversationID, tabID, requestID, agentConfig, providerConfig, agentExtras)
+	s.runGenerationWithExistingHistory(ctx, db, conversationID, tabID, requestID, agentConfig, providerConfig, agentExtras, nil)
 }
 
-// runGenerationWithExistingHistory runs the generation loop with existing message history
-func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *bun.DB, conversationID int64, tabID, requestID string, agentConfig einoagent.Config, providerConfig einoagent.ProviderConfig, agentExtras AgentExtras) {
+// runGenerationWithExistingHistory runs the generation loop with existing message history.
+// When resume is set, the existing assistant message is continued instead of creating a new one.
+func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *bun.DB, conversationID int64, tabID, requestID string, agentConfig einoagent.Config, providerConfig einoagent.ProviderConfig, agentExtras AgentExtras, resume *generationResume) {
 
 	var seq int32 = 0
 	nextSeq := func() int {
@@ -570,24 +807,50 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 		})
 	}
 
-	// Create assistant message placeholder
-	assistantMsg := &messageModel{
-		ConversationID: conversationID,
-		Role:           RoleAssistant,
-		Content:        "",
-		ProviderID:     providerConfig.ProviderID,
-		ModelID:        agentConfig.ModelID,
-		Status:         StatusStreaming,
-		ToolCalls:      "[]",
-	}
+	// Latency is measured from the placeholder creation to the final update
+	startedAt := time.Now()
+	autoContinueLeft := maxAutoContinue
 
-	dbCtx, dbCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	if _, err := db.NewInsert().Model(assistantMsg).Exec(dbCtx); err != nil {
+	var assistantMsg *messageModel
+	if resume != nil {
+		assistantMsg = resume.message
+		autoContinueLeft = resume.autoContinueLeft
+		// Latency accumulates across continuations of the same answer
+		startedAt = startedAt.Add(-time.Duration(assistantMsg.LatencyMs) * time.Millisecond)
+	} else {
+		dbCtx, dbCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		parentID, err := currentLeafID(dbCtx, db, conversationID)
+		if err != nil {
+			dbCancel()
+			emitError("error.chat_message_save_failed", nil)
+			return
+		}
+
+		// Create assistant message placeholder as an answer to the active branch
+		assistantMsg = &messageModel{
+			ConversationID: conversationID,
+			Role:           RoleAssistant,
+			Content:        "",
+			ProviderID:     providerConfig.ProviderID,
+			ModelID:        agentConfig.ModelID,
+			Status:         StatusStreaming,
+			ToolCalls:      "[]",
+			ParentID:       parentID,
+			AgentRevision:  agentExtras.AgentRevision,
+		}
+
+		if _, err := db.NewInsert().Model(assistantMsg).Exec(dbCtx); err != nil {
+			dbCancel()
+			emitError("error.chat_message_save_failed", nil)
+			return
+		}
+		if err := setActiveLeaf(dbCtx, db, conversationID, assistantMsg.ID); err != nil {
+			dbCancel()
+			emitError("error.chat_message_save_failed", nil)
+			return
+		}
 		dbCancel()
-		emitError("error.chat_message_save_failed", nil)
-		return
 	}
-	dbCancel()
 
 	// Emit start event
 	emit(EventChatStart, ChatStartEvent{
@@ -609,6 +872,11 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 		s.updateMessageStatus(db, assistantMsg.ID, StatusError, "Failed to load messages", "")
 		return
 	}
+	if resume != nil {
+		// The partial answer is already part of the context; ask the model to pick up from there
+		messages = append(messages, schema.UserMessage(continuePrompt))
+		s.updateMessageStatus(db, assistantMsg.ID, StatusStreaming, "", "")
+	}
 
 	// LLM request log
 	s.app.Logger.Info("[llm] start", "conv", conversationID, "tab", tabID, "req", requestID,
@@ -618,24 +886,13 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 	s.app.Logger.Info("[llm] context", "conv", conversationID, "req", requestID, "context", summarizeMessagesForLog(messages, 12, llmLogMaxContent))
 
 	// Create extra tools (e.g., LibraryRetrieverTool if agent has associated libraries)
-	var extraTools []tool.BaseTool
-	if len(agentExtras.LibraryIDs) > 0 {
-		retrieverTool, toolErr := s.createLibraryRetrieverTool(ctx, db, agentExtras.LibraryIDs, agentConfig.RetrievalTopK, agentExtras.MatchThreshold)
-		if toolErr != nil {
-			s.app.Logger.Warn("[chat] failed to create library retriever tool", "error", toolErr)
-			// Continue without the retriever tool
-		} else if retrieverTool != nil {
-			extraTools = append(extraTools, retrieverTool)
-			s.app.Logger.Info("[chat] library retriever tool created", "libraries", len(agentExtras.LibraryIDs), "topK", agentConfig.RetrievalTopK, "threshold", agentExtras.MatchThreshold)
-
-			// Append knowledge-base-first hint to the system instruction so that the LLM
-			// prioritizes the library_retriever tool over web search tools.
-			agentConfig.Instruction += "\n\n[IMPORTANT] A private knowledge base is attached to this conversation. " +
-				"You MUST use the library_retriever tool FIRST to search for answers before using any web search tools (duckduckgo_search, wikipedia_search, etc.). " +
-				"When calling library_retriever, ALWAYS provide 2-5 queries from different angles, using varied keywords and phrasings, to ensure comprehensive coverage. " +
-				"Only fall back to web search if the knowledge base returns no relevant results."
-		}
-	}
+	extraTools := s.setupRetrieval(ctx, db, &agentConfig, agentExtras, providerConfig, messages)
+	extraTools = append(extraTools, s.setupMemory(ctx, db, &agentConfig, agentExtras, conversationID, messages)...)
+
+	// Sub-agents (called as tools or handed the conversation); they run with the conversation model when they have none
+	subAgents, subAgentInfos, cleanupSubAgents := s.buildSubAgents(ctx, db, conversationID, agentExtras, agentConfig, providerConfig, messages)
+	defer cleanupSubAgents()
+	agentConfig.SubAgents = subAgents
 
 	// Create agent (includes per-session browserTool; cleanup releases its Chrome process)
 	agentConfig.Provider = providerConfig
@@ -680,22 +937,24 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 		Type        string   `json:"type"`                    // "thinking", "content" or "tools"
 		Content     string   `json:"content,omitempty"`       // for type="content" or "thinking"
 		ToolCallIDs []string `json:"tool_call_ids,omitempty"` // for type="tools"
+		AgentSource                                           // sub-agent that produced the segment
 	}
 	var segments []segment
 	var lastSegmentType string                             // "thinking", "content", or "tools"
 	var lastSegmentToolCallIDs map[string]bool // to track which tool calls are in the last segment
+	var source AgentSource                     // producer of the current event (zero for the conversation agent)
 
 	// Helper to add thinking to segments
 	addThinkingToSegments := func(thinking string) {
 		if thinking == "" {
 			return
 		}
-		if lastSegmentType == "thinking" && len(segments) > 0 {
+		if lastSegmentType == "thinking" && len(segments) > 0 && segments[len(segments)-1].AgentSource == source {
 			// Append to last thinking segment
 			segments[len(segments)-1].Content += thinking
 		} else {
 			// Start new thinking segment
-			segments = append(segments, segment{Type: "thinking", Content: thinking})
+			segments = append(segments, segment{Type: "thinking", Content: thinking, AgentSource: source})
 			lastSegmentType = "thinking"
 			lastSegmentToolCallIDs = nil
 		}
@@ -706,12 +965,12 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 		if content == "" {
 			return
 		}
-		if lastSegmentType == "content" && len(segments) > 0 {
+		if lastSegmentType == "content" && len(segments) > 0 && segments[len(segments)-1].AgentSource == source {
 			// Append to last content segment
 			segments[len(segments)-1].Content += content
 		} else {
 			// Start new content segment
-			segments = append(segments, segment{Type: "content", Content: content})
+			segments = append(segments, segment{Type: "content", Content: content, AgentSource: source})
 			lastSegmentType = "content"
 			lastSegmentToolCallIDs = nil
 		}
@@ -722,9 +981,9 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 		if toolCallID == "" {
 			return
 		}
-		if lastSegmentType != "tools" || len(segments) == 0 {
+		if lastSegmentType != "tools" || len(segments) == 0 || segments[len(segments)-1].AgentSource != source {
 			// Start new tools segment
-			segments = append(segments, segment{Type: "tools", ToolCallIDs: []string{toolCallID}})
+			segments = append(segments, segment{Type: "tools", ToolCallIDs: []string{toolCallID}, AgentSource: source})
 			lastSegmentType = "tools"
 			lastSegmentToolCallIDs = map[string]bool{toolCallID: true}
 		} else if !lastSegmentToolCallIDs[toolCallID] {
@@ -840,6 +1099,61 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 		}
 	}
 
+	// Continuing an answer: start from what was already generated
+	if resume != nil {
+		contentBuilder.WriteString(assistantMsg.Content)
+		thinkingBuilder.WriteString(assistantMsg.ThinkingContent)
+		inputTokens, outputTokens = assistantMsg.InputTokens, assistantMsg.OutputTokens
+		if assistantMsg.Segments != "" {
+			_ = json.Unmarshal([]byte(assistantMsg.Segments), &segments)
+		}
+		if len(segments) > 0 {
+			last := segments[len(segments)-1]
+			lastSegmentType = last.Type
+			if last.Type == "tools" {
+				lastSegmentToolCallIDs = make(map[string]bool, len(last.ToolCallIDs))
+				for _, id := range last.ToolCallIDs {
+					lastSegmentToolCallIDs[id] = true
+				}
+			}
+		}
+		var prevCalls []schema.ToolCall
+		if err := json.Unmarshal([]byte(assistantMsg.ToolCalls), &prevCalls); err == nil {
+			for _, tc := range prevCalls {
+				if tc.ID == "" || toolStatesByKey[tc.ID] != nil {
+					continue
+				}
+				toolStatesByKey[tc.ID] = &toolCallState{id: tc.ID, name: tc.Function.Name, args: tc.Function.Arguments}
+				toolOrder = append(toolOrder, tc.ID)
+			}
+			if len(prevCalls) > 0 {
+				toolCallsJSON = []byte(assistantMsg.ToolCalls)
+			}
+		}
+	}
+
+	// Periodically persist the partial answer so it survives a crash or forced quit
+	lastProgressSave := time.Now()
+	saveProgress := func() {
+		if time.Since(lastProgressSave) < progressSaveInterval {
+			return
+		}
+		lastProgressSave = time.Now()
+		segmentsJSON, _ := json.Marshal(segments)
+		s.updateMessageProgress(db, assistantMsg.ID, contentBuilder.String(), thinkingBuilder.String(), string(toolCallsJSON), string(segmentsJSON))
+	}
+
+	// saveToolMessage stores a tool result under the assistant message
+	saveToolMessage := func(toolMsg *messageModel) {
+		dbCtx, dbCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer dbCancel()
+		if _, err := db.NewInsert().Model(toolMsg).Exec(dbCtx); err != nil {
+			s.app.Logger.Warn("[chat] failed to save tool message", "conv", conversationID, "tool", toolMsg.ToolCallName, "call_id", toolMsg.ToolCallID, "error", err)
+		}
+	}
+	// Calls made by sub-agents called as tools, saved with their results
+	subAgentToolCalls := make(map[string]schema.ToolCall)
+
 	iter := runner.Run(ctx, messages)
 	for {
 		event, ok := iter.Next()
@@ -851,7 +1165,7 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 		if ctx.Err() != nil {
 			// Save partial content
 			segmentsJSON, _ := json.Marshal(segments)
-			s.updateMessageFinal(db, assistantMsg.ID, contentBuilder.String(), thinkingBuilder.String(), string(toolCallsJSON), string(segmentsJSON), StatusCancelled, "", "cancelled", inputTokens, outputTokens)
+			s.updateMessageFinal(db, assistantMsg.ID, contentBuilder.String(), thinkingBuilder.String(), string(toolCallsJSON), string(segmentsJSON), StatusCancelled, "", "cancelled", inputTokens, outputTokens, time.Since(startedAt).Milliseconds())
 			emit(EventChatStopped, ChatStoppedEvent{
 				ChatEvent: ChatEvent{
 					ConversationID: conversationID,
@@ -885,10 +1199,93 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 					segmentsStr = string(segBytes)
 				}
 			}
-			s.updateMessageFinal(db, assistantMsg.ID, contentBuilder.String(), thinkingBuilder.String(), toolCallsStr, segmentsStr, StatusError, errMsg, "", inputTokens, outputTokens)
+			s.updateMessageFinal(db, assistantMsg.ID, contentBuilder.String(), thinkingBuilder.String(), toolCallsStr, segmentsStr, StatusError, errMsg, "", inputTokens, outputTokens, time.Since(startedAt).Milliseconds())
 			return
 		}
 
+		if event.Action != nil && event.Action.TransferToAgent != nil {
+			s.app.Logger.Info("[chat] transfer to sub-agent", "conv", conversationID, "req", requestID, "from", event.AgentName, "to", event.Action.TransferToAgent.DestAgentName)
+		}
+
+		// Attribute the event to the sub-agent that produced it
+		source = AgentSource{}
+		if info, ok := subAgentInfos[event.AgentName]; ok {
+			source = info.source()
+		}
+
+		// A sub-agent called as a tool: show its output live and keep it in the segments, but not in the
+		// answer content or tool history; the parent receives its final answer as the tool result.
+		if source.Internal {
+			if event.Output != nil && event.Output.MessageOutput != nil {
+				chatEvent := func() ChatEvent {
+					return ChatEvent{
+						ConversationID: conversationID,
+						TabID:          tabID,
+						RequestID:      requestID,
+						Seq:            nextSeq(),
+						MessageID:      assistantMsg.ID,
+						Ts:             time.Now().UnixMilli(),
+					}
+				}
+				err := streamSubAgentOutput(event.Output.MessageOutput, subAgentSink{
+					thinking: func(delta string) {
+						addThinkingToSegments(delta)
+						emit(EventChatThinking, ChatThinkingEvent{ChatEvent: chatEvent(), AgentSource: source, Delta: delta})
+					},
+					content: func(delta string) {
+						addContentToSegments(delta)
+						emit(EventChatChunk, ChatChunkEvent{ChatEvent: chatEvent(), AgentSource: source, Delta: delta})
+					},
+					toolCall: func(call schema.ToolCall) {
+						s.app.Logger.Info("[llm] sub-agent tool_call", "conv", conversationID, "req", requestID, "agent", source.AgentID, "tool", call.Function.Name, "call_id", call.ID, "args", truncateRunes(call.Function.Arguments, 300))
+						addToolCallToSegments(call.ID)
+						subAgentToolCalls[call.ID] = call
+						emit(EventChatTool, ChatToolEvent{ChatEvent: chatEvent(), AgentSource: source, Type: "call",
+							ToolCallID: call.ID, ToolName: call.Function.Name, ArgsJSON: call.Function.Arguments})
+					},
+					toolResult: func(msg *schema.Message) {
+						s.app.Logger.Info("[llm] sub-agent tool_result", "conv", conversationID, "req", requestID, "agent", source.AgentID, "tool", msg.Name, "call_id", msg.ToolCallID, "result_len", len(msg.Content))
+						emit(EventChatTool, ChatToolEvent{ChatEvent: chatEvent(), AgentSource: source, Type: "result",
+							ToolCallID: msg.ToolCallID, ToolName: msg.Name, ResultJSON: msg.Content})
+
+						// Save with the sub-agent's call so the result can be shown after a reload;
+						// the agent source keeps it out of the parent's tool history.
+						toolCalls := "[]"
+						toolName := msg.Name
+						if call, ok := subAgentToolCalls[msg.ToolCallID]; ok {
+							if b, err := json.Marshal([]schema.ToolCall{call}); err == nil {
+								toolCalls = string(b)
+							}
+							if toolName == "" {
+								toolName = call.Function.Name
+							}
+						}
+						saveToolMessage(&messageModel{
+							ConversationID: conversationID,
+							Role:           RoleTool,
+							Content:        msg.Content,
+							Status:         StatusSuccess,
+							ToolCallID:     msg.ToolCallID,
+							ToolCallName:   toolName,
+							ToolCalls:      toolCalls,
+							ParentID:       assistantMsg.ID,
+							AgentID:        source.AgentID,
+							AgentName:      source.AgentName,
+						})
+					},
+					usage: func(usage *schema.TokenUsage) {
+						inputTokens += int(usage.PromptTokens)
+						outputTokens += int(usage.CompletionTokens)
+					},
+				})
+				if err != nil && ctx.Err() == nil {
+					s.app.Logger.Warn("[chat] sub-agent stream failed", "conv", conversationID, "req", requestID, "agent", source.AgentID, "error", err)
+				}
+				saveProgress()
+			}
+			continue
+		}
+
 		if event.Output != nil && event.Output.MessageOutput != nil {
 			msgOutput := event.Output.MessageOutput
 
@@ -922,7 +1319,8 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 								MessageID:      assistantMsg.ID,
 								Ts:             time.Now().UnixMilli(),
 							},
-							Delta: msg.ReasoningContent,
+							AgentSource: source,
+							Delta:       msg.ReasoningContent,
 						})
 					}
 
@@ -939,7 +1337,8 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 								MessageID:      assistantMsg.ID,
 								Ts:             time.Now().UnixMilli(),
 							},
-							Delta: msg.Content,
+							AgentSource: source,
+							Delta:       msg.Content,
 						})
 					}
 
@@ -995,10 +1394,11 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 									MessageID:      assistantMsg.ID,
 									Ts:             time.Now().UnixMilli(),
 								},
-								Type:       "call",
-								ToolCallID: resolvedID,
-								ToolName:   toolName,
-								ArgsJSON:   args,
+								AgentSource: source,
+								Type:        "call",
+								ToolCallID:  resolvedID,
+								ToolName:    toolName,
+								ArgsJSON:    args,
 							})
 						}
 					}
@@ -1014,6 +1414,8 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 						outputTokens += int(msg.ResponseMeta.Usage.CompletionTokens)
 					}
 				}
+
+				saveProgress()
 			}
 		} else if msgOutput.Message != nil {
 				// Non-streaming message
@@ -1046,14 +1448,15 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 							MessageID:      assistantMsg.ID,
 							Ts:             time.Now().UnixMilli(),
 						},
-						Type:       "result",
-						ToolCallID: msg.ToolCallID,
-						ToolName:   toolName,
-						ResultJSON: msg.Content,
+						AgentSource: source,
+						Type:        "result",
+						ToolCallID:  msg.ToolCallID,
+						ToolName:    toolName,
+						ResultJSON:  msg.Content,
 					})
 
 					// Save tool message to DB
-					toolMsg := &messageModel{
+					saveToolMessage(&messageModel{
 						ConversationID: conversationID,
 						Role:           RoleTool,
 						Content:        msg.Content,
@@ -1061,12 +1464,8 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 						ToolCallID:     msg.ToolCallID,
 						ToolCallName:   toolName,
 						ToolCalls:      "[]",
-					}
-					dbCtx, dbCancel := context.WithTimeout(context.Background(), 5*time.Second)
-					if _, err := db.NewInsert().Model(toolMsg).Exec(dbCtx); err != nil {
-						s.app.Logger.Warn("[chat] failed to save tool message", "conv", conversationID, "tool", toolName, "call_id", msg.ToolCallID, "error", err)
-					}
-					dbCancel()
+						ParentID:       assistantMsg.ID,
+					})
 				} else if msg.Content != "" {
 					contentBuilder.WriteString(msg.Content)
 					addContentToSegments(msg.Content)
@@ -1079,7 +1478,8 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 							MessageID:      assistantMsg.ID,
 							Ts:             time.Now().UnixMilli(),
 						},
-						Delta: msg.Content,
+						AgentSource: source,
+						Delta:       msg.Content,
 					})
 				}
 
@@ -1094,6 +1494,8 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 					outputTokens += int(msg.ResponseMeta.Usage.CompletionTokens)
 				}
 			}
+
+			saveProgress()
 		}
 	}
 	}
@@ -1101,7 +1503,7 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 	// Check final cancellation
 	if ctx.Err() != nil {
 		segmentsJSONFinal, _ := json.Marshal(segments)
-		s.updateMessageFinal(db, assistantMsg.ID, contentBuilder.String(), thinkingBuilder.String(), string(toolCallsJSON), string(segmentsJSONFinal), StatusCancelled, "", "cancelled", inputTokens, outputTokens)
+		s.updateMessageFinal(db, assistantMsg.ID, contentBuilder.String(), thinkingBuilder.String(), string(toolCallsJSON), string(segmentsJSONFinal), StatusCancelled, "", "cancelled", inputTokens, outputTokens, time.Since(startedAt).Milliseconds())
 		s.app.Logger.Info("[llm] complete", "conv", conversationID, "tab", tabID, "req", requestID,
 			"status", StatusCancelled, "finish", "cancelled", "input_tokens", inputTokens,
 			"output_tokens", outputTokens, "content_len", len(contentBuilder.String()), "thinking_len", len(thinkingBuilder.String()))
@@ -1119,6 +1521,30 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 		return
 	}
 
+	// Structured output: validate the complete answer (not a truncated one that will be continued)
+	validateStructured := agentConfig.ResponseFormat != nil && !(isLengthFinish(finishReason) && autoContinueLeft > 0)
+	var structured structuredResult
+	replaced := false
+	if validateStructured {
+		structured = s.validateStructuredOutput(ctx, agentConfig, providerConfig, messages, contentBuilder.String())
+		if structured.Content != contentBuilder.String() {
+			// The repaired answer replaces the streamed answer text
+			replaced = true
+			contentBuilder.Reset()
+			contentBuilder.WriteString(structured.Content)
+			kept := segments[:0]
+			for _, seg := range segments {
+				if seg.Type == "content" && !seg.Internal {
+					continue
+				}
+				kept = append(kept, seg)
+			}
+			segments = append(kept, segment{Type: "content", Content: structured.Content})
+		}
+		s.app.Logger.Info("[chat] structured output", "conv", conversationID, "req", requestID,
+			"valid", structured.Output != "", "repairs", structured.Repairs, "error", structured.Error)
+	}
+
 	// Update final message
 	toolCallsStr := "[]"
 	if len(toolCallsJSON) > 0 {
@@ -1130,7 +1556,10 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 			segmentsStr = string(segBytes)
 		}
 	}
-	s.updateMessageFinal(db, assistantMsg.ID, contentBuilder.String(), thinkingBuilder.String(), toolCallsStr, segmentsStr, StatusSuccess, "", finishReason, inputTokens, outputTokens)
+	s.updateMessageFinal(db, assistantMsg.ID, contentBuilder.String(), thinkingBuilder.String(), toolCallsStr, segmentsStr, StatusSuccess, "", finishReason, inputTokens, outputTokens, time.Since(startedAt).Milliseconds())
+	if validateStructured {
+		s.updateMessageStructured(db, assistantMsg.ID, structured.Output, structured.Error)
+	}
 
 	// LLM completion log
 	s.app.Logger.Info("[llm] complete", "conv", conversationID, "tab", tabID, "req", requestID,
@@ -1139,8 +1568,22 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 		"thinking_len", len(thinkingBuilder.String()), "tool_calls_len", len(toolCallsStr))
 	s.app.Logger.Info("[llm] output", "conv", conversationID, "req", requestID, "output", truncateRunes(contentBuilder.String(), llmLogMaxOutput))
 
+	// The answer was cut off by the output token limit: continue it in place
+	if isLengthFinish(finishReason) && autoContinueLeft > 0 {
+		if next, err := s.getMessageModel(db, assistantMsg.ID); err == nil {
+			s.app.Logger.Info("[chat] auto-continue truncated answer", "conv", conversationID, "req", requestID, "msg", assistantMsg.ID, "left", autoContinueLeft-1)
+			s.runGenerationWithExistingHistory(ctx, db, conversationID, tabID, requestID, agentConfig, providerConfig, agentExtras,
+				&generationResume{message: next, autoContinueLeft: autoContinueLeft - 1})
+			return
+		}
+	}
+
+	if agentExtras.MemoryAutoExtract {
+		go s.extractMemories(db, conversationID, agentConfig, providerConfig, agentExtras, lastUserQuery(messages), contentBuilder.String())
+	}
+
 	// Emit complete event
-	emit(EventChatComplete, ChatCompleteEvent{
+	completeEvent := ChatCompleteEvent{
 		ChatEvent: ChatEvent{
 			ConversationID: conversationID,
 			TabID:          tabID,
@@ -1149,50 +1592,85 @@ func (s *ChatService) runGenerationWithExistingHistory(ctx context.Context, db *
 			MessageID:      assistantMsg.ID,
 			Ts:             time.Now().UnixMilli(),
 		},
-		Status:       StatusSuccess,
-		FinishReason: finishReason,
-	})
+		Status:           StatusSuccess,
+		FinishReason:     finishReason,
+		StructuredOutput: structured.Output,
+		StructuredError:  structured.Error,
+	}
+	if replaced {
+		completeEvent.Content = contentBuilder.String()
+	}
+	emit(EventChatComplete, completeEvent)
 }
 
-// loadMessagesForContext loads messages for agent context
-// contextCount: maximum number of messages to include (0 or >=200 means unlimited)
-func (s *ChatService) loadMessagesForContext(ctx context.Context, db *bun.DB, conversationID int64, contextCount int) ([]*schema.Message, error) {
-	var models []messageModel
-
-	// Determine if we need to limit context
-	needLimit := contextCount > 0 && contextCount < 200
-
-	q := db.NewSelect().
-		Model(&models).
-		Where("conversation_id = ?", conversationID).
-		Where("status IN (?)", bun.In([]string{StatusSuccess, StatusCancelled}))
+// setupRetrieval configures knowledge base retrieval for an agent according to its retrieval mode.
+// It returns the extra tools (library_retriever) and may set a message modifier or extend the instruction.
+func (s *ChatService) setupRetrieval(ctx context.Context, db *bun.DB, agentConfig *einoagent.Config, agentExtras AgentExtras, providerConfig einoagent.ProviderConfig, messages []*schema.Message) []tool.BaseTool {
+	var extraTools []tool.BaseTool
+	if len(agentExtras.LibraryIDs) > 0 {
+		switch agentExtras.RetrievalMode {
+		case agents.RetrievalModeOff:
+			s.app.Logger.Info("[chat] knowledge base retrieval is off for this agent", "libraries", len(agentExtras.LibraryIDs))
+
+		case agents.RetrievalModeAlways:
+			// Retrieve before every LLM call and inject the results, for models that never call tools
+			retrievalService, svcErr := s.createRetrievalService(ctx, db, agentExtras, providerConfig, agentConfig.ModelID)
+			if svcErr != nil {
+				s.app.Logger.Warn("[chat] failed to create retrieval service for auto retrieval", "error", svcErr)
+			} else {
+				agentConfig.MessageModifier = newAutoRetriever(s.app.Logger, retrievalService, agentExtras, agentConfig.RetrievalTopK, messages).inject
+				s.app.Logger.Info("[chat] auto retrieval enabled", "libraries", len(agentExtras.LibraryIDs), "topK", agentConfig.RetrievalTopK, "threshold", agentExtras.MatchThreshold)
+			}
 
-	if needLimit {
-		// Get the latest N messages: order DESC with limit, then reverse in memory
-		q = q.OrderExpr("created_at DESC, id DESC").Limit(contextCount)
-	} else {
-		// No limit: get all messages in chronological order
-		q = q.OrderExpr("created_at ASC, id ASC")
+		default:
+			retrieverTool, toolErr := s.createLibraryRetrieverTool(ctx, db, agentExtras, agentConfig.RetrievalTopK, providerConfig, agentConfig.ModelID, messages)
+			if toolErr != nil {
+				s.app.Logger.Warn("[chat] failed to create library retriever tool", "error", toolErr)
+				// Continue without the retriever tool
+			} else if retrieverTool != nil {
+				extraTools = append(extraTools, retrieverTool)
+				s.app.Logger.Info("[chat] library retriever tool created", "libraries", len(agentExtras.LibraryIDs), "topK", agentConfig.RetrievalTopK, "threshold", agentExtras.MatchThreshold)
+
+				// Append knowledge-base-first hint to the system instruction so that the LLM
+				// prioritizes the library_retriever tool over web search tools.
+				agentConfig.Instruction += "\n\n[IMPORTANT] A private knowledge base is attached to this conversation. " +
+					"You MUST use the library_retriever tool FIRST to search for answers before using any web search tools (duckduckgo_search, wikipedia_search, etc.). " +
+					"When calling library_retriever, ALWAYS provide 2-5 queries from different angles, using varied keywords and phrasings, to ensure comprehensive coverage. " +
+					"Only fall back to web search if the knowledge base returns no relevant results."
+			}
+		}
 	}
+	return extraTools
+}
 
-	if err := q.Scan(ctx); err != nil {
+// loadMessagesForContext loads messages for agent context
+// contextCount: maximum number of messages to include (0 or >=200 means unlimited)
+func (s *ChatService) loadMessagesForContext(ctx context.Context, db *bun.DB, conversationID int64, contextCount int) ([]*schema.Message, error) {
+	// Only the active branch is sent to the model; other branches are alternatives
+	path, _, err := loadActivePath(ctx, db, conversationID)
+	if err != nil {
 		return nil, err
 	}
 
-	// If we limited and ordered DESC, reverse to get chronological order
-	if needLimit {
-		for i, j := 0, len(models)-1; i < j; i, j = i+1, j-1 {
-			models[i], models[j] = models[j], models[i]
+	models := make([]*messageModel, 0, len(path))
+	for _, m := range path {
+		if m.Status == StatusSuccess || m.Status == StatusCancelled {
+			models = append(models, m)
 		}
 	}
 
+	// Keep only the latest N messages when a limit is configured
+	if contextCount > 0 && contextCount < 200 && len(models) > contextCount {
+		models = models[len(models)-contextCount:]
+	}
+
 	// Build maps for repairing assistant tool_calls entries:
 	// 1. toolNameByCallID: maps tool_call_id -> tool name for name recovery
 	// 2. answeredToolCallIDs: set of tool_call_ids that have a corresponding tool result message
 	toolNameByCallID := make(map[string]string)
 	answeredToolCallIDs := make(map[string]bool)
 	for _, m := range models {
-		if m.Role == RoleTool && m.ToolCallID != "" {
+		if m.Role == RoleTool && m.ToolCallID != "" && m.AgentID == 0 {
 			answeredToolCallIDs[m.ToolCallID] = true
 			if m.ToolCallName != "" {
 				if _, ok := toolNameByCallID[m.ToolCallID]; !ok {
@@ -1213,6 +1691,10 @@ func (s *ChatService) loadMessagesForContext(ctx context.Context, db *bun.DB, co
 		case RoleSystem:
 			role = schema.System
 		case RoleTool:
+			// Tool results of sub-agents belong to the sub-agent's own run, not to this history
+			if m.AgentID != 0 {
+				continue
+			}
 			role = schema.Tool
 		default:
 			continue
@@ -1290,7 +1772,7 @@ func (s *ChatService) updateMessageStatus(db *bun.DB, messageID int64, status, e
 }
 
 // updateMessageFinal updates the final message content
-func (s *ChatService) updateMessageFinal(db *bun.DB, messageID int64, content, thinking, toolCalls, segmentsJSON, status, errorMsg, finishReason string, inputTokens, outputTokens int) {
+func (s *ChatService) updateMessageFinal(db *bun.DB, messageID int64, content, thinking, toolCalls, segmentsJSON, status, errorMsg, finishReason string, inputTokens, outputTokens int, latencyMs int64) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -1305,18 +1787,70 @@ func (s *ChatService) updateMessageFinal(db *bun.DB, messageID int64, content, t
 		Set("finish_reason = ?", finishReason).
 		Set("input_tokens = ?", inputTokens).
 		Set("output_tokens = ?", outputTokens).
+		Set("latency_ms = ?", latencyMs).
 		Where("id = ?", messageID).
 		Exec(ctx); err != nil {
 		s.app.Logger.Error("update message final failed", "messageID", messageID, "error", err)
 	}
 }
 
-// createLibraryRetrieverTool creates a LibraryRetrieverTool for the given library IDs
-func (s *ChatService) createLibraryRetrieverTool(ctx context.Context, db *bun.DB, libraryIDs []int64, topK int, matchThreshold float64) (tool.BaseTool, error) {
+// updateMessageProgress saves the partial answer of a message that is still streaming
+func (s *ChatService) updateMessageProgress(db *bun.DB, messageID int64, content, thinking, toolCalls, segmentsJSON string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if toolCalls == "" {
+		toolCalls = "[]"
+	}
+	if _, err := db.NewUpdate().
+		Model((*messageModel)(nil)).
+		Set("content = ?", content).
+		Set("thinking_content = ?", thinking).
+		Set("tool_calls = ?", toolCalls).
+		Set("segments = ?", segmentsJSON).
+		Where("id = ?", messageID).
+		Exec(ctx); err != nil {
+		s.app.Logger.Warn("update message progress failed", "messageID", messageID, "error", err)
+	}
+}
+
+// createLibraryRetrieverTool creates a LibraryRetrieverTool for the agent's library IDs.
+// chatProvider/chatModelID are used for query transformation when the agent has no dedicated model.
+func (s *ChatService) createLibraryRetrieverTool(ctx context.Context, db *bun.DB, extras AgentExtras, topK int, chatProvider einoagent.ProviderConfig, chatModelID string, history []*schema.Message) (tool.BaseTool, error) {
+	libraryIDs := extras.LibraryIDs
+	matchThreshold := extras.MatchThreshold
 	if len(libraryIDs) == 0 {
 		return nil, nil
 	}
 
+	retrievalService, err := s.createRetrievalService(ctx, db, extras, chatProvider, chatModelID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set default topK if not specified
+	if topK <= 0 {
+		topK = 10
+	}
+
+	// Create the library retriever tool
+	retrieverTool, err := tools.NewLibraryRetrieverTool(ctx, &tools.LibraryRetrieverConfig{
+		LibraryIDs:     libraryIDs,
+		TopK:           topK,
+		MatchThreshold: matchThreshold,
+		Retriever:      retrievalService,
+		History:        history,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create library retriever tool: %w", err)
+	}
+
+	return retrieverTool, nil
+}
+
+// createRetrievalService creates the retrieval service (embedder + optional query transformer)
+// shared by the library retriever tool and auto retrieval.
+func (s *ChatService) createRetrievalService(ctx context.Context, db *bun.DB, extras AgentExtras, chatProvider einoagent.ProviderConfig, chatModelID string) (*retrieval.Service, error) {
 	// Get embedding config for creating embedder
 	embeddingConfig, err := processor.GetEmbeddingConfig(ctx, db)
 	if err != nil {
@@ -1325,12 +1859,14 @@ func (s *ChatService) createLibraryRetrieverTool(ctx context.Context, db *bun.DB
 
 	// Create embedder for vector search
 	embedder, err := einoembed.NewEmbedder(ctx, &einoembed.ProviderConfig{
+		ProviderID:   embeddingConfig.ProviderID,
 		ProviderType: embeddingConfig.ProviderType,
 		APIKey:       embeddingConfig.APIKey,
 		APIEndpoint:  embeddingConfig.APIEndpoint,
 		ModelID:      embeddingConfig.ModelID,
 		Dimension:    embeddingConfig.Dimension,
 		ExtraConfig:  embeddingConfig.ExtraConfig,
+		Batch:        embeddingConfig.Batch,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("create embedder: %w", err)
@@ -1342,21 +1878,53 @@ func (s *ChatService) createLibraryRetrieverTool(ctx context.Context, db *bun.DB
 	// Create retrieval service
 	retrievalService := retrieval.NewService(db, embedder)
 
-	// Set default topK if not specified
-	if topK <= 0 {
-		topK = 10
+	// Optional query transformation (rewrite / multi-query / HyDE)
+	if extras.QueryTransform.Enabled() {
+		transformer, err := s.createQueryTransformer(ctx, db, extras, chatProvider, chatModelID)
+		if err != nil {
+			s.app.Logger.Warn("[chat] failed to create query transformer, searching with original queries", "error", err)
+		} else {
+			retrievalService.SetQueryTransformer(transformer)
+		}
 	}
 
-	// Create the library retriever tool
-	retrieverTool, err := tools.NewLibraryRetrieverTool(ctx, &tools.LibraryRetrieverConfig{
-		LibraryIDs:     libraryIDs,
-		TopK:           topK,
-		MatchThreshold: matchThreshold,
-		Retriever:      retrievalService,
-	})
+	return retrievalService, nil
+}
+
+// createQueryTransformer creates the query transformer for retrieval.
+// It uses the agent's dedicated query transform model if configured, otherwise the chat model.
+func (s *ChatService) createQueryTransformer(ctx context.Context, db *bun.DB, extras AgentExtras, chatProvider einoagent.ProviderConfig, chatModelID string) (*retrieval.QueryTransformer, error) {
+	providerID := chatProvider.ProviderID
+	modelID := chatModelID
+	providerCfg := &chatmodel.ProviderConfig{
+		ProviderType: chatProvider.Type,
+		APIKey:       chatProvider.APIKey,
+		APIEndpoint:  chatProvider.APIEndpoint,
+		ExtraConfig:  chatProvider.ExtraConfig,
+	}
+
+	if extras.QueryTransformProviderID != "" && extras.QueryTransformModelID != "" {
+		info, err := processor.GetProviderInfo(ctx, db, extras.QueryTransformProviderID)
+		if err != nil {
+			return nil, fmt.Errorf("get query transform provider: %w", err)
+		}
+		providerID = extras.QueryTransformProviderID
+		modelID = extras.QueryTransformModelID
+		providerCfg = &chatmodel.ProviderConfig{
+			ProviderType: info.ProviderType,
+			APIKey:       info.APIKey,
+			APIEndpoint:  info.APIEndpoint,
+			ExtraConfig:  info.ExtraConfig,
+		}
+	}
+	providerCfg.ProviderID = providerID
+	providerCfg.ModelID = modelID
+	providerCfg.Timeout = 30 * time.Second
+
+	llm, err := chatmodel.NewChatModel(ctx, providerCfg)
 	if err != nil {
-		return nil, fmt.Errorf("create library retriever tool: %w", err)
+		return nil, fmt.Errorf("create query transform model: %w", err)
 	}
 
-	return retrieverTool, nil
+	return retrieval.NewQueryTransformer(llm, providerID+"/"+modelID, extras.QueryTransform), nil
 }
@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	einoagent "chatclaw/internal/eino/agent"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/uptrace/bun"
+)
+
+// maxStructuredRepairs is the number of times the model is asked to fix an answer
+// that does not match the agent's response schema.
+const maxStructuredRepairs = 2
+
+// structuredRepairPrompt asks the model to correct an answer that failed validation.
+const structuredRepairPrompt = "Your previous answer does not match the required JSON Schema: %s\n" +
+	"Reply again with only the corrected JSON value, without any other text or Markdown code fences."
+
+// structuredResult is the outcome of validating an answer against the response schema.
+type structuredResult struct {
+	Content string // final answer (replaced when a repair succeeded)
+	Output  string // validated JSON; empty when the answer does not match
+	Error   string // last validation error when the answer does not match
+	Repairs int    // repair calls made
+}
+
+// validateStructuredOutput checks the final answer against the agent's response schema.
+// An answer that does not match is sent back to the model with the validation errors,
+// up to maxStructuredRepairs times.
+func (s *ChatService) validateStructuredOutput(ctx context.Context, agentConfig einoagent.Config, providerConfig einoagent.ProviderConfig, history []*schema.Message, content string) structuredResult {
+	format := agentConfig.ResponseFormat
+	output, err := format.Validate(content)
+	if err == nil {
+		return structuredResult{Content: content, Output: output}
+	}
+	result := structuredResult{Content: content, Error: err.Error()}
+
+	cfg := agentConfig
+	cfg.Provider = providerConfig
+	cfg.EnableThinking = false
+	chatModel, err := einoagent.CreateChatModel(ctx, cfg)
+	if err != nil {
+		s.app.Logger.Warn("[chat] structured output: create model failed", "error", err)
+		return result
+	}
+
+	messages := make([]*schema.Message, 0, len(history)+1+2*maxStructuredRepairs)
+	messages = append(messages, schema.SystemMessage(agentConfig.Instruction+format.Instruction()))
+	messages = append(messages, history...)
+	answer := content
+	for result.Repairs < maxStructuredRepairs && ctx.Err() == nil {
+		result.Repairs++
+		messages = append(messages,
+			schema.AssistantMessage(answer, nil),
+			schema.UserMessage(fmt.Sprintf(structuredRepairPrompt, result.Error)))
+		resp, err := chatModel.Generate(ctx, messages)
+		if err != nil {
+			s.app.Logger.Warn("[chat] structured output: repair failed", "attempt", result.Repairs, "error", err)
+			break
+		}
+		answer = resp.Content
+		output, err := format.Validate(answer)
+		if err == nil {
+			return structuredResult{Content: answer, Output: output, Repairs: result.Repairs}
+		}
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// updateMessageStructured stores the structured output of an answer
+func (s *ChatService) updateMessageStructured(db *bun.DB, messageID int64, output, errorMsg string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := db.NewUpdate().
+		Model((*messageModel)(nil)).
+		Set("structured_output = ?", output).
+		Set("structured_error = ?", errorMsg).
+		Where("id = ?", messageID).
+		Exec(ctx); err != nil {
+		s.app.Logger.Error("update message structured output failed", "messageID", messageID, "error", err)
+	}
+}
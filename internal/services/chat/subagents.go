@@ -0,0 +1,177 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	einoagent "chatclaw/internal/eino/agent"
+	"chatclaw/internal/services/agents"
+
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/schema"
+	"github.com/uptrace/bun"
+)
+
+// subAgentDescriptionMaxRunes limits the prompt excerpt a parent agent sees for each sub-agent.
+const subAgentDescriptionMaxRunes = 300
+
+// subAgentName is the ADK name of a sub-agent. ChatClaw agent names are often non-ASCII,
+// but ADK uses the name as a tool name, which providers restrict to [a-zA-Z0-9_-].
+func subAgentName(agentID int64) string {
+	return fmt.Sprintf("agent_%d", agentID)
+}
+
+// subAgentDescription tells the parent agent what a sub-agent is for.
+func subAgentDescription(name, prompt string) string {
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return name
+	}
+	return name + ": " + truncateRunes(prompt, subAgentDescriptionMaxRunes)
+}
+
+// subAgentInfo identifies the ChatClaw agent behind an ADK sub-agent name.
+type subAgentInfo struct {
+	ID   int64
+	Name string
+	Mode string // agents.SubAgentModeTool / Transfer
+}
+
+func (i subAgentInfo) source() AgentSource {
+	return AgentSource{
+		AgentID:   i.ID,
+		AgentName: i.Name,
+		Internal:  i.Mode != agents.SubAgentModeTransfer,
+	}
+}
+
+// buildSubAgents creates the sub-agents of the conversation agent. Each one runs with its own
+// prompt, model, libraries, memories and tools; sub-agents without a default model use the conversation model.
+// Sub-agents that fail to build are skipped. The returned cleanup releases their resources.
+func (s *ChatService) buildSubAgents(ctx context.Context, db *bun.DB, conversationID int64, extras AgentExtras, parent einoagent.Config, parentProvider einoagent.ProviderConfig, history []*schema.Message) ([]einoagent.SubAgent, map[string]subAgentInfo, func()) {
+	var subAgents []einoagent.SubAgent
+	infos := make(map[string]subAgentInfo, len(extras.SubAgents))
+	var cleanups []func()
+	cleanup := func() {
+		for _, c := range cleanups {
+			c()
+		}
+	}
+
+	for _, ref := range extras.SubAgents {
+		cfg, provider, subExtras, err := s.loadAgentConfig(ctx, db, agentConfigInput{
+			AgentID:            ref.AgentID,
+			FallbackProviderID: parentProvider.ProviderID,
+			FallbackModelID:    parent.ModelID,
+			EnableThinking:     parent.EnableThinking,
+			WorkspaceDir:       extras.WorkspaceDir,
+		})
+		if err != nil {
+			s.app.Logger.Warn("[chat] skip sub-agent", "agent", ref.AgentID, "error", err)
+			continue
+		}
+
+		displayName := cfg.Name
+		prompt := strings.TrimPrefix(cfg.Instruction, "# System Instruction\n\n")
+		cfg.Name = subAgentName(ref.AgentID)
+		cfg.Description = subAgentDescription(displayName, prompt)
+		cfg.Provider = provider
+
+		extraTools := s.setupRetrieval(ctx, db, &cfg, subExtras, provider, history)
+		extraTools = append(extraTools, s.setupMemory(ctx, db, &cfg, subExtras, conversationID, history)...)
+		result, err := einoagent.NewChatModelAgent(ctx, cfg, s.toolRegistry, extraTools, nil)
+		if err != nil {
+			s.app.Logger.Warn("[chat] failed to create sub-agent", "agent", ref.AgentID, "error", err)
+			continue
+		}
+		cleanups = append(cleanups, result.Cleanup)
+
+		mode := einoagent.SubAgentAsTool
+		if ref.Mode == agents.SubAgentModeTransfer {
+			mode = einoagent.SubAgentTransfer
+		}
+		subAgents = append(subAgents, einoagent.SubAgent{Agent: result.Agent, Mode: mode})
+		infos[cfg.Name] = subAgentInfo{ID: ref.AgentID, Name: displayName, Mode: ref.Mode}
+		s.app.Logger.Info("[chat] sub-agent created", "agent", ref.AgentID, "name", displayName, "mode", ref.Mode,
+			"provider", provider.ProviderID, "model", cfg.ModelID)
+	}
+
+	return subAgents, infos, cleanup
+}
+
+// subAgentSink receives the live output of a sub-agent that is called as a tool.
+type subAgentSink struct {
+	thinking   func(delta string)
+	content    func(delta string)
+	toolCall   func(call schema.ToolCall)
+	toolResult func(msg *schema.Message)
+	usage      func(usage *schema.TokenUsage)
+}
+
+// streamSubAgentOutput forwards one message of a sub-agent called as a tool.
+// Text is streamed as it arrives; tool calls are reported once the message is complete,
+// because streamed tool call chunks only become meaningful after they are merged.
+func streamSubAgentOutput(out *adk.MessageVariant, sink subAgentSink) error {
+	isTool := out.Role == schema.Tool
+
+	var msg *schema.Message
+	if out.IsStreaming && out.MessageStream != nil {
+		var chunks []*schema.Message
+		for {
+			chunk, err := out.MessageStream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			chunks = append(chunks, chunk)
+			if !isTool {
+				if chunk.ReasoningContent != "" {
+					sink.thinking(chunk.ReasoningContent)
+				}
+				if chunk.Content != "" {
+					sink.content(chunk.Content)
+				}
+			}
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		merged, err := schema.ConcatMessages(chunks)
+		if err != nil {
+			return err
+		}
+		msg = merged
+	} else if out.Message != nil {
+		msg = out.Message
+		if !isTool {
+			if msg.ReasoningContent != "" {
+				sink.thinking(msg.ReasoningContent)
+			}
+			if msg.Content != "" {
+				sink.content(msg.Content)
+			}
+		}
+	}
+	if msg == nil {
+		return nil
+	}
+
+	if isTool || msg.Role == schema.Tool {
+		if msg.Name == "" {
+			msg.Name = out.ToolName
+		}
+		sink.toolResult(msg)
+		return nil
+	}
+	for _, tc := range msg.ToolCalls {
+		sink.toolCall(tc)
+	}
+	if msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+		sink.usage(msg.ResponseMeta.Usage)
+	}
+	return nil
+}
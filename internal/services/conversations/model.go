@@ -24,6 +24,9 @@ type Conversation struct {
 	LibraryIDs    []int64 `json:"library_ids"`
 	EnableThinking bool   `json:"enable_thinking"`
 
+	// 会话级工作区（文件工具和 execute 的沙箱），为空时使用助手的工作区
+	WorkspaceDir string `json:"workspace_dir"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -35,8 +38,9 @@ type CreateConversationInput struct {
 	LastMessage    string  `json:"last_message"`
 	LLMProviderID  string  `json:"llm_provider_id"`
 	LLMModelID     string  `json:"llm_model_id"`
-	LibraryIDs     []int64 `json:"library_ids"`
+	LibraryIDs     []int64 `json:"library_ids"` // 为空时继承助手的默认知识库
 	EnableThinking bool    `json:"enable_thinking"`
+	WorkspaceDir   string  `json:"workspace_dir"` // 为空时使用助手的工作区
 }
 
 // UpdateConversationInput 更新会话的输入参数
@@ -48,6 +52,7 @@ type UpdateConversationInput struct {
 	LLMModelID     *string  `json:"llm_model_id"`
 	LibraryIDs     *[]int64 `json:"library_ids"`
 	EnableThinking *bool    `json:"enable_thinking"`
+	WorkspaceDir   *string  `json:"workspace_dir"`
 }
 
 // conversationModel 数据库模型
@@ -66,6 +71,7 @@ type conversationModel struct {
 	LLMModelID     string `bun:"llm_model_id,notnull"`
 	LibraryIDs     string `bun:"library_ids,notnull"` // JSON array stored as string
 	EnableThinking bool   `bun:"enable_thinking,notnull"`
+	WorkspaceDir   string `bun:"workspace_dir,notnull"`
 }
 
 // BeforeInsert 在 INSERT 时自动设置 created_at 和 updated_at
@@ -111,6 +117,8 @@ func (m *conversationModel) toDTO() Conversation {
 		LibraryIDs:     libraryIDs,
 		EnableThinking: m.EnableThinking,
 
+		WorkspaceDir: m.WorkspaceDir,
+
 		CreatedAt: m.CreatedAt,
 		UpdatedAt: m.UpdatedAt,
 	}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"chatclaw/internal/errs"
+	"chatclaw/internal/services/agents"
 	"chatclaw/internal/sqlite"
 
 	"github.com/uptrace/bun"
@@ -106,7 +107,7 @@ func (s *ConversationsService) GetConversation(id int64) (*Conversation, error)
 	return &dto, nil
 }
 
-// CreateConversation 创建会话
+// CreateConversation 创建会话（未指定知识库时继承助手的默认知识库）
 func (s *ConversationsService) CreateConversation(input CreateConversationInput) (*Conversation, error) {
 	if input.AgentID <= 0 {
 		return nil, errs.New("error.agent_id_required")
@@ -124,6 +125,11 @@ func (s *ConversationsService) CreateConversation(input CreateConversationInput)
 
 	lastMessage := strings.TrimSpace(input.LastMessage)
 
+	workspaceDir, err := agents.NormalizeWorkspaceDir(input.WorkspaceDir)
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := s.db()
 	if err != nil {
 		return nil, err
@@ -132,17 +138,26 @@ func (s *ConversationsService) CreateConversation(input CreateConversationInput)
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// 验证助手是否存在
-	var agentCount int
+	// 验证助手是否存在，同时读取助手默认关联的知识库
+	var agentLibraryIDs string
 	if err := db.NewSelect().
 		Table("agents").
-		ColumnExpr("COUNT(1)").
+		Column("library_ids").
 		Where("id = ?", input.AgentID).
-		Scan(ctx, &agentCount); err != nil {
+		Scan(ctx, &agentLibraryIDs); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.Newf("error.agent_not_found", map[string]any{"ID": input.AgentID})
+		}
 		return nil, errs.Wrap("error.conversation_create_failed", err)
 	}
-	if agentCount == 0 {
-		return nil, errs.Newf("error.agent_not_found", map[string]any{"ID": input.AgentID})
+
+	// 未指定知识库时继承助手的默认知识库
+	libraryIDs := input.LibraryIDs
+	if len(libraryIDs) == 0 && agentLibraryIDs != "" && agentLibraryIDs != "[]" {
+		if err := json.Unmarshal([]byte(agentLibraryIDs), &libraryIDs); err != nil {
+			s.app.Logger.Warn("[conversations] failed to parse agent library_ids", "agent", input.AgentID, "error", err)
+			libraryIDs = nil
+		}
 	}
 
 	m := &conversationModel{
@@ -152,8 +167,9 @@ func (s *ConversationsService) CreateConversation(input CreateConversationInput)
 		IsPinned:       false,
 		LLMProviderID:  strings.TrimSpace(input.LLMProviderID),
 		LLMModelID:     strings.TrimSpace(input.LLMModelID),
-		LibraryIDs:     s.serializeLibraryIDs(input.LibraryIDs),
+		LibraryIDs:     s.serializeLibraryIDs(libraryIDs),
 		EnableThinking: input.EnableThinking,
+		WorkspaceDir:   workspaceDir,
 	}
 
 	if _, err := db.NewInsert().Model(m).Exec(ctx); err != nil {
@@ -250,6 +266,14 @@ func (s *ConversationsService) UpdateConversation(id int64, input UpdateConversa
 			q = q.Set("enable_thinking = ?", *input.EnableThinking)
 		}
 
+		if input.WorkspaceDir != nil {
+			workspaceDir, err := agents.NormalizeWorkspaceDir(*input.WorkspaceDir)
+			if err != nil {
+				return err
+			}
+			q = q.Set("workspace_dir = ?", workspaceDir)
+		}
+
 		res, err := q.Exec(ctx)
 		if err != nil {
 			return errs.Wrap("error.conversation_update_failed", err)
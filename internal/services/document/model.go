@@ -2,6 +2,8 @@ package document
 
 import (
 	"context"
+	"strconv"
+	"strings"
 	"time"
 
 	"chatclaw/internal/sqlite"
@@ -49,6 +51,11 @@ type Document struct {
 
 	WordTotal  int `json:"word_total"`
 	SplitTotal int `json:"split_total"`
+
+	// OCRCandidatePages 没有可提取文本的页码（如扫描页），提示用户这些页需要 OCR
+	OCRCandidatePages []int `json:"ocr_candidate_pages"`
+	// SkippedSteps 处理时跳过的步骤（大文件流式处理时不执行上下文增强和 RAPTOR）
+	SkippedSteps []string `json:"skipped_steps"`
 }
 
 // UploadInput 上传文档的输入参数
@@ -84,14 +91,19 @@ type ListDocumentsPageInput struct {
 
 // ProgressEvent 进度事件数据（发送给前端）
 type ProgressEvent struct {
-	DocumentID        int64  `json:"document_id"`
-	LibraryID         int64  `json:"library_id"`
-	ParsingStatus     int    `json:"parsing_status"`
-	ParsingProgress   int    `json:"parsing_progress"`
-	ParsingError      string `json:"parsing_error"`
-	EmbeddingStatus   int    `json:"embedding_status"`
-	EmbeddingProgress int    `json:"embedding_progress"`
-	EmbeddingError    string `json:"embedding_error"`
+	DocumentID        int64    `json:"document_id"`
+	LibraryID         int64    `json:"library_id"`
+	ParsingStatus     int      `json:"parsing_status"`
+	ParsingProgress   int      `json:"parsing_progress"`
+	ParsingError      string   `json:"parsing_error"`
+	EmbeddingStatus   int      `json:"embedding_status"`
+	EmbeddingProgress int      `json:"embedding_progress"`
+	EmbeddingError    string   `json:"embedding_error"`
+	OCRCandidatePages []int    `json:"ocr_candidate_pages"`
+	SkippedSteps      []string `json:"skipped_steps"`
+	// 向量化的分段数及其中命中向量缓存（未调用供应商接口）的数量
+	EmbeddingTotal     int `json:"embedding_total"`
+	EmbeddingCacheHits int `json:"embedding_cache_hits"`
 }
 
 // ThumbnailEvent 缩略图更新事件数据（发送给前端）
@@ -135,6 +147,9 @@ type documentModel struct {
 
 	WordTotal  int `bun:"word_total,notnull"`
 	SplitTotal int `bun:"split_total,notnull"`
+
+	OCRCandidatePages string `bun:"ocr_candidate_pages,notnull"` // 逗号分隔的页码
+	SkippedSteps      string `bun:"skipped_steps,notnull"`       // 逗号分隔的步骤
 }
 
 // BeforeInsert 在 INSERT 时自动设置 created_at 和 updated_at
@@ -186,7 +201,33 @@ func (m *documentModel) toDTO() Document {
 
 		WordTotal:  m.WordTotal,
 		SplitTotal: m.SplitTotal,
+
+		OCRCandidatePages: parsePageList(m.OCRCandidatePages),
+		SkippedSteps:      parseStepList(m.SkippedSteps),
+	}
+}
+
+// formatPageList 把页码列表格式化为逗号分隔的字符串（用于存储）
+func formatPageList(pages []int) string {
+	parts := make([]string, 0, len(pages))
+	for _, p := range pages {
+		parts = append(parts, strconv.Itoa(p))
+	}
+	return strings.Join(parts, ",")
+}
+
+// parsePageList 解析逗号分隔的页码字符串
+func parsePageList(s string) []int {
+	if strings.TrimSpace(s) == "" {
+		return nil
 	}
+	var pages []int
+	for _, part := range strings.Split(s, ",") {
+		if p, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && p > 0 {
+			pages = append(pages, p)
+		}
+	}
+	return pages
 }
 
 // 支持的文件扩展名及其 MIME 类型（不带小数点前缀）
@@ -201,6 +242,13 @@ var supportedExtensions = map[string]string{
 	"html": "text/html",
 	"htm":  "text/html",
 	"ofd":  "application/ofd",
+	"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"odt":  "application/vnd.oasis.opendocument.text",
+	"ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	"epub": "application/epub+zip",
+	"rtf":  "application/rtf",
+	"eml":  "message/rfc822",
+	"mbox": "application/mbox",
 }
 
 // IsSupportedExtension 检查扩展名是否支持
@@ -216,3 +264,14 @@ func GetMimeType(ext string) string {
 	}
 	return "application/octet-stream"
 }
+
+// parseStepList 解析逗号分隔的步骤列表
+func parseStepList(s string) []string {
+	steps := []string{}
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			steps = append(steps, part)
+		}
+	}
+	return steps
+}
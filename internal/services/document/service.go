@@ -95,8 +95,7 @@ func (s *DocumentService) registerTaskHandlers() {
 			s.app.Logger.Error("failed to unmarshal process job data", "error", err)
 			return nil // Don't retry malformed jobs
 		}
-		s.processDocument(jobData.DocID, jobData.LibraryID, jobData.RunID, info)
-		return nil
+		return s.processDocument(ctx, jobData.DocID, jobData.LibraryID, jobData.RunID, info)
 	})
 
 	// Register embedding-only handler
@@ -106,11 +105,43 @@ func (s *DocumentService) registerTaskHandlers() {
 			s.app.Logger.Error("failed to unmarshal reembed job data", "error", err)
 			return nil
 		}
-		s.reembedDocument(jobData.DocID, jobData.LibraryID, jobData.RunID, info)
-		return nil
+		return s.reembedDocument(ctx, jobData.DocID, jobData.LibraryID, jobData.RunID, info)
+	})
+
+	// 向量化失败多为供应商限流或网络抖动，退避后重试；解析失败由 PhaseError 标记为不可重试
+	for _, jobType := range []string{JobTypeProcess, JobTypeReembed} {
+		tm.SetRetryPolicy(taskmanager.QueueDocument, jobType, taskmanager.RetryPolicy{
+			MaxAttempts:    4,
+			InitialBackoff: 10 * time.Second,
+			MaxBackoff:     10 * time.Minute,
+			Multiplier:     3,
+		})
+	}
+}
+
+// jobError 将文档处理错误转换为任务错误：
+// processor.PhaseError 自行声明是否可重试，其余错误（配置缺失、读取文档失败等）重试也无济于事
+func jobError(err error) error {
+	var pe *processor.PhaseError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return taskmanager.Permanent(err)
+}
+
+// tooLargeError 不支持流式解析的格式超过大小上限时的错误
+func tooLargeError(ext string) error {
+	return errs.Newf("error.document_file_too_large", map[string]any{
+		"Ext":   ext,
+		"Limit": processor.MaxNonStreamableFileSize >> 20,
 	})
 }
 
+// retryPendingMessage 等待自动重试时展示的错误信息
+func retryPendingMessage(errMsg string) string {
+	return "处理失败，稍后自动重试：" + errMsg
+}
+
 func (s *DocumentService) db() (*bun.DB, error) {
 	db := sqlite.DB()
 	if db == nil {
@@ -326,6 +357,7 @@ func (s *DocumentService) UploadDocuments(input UploadInput) ([]Document, error)
 	}
 	emitUploadProgress()
 
+	var lastErr error
 	for _, srcPath := range input.FilePaths {
 		doc, err := s.uploadSingleFile(ctx, db, input.LibraryID, libraryDir, srcPath)
 		done++
@@ -333,6 +365,7 @@ func (s *DocumentService) UploadDocuments(input UploadInput) ([]Document, error)
 		if err != nil {
 			// 记录错误但继续处理其他文件
 			s.app.Logger.Warn("upload file failed", "path", srcPath, "error", err)
+			lastErr = err
 			continue
 		}
 		uploaded = append(uploaded, *doc)
@@ -348,6 +381,11 @@ func (s *DocumentService) UploadDocuments(input UploadInput) ([]Document, error)
 	}
 
 	if len(uploaded) == 0 {
+		// 全部失败时优先返回可读的业务错误（如文件类型不支持、文件过大）
+		var i18nErr *errs.I18nError
+		if errors.As(lastErr, &i18nErr) {
+			return nil, lastErr
+		}
 		return nil, errs.New("error.document_upload_failed")
 	}
 
@@ -367,6 +405,9 @@ func (s *DocumentService) uploadSingleFile(ctx context.Context, db *bun.DB, libr
 	if !IsSupportedExtension(ext) {
 		return nil, errs.Newf("error.document_file_type_not_supported", map[string]any{"Ext": ext})
 	}
+	if err := processor.CheckFileSize(srcPath, srcInfo.Size()); err != nil {
+		return nil, tooLargeError(ext)
+	}
 
 	// 计算文件 hash
 	hash, err := s.calculateFileHash(srcPath)
@@ -551,6 +592,10 @@ func (s *DocumentService) ReprocessDocument(id int64) error {
 	if _, err := db.NewDelete().Table("document_nodes").Where("document_id = ?", id).Exec(ctx); err != nil {
 		s.app.Logger.Warn("delete document_nodes failed", "error", err)
 	}
+	// 重新学习从头开始，丢弃流式处理的断点
+	if _, err := db.NewDelete().Table("document_ingest_checkpoints").Where("document_id = ?", id).Exec(ctx); err != nil {
+		s.app.Logger.Warn("delete document_ingest_checkpoints failed", "error", err)
+	}
 
 	// 5. 生成新的处理运行 ID 并重置状态
 	runID := fmt.Sprintf("%d-%d", id, time.Now().UnixNano())
@@ -564,6 +609,8 @@ func (s *DocumentService) ReprocessDocument(id int64) error {
 		Set("embedding_error = ?", "").
 		Set("word_total = ?", 0).
 		Set("split_total = ?", 0).
+		Set("ocr_candidate_pages = ?", "").
+		Set("skipped_steps = ?", "").
 		Where("id = ?", id).
 		Exec(ctx); err != nil {
 		return errs.Wrap("error.document_update_failed", err)
@@ -701,7 +748,8 @@ func (s *DocumentService) startProcessingTask(doc *Document) {
 		RunID:     runID,
 	})
 
-	tm.Submit(taskmanager.QueueDocument, JobTypeProcess, taskKey, runID, jobData)
+	// 用户刚上传/重新学习的文档优先处理，排在批量重新向量化之前
+	tm.SubmitWithPriority(taskmanager.QueueDocument, JobTypeProcess, taskKey, runID, taskmanager.PriorityHigh, jobData)
 }
 
 // startThumbnailTask 启动缩略图生成任务
@@ -780,11 +828,13 @@ func (s *DocumentService) generateThumbnail(docID, libraryID int64, localPath st
 }
 
 // processDocument 处理文档（解析 + 分段 + 向量化 + RAPTOR）
-func (s *DocumentService) processDocument(docID, libraryID int64, runID string, info *taskmanager.TaskInfo) {
+// 返回的错误交给任务管理器决定是否重试，文档状态在返回前已更新：
+// 还会自动重试的失败标记为等待中（附带错误信息），重试开始时状态重置为处理中
+func (s *DocumentService) processDocument(jobCtx context.Context, docID, libraryID int64, runID string, info *taskmanager.TaskInfo) error {
 	tm := taskmanager.Get()
 	db, err := s.db()
 	if err != nil {
-		return
+		return taskmanager.Permanent(err)
 	}
 
 	ctx := context.Background()
@@ -809,6 +859,13 @@ func (s *DocumentService) processDocument(docID, libraryID int64, runID string,
 		return currentRunID == runID
 	}
 
+	// 没有可提取文本的页码（处理完成后填充，随进度事件一起发送）
+	var ocrCandidatePages []int
+	// 处理时跳过的步骤（处理完成后填充）
+	var skippedSteps []string
+	// 向量缓存命中情况（向量化过程中更新，随进度事件一起发送）
+	var embedStats processor.EmbeddingStats
+
 	// 辅助函数：更新状态并发送事件
 	updateAndEmit := func(parsingStatus, parsingProgress int, parsingError string, embeddingStatus, embeddingProgress int, embeddingError string) {
 		if _, err := db.NewUpdate().
@@ -828,32 +885,36 @@ func (s *DocumentService) processDocument(docID, libraryID int64, runID string,
 
 		if tm != nil {
 			tm.Emit("document:progress", ProgressEvent{
-				DocumentID:        docID,
-				LibraryID:         libraryID,
-				ParsingStatus:     parsingStatus,
-				ParsingProgress:   parsingProgress,
-				ParsingError:      parsingError,
-				EmbeddingStatus:   embeddingStatus,
-				EmbeddingProgress: embeddingProgress,
-				EmbeddingError:    embeddingError,
+				DocumentID:         docID,
+				LibraryID:          libraryID,
+				ParsingStatus:      parsingStatus,
+				ParsingProgress:    parsingProgress,
+				ParsingError:       parsingError,
+				EmbeddingStatus:    embeddingStatus,
+				EmbeddingProgress:  embeddingProgress,
+				EmbeddingError:     embeddingError,
+				OCRCandidatePages:  ocrCandidatePages,
+				SkippedSteps:       skippedSteps,
+				EmbeddingTotal:     embedStats.Total,
+				EmbeddingCacheHits: embedStats.CacheHits,
 			})
 		}
 	}
 
 	// 检查任务是否应该继续
 	if !shouldContinue() {
-		return
+		return nil
 	}
 
 	// 获取文档信息
 	var doc documentModel
 	if err := db.NewSelect().Model(&doc).Where("id = ?", docID).Scan(ctx); err != nil {
 		updateAndEmit(StatusFailed, 0, "获取文档信息失败: "+err.Error(), StatusPending, 0, "")
-		return
+		return jobError(err)
 	}
 	// Skip stale jobs (e.g. after restart or "relearn" created a new run)
 	if runID != "" && doc.ProcessingRunID != "" && runID != doc.ProcessingRunID {
-		return
+		return nil
 	}
 
 	// 开始解析
@@ -863,21 +924,24 @@ func (s *DocumentService) processDocument(docID, libraryID int64, runID string,
 	libraryConfig, err := processor.GetLibraryConfig(ctx, db, libraryID)
 	if err != nil {
 		updateAndEmit(StatusFailed, 0, "获取知识库配置失败: "+err.Error(), StatusPending, 0, "")
-		return
+		return jobError(err)
 	}
 
 	// 获取全局嵌入模型配置
 	embeddingConfig, err := processor.GetEmbeddingConfig(ctx, db)
 	if err != nil {
 		updateAndEmit(StatusFailed, 0, "获取嵌入模型配置失败: "+err.Error(), StatusPending, 0, "")
-		return
+		return jobError(err)
 	}
 
 	// 创建文档处理器
 	proc, err := processor.NewProcessor(db)
 	if err != nil {
 		updateAndEmit(StatusFailed, 0, "创建处理器失败: "+err.Error(), StatusPending, 0, "")
-		return
+		return jobError(err)
+	}
+	proc.OnEmbeddingStats = func(stats processor.EmbeddingStats) {
+		embedStats = stats
 	}
 
 	// 获取供应商信息的回调函数
@@ -886,22 +950,26 @@ func (s *DocumentService) processDocument(docID, libraryID int64, runID string,
 	}
 
 	// 进度回调
-	var lastPhase string
+	// 上下文增强在向量化之前执行：有增强时向量化进度的 0~10% 属于增强，向量化阶段映射到 10~100%，
+	// 保证进度条只前进不后退
+	const enrichSpan = 10
+	enriched := false
 	onProgress := func(phase string, progress int) {
 		if !shouldContinue() {
 			return
 		}
-		if phase == "parsing" {
+		switch phase {
+		case "parsing":
 			updateAndEmit(StatusProcessing, progress, "", StatusPending, 0, "")
-		} else if phase == "embedding" {
-			if lastPhase != "embedding" {
-				// 解析完成，开始向量化
-				updateAndEmit(StatusCompleted, 100, "", StatusProcessing, progress, "")
-			} else {
-				updateAndEmit(StatusCompleted, 100, "", StatusProcessing, progress, "")
+		case "enriching":
+			enriched = true
+			updateAndEmit(StatusCompleted, 100, "", StatusProcessing, progress*enrichSpan/100, "")
+		case "embedding":
+			if enriched {
+				progress = enrichSpan + progress*(100-enrichSpan)/100
 			}
+			updateAndEmit(StatusCompleted, 100, "", StatusProcessing, progress, "")
 		}
-		lastPhase = phase
 	}
 
 	// 执行文档处理
@@ -916,25 +984,48 @@ func (s *DocumentService) processDocument(docID, libraryID int64, runID string,
 	)
 
 	if !shouldContinue() {
-		return
+		return nil
+	}
+
+	// 记录 OCR 候选页（解析失败时也记录，便于提示用户是扫描件）和跳过的步骤
+	if result != nil {
+		ocrCandidatePages = result.OCRCandidatePages
+		skippedSteps = result.SkippedSteps
+		if _, err := db.NewUpdate().
+			Table("documents").
+			Set("ocr_candidate_pages = ?", formatPageList(ocrCandidatePages)).
+			Set("skipped_steps = ?", strings.Join(skippedSteps, ",")).
+			Where("id = ?", docID).
+			Where("processing_run_id = ?", runID).
+			Exec(ctx); err != nil {
+			s.app.Logger.Warn("update ocr candidate pages failed", "docID", docID, "error", err)
+		}
 	}
 
 	if err != nil {
 		// Classify error by processor phase to update statuses correctly.
 		errMsg := err.Error()
+		if errors.Is(err, processor.ErrTooLargeToParse) {
+			errMsg = tooLargeError(doc.Extension).Error()
+		}
+		jobErr := jobError(err)
 		var pe *processor.PhaseError
 		if errors.As(err, &pe) {
 			switch pe.Phase {
 			case processor.PhaseParsing, processor.PhaseSplitting:
 				updateAndEmit(StatusFailed, 0, errMsg, StatusPending, 0, "")
 			default:
-				updateAndEmit(StatusCompleted, 100, "", StatusFailed, 0, errMsg)
+				if taskmanager.WillRetry(jobCtx, jobErr) {
+					updateAndEmit(StatusCompleted, 100, "", StatusPending, 0, retryPendingMessage(errMsg))
+				} else {
+					updateAndEmit(StatusCompleted, 100, "", StatusFailed, 0, errMsg)
+				}
 			}
 		} else {
 			// Fallback: treat as embedding failure (parsing likely completed if we reached here).
 			updateAndEmit(StatusCompleted, 100, "", StatusFailed, 0, errMsg)
 		}
-		return
+		return jobErr
 	}
 
 	// 更新文档统计信息
@@ -951,17 +1042,18 @@ func (s *DocumentService) processDocument(docID, libraryID int64, runID string,
 
 	// 全部完成
 	updateAndEmit(StatusCompleted, 100, "", StatusCompleted, 100, "")
+	return nil
 }
 
 // reembedDocument 仅对已有节点重新向量化（不重新解析/分段）
-func (s *DocumentService) reembedDocument(docID, libraryID int64, runID string, info *taskmanager.TaskInfo) {
+func (s *DocumentService) reembedDocument(jobCtx context.Context, docID, libraryID int64, runID string, info *taskmanager.TaskInfo) error {
 	if info != nil && info.IsCancelled() {
-		return
+		return nil
 	}
 
 	db, err := s.db()
 	if err != nil {
-		return
+		return taskmanager.Permanent(err)
 	}
 
 	ctx := context.Background()
@@ -969,15 +1061,19 @@ func (s *DocumentService) reembedDocument(docID, libraryID int64, runID string,
 	// Load document and validate runID to avoid stale jobs
 	var doc documentModel
 	if err := db.NewSelect().Model(&doc).Where("id = ?", docID).Scan(ctx); err != nil {
-		return
+		if errors.Is(err, sql.ErrNoRows) {
+			return taskmanager.Permanent(fmt.Errorf("document %d not found", docID))
+		}
+		return fmt.Errorf("read document %d: %w", docID, err)
 	}
 	if runID != "" && doc.ProcessingRunID != "" && runID != doc.ProcessingRunID {
-		return
+		return nil
 	}
 
 	parsingStatus := doc.ParsingStatus
 	parsingProgress := doc.ParsingProgress
 	parsingError := doc.ParsingError
+	var embedStats processor.EmbeddingStats
 
 	emitProgress := func(status int, progress int, errMsg string) {
 		// Update DB
@@ -996,14 +1092,16 @@ func (s *DocumentService) reembedDocument(docID, libraryID int64, runID string,
 
 		// Emit event
 		s.app.Event.Emit("document:progress", ProgressEvent{
-			DocumentID:        docID,
-			LibraryID:         libraryID,
-			ParsingStatus:     parsingStatus,
-			ParsingProgress:   parsingProgress,
-			ParsingError:      parsingError,
-			EmbeddingStatus:   status,
-			EmbeddingProgress: progress,
-			EmbeddingError:    errMsg,
+			DocumentID:         docID,
+			LibraryID:          libraryID,
+			ParsingStatus:      parsingStatus,
+			ParsingProgress:    parsingProgress,
+			ParsingError:       parsingError,
+			EmbeddingStatus:    status,
+			EmbeddingProgress:  progress,
+			EmbeddingError:     errMsg,
+			EmbeddingTotal:     embedStats.Total,
+			EmbeddingCacheHits: embedStats.CacheHits,
 		})
 	}
 
@@ -1014,14 +1112,17 @@ func (s *DocumentService) reembedDocument(docID, libraryID int64, runID string,
 	embeddingConfig, err := processor.GetEmbeddingConfig(ctx, db)
 	if err != nil {
 		emitProgress(StatusFailed, 0, "获取嵌入模型配置失败: "+err.Error())
-		return
+		return jobError(err)
 	}
 
 	// Create processor
 	proc, err := processor.NewProcessor(db)
 	if err != nil {
 		emitProgress(StatusFailed, 0, "创建处理器失败: "+err.Error())
-		return
+		return jobError(err)
+	}
+	proc.OnEmbeddingStats = func(stats processor.EmbeddingStats) {
+		embedStats = stats
 	}
 
 	err = proc.ReembedDocumentNodes(ctx, docID, embeddingConfig, func(p int) {
@@ -1031,9 +1132,15 @@ func (s *DocumentService) reembedDocument(docID, libraryID int64, runID string,
 		emitProgress(StatusProcessing, p, "")
 	})
 	if err != nil {
-		emitProgress(StatusFailed, 0, err.Error())
-		return
+		jobErr := jobError(err)
+		if taskmanager.WillRetry(jobCtx, jobErr) {
+			emitProgress(StatusPending, 0, retryPendingMessage(err.Error()))
+		} else {
+			emitProgress(StatusFailed, 0, err.Error())
+		}
+		return jobErr
 	}
 
 	emitProgress(StatusCompleted, 100, "")
+	return nil
 }
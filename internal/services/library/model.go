@@ -21,6 +21,8 @@ type Library struct {
 	SemanticSegmentationEnabled bool   `json:"semantic_segmentation_enabled"`
 	RaptorLLMProviderID         string `json:"raptor_llm_provider_id"`
 	RaptorLLMModelID            string `json:"raptor_llm_model_id"`
+	ContextLLMProviderID        string `json:"context_llm_provider_id"`
+	ContextLLMModelID           string `json:"context_llm_model_id"`
 
 	ChunkSize    int `json:"chunk_size"`
 	ChunkOverlap int `json:"chunk_overlap"`
@@ -35,6 +37,8 @@ type CreateLibraryInput struct {
 	SemanticSegmentationEnabled *bool  `json:"semantic_segmentation_enabled"`
 	RaptorLLMProviderID         string `json:"raptor_llm_provider_id"`
 	RaptorLLMModelID            string `json:"raptor_llm_model_id"`
+	ContextLLMProviderID        string `json:"context_llm_provider_id"`
+	ContextLLMModelID           string `json:"context_llm_model_id"`
 
 	ChunkSize    *int `json:"chunk_size"`
 	ChunkOverlap *int `json:"chunk_overlap"`
@@ -47,6 +51,8 @@ type UpdateLibraryInput struct {
 	SemanticSegmentationEnabled bool    `json:"semantic_segmentation_enabled"`
 	RaptorLLMProviderID         *string `json:"raptor_llm_provider_id"`
 	RaptorLLMModelID            *string `json:"raptor_llm_model_id"`
+	ContextLLMProviderID        *string `json:"context_llm_provider_id"`
+	ContextLLMModelID           *string `json:"context_llm_model_id"`
 
 	ChunkSize    *int `json:"chunk_size"`
 	ChunkOverlap *int `json:"chunk_overlap"`
@@ -65,6 +71,8 @@ type libraryModel struct {
 	SemanticSegmentationEnabled bool   `bun:"semantic_segmentation_enabled,notnull"`
 	RaptorLLMProviderID         string `bun:"raptor_llm_provider_id,notnull"`
 	RaptorLLMModelID            string `bun:"raptor_llm_model_id,notnull"`
+	ContextLLMProviderID        string `bun:"context_llm_provider_id,notnull"`
+	ContextLLMModelID           string `bun:"context_llm_model_id,notnull"`
 
 	ChunkSize    int `bun:"chunk_size,notnull"`
 	ChunkOverlap int `bun:"chunk_overlap,notnull"`
@@ -100,6 +108,8 @@ func (m *libraryModel) toDTO() Library {
 		SemanticSegmentationEnabled: m.SemanticSegmentationEnabled,
 		RaptorLLMProviderID:         m.RaptorLLMProviderID,
 		RaptorLLMModelID:            m.RaptorLLMModelID,
+		ContextLLMProviderID:        m.ContextLLMProviderID,
+		ContextLLMModelID:           m.ContextLLMModelID,
 
 		ChunkSize:    m.ChunkSize,
 		ChunkOverlap: m.ChunkOverlap,
@@ -117,6 +117,19 @@ func (s *LibraryService) CreateLibrary(input CreateLibraryInput) (*Library, erro
 		return nil, errs.New("error.library_raptor_llm_incomplete")
 	}
 
+	// 上下文增强 LLM 配置（可选）
+	contextLLMProviderID := strings.TrimSpace(input.ContextLLMProviderID)
+	contextLLMModelID := strings.TrimSpace(input.ContextLLMModelID)
+	// 两者要么都为空（不使用），要么都有值
+	if (contextLLMProviderID == "") != (contextLLMModelID == "") {
+		return nil, errs.New("error.library_context_llm_incomplete")
+	}
+	if contextLLMProviderID != "" {
+		if err := ensureContextLLMModelExists(ctx, db, contextLLMProviderID, contextLLMModelID); err != nil {
+			return nil, err
+		}
+	}
+
 	// 默认值（与 migrations 中的 DEFAULT 保持一致）
 	chunkSize := 1024
 	chunkOverlap := 100
@@ -186,6 +199,8 @@ func (s *LibraryService) CreateLibrary(input CreateLibraryInput) (*Library, erro
 		SemanticSegmentationEnabled: semanticSegmentationEnabled,
 		RaptorLLMProviderID:         raptorLLMProviderID,
 		RaptorLLMModelID:            raptorLLMModelID,
+		ContextLLMProviderID:        contextLLMProviderID,
+		ContextLLMModelID:           contextLLMModelID,
 
 		ChunkSize:    chunkSize,
 		ChunkOverlap: chunkOverlap,
@@ -281,6 +296,46 @@ func (s *LibraryService) UpdateLibrary(id int64, input UpdateLibraryInput) (*Lib
 		q = q.Set("raptor_llm_provider_id = ?", rp).Set("raptor_llm_model_id = ?", rm)
 	}
 
+	if input.ContextLLMProviderID != nil || input.ContextLLMModelID != nil {
+		// 与 RAPTOR 配置相同：允许局部更新，先读当前值再合并
+		type row struct {
+			ContextLLMProviderID string `bun:"context_llm_provider_id"`
+			ContextLLMModelID    string `bun:"context_llm_model_id"`
+		}
+		var cur row
+		if err := db.NewSelect().
+			Table("library").
+			Column("context_llm_provider_id", "context_llm_model_id").
+			Where("id = ?", id).
+			Limit(1).
+			Scan(ctx, &cur); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, errs.Newf("error.library_not_found", map[string]any{"ID": id})
+			}
+			return nil, errs.Wrap("error.library_read_failed", err)
+		}
+
+		cp := strings.TrimSpace(cur.ContextLLMProviderID)
+		cm := strings.TrimSpace(cur.ContextLLMModelID)
+
+		if input.ContextLLMProviderID != nil {
+			cp = strings.TrimSpace(*input.ContextLLMProviderID)
+		}
+		if input.ContextLLMModelID != nil {
+			cm = strings.TrimSpace(*input.ContextLLMModelID)
+		}
+		// 两者要么都为空（清空），要么都有值
+		if (cp == "") != (cm == "") {
+			return nil, errs.New("error.library_context_llm_incomplete")
+		}
+		if cp != "" {
+			if err := ensureContextLLMModelExists(ctx, db, cp, cm); err != nil {
+				return nil, err
+			}
+		}
+		q = q.Set("context_llm_provider_id = ?", cp).Set("context_llm_model_id = ?", cm)
+	}
+
 	if input.ChunkSize != nil {
 		if *input.ChunkSize < 500 || *input.ChunkSize > 5000 {
 			return nil, errs.New("error.library_chunk_size_invalid")
@@ -394,3 +449,24 @@ func (s *LibraryService) DeleteLibrary(id int64) error {
 
 	return nil
 }
+
+// ensureContextLLMModelExists 校验上下文增强使用的 LLM 模型存在且已启用
+func ensureContextLLMModelExists(ctx context.Context, db *bun.DB, providerID, modelID string) error {
+	cnt, err := db.NewSelect().
+		Table("models").
+		Where("provider_id = ?", providerID).
+		Where("model_id = ?", modelID).
+		Where("type = ?", "llm").
+		Where("enabled = ?", true).
+		Count(ctx)
+	if err != nil {
+		return errs.Wrap("error.library_read_failed", err)
+	}
+	if cnt == 0 {
+		return errs.Newf("error.library_context_llm_not_found", map[string]any{
+			"ProviderID": providerID,
+			"ModelID":    modelID,
+		})
+	}
+	return nil
+}
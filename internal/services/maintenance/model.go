@@ -0,0 +1,52 @@
+package maintenance
+
+import "time"
+
+// LibraryReport 单个知识库的索引问题统计
+type LibraryReport struct {
+	LibraryID   int64  `json:"library_id"`
+	LibraryName string `json:"library_name"` // 知识库已删除时为空
+
+	OrphanVectors     int   `json:"orphan_vectors"`      // doc_vec 中没有对应节点的向量
+	OrphanFTS         int   `json:"orphan_fts"`          // doc_fts 中没有对应节点的索引
+	MissingVectors    int   `json:"missing_vectors"`     // 已完成向量化的文档中缺少向量的节点
+	MissingVectorDocs int   `json:"missing_vector_docs"` // 缺少向量的文档数（修复时重新向量化）
+	OrphanFiles       int   `json:"orphan_files"`        // 文档目录中没有数据库记录的文件
+	OrphanFileBytes   int64 `json:"orphan_file_bytes"`
+}
+
+// Report 索引完整性检查结果
+type Report struct {
+	Libraries []LibraryReport `json:"libraries"`
+
+	// 全文索引是 contentless 表，无法按行读取知识库；已删除知识库的孤立索引只计入总数
+	OrphanFTS      int      `json:"orphan_fts"`
+	MissingFTS     int      `json:"missing_fts"`     // 没有全文索引的节点
+	LeftoverTables []string `json:"leftover_tables"` // 重建向量表中断后遗留的临时表
+
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// HasIssues 是否存在需要修复的问题
+func (r *Report) HasIssues() bool {
+	if r.OrphanFTS > 0 || r.MissingFTS > 0 || len(r.LeftoverTables) > 0 {
+		return true
+	}
+	for _, lib := range r.Libraries {
+		if lib.OrphanVectors > 0 || lib.MissingVectors > 0 || lib.OrphanFiles > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RepairResult 修复结果
+type RepairResult struct {
+	DroppedTables    []string `json:"dropped_tables"`
+	PurgedVectors    int      `json:"purged_vectors"`
+	RebuiltFTS       bool     `json:"rebuilt_fts"`
+	RemovedFiles     int      `json:"removed_files"`
+	RemovedBytes     int64    `json:"removed_bytes"`
+	ReembedDocuments int      `json:"reembed_documents"` // 已提交重新向量化任务的文档数
+	OptimizeError    string   `json:"optimize_error"`    // 整理数据库（VACUUM）失败的原因，修复本身已完成
+}
@@ -0,0 +1,561 @@
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"chatclaw/internal/errs"
+	"chatclaw/internal/services/document"
+	"chatclaw/internal/services/settings"
+	"chatclaw/internal/sqlite"
+	"chatclaw/internal/taskmanager"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/wailsapp/wails/v3/pkg/application"
+)
+
+const (
+	// intervalKey 定时检查间隔（小时），0 表示关闭
+	intervalKey = "maintenance_interval_hours"
+	// lastRunKey 上一次定时检查的时间
+	lastRunKey = "maintenance_last_run_at"
+
+	// defaultIntervalHours 默认关闭定时检查
+	defaultIntervalHours = 0
+	// scheduleCheckInterval 检查是否到达维护时间的频率
+	scheduleCheckInterval = time.Hour
+	// startupDelay 启动后延迟执行，避免与启动时的任务恢复抢占资源
+	startupDelay = 5 * time.Minute
+
+	// orphanFileGrace 最近修改的文件可能正在上传（先复制文件再写入记录），不视为孤立文件
+	orphanFileGrace = time.Hour
+	// deleteBatchSize 批量删除向量时每条语句的 id 数
+	deleteBatchSize = 500
+)
+
+// MaintenanceService 索引维护服务（暴露给前端调用）：
+// 检查孤立向量 / 全文索引、缺少向量的节点、遗留临时表和孤立文件，由用户确认后修复并整理数据库。
+// 定时任务只做检查，发现问题时通过 maintenance:issues 事件通知前端，不会自动删除数据
+type MaintenanceService struct {
+	app *application.App
+
+	// running 同一时间只允许一次检查或修复
+	running sync.Mutex
+	stop    context.CancelFunc
+}
+
+func NewMaintenanceService(app *application.App) *MaintenanceService {
+	return &MaintenanceService{app: app}
+}
+
+// ServiceStartup 实现 Wails 服务生命周期接口，启动定时检查
+func (s *MaintenanceService) ServiceStartup(ctx context.Context, options application.ServiceOptions) error {
+	runCtx, cancel := context.WithCancel(context.Background())
+	s.stop = cancel
+	go s.scheduleLoop(runCtx)
+	return nil
+}
+
+// ServiceShutdown 实现 Wails 服务生命周期接口
+func (s *MaintenanceService) ServiceShutdown() error {
+	if s.stop != nil {
+		s.stop()
+	}
+	return nil
+}
+
+func (s *MaintenanceService) db() (*bun.DB, error) {
+	db := sqlite.DB()
+	if db == nil {
+		return nil, errs.New("error.sqlite_not_initialized")
+	}
+	return db, nil
+}
+
+// CheckIndex 检查索引完整性（只读，不做修改）
+func (s *MaintenanceService) CheckIndex() (*Report, error) {
+	if !s.running.TryLock() {
+		return nil, errs.New("error.maintenance_running")
+	}
+	defer s.running.Unlock()
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	res, err := s.scan(ctx, db)
+	if err != nil {
+		return nil, errs.Wrap("error.maintenance_check_failed", err)
+	}
+	return res.report, nil
+}
+
+// RepairIndex 检查并修复索引：删除遗留临时表、孤立向量和孤立文件，重建全文索引，
+// 对缺少向量的文档提交重新向量化任务，最后整理数据库（整理失败记录在 OptimizeError 中，不影响修复结果）
+func (s *MaintenanceService) RepairIndex() (*RepairResult, error) {
+	if !s.running.TryLock() {
+		return nil, errs.New("error.maintenance_running")
+	}
+	defer s.running.Unlock()
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	result, err := s.repair(ctx, db)
+	if err != nil {
+		return nil, errs.Wrap("error.maintenance_repair_failed", err)
+	}
+	return result, nil
+}
+
+// OptimizeDatabase 合并全文索引段并执行 VACUUM 回收空间
+func (s *MaintenanceService) OptimizeDatabase() error {
+	if !s.running.TryLock() {
+		return errs.New("error.maintenance_running")
+	}
+	defer s.running.Unlock()
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	if err := s.optimize(ctx, db); err != nil {
+		return errs.Wrap("error.maintenance_optimize_failed", err)
+	}
+	return nil
+}
+
+// scanResult 检查结果及修复所需的明细
+type scanResult struct {
+	report *Report
+
+	orphanVectorIDs   []int64
+	missingVectorDocs map[int64]int64 // 文档 ID -> 知识库 ID
+	orphanFiles       []orphanFile
+}
+
+type orphanFile struct {
+	path string
+	size int64
+}
+
+func (s *MaintenanceService) scan(ctx context.Context, db *bun.DB) (*scanResult, error) {
+	res := &scanResult{
+		report:            &Report{CheckedAt: time.Now()},
+		missingVectorDocs: make(map[int64]int64),
+	}
+
+	// 按知识库汇总；已删除的知识库在遇到时补上
+	var libs []struct {
+		ID   int64  `bun:"id"`
+		Name string `bun:"name"`
+	}
+	if err := db.NewSelect().Table("library").Column("id", "name").OrderExpr("id ASC").Scan(ctx, &libs); err != nil {
+		return nil, fmt.Errorf("query libraries: %w", err)
+	}
+	byLibrary := make(map[int64]*LibraryReport, len(libs))
+	order := make([]int64, 0, len(libs))
+	libraryReport := func(id int64) *LibraryReport {
+		if r, ok := byLibrary[id]; ok {
+			return r
+		}
+		r := &LibraryReport{LibraryID: id}
+		byLibrary[id] = r
+		order = append(order, id)
+		return r
+	}
+	for _, l := range libs {
+		libraryReport(l.ID).LibraryName = l.Name
+	}
+
+	// 1. 孤立向量（doc_vec 没有外键，删除节点时需要手动清理）
+	var orphanVecs []struct {
+		ID        int64 `bun:"id"`
+		LibraryID int64 `bun:"library_id"`
+	}
+	if err := db.NewRaw("SELECT id, library_id FROM doc_vec WHERE id NOT IN (SELECT id FROM document_nodes)").Scan(ctx, &orphanVecs); err != nil {
+		return nil, fmt.Errorf("scan orphan vectors: %w", err)
+	}
+	for _, v := range orphanVecs {
+		libraryReport(v.LibraryID).OrphanVectors++
+		res.orphanVectorIDs = append(res.orphanVectorIDs, v.ID)
+	}
+
+	// 2. 缺少向量的节点（只看已完成向量化的文档，处理中的文档本就没有全部向量）
+	var missing []struct {
+		LibraryID  int64 `bun:"library_id"`
+		DocumentID int64 `bun:"document_id"`
+		Count      int   `bun:"cnt"`
+	}
+	if err := db.NewRaw(`
+		SELECT n.library_id, n.document_id, COUNT(*) AS cnt
+		FROM document_nodes n
+		JOIN documents d ON d.id = n.document_id
+		WHERE d.embedding_status = ?
+		  AND n.id NOT IN (SELECT id FROM doc_vec)
+		GROUP BY n.library_id, n.document_id
+	`, document.StatusCompleted).Scan(ctx, &missing); err != nil {
+		return nil, fmt.Errorf("scan missing vectors: %w", err)
+	}
+	for _, m := range missing {
+		r := libraryReport(m.LibraryID)
+		r.MissingVectors += m.Count
+		r.MissingVectorDocs++
+		res.missingVectorDocs[m.DocumentID] = m.LibraryID
+	}
+
+	// 3. 全文索引与节点不一致（索引由触发器维护，正常情况下不会出现）
+	if err := db.NewRaw("SELECT COUNT(*) FROM doc_fts WHERE rowid NOT IN (SELECT id FROM document_nodes)").Scan(ctx, &res.report.OrphanFTS); err != nil {
+		return nil, fmt.Errorf("scan orphan fts: %w", err)
+	}
+	if res.report.OrphanFTS > 0 {
+		for _, l := range libs {
+			var n int
+			if err := db.NewRaw(
+				"SELECT COUNT(*) FROM doc_fts WHERE doc_fts MATCH ? AND rowid NOT IN (SELECT id FROM document_nodes)",
+				fmt.Sprintf("library_id:%d", l.ID),
+			).Scan(ctx, &n); err != nil {
+				return nil, fmt.Errorf("scan orphan fts: %w", err)
+			}
+			libraryReport(l.ID).OrphanFTS = n
+		}
+	}
+	if err := db.NewRaw("SELECT COUNT(*) FROM document_nodes WHERE id NOT IN (SELECT rowid FROM doc_fts)").Scan(ctx, &res.report.MissingFTS); err != nil {
+		return nil, fmt.Errorf("scan missing fts: %w", err)
+	}
+
+	// 4. 重建向量表中断后遗留的临时表
+	tables, err := leftoverTables(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("scan leftover tables: %w", err)
+	}
+	res.report.LeftoverTables = tables
+
+	// 5. 文档目录中没有数据库记录的文件
+	files, err := s.scanOrphanFiles(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("scan orphan files: %w", err)
+	}
+	for libraryID, list := range files {
+		r := libraryReport(libraryID)
+		for _, f := range list {
+			r.OrphanFiles++
+			r.OrphanFileBytes += f.size
+			res.orphanFiles = append(res.orphanFiles, f)
+		}
+	}
+
+	res.report.Libraries = make([]LibraryReport, 0, len(order))
+	for _, id := range order {
+		res.report.Libraries = append(res.report.Libraries, *byLibrary[id])
+	}
+	return res, nil
+}
+
+// leftoverTables 返回遗留的临时向量表（vec0 的影子表随虚拟表一起删除，不单独列出）
+func leftoverTables(ctx context.Context, db *bun.DB) ([]string, error) {
+	var rows []struct {
+		Name string `bun:"name"`
+		SQL  string `bun:"sql"`
+	}
+	if err := db.NewRaw(`
+		SELECT name, COALESCE(sql, '') AS sql
+		FROM sqlite_master
+		WHERE type = 'table'
+		  AND (name LIKE 'doc\_vec\_tmp\_%' ESCAPE '\'
+		    OR name LIKE 'doc\_vec\_old\_%' ESCAPE '\'
+		    OR name IN ('doc_vec_migrate', 'doc_vec_convert'))
+		ORDER BY name
+	`).Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	var virtual []string
+	for _, r := range rows {
+		if strings.HasPrefix(strings.ToUpper(r.SQL), "CREATE VIRTUAL TABLE") {
+			virtual = append(virtual, r.Name)
+		}
+	}
+	out := make([]string, 0, len(rows))
+	for _, r := range rows {
+		shadow := false
+		for _, v := range virtual {
+			if strings.HasPrefix(r.Name, v+"_") {
+				shadow = true
+				break
+			}
+		}
+		if !shadow {
+			out = append(out, r.Name)
+		}
+	}
+	return out, nil
+}
+
+// scanOrphanFiles 按知识库返回文档目录中没有数据库记录的文件（目录名不是知识库 ID 的计入 0）
+func (s *MaintenanceService) scanOrphanFiles(ctx context.Context, db *bun.DB) (map[int64][]orphanFile, error) {
+	docsDir, err := document.NewDocumentService(s.app).GetDocumentsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if err := db.NewSelect().Table("documents").Column("local_path").Where("local_path <> ''").Scan(ctx, &paths); err != nil {
+		return nil, err
+	}
+	known := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		known[filepath.Clean(p)] = struct{}{}
+	}
+
+	out := make(map[int64][]orphanFile)
+	cutoff := time.Now().Add(-orphanFileGrace)
+	err = filepath.WalkDir(docsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		if _, ok := known[filepath.Clean(path)]; ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		var libraryID int64
+		if rel, err := filepath.Rel(docsDir, path); err == nil {
+			first := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+			libraryID, _ = strconv.ParseInt(first, 10, 64)
+		}
+		out[libraryID] = append(out[libraryID], orphanFile{path: path, size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *MaintenanceService) repair(ctx context.Context, db *bun.DB) (*RepairResult, error) {
+	res, err := s.scan(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	report := res.report
+	result := &RepairResult{}
+
+	// 1. 删除遗留的临时表
+	for _, name := range report.LeftoverTables {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS "%s"`, name)); err != nil {
+			return nil, fmt.Errorf("drop %s: %w", name, err)
+		}
+		result.DroppedTables = append(result.DroppedTables, name)
+	}
+
+	// 2. 删除孤立向量
+	for start := 0; start < len(res.orphanVectorIDs); start += deleteBatchSize {
+		ids := res.orphanVectorIDs[start:min(start+deleteBatchSize, len(res.orphanVectorIDs))]
+		if _, err := db.NewRaw("DELETE FROM doc_vec WHERE id IN (?)", bun.In(ids)).Exec(ctx); err != nil {
+			return nil, fmt.Errorf("purge orphan vectors: %w", err)
+		}
+		result.PurgedVectors += len(ids)
+	}
+
+	// 3. 全文索引不一致时按节点重建（contentless 表无法按行删除不知道原内容的索引）
+	if report.OrphanFTS > 0 || report.MissingFTS > 0 {
+		if err := rebuildFTS(ctx, db); err != nil {
+			return nil, fmt.Errorf("rebuild fts: %w", err)
+		}
+		result.RebuiltFTS = true
+	}
+
+	// 4. 删除孤立文件
+	for _, f := range res.orphanFiles {
+		if err := os.Remove(f.path); err != nil {
+			s.app.Logger.Warn("remove orphan file failed", "path", f.path, "error", err)
+			continue
+		}
+		result.RemovedFiles++
+		result.RemovedBytes += f.size
+	}
+
+	// 5. 缺少向量的文档重新向量化
+	result.ReembedDocuments = s.submitReembed(ctx, db, res.missingVectorDocs)
+
+	// 6. 整理数据库：修复已经完成，整理失败（如 VACUUM 时磁盘空间不足）单独报告
+	if err := s.optimize(ctx, db); err != nil {
+		s.app.Logger.Warn("optimize after repair failed", "error", err)
+		result.OptimizeError = err.Error()
+	}
+
+	s.app.Logger.Info("index repaired",
+		"droppedTables", len(result.DroppedTables),
+		"purgedVectors", result.PurgedVectors,
+		"rebuiltFTS", result.RebuiltFTS,
+		"removedFiles", result.RemovedFiles,
+		"reembedDocuments", result.ReembedDocuments,
+	)
+	return result, nil
+}
+
+// rebuildFTS 清空 doc_fts 并按 document_nodes 重新写入
+func rebuildFTS(ctx context.Context, db *bun.DB) error {
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO doc_fts(doc_fts) VALUES('delete-all')`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO doc_fts(rowid, tokens, library_id, document_id, level)
+			SELECT id, content_tokens, library_id, document_id, level FROM document_nodes
+		`)
+		return err
+	})
+}
+
+// submitReembed 为文档提交重新向量化任务，返回提交成功的数量
+func (s *MaintenanceService) submitReembed(ctx context.Context, db *bun.DB, docs map[int64]int64) int {
+	tm := taskmanager.Get()
+	if tm == nil || len(docs) == 0 {
+		return 0
+	}
+
+	ids := make([]int64, 0, len(docs))
+	for id := range docs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+
+	submitted := 0
+	for _, docID := range ids {
+		runID := uuid.New().String()
+		if _, err := db.NewUpdate().
+			Table("documents").
+			Set("processing_run_id = ?", runID).
+			Set("embedding_status = ?", document.StatusPending).
+			Set("embedding_progress = ?", 0).
+			Set("embedding_error = ?", "").
+			Where("id = ?", docID).
+			Exec(ctx); err != nil {
+			s.app.Logger.Error("update document for reembed failed", "docID", docID, "error", err)
+			continue
+		}
+
+		jobData, _ := json.Marshal(document.ProcessJobData{
+			DocID:     docID,
+			LibraryID: docs[docID],
+			RunID:     runID,
+		})
+		taskKey := fmt.Sprintf("doc:%d", docID)
+		if tm.SubmitWithPriority(taskmanager.QueueDocument, document.JobTypeReembed, taskKey, runID, taskmanager.PriorityLow, jobData) {
+			submitted++
+		}
+	}
+	return submitted
+}
+
+// optimize 合并全文索引段并 VACUUM
+func (s *MaintenanceService) optimize(ctx context.Context, db *bun.DB) error {
+	for _, table := range []string{"doc_fts", "doc_name_fts"} {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s(%s) VALUES('optimize')`, table, table)); err != nil {
+			return fmt.Errorf("optimize %s: %w", table, err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, `VACUUM`); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	return nil
+}
+
+// scheduleLoop 按 maintenance_interval_hours 定时检查
+func (s *MaintenanceService) scheduleLoop(ctx context.Context) {
+	timer := time.NewTimer(startupDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		if s.due() {
+			s.runScheduled(ctx)
+		}
+		timer.Reset(scheduleCheckInterval)
+	}
+}
+
+// due 是否到达定时检查时间
+// 从未运行过时以当前时间为起点，满一个间隔后再检查，避免开启后立即运行
+func (s *MaintenanceService) due() bool {
+	hours := settings.GetInt(intervalKey, defaultIntervalHours)
+	if hours <= 0 {
+		return false
+	}
+	v, _ := settings.GetValue(lastRunKey)
+	last, err := time.Parse(time.RFC3339, strings.TrimSpace(v))
+	if err != nil {
+		s.saveLastRun()
+		return false
+	}
+	return time.Since(last) >= time.Duration(hours)*time.Hour
+}
+
+// saveLastRun 记录定时检查时间
+func (s *MaintenanceService) saveLastRun() {
+	if _, err := settings.NewSettingsService(s.app).SetValue(lastRunKey, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		s.app.Logger.Warn("save maintenance run time failed", "error", err)
+	}
+}
+
+func (s *MaintenanceService) runScheduled(ctx context.Context) {
+	if !s.running.TryLock() {
+		return
+	}
+	defer s.running.Unlock()
+
+	db, err := s.db()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	// 只检查不修复：修复会删除数据，需要用户确认后调用 RepairIndex
+	res, err := s.scan(ctx, db)
+	if err != nil {
+		s.app.Logger.Error("scheduled index check failed", "error", err)
+	} else if res.report.HasIssues() {
+		s.app.Logger.Info("scheduled index check found issues")
+		s.app.Event.Emit("maintenance:issues", *res.report)
+	}
+	// 失败也记录时间，避免每小时重复失败
+	s.saveLastRun()
+}
@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	// maxExtractInputRunes 发送给提取模型的单条消息长度上限
+	maxExtractInputRunes = 2000
+	// maxExtractedPerTurn 每轮对话最多写入的记忆条数
+	maxExtractedPerTurn = 5
+)
+
+// Extracted 从一轮对话中提取出的记忆
+type Extracted struct {
+	Content string `json:"content"`
+	Scope   string `json:"scope"` // agent / user
+}
+
+const extractPrompt = `You maintain the long-term memory of an AI assistant.
+From the conversation turn below, extract facts worth remembering in future conversations: the user's preferences, personal details, ongoing projects, decisions and explicit requests to remember something.
+Do not extract small talk, one-off questions, general knowledge, or facts that only matter for this turn. Do not repeat the known memories unless the turn changes them.
+
+Each memory is one short, self-contained sentence in the same language as the user.
+Use scope "user" for facts about the user that any assistant should know (name, language, preferences), and "agent" for facts that only matter for this assistant's task.
+
+Known memories:
+%s
+
+User: %s
+
+Assistant: %s
+
+Output a JSON array such as [{"content": "...", "scope": "user"}], or [] if there is nothing to remember. Output only the JSON.`
+
+// Extract 让模型从一轮对话（用户消息 + 回答）中提取值得长期记住的信息
+// known 为已有的相关记忆，避免重复提取。
+func Extract(ctx context.Context, llm model.BaseChatModel, known []Memory, userContent, answer string) ([]Extracted, error) {
+	userContent = strings.TrimSpace(userContent)
+	if userContent == "" {
+		return nil, nil
+	}
+
+	knownText := "(none)"
+	if len(known) > 0 {
+		lines := make([]string, len(known))
+		for i, m := range known {
+			lines[i] = "- " + m.Content
+		}
+		knownText = strings.Join(lines, "\n")
+	}
+
+	prompt := fmt.Sprintf(extractPrompt, knownText, truncate(userContent), truncate(strings.TrimSpace(answer)))
+	resp, err := llm.Generate(ctx, []*schema.Message{schema.UserMessage(prompt)})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("empty response")
+	}
+	return parseExtracted(resp.Content)
+}
+
+// parseExtracted 解析模型输出的 JSON 数组（容忍代码块包裹和前后说明文字）
+func parseExtracted(out string) ([]Extracted, error) {
+	start := strings.Index(out, "[")
+	end := strings.LastIndex(out, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in extraction output")
+	}
+	var items []Extracted
+	if err := json.Unmarshal([]byte(out[start:end+1]), &items); err != nil {
+		return nil, fmt.Errorf("parse extraction output: %w", err)
+	}
+
+	result := make([]Extracted, 0, len(items))
+	for _, item := range items {
+		item.Content = strings.TrimSpace(item.Content)
+		if item.Content == "" || len([]rune(item.Content)) > maxContentRunes {
+			continue
+		}
+		if !IsValidScope(item.Scope) {
+			item.Scope = ScopeAgent
+		}
+		result = append(result, item)
+		if len(result) >= maxExtractedPerTurn {
+			break
+		}
+	}
+	return result, nil
+}
+
+func truncate(s string) string {
+	if r := []rune(s); len(r) > maxExtractInputRunes {
+		return string(r[:maxExtractInputRunes]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"chatclaw/internal/sqlite"
+
+	"github.com/uptrace/bun"
+)
+
+// 记忆范围
+const (
+	ScopeAgent = "agent" // 只对所属助手可见
+	ScopeUser  = "user"  // 用户级记忆，所有启用记忆的助手共享
+)
+
+// IsValidScope 检查记忆范围是否合法
+func IsValidScope(scope string) bool {
+	return scope == ScopeAgent || scope == ScopeUser
+}
+
+// 记忆来源
+const (
+	SourceManual    = "manual"    // 在管理界面手动添加
+	SourceTool      = "tool"      // 模型调用 remember 工具写入
+	SourceExtracted = "extracted" // 对话结束后自动提取
+)
+
+const (
+	// maxContentRunes 单条记忆的最大长度
+	maxContentRunes = 1000
+	// maxMemoriesPerScope 每个助手（或用户级）最多保存的记忆条数；检索时向量在内存中逐条比较
+	maxMemoriesPerScope = 500
+)
+
+// Memory 记忆 DTO（暴露给前端）
+type Memory struct {
+	ID int64 `json:"id"`
+
+	AgentID        int64  `json:"agent_id"` // 用户级记忆为 0
+	Scope          string `json:"scope"`    // agent / user
+	Content        string `json:"content"`
+	Source         string `json:"source"` // manual / tool / extracted
+	ConversationID int64  `json:"conversation_id"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListMemoriesInput 查询记忆的参数
+type ListMemoriesInput struct {
+	AgentID int64  `json:"agent_id"` // 助手记忆所属助手；同时返回用户级记忆时使用
+	Scope   string `json:"scope"`    // agent / user，为空表示两者都返回
+	Query   string `json:"query"`    // 非空时按相关度检索
+}
+
+// CreateMemoryInput 手动添加记忆的参数
+type CreateMemoryInput struct {
+	AgentID int64  `json:"agent_id"`
+	Scope   string `json:"scope"` // 默认 agent
+	Content string `json:"content"`
+}
+
+// UpdateMemoryInput 编辑记忆的参数
+type UpdateMemoryInput struct {
+	Content *string `json:"content"`
+	Scope   *string `json:"scope"` // 修改范围（改为 agent 时需要 AgentID）
+
+	AgentID int64 `json:"agent_id"`
+}
+
+// ClearMemoriesInput 清空记忆的参数
+type ClearMemoriesInput struct {
+	AgentID int64  `json:"agent_id"`
+	Scope   string `json:"scope"` // agent：清空该助手的记忆；user：清空用户级记忆
+}
+
+type memoryModel struct {
+	bun.BaseModel `bun:"table:agent_memories,alias:m"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	CreatedAt time.Time `bun:"created_at,notnull"`
+	UpdatedAt time.Time `bun:"updated_at,notnull"`
+
+	AgentID        *int64 `bun:"agent_id"`
+	Content        string `bun:"content,notnull"`
+	ContentTokens  string `bun:"content_tokens,notnull"`
+	Source         string `bun:"source,notnull"`
+	ConversationID int64  `bun:"conversation_id,notnull"`
+
+	Embedding      []byte `bun:"embedding"`
+	EmbeddingModel string `bun:"embedding_model,notnull"`
+}
+
+// BeforeInsert 在 INSERT 时自动设置 created_at 和 updated_at（字符串格式）
+var _ bun.BeforeInsertHook = (*memoryModel)(nil)
+
+func (*memoryModel) BeforeInsert(ctx context.Context, query *bun.InsertQuery) error {
+	now := sqlite.NowUTC()
+	query.Value("created_at", "?", now)
+	query.Value("updated_at", "?", now)
+	return nil
+}
+
+// BeforeUpdate 在 UPDATE 时自动设置 updated_at（字符串格式）
+var _ bun.BeforeUpdateHook = (*memoryModel)(nil)
+
+func (*memoryModel) BeforeUpdate(ctx context.Context, query *bun.UpdateQuery) error {
+	query.Set("updated_at = ?", sqlite.NowUTC())
+	return nil
+}
+
+func (m *memoryModel) toDTO() Memory {
+	out := Memory{
+		ID:             m.ID,
+		Scope:          ScopeUser,
+		Content:        m.Content,
+		Source:         m.Source,
+		ConversationID: m.ConversationID,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+	if m.AgentID != nil {
+		out.AgentID = *m.AgentID
+		out.Scope = ScopeAgent
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"chatclaw/internal/errs"
+	"chatclaw/internal/sqlite"
+
+	"github.com/uptrace/bun"
+	"github.com/wailsapp/wails/v3/pkg/application"
+)
+
+// MemoryService 长期记忆管理服务（暴露给前端调用）：查看、检索、添加、编辑和删除助手记忆
+type MemoryService struct {
+	app *application.App
+}
+
+func NewMemoryService(app *application.App) *MemoryService {
+	return &MemoryService{app: app}
+}
+
+func (s *MemoryService) db() (*bun.DB, error) {
+	db := sqlite.DB()
+	if db == nil {
+		return nil, errs.New("error.sqlite_not_initialized")
+	}
+	return db, nil
+}
+
+// ListMemories 列出记忆；Query 非空时按相关度检索该助手可见的记忆（此时忽略 Scope）
+func (s *MemoryService) ListMemories(input ListMemoriesInput) ([]Memory, error) {
+	scope := strings.TrimSpace(input.Scope)
+	if scope != "" && !IsValidScope(scope) {
+		return nil, errs.New("error.memory_scope_invalid")
+	}
+	if scope != ScopeUser && input.AgentID <= 0 {
+		return nil, errs.New("error.agent_id_required")
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	if query := strings.TrimSpace(input.Query); query != "" {
+		// 检索需要生成查询向量
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return OpenStore(ctx, db).Search(ctx, input.AgentID, query, maxMemoriesPerScope)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// 列表不需要向量
+	return NewStore(db, nil, "").List(ctx, input.AgentID, scope)
+}
+
+// CreateMemory 手动添加记忆；与已有记忆重复时更新已有记忆
+func (s *MemoryService) CreateMemory(input CreateMemoryInput) (*Memory, error) {
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	scope := strings.TrimSpace(input.Scope)
+	mem, _, err := OpenStore(ctx, db).Add(ctx, input.AgentID, scope, input.Content, SourceManual, 0)
+	return mem, err
+}
+
+// UpdateMemory 编辑记忆内容或范围
+func (s *MemoryService) UpdateMemory(id int64, input UpdateMemoryInput) (*Memory, error) {
+	if id <= 0 {
+		return nil, errs.New("error.memory_id_required")
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store := NewStore(db, nil, "")
+	if input.Content != nil {
+		// 内容变化需要重新生成向量
+		store = OpenStore(ctx, db)
+	}
+	return store.Update(ctx, id, input)
+}
+
+// DeleteMemory 删除一条记忆
+func (s *MemoryService) DeleteMemory(id int64) error {
+	if id <= 0 {
+		return errs.New("error.memory_id_required")
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return NewStore(db, nil, "").Delete(ctx, id, 0)
+}
+
+// ClearMemories 清空助手记忆或用户级记忆，返回删除的条数
+func (s *MemoryService) ClearMemories(input ClearMemoriesInput) (int, error) {
+	db, err := s.db()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return NewStore(db, nil, "").Clear(ctx, input.AgentID, strings.TrimSpace(input.Scope))
+}
@@ -0,0 +1,523 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	einoembed "chatclaw/internal/eino/embedding"
+	"chatclaw/internal/eino/processor"
+	"chatclaw/internal/errs"
+	"chatclaw/internal/fts/tokenizer"
+	"chatclaw/internal/sqlite/vecstore"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/uptrace/bun"
+)
+
+const (
+	// rrfK 与知识库检索一致的 RRF 常数
+	rrfK = 60
+	// defaultTopK 检索默认返回的记忆条数
+	defaultTopK = 8
+	// duplicateSimilarity 与同范围已有记忆的余弦相似度达到该值时视为同一条记忆（更新而不是新增）
+	duplicateSimilarity = 0.92
+	// maxEmbedBatch 检索时为缺少向量（或嵌入模型已变化）的记忆补齐向量的最大条数
+	maxEmbedBatch = 100
+)
+
+// Store 记忆的读写与检索，供管理接口、聊天工具和自动提取共用
+// 记忆按助手存放在 agent_memories 中：全文检索使用 memory_fts，向量保存在记忆行内，
+// 每个助手的记忆条数有限，检索时在内存中逐条计算相似度，不依赖随嵌入设置重建的 doc_vec。
+type Store struct {
+	db           *bun.DB
+	embedder     embedding.Embedder // 为 nil 时只使用全文检索
+	embeddingKey string             // 供应商/模型:维度，与记忆行的 embedding_model 比较
+}
+
+// NewStore 创建记忆存储，embedder 可为 nil
+func NewStore(db *bun.DB, embedder embedding.Embedder, embeddingKey string) *Store {
+	if embedder == nil {
+		embeddingKey = ""
+	}
+	return &Store{db: db, embedder: embedder, embeddingKey: embeddingKey}
+}
+
+// OpenStore 按全局嵌入设置创建记忆存储；嵌入模型未配置或创建失败时只使用全文检索
+func OpenStore(ctx context.Context, db *bun.DB) *Store {
+	cfg, err := processor.GetEmbeddingConfig(ctx, db)
+	if err != nil {
+		log.Printf("[memory] embedding unavailable, using full-text search only: %v", err)
+		return NewStore(db, nil, "")
+	}
+	embedder, err := einoembed.NewEmbedder(ctx, &einoembed.ProviderConfig{
+		ProviderID:   cfg.ProviderID,
+		ProviderType: cfg.ProviderType,
+		APIKey:       cfg.APIKey,
+		APIEndpoint:  cfg.APIEndpoint,
+		ModelID:      cfg.ModelID,
+		Dimension:    cfg.Dimension,
+		ExtraConfig:  cfg.ExtraConfig,
+		Batch:        cfg.Batch,
+	})
+	if err != nil || embedder == nil {
+		log.Printf("[memory] create embedder failed, using full-text search only: %v", err)
+		return NewStore(db, nil, "")
+	}
+	return NewStore(db, embedder, fmt.Sprintf("%s/%s:%d", cfg.ProviderID, cfg.ModelID, cfg.Dimension))
+}
+
+// normalizeContent 去除首尾空白并校验长度
+func normalizeContent(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", errs.New("error.memory_content_required")
+	}
+	if len([]rune(content)) > maxContentRunes {
+		return "", errs.Newf("error.memory_content_too_long", map[string]any{"Max": maxContentRunes})
+	}
+	return content, nil
+}
+
+// scopeFilter 限定记忆范围：user 为用户级记忆，agent 为该助手的记忆，空表示该助手可见的全部记忆
+func scopeFilter(q *bun.SelectQuery, agentID int64, scope string) *bun.SelectQuery {
+	switch scope {
+	case ScopeUser:
+		return q.Where("m.agent_id IS NULL")
+	case ScopeAgent:
+		return q.Where("m.agent_id = ?", agentID)
+	default:
+		return q.Where("(m.agent_id = ? OR m.agent_id IS NULL)", agentID)
+	}
+}
+
+// List 列出记忆（按更新时间倒序）
+func (s *Store) List(ctx context.Context, agentID int64, scope string) ([]Memory, error) {
+	var models []memoryModel
+	q := s.db.NewSelect().Model(&models).ExcludeColumn("embedding")
+	if err := scopeFilter(q, agentID, scope).
+		OrderExpr("m.updated_at DESC, m.id DESC").
+		Scan(ctx); err != nil {
+		return nil, errs.Wrap("error.memory_read_failed", err)
+	}
+	out := make([]Memory, 0, len(models))
+	for i := range models {
+		out = append(out, models[i].toDTO())
+	}
+	return out, nil
+}
+
+// Get 读取一条记忆
+func (s *Store) Get(ctx context.Context, id int64) (*Memory, error) {
+	m, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	dto := m.toDTO()
+	return &dto, nil
+}
+
+func (s *Store) load(ctx context.Context, id int64) (*memoryModel, error) {
+	var m memoryModel
+	if err := s.db.NewSelect().Model(&m).Where("id = ?", id).Limit(1).Scan(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.Newf("error.memory_not_found", map[string]any{"ID": id})
+		}
+		return nil, errs.Wrap("error.memory_read_failed", err)
+	}
+	return &m, nil
+}
+
+// Add 写入一条记忆
+// 与同范围内已有记忆重复（内容相同或语义接近）时用新内容更新已有记忆，返回的 updated 为 true。
+func (s *Store) Add(ctx context.Context, agentID int64, scope, content, source string, conversationID int64) (mem *Memory, updated bool, err error) {
+	if content, err = normalizeContent(content); err != nil {
+		return nil, false, err
+	}
+	if scope == "" {
+		scope = ScopeAgent
+	}
+	if !IsValidScope(scope) {
+		return nil, false, errs.New("error.memory_scope_invalid")
+	}
+	if scope == ScopeAgent && agentID <= 0 {
+		return nil, false, errs.New("error.agent_id_required")
+	}
+
+	vec := s.embedOne(ctx, content)
+
+	// 同范围内的已有记忆（用于去重和条数限制）
+	var existing []memoryModel
+	q := s.db.NewSelect().Model(&existing).Column("id", "content", "embedding", "embedding_model")
+	if err := scopeFilter(q, agentID, scope).Scan(ctx); err != nil {
+		return nil, false, errs.Wrap("error.memory_read_failed", err)
+	}
+	if dup := s.findDuplicate(existing, content, vec); dup > 0 {
+		q := s.db.NewUpdate().
+			Model((*memoryModel)(nil)).
+			Where("id = ?", dup).
+			Set("content = ?", content).
+			Set("content_tokens = ?", tokenizer.TokenizeContent(content))
+		q = s.setEmbedding(q, vec)
+		if _, err := q.Exec(ctx); err != nil {
+			return nil, false, errs.Wrap("error.memory_save_failed", err)
+		}
+		mem, err := s.Get(ctx, dup)
+		return mem, true, err
+	}
+	if len(existing) >= maxMemoriesPerScope {
+		return nil, false, errs.Newf("error.memory_limit_reached", map[string]any{"Max": maxMemoriesPerScope})
+	}
+
+	m := &memoryModel{
+		Content:        content,
+		ContentTokens:  tokenizer.TokenizeContent(content),
+		Source:         source,
+		ConversationID: conversationID,
+	}
+	if scope == ScopeAgent {
+		m.AgentID = &agentID
+	}
+	if vec != nil {
+		m.Embedding = vecstore.Encode(vec)
+		m.EmbeddingModel = s.embeddingKey
+	}
+	if _, err := s.db.NewInsert().Model(m).Exec(ctx); err != nil {
+		return nil, false, errs.Wrap("error.memory_save_failed", err)
+	}
+	mem, err = s.Get(ctx, m.ID)
+	return mem, false, err
+}
+
+// findDuplicate 返回与 content 重复的记忆 ID，没有时返回 0
+func (s *Store) findDuplicate(existing []memoryModel, content string, vec []float64) int64 {
+	var bestID int64
+	best := duplicateSimilarity
+	for _, m := range existing {
+		if strings.EqualFold(strings.TrimSpace(m.Content), content) {
+			return m.ID
+		}
+		if vec == nil || m.EmbeddingModel != s.embeddingKey {
+			continue
+		}
+		if sim := cosine(vec, vecstore.Decode(m.Embedding)); sim >= best {
+			best, bestID = sim, m.ID
+		}
+	}
+	return bestID
+}
+
+// Update 编辑记忆内容或范围
+func (s *Store) Update(ctx context.Context, id int64, input UpdateMemoryInput) (*Memory, error) {
+	if _, err := s.load(ctx, id); err != nil {
+		return nil, err
+	}
+
+	q := s.db.NewUpdate().Model((*memoryModel)(nil)).Where("id = ?", id)
+	if input.Content != nil {
+		content, err := normalizeContent(*input.Content)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("content = ?", content).
+			Set("content_tokens = ?", tokenizer.TokenizeContent(content))
+		q = s.setEmbedding(q, s.embedOne(ctx, content))
+	}
+	if input.Scope != nil {
+		switch *input.Scope {
+		case ScopeUser:
+			q = q.Set("agent_id = NULL")
+		case ScopeAgent:
+			if input.AgentID <= 0 {
+				return nil, errs.New("error.agent_id_required")
+			}
+			q = q.Set("agent_id = ?", input.AgentID)
+		default:
+			return nil, errs.New("error.memory_scope_invalid")
+		}
+	}
+
+	if _, err := q.Exec(ctx); err != nil {
+		return nil, errs.Wrap("error.memory_save_failed", err)
+	}
+	return s.Get(ctx, id)
+}
+
+// setEmbedding 写入新向量；向量生成失败时清空旧向量，检索时再补齐
+func (s *Store) setEmbedding(q *bun.UpdateQuery, vec []float64) *bun.UpdateQuery {
+	if vec == nil {
+		return q.Set("embedding = NULL").Set("embedding_model = ''")
+	}
+	return q.Set("embedding = ?", vecstore.Encode(vec)).Set("embedding_model = ?", s.embeddingKey)
+}
+
+// Delete 删除记忆；agentID > 0 时只允许删除该助手可见的记忆（供 forget 工具使用）
+func (s *Store) Delete(ctx context.Context, id, agentID int64) error {
+	q := s.db.NewDelete().Model((*memoryModel)(nil)).Where("id = ?", id)
+	if agentID > 0 {
+		q = q.Where("(agent_id = ? OR agent_id IS NULL)", agentID)
+	}
+	result, err := q.Exec(ctx)
+	if err != nil {
+		return errs.Wrap("error.memory_delete_failed", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errs.Newf("error.memory_not_found", map[string]any{"ID": id})
+	}
+	return nil
+}
+
+// Clear 清空助手记忆（scope=agent）或用户级记忆（scope=user），返回删除的条数
+func (s *Store) Clear(ctx context.Context, agentID int64, scope string) (int, error) {
+	q := s.db.NewDelete().Model((*memoryModel)(nil))
+	switch scope {
+	case ScopeUser:
+		q = q.Where("agent_id IS NULL")
+	case ScopeAgent:
+		if agentID <= 0 {
+			return 0, errs.New("error.agent_id_required")
+		}
+		q = q.Where("agent_id = ?", agentID)
+	default:
+		return 0, errs.New("error.memory_scope_invalid")
+	}
+	result, err := q.Exec(ctx)
+	if err != nil {
+		return 0, errs.Wrap("error.memory_delete_failed", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+// Search 检索与 query 相关、该助手可见的记忆（助手记忆 + 用户级记忆）
+// 全文检索与向量检索的排名按 RRF 融合；向量不可用时只使用全文检索。
+func (s *Store) Search(ctx context.Context, agentID int64, query string, topK int) ([]Memory, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
+	if topK <= 0 {
+		topK = defaultTopK
+	}
+	fetchK := max(topK*3, 30)
+
+	var lists [][]int64
+	ftsIDs, err := s.fullTextSearch(ctx, agentID, query, fetchK)
+	if err != nil {
+		return nil, errs.Wrap("error.memory_read_failed", err)
+	}
+	lists = append(lists, ftsIDs)
+
+	vecIDs, err := s.vectorSearch(ctx, agentID, query, fetchK)
+	if err != nil {
+		// 向量检索失败不影响全文检索结果
+		log.Printf("[memory] vector search failed: %v", err)
+	}
+	lists = append(lists, vecIDs)
+
+	ids := rrfMerge(lists...)
+	if len(ids) > topK {
+		ids = ids[:topK]
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var models []memoryModel
+	if err := s.db.NewSelect().
+		Model(&models).
+		ExcludeColumn("embedding").
+		Where("id IN (?)", bun.In(ids)).
+		Scan(ctx); err != nil {
+		return nil, errs.Wrap("error.memory_read_failed", err)
+	}
+	byID := make(map[int64]*memoryModel, len(models))
+	for i := range models {
+		byID[models[i].ID] = &models[i]
+	}
+	out := make([]Memory, 0, len(ids))
+	for _, id := range ids {
+		if m, ok := byID[id]; ok {
+			out = append(out, m.toDTO())
+		}
+	}
+	return out, nil
+}
+
+// fullTextSearch 在 memory_fts 中检索，agent_id 为 0 的行是用户级记忆
+func (s *Store) fullTextSearch(ctx context.Context, agentID int64, query string, limit int) ([]int64, error) {
+	matchQuery := tokenizer.BuildMatchQuery(query)
+	if matchQuery == "" {
+		return nil, nil
+	}
+	ftsQuery := fmt.Sprintf("(%s) AND (agent_id:%d OR agent_id:0)", matchQuery, max(agentID, 0))
+
+	var ids []int64
+	if err := s.db.NewRaw(
+		"SELECT rowid FROM memory_fts WHERE memory_fts MATCH ? ORDER BY bm25(memory_fts) LIMIT ?",
+		ftsQuery, limit,
+	).Scan(ctx, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// vectorSearch 按余弦相似度对该助手可见的记忆排序
+func (s *Store) vectorSearch(ctx context.Context, agentID int64, query string, limit int) ([]int64, error) {
+	if s.embedder == nil {
+		return nil, nil
+	}
+
+	var rows []memoryModel
+	q := s.db.NewSelect().Model(&rows).Column("id", "content", "embedding", "embedding_model")
+	if err := scopeFilter(q, agentID, "").Scan(ctx); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	if err := s.ensureEmbeddings(ctx, rows); err != nil {
+		log.Printf("[memory] embed memories failed: %v", err)
+	}
+
+	vectors, err := s.embedder.EmbedStrings(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 || len(vectors[0]) == 0 {
+		return nil, fmt.Errorf("empty embedding result")
+	}
+	qvec := vectors[0]
+
+	type scored struct {
+		id    int64
+		score float64
+	}
+	hits := make([]scored, 0, len(rows))
+	for _, r := range rows {
+		if r.EmbeddingModel != s.embeddingKey {
+			continue
+		}
+		vec := vecstore.Decode(r.Embedding)
+		if len(vec) != len(qvec) {
+			continue
+		}
+		hits = append(hits, scored{id: r.ID, score: cosine(qvec, vec)})
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	ids := make([]int64, len(hits))
+	for i, h := range hits {
+		ids[i] = h.id
+	}
+	return ids, nil
+}
+
+// ensureEmbeddings 为缺少向量或嵌入模型已变化的记忆补齐向量（就地更新 rows）
+// 只更新向量列，不修改 updated_at
+func (s *Store) ensureEmbeddings(ctx context.Context, rows []memoryModel) error {
+	var stale []int
+	for i := range rows {
+		if rows[i].EmbeddingModel != s.embeddingKey || len(rows[i].Embedding) == 0 {
+			stale = append(stale, i)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	if len(stale) > maxEmbedBatch {
+		stale = stale[:maxEmbedBatch]
+	}
+
+	texts := make([]string, len(stale))
+	for i, idx := range stale {
+		texts[i] = rows[idx].Content
+	}
+	vectors, err := s.embedder.EmbedStrings(ctx, texts)
+	if err != nil {
+		return err
+	}
+	if len(vectors) != len(texts) {
+		return fmt.Errorf("embedding count mismatch: got %d, want %d", len(vectors), len(texts))
+	}
+
+	for i, idx := range stale {
+		if len(vectors[i]) == 0 {
+			continue
+		}
+		blob := vecstore.Encode(vectors[i])
+		if _, err := s.db.NewUpdate().
+			TableExpr("agent_memories").
+			Set("embedding = ?", blob).
+			Set("embedding_model = ?", s.embeddingKey).
+			Where("id = ?", rows[idx].ID).
+			Exec(ctx); err != nil {
+			return err
+		}
+		rows[idx].Embedding = blob
+		rows[idx].EmbeddingModel = s.embeddingKey
+	}
+	return nil
+}
+
+// embedOne 生成单条文本的向量，嵌入不可用或失败时返回 nil
+func (s *Store) embedOne(ctx context.Context, text string) []float64 {
+	if s.embedder == nil {
+		return nil
+	}
+	vectors, err := s.embedder.EmbedStrings(ctx, []string{text})
+	if err != nil {
+		log.Printf("[memory] embed memory failed: %v", err)
+		return nil
+	}
+	if len(vectors) != 1 || len(vectors[0]) == 0 {
+		return nil
+	}
+	return vectors[0]
+}
+
+// rrfMerge 按 RRF 融合多个排名列表，返回按得分降序的记忆 ID
+func rrfMerge(lists ...[]int64) []int64 {
+	scores := make(map[int64]float64)
+	for _, ids := range lists {
+		for rank, id := range ids {
+			scores[id] += 1.0 / float64(rrfK+rank+1)
+		}
+	}
+	ids := make([]int64, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] > ids[j]
+	})
+	return ids
+}
+
+// cosine 余弦相似度，长度不一致或为零向量时返回 0
+func cosine(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -9,8 +9,10 @@ import (
 	"sync"
 
 	"chatclaw/internal/fts/tokenizer"
+	"chatclaw/internal/sqlite/vecstore"
 
 	"github.com/cloudwego/eino/components/embedding"
+	"github.com/cloudwego/eino/schema"
 	"github.com/uptrace/bun"
 )
 
@@ -27,6 +29,9 @@ type SearchInput struct {
 	Level      *int    // Optional level filter (0/1/2)
 	TopK       int     // Maximum results to return
 	MinScore   float64 // Minimum score threshold for filtering results
+
+	// History is the recent conversation context used by query rewriting (optional)
+	History []*schema.Message
 }
 
 // SearchResult represents a single retrieval result
@@ -37,6 +42,21 @@ type SearchResult struct {
 	Content      string  `json:"content"`
 	Level        int     `json:"level"`
 	Score        float64 `json:"score"` // RRF normalized score
+
+	// PageStart/PageEnd is the 1-based page range the node covers (0 when the source has no pages)
+	PageStart int `json:"page_start,omitempty"`
+	PageEnd   int `json:"page_end,omitempty"`
+}
+
+// PageLabel formats the page range for citations ("p.14" / "pp.14-15"), empty when unknown
+func (r SearchResult) PageLabel() string {
+	if r.PageStart <= 0 {
+		return ""
+	}
+	if r.PageEnd <= r.PageStart {
+		return fmt.Sprintf("p.%d", r.PageStart)
+	}
+	return fmt.Sprintf("pp.%d-%d", r.PageStart, r.PageEnd)
 }
 
 // rankedResult is used internally for RRF calculation
@@ -48,8 +68,9 @@ type rankedResult struct {
 
 // Service provides document retrieval capabilities
 type Service struct {
-	db       *bun.DB
-	embedder embedding.Embedder
+	db          *bun.DB
+	embedder    embedding.Embedder
+	transformer *QueryTransformer
 }
 
 // NewService creates a new retrieval service
@@ -60,6 +81,12 @@ func NewService(db *bun.DB, embedder embedding.Embedder) *Service {
 	}
 }
 
+// SetQueryTransformer enables the optional query transformation stage
+// (rewrite / multi-query / HyDE). Passing nil disables it.
+func (s *Service) SetQueryTransformer(t *QueryTransformer) {
+	s.transformer = t
+}
+
 // Search performs hybrid search combining vector and full-text retrieval with RRF fusion
 func (s *Service) Search(ctx context.Context, input SearchInput) ([]SearchResult, error) {
 	if len(input.LibraryIDs) == 0 {
@@ -75,36 +102,81 @@ func (s *Service) Search(ctx context.Context, input SearchInput) ([]SearchResult
 	// Fetch more results than needed for better RRF fusion
 	fetchK := max(input.TopK*3, 30)
 
+	// Optional query transformation: the original query is always searched,
+	// rewritten/variant queries are added, and a HyDE document only feeds the vector leg.
+	queries := []string{input.Query}
+	var hypotheticalDoc string
+	if s.transformer != nil {
+		transformed, err := s.transformer.Transform(ctx, input.Query, input.History)
+		if err != nil {
+			log.Printf("[retrieval] query transform error: %v", err)
+		} else if len(transformed.Queries) > 0 {
+			queries = transformed.Queries
+			hypotheticalDoc = transformed.HypotheticalDoc
+		}
+	}
+
+	vecTexts := queries
+	if hypotheticalDoc != "" {
+		vecTexts = append(append([]string{}, queries...), hypotheticalDoc)
+	}
+
 	var wg sync.WaitGroup
-	var vecResults []rankedResult
-	var ftsResults []rankedResult
-	var vecErr, ftsErr error
+	var mu sync.Mutex
+	var rankedLists [][]rankedResult
 
-	// Parallel: vector search
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		vecResults, vecErr = s.vectorSearch(ctx, input.LibraryIDs, input.Query, input.Level, fetchK)
-	}()
+	addResults := func(results []rankedResult) {
+		if len(results) == 0 {
+			return
+		}
+		mu.Lock()
+		rankedLists = append(rankedLists, results)
+		mu.Unlock()
+	}
 
-	// Parallel: full-text search
+	// Parallel: vector search (one KNN per query/HyDE vector)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		ftsResults, ftsErr = s.fullTextSearch(ctx, input.LibraryIDs, input.Query, input.Level, fetchK)
+		vectors, err := s.embedQueries(ctx, vecTexts)
+		if err != nil {
+			log.Printf("[retrieval] vector search error: %v", err)
+			return
+		}
+		var vwg sync.WaitGroup
+		for _, vec := range vectors {
+			vwg.Add(1)
+			go func(vec []float64) {
+				defer vwg.Done()
+				results, err := s.vectorSearch(ctx, input.LibraryIDs, vec, input.Level, fetchK)
+				if err != nil {
+					log.Printf("[retrieval] vector search error: %v", err)
+					return
+				}
+				addResults(results)
+			}(vec)
+		}
+		vwg.Wait()
 	}()
 
-	wg.Wait()
-
-	if vecErr != nil {
-		log.Printf("[retrieval] vector search error: %v", vecErr)
-	}
-	if ftsErr != nil {
-		log.Printf("[retrieval] full-text search error: %v", ftsErr)
+	// Parallel: full-text search (one per query)
+	for _, q := range queries {
+		wg.Add(1)
+		go func(query string) {
+			defer wg.Done()
+			results, err := s.fullTextSearch(ctx, input.LibraryIDs, query, input.Level, fetchK)
+			if err != nil {
+				log.Printf("[retrieval] full-text search error: %v", err)
+				return
+			}
+			addResults(results)
+		}(q)
 	}
 
+	wg.Wait()
+
 	// RRF fusion
-	merged := s.rrfMerge(vecResults, ftsResults)
+	merged := s.rrfMerge(rankedLists...)
 
 	// Limit to topK
 	if len(merged) > input.TopK {
@@ -119,62 +191,56 @@ func (s *Service) Search(ctx context.Context, input SearchInput) ([]SearchResult
 	return s.fetchNodeDetails(ctx, merged)
 }
 
-// vectorSearch performs KNN search using sqlite-vec
-func (s *Service) vectorSearch(ctx context.Context, libraryIDs []int64, query string, level *int, topK int) ([]rankedResult, error) {
-	if s.embedder == nil {
+// embedQueries embeds the query texts in a single batch
+func (s *Service) embedQueries(ctx context.Context, texts []string) ([][]float64, error) {
+	if s.embedder == nil || len(texts) == 0 {
 		return nil, nil
 	}
 
-	// Embed the query
-	vectors, err := s.embedder.EmbedStrings(ctx, []string{query})
+	vectors, err := s.embedder.EmbedStrings(ctx, texts)
 	if err != nil {
 		return nil, fmt.Errorf("embed query: %w", err)
 	}
-	if len(vectors) == 0 || len(vectors[0]) == 0 {
-		return nil, fmt.Errorf("empty embedding result")
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("embedding count mismatch: got %d, want %d", len(vectors), len(texts))
 	}
-
-	queryVec := formatVector(vectors[0])
-
-	// Build the KNN query
-	// We need to join with document_nodes to filter by library_id and level
-	// sqlite-vec KNN query: SELECT id, distance FROM doc_vec WHERE content MATCH ? AND k = ?
-	sql := `
-		WITH knn AS (
-			SELECT v.id, v.distance
-			FROM doc_vec v
-			WHERE v.content MATCH ?
-			  AND k = ?
-		)
-		SELECT knn.id, knn.distance
-		FROM knn
-		INNER JOIN document_nodes n ON n.id = knn.id
-		WHERE n.library_id IN (?)
-	`
-	args := []interface{}{queryVec, topK * 2, bun.In(libraryIDs)}
-
-	if level != nil {
-		sql += " AND n.level = ?"
-		args = append(args, *level)
+	for _, vec := range vectors {
+		if len(vec) == 0 {
+			return nil, fmt.Errorf("empty embedding result")
+		}
 	}
+	return vectors, nil
+}
 
-	sql += " ORDER BY knn.distance ASC LIMIT ?"
-	args = append(args, topK)
+// vectorSearch performs KNN search using sqlite-vec.
+// doc_vec is partitioned by library_id (with level as a metadata column), so filtering happens
+// inside the KNN: each library is searched separately and the hits are merged by distance.
+// A small library sharing the DB with a huge one therefore still gets its full topK candidates.
+// When doc_vec is quantized, vecstore oversamples and rescores candidates at full precision.
+func (s *Service) vectorSearch(ctx context.Context, libraryIDs []int64, vector []float64, level *int, topK int) ([]rankedResult, error) {
+	q, _, err := vecstore.Schema(ctx, s.db)
+	if err != nil {
+		return nil, fmt.Errorf("vector search: %w", err)
+	}
 
-	type vecRow struct {
-		ID       int64   `bun:"id"`
-		Distance float64 `bun:"distance"`
+	var hits []vecstore.Hit
+	for _, libraryID := range libraryIDs {
+		libHits, err := vecstore.Search(ctx, s.db, q, libraryID, level, vector, topK)
+		if err != nil {
+			return nil, fmt.Errorf("vector search: %w", err)
+		}
+		hits = append(hits, libHits...)
 	}
 
-	var rows []vecRow
-	if err := s.db.NewRaw(sql, args...).Scan(ctx, &rows); err != nil {
-		return nil, fmt.Errorf("vector search: %w", err)
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Distance < hits[j].Distance })
+	if len(hits) > topK {
+		hits = hits[:topK]
 	}
 
-	results := make([]rankedResult, len(rows))
-	for i, row := range rows {
+	results := make([]rankedResult, len(hits))
+	for i, hit := range hits {
 		results[i] = rankedResult{
-			nodeID: row.ID,
+			nodeID: hit.ID,
 			rank:   i + 1,
 		}
 	}
@@ -241,18 +307,14 @@ func (s *Service) fullTextSearch(ctx context.Context, libraryIDs []int64, query
 	return results, nil
 }
 
-// rrfMerge combines results using Reciprocal Rank Fusion
-func (s *Service) rrfMerge(vecResults, ftsResults []rankedResult) []rankedResult {
+// rrfMerge combines ranked lists (vector and full-text, per query) using Reciprocal Rank Fusion
+func (s *Service) rrfMerge(lists ...[]rankedResult) []rankedResult {
 	scores := make(map[int64]float64)
 
-	// Add vector search scores
-	for _, r := range vecResults {
-		scores[r.nodeID] += rrfScore(r.rank)
-	}
-
-	// Add full-text search scores
-	for _, r := range ftsResults {
-		scores[r.nodeID] += rrfScore(r.rank)
+	for _, results := range lists {
+		for _, r := range results {
+			scores[r.nodeID] += rrfScore(r.rank)
+		}
 	}
 
 	// Convert to slice and sort by score descending
@@ -292,7 +354,7 @@ func (s *Service) fetchNodeDetails(ctx context.Context, merged []rankedResult) (
 
 	// Fetch node details with document name
 	sql := `
-		SELECT n.id, n.document_id, n.content, n.level, d.original_name
+		SELECT n.id, n.document_id, n.content, n.level, n.page_start, n.page_end, d.original_name
 		FROM document_nodes n
 		INNER JOIN documents d ON d.id = n.document_id
 		WHERE n.id IN (?)
@@ -303,6 +365,8 @@ func (s *Service) fetchNodeDetails(ctx context.Context, merged []rankedResult) (
 		DocumentID   int64  `bun:"document_id"`
 		Content      string `bun:"content"`
 		Level        int    `bun:"level"`
+		PageStart    int    `bun:"page_start"`
+		PageEnd      int    `bun:"page_end"`
 		OriginalName string `bun:"original_name"`
 	}
 
@@ -331,26 +395,10 @@ func (s *Service) fetchNodeDetails(ctx context.Context, merged []rankedResult) (
 			Content:      row.Content,
 			Level:        row.Level,
 			Score:        scoreMap[row.ID],
+			PageStart:    row.PageStart,
+			PageEnd:      row.PageEnd,
 		})
 	}
 
 	return results, nil
 }
-
-// formatVector converts a float64 slice to sqlite-vec format string
-func formatVector(vec []float64) string {
-	if len(vec) == 0 {
-		return "[]"
-	}
-	var b strings.Builder
-	b.Grow(len(vec) * 12) // Pre-allocate approximate space
-	b.WriteByte('[')
-	for i, v := range vec {
-		if i > 0 {
-			b.WriteByte(',')
-		}
-		b.WriteString(fmt.Sprintf("%f", v))
-	}
-	b.WriteByte(']')
-	return b.String()
-}
@@ -0,0 +1,143 @@
+package retrieval
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"chatclaw/internal/sqlite/vecstore"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+)
+
+const testDimension = 8
+
+// unitVec returns a vector with 1 at axis and the given offset on the last axis
+func unitVec(axis int, offset float64) []float64 {
+	v := make([]float64, testDimension)
+	v[axis] = 1
+	v[testDimension-1] += offset
+	return v
+}
+
+// newTestDB creates a doc_vec table with the given quantization
+func newTestDB(t *testing.T, q vecstore.Quantization) *bun.DB {
+	t.Helper()
+	sqlite_vec.Auto()
+	sqlDB, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := bun.NewDB(sqlDB, sqlitedialect.New())
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(vecstore.TableSQL(testDimension, q)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// addNode stores the vector of a node
+func addNode(t *testing.T, db *bun.DB, q vecstore.Quantization, id, libraryID int64, level int, vec []float64) {
+	t.Helper()
+	if err := vecstore.Store(context.Background(), db, q, id, libraryID, level, vec); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestVectorSearchSmallLibraryNotCrowdedOut puts a large library whose vectors are all closer to the
+// query than anything in a small library into the same doc_vec. Searching only the small library
+// must still return its own topK nodes instead of losing them to the large library's neighbours.
+func TestVectorSearchSmallLibraryNotCrowdedOut(t *testing.T) {
+	const (
+		largeLibrary = int64(1)
+		smallLibrary = int64(2)
+		largeNodes   = 500
+		topK         = 5
+	)
+	level0 := 0
+
+	tests := []struct {
+		name  string
+		q     vecstore.Quantization
+		level *int
+	}{
+		{name: "float", q: vecstore.QuantizationNone},
+		{name: "float with level", q: vecstore.QuantizationNone, level: &level0},
+		{name: "int8", q: vecstore.QuantizationInt8},
+		{name: "binary with level", q: vecstore.QuantizationBinary, level: &level0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDB(t, tt.q)
+
+			query := unitVec(0, 0)
+			for i := int64(1); i <= largeNodes; i++ {
+				addNode(t, db, tt.q, i, largeLibrary, 0, unitVec(0, 0.001*float64(i%10)))
+			}
+			// Small library: topK level-0 nodes pointing away from the query, plus level-1 summaries
+			var wantIDs []int64
+			for i := int64(0); i < topK; i++ {
+				id := largeNodes + 1 + i
+				addNode(t, db, tt.q, id, smallLibrary, 0, unitVec(1+int(i), 0))
+				wantIDs = append(wantIDs, id)
+			}
+			for i := int64(0); i < topK; i++ {
+				id := largeNodes + 1 + topK + i
+				addNode(t, db, tt.q, id, smallLibrary, 1, unitVec(1+int(i), 0))
+				if tt.level == nil {
+					wantIDs = append(wantIDs, id)
+				}
+			}
+
+			svc := NewService(db, nil)
+			results, err := svc.vectorSearch(ctx, []int64{smallLibrary}, query, tt.level, len(wantIDs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(wantIDs) {
+				t.Fatalf("got %d results, want %d", len(results), len(wantIDs))
+			}
+			want := make(map[int64]bool, len(wantIDs))
+			for _, id := range wantIDs {
+				want[id] = true
+			}
+			for _, r := range results {
+				if !want[r.nodeID] {
+					t.Errorf("unexpected node %d", r.nodeID)
+				}
+			}
+		})
+	}
+}
+
+// TestVectorSearchMergesLibrariesByDistance searches both libraries together: hits from each
+// partition are merged by distance and cut to topK.
+func TestVectorSearchMergesLibrariesByDistance(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, vecstore.QuantizationNone)
+
+	addNode(t, db, vecstore.QuantizationNone, 1, 1, 0, unitVec(0, 0.5))
+	addNode(t, db, vecstore.QuantizationNone, 2, 1, 0, unitVec(1, 0))
+	addNode(t, db, vecstore.QuantizationNone, 3, 2, 0, unitVec(0, 0.1))
+	addNode(t, db, vecstore.QuantizationNone, 4, 2, 0, unitVec(2, 0))
+
+	svc := NewService(db, nil)
+	results, err := svc.vectorSearch(ctx, []int64{1, 2}, unitVec(0, 0), nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int64
+	for _, r := range results {
+		got = append(got, r.nodeID)
+	}
+	if fmt.Sprint(got) != fmt.Sprint([]int64{3, 1}) {
+		t.Fatalf("got %v, want [3 1]", got)
+	}
+}
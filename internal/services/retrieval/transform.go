@@ -0,0 +1,301 @@
+package retrieval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	// defaultMultiQueryCount is the number of alternative queries generated by multi-query.
+	defaultMultiQueryCount = 3
+	// maxHistoryMessages limits how many recent conversation turns are sent to the rewriter.
+	maxHistoryMessages = 6
+	// maxHistoryMessageRunes truncates each history message sent to the rewriter.
+	maxHistoryMessageRunes = 500
+	// transformCacheSize bounds the number of cached transformation results.
+	transformCacheSize = 256
+)
+
+// QueryTransformOptions toggles the query transformation strategies applied before search.
+type QueryTransformOptions struct {
+	Rewrite         bool // Rewrite the query into a standalone question using conversation history
+	MultiQuery      bool // Generate alternative phrasings and search them all
+	MultiQueryCount int  // Number of alternative phrasings (default 3)
+	HyDE            bool // Embed a hypothetical answer document for the vector leg
+}
+
+// Enabled reports whether any transformation strategy is turned on.
+func (o QueryTransformOptions) Enabled() bool {
+	return o.Rewrite || o.MultiQuery || o.HyDE
+}
+
+// TransformedQuery is the result of the query transformation stage
+type TransformedQuery struct {
+	Queries         []string // Queries to search (original first, then rewritten and variants)
+	HypotheticalDoc string   // Hypothetical answer used for the vector leg (HyDE)
+}
+
+// QueryTransformer rewrites and expands search queries with a chat model
+type QueryTransformer struct {
+	llm      model.ChatModel
+	modelKey string // Identifies the backing model in cache keys (e.g. "provider/model")
+	opts     QueryTransformOptions
+}
+
+// NewQueryTransformer creates a query transformer backed by the given chat model.
+// Returns nil if llm is nil or no strategy is enabled.
+func NewQueryTransformer(llm model.ChatModel, modelKey string, opts QueryTransformOptions) *QueryTransformer {
+	if llm == nil || !opts.Enabled() {
+		return nil
+	}
+	if opts.MultiQueryCount <= 0 {
+		opts.MultiQueryCount = defaultMultiQueryCount
+	}
+	return &QueryTransformer{
+		llm:      llm,
+		modelKey: modelKey,
+		opts:     opts,
+	}
+}
+
+// Transform applies the enabled strategies to the query.
+// Individual strategy failures are logged and skipped so that search can still
+// fall back to the original query.
+func (t *QueryTransformer) Transform(ctx context.Context, query string, history []*schema.Message) (*TransformedQuery, error) {
+	historyText := formatHistory(history)
+	key := t.cacheKey(query, historyText)
+	if cached, ok := defaultTransformCache.get(key); ok {
+		return cached, nil
+	}
+
+	// Failed strategies fall back for this search only; the result is not cached
+	// so that a transient LLM error is retried on the next search.
+	var failed atomic.Bool
+
+	// Step 1: rewrite into a standalone query (only meaningful with conversation context)
+	rewritten := query
+	if t.opts.Rewrite && historyText != "" {
+		out, err := t.generate(ctx, fmt.Sprintf(rewritePrompt, historyText, query))
+		if err != nil {
+			log.Printf("[retrieval] query rewrite failed: %v", err)
+			failed.Store(true)
+		} else if out = cleanLine(out); out != "" {
+			rewritten = out
+		}
+	}
+
+	// Step 2: generate variants and the hypothetical document in parallel
+	var wg sync.WaitGroup
+	var variants []string
+	var hypothetical string
+
+	if t.opts.MultiQuery {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := t.generate(ctx, fmt.Sprintf(multiQueryPrompt, t.opts.MultiQueryCount, rewritten))
+			if err != nil {
+				log.Printf("[retrieval] multi-query generation failed: %v", err)
+				failed.Store(true)
+				return
+			}
+			variants = parseLines(out, t.opts.MultiQueryCount)
+		}()
+	}
+
+	if t.opts.HyDE {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := t.generate(ctx, fmt.Sprintf(hydePrompt, rewritten))
+			if err != nil {
+				log.Printf("[retrieval] HyDE generation failed: %v", err)
+				failed.Store(true)
+				return
+			}
+			hypothetical = strings.TrimSpace(out)
+		}()
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	result := &TransformedQuery{
+		Queries:         dedupeQueries(append([]string{query, rewritten}, variants...)),
+		HypotheticalDoc: hypothetical,
+	}
+	if !failed.Load() {
+		defaultTransformCache.put(key, result)
+	}
+	return result, nil
+}
+
+// generate runs a single-turn completion against the backing chat model
+func (t *QueryTransformer) generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := t.llm.Generate(ctx, []*schema.Message{schema.UserMessage(prompt)})
+	if err != nil {
+		return "", err
+	}
+	if resp == nil {
+		return "", fmt.Errorf("empty response")
+	}
+	return resp.Content, nil
+}
+
+// cacheKey builds the cache key from the model, enabled strategies, history and query
+func (t *QueryTransformer) cacheKey(query, historyText string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%t:%t:%d:%t\x00%s\x00%s",
+		t.modelKey, t.opts.Rewrite, t.opts.MultiQuery, t.opts.MultiQueryCount, t.opts.HyDE, historyText, query)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+const rewritePrompt = `You rewrite search queries for a knowledge base.
+Given the conversation history and the latest query, rewrite the query into a single standalone search query that resolves pronouns and references using the history.
+Keep the same language as the query. Output only the rewritten query, nothing else.
+
+Conversation history:
+%s
+
+Latest query: %s
+
+Rewritten query:`
+
+const multiQueryPrompt = `Generate %d alternative search queries for retrieving documents relevant to the query below.
+Use different keywords, synonyms and angles. Keep the same language as the query.
+Output one query per line without numbering or explanations.
+
+Query: %s
+
+Alternative queries:`
+
+const hydePrompt = `Write a short passage (about 100-200 words) that directly answers the question below, as if it were an excerpt from a reference document.
+Keep the same language as the question. Output only the passage.
+
+Question: %s
+
+Passage:`
+
+// formatHistory renders the most recent user/assistant turns as plain text
+func formatHistory(history []*schema.Message) string {
+	var turns []string
+	for i := len(history) - 1; i >= 0 && len(turns) < maxHistoryMessages; i-- {
+		m := history[i]
+		if m == nil || (m.Role != schema.User && m.Role != schema.Assistant) {
+			continue
+		}
+		content := strings.TrimSpace(m.Content)
+		if content == "" {
+			continue
+		}
+		if r := []rune(content); len(r) > maxHistoryMessageRunes {
+			content = string(r[:maxHistoryMessageRunes]) + "..."
+		}
+		turns = append(turns, fmt.Sprintf("%s: %s", m.Role, content))
+	}
+	// Restore chronological order
+	for i, j := 0, len(turns)-1; i < j; i, j = i+1, j-1 {
+		turns[i], turns[j] = turns[j], turns[i]
+	}
+	return strings.Join(turns, "\n")
+}
+
+// parseLines splits LLM output into at most limit cleaned, non-empty lines
+func parseLines(s string, limit int) []string {
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = cleanLine(line); line != "" {
+			out = append(out, line)
+			if len(out) >= limit {
+				break
+			}
+		}
+	}
+	return out
+}
+
+// cleanLine strips list markers, numbering and surrounding quotes from a line
+func cleanLine(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimLeft(s, "-*•")
+	// Strip "1." / "1)" / "1、" style numbering
+	if i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' }); i > 0 {
+		rest := s[i:]
+		for _, sep := range []string{".", ")", "、", ":"} {
+			if strings.HasPrefix(rest, sep) {
+				s = rest[len(sep):]
+				break
+			}
+		}
+	}
+	s = strings.TrimSpace(s)
+	s = strings.Trim(s, "\"'“”")
+	return strings.TrimSpace(s)
+}
+
+// dedupeQueries removes empty and duplicate queries while preserving order
+func dedupeQueries(queries []string) []string {
+	seen := make(map[string]struct{}, len(queries))
+	out := make([]string, 0, len(queries))
+	for _, q := range queries {
+		q = strings.TrimSpace(q)
+		if q == "" {
+			continue
+		}
+		k := strings.ToLower(q)
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		out = append(out, q)
+	}
+	return out
+}
+
+// transformCache is a size-bounded FIFO cache of transformation results shared
+// across retrieval service instances (a new service is created per generation).
+type transformCache struct {
+	mu    sync.Mutex
+	items map[string]*TransformedQuery
+	order []string
+	limit int
+}
+
+var defaultTransformCache = &transformCache{
+	items: make(map[string]*TransformedQuery),
+	limit: transformCacheSize,
+}
+
+func (c *transformCache) get(key string) (*TransformedQuery, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.items[key]
+	return v, ok
+}
+
+func (c *transformCache) put(key string, v *TransformedQuery) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; ok {
+		c.items[key] = v
+		return
+	}
+	for len(c.order) >= c.limit {
+		delete(c.items, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.items[key] = v
+	c.order = append(c.order, key)
+}
@@ -0,0 +1,214 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// mustLocation 加载时区，系统缺少时区数据时跳过测试
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s unavailable: %v", name, err)
+	}
+	return loc
+}
+
+// bitsOf 返回位图中命中的取值
+func bitsOf(bits uint64) []int {
+	var out []int
+	for v := 0; v < 64; v++ {
+		if bits&(1<<uint(v)) != 0 {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field string
+		f     cronField
+		want  []int
+	}{
+		{"*", hourField, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}},
+		{"*/15", minuteField, []int{0, 15, 30, 45}},
+		{"1-10/3", minuteField, []int{1, 4, 7, 10}},
+		{"5/20", minuteField, []int{5, 25, 45}},
+		{"8-18/2", hourField, []int{8, 10, 12, 14, 16, 18}},
+		{"1,15,31", domField, []int{1, 15, 31}},
+		{"1-3,10,20-21", domField, []int{1, 2, 3, 10, 20, 21}},
+		{"*/2,1", hourField, []int{0, 1, 2, 4, 6, 8, 10, 12, 14, 16, 18, 20, 22}},
+		{"jan,JUN,dec", monthField, []int{1, 6, 12}},
+		{"mar-may", monthField, []int{3, 4, 5}},
+		{"mon-fri", dowField, []int{1, 2, 3, 4, 5}},
+		{"*", dowField, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"*/2", dowField, []int{0, 2, 4, 6}},
+		{"sat,sun", dowField, []int{0, 6}},
+		{"5-7", dowField, []int{5, 6, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.f.name+" "+tt.field, func(t *testing.T) {
+			bits, err := parseCronField(tt.field, tt.f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bitsOf(bits); !equalInts(got, tt.want) {
+				t.Fatalf("parseCronField(%q) = %v, want %v", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"", "expected 5 fields"},
+		{"* * * *", "expected 5 fields"},
+		{"* * * * * *", "expected 5 fields"},
+		{"@every 5m", "expected 5 fields"},
+		{"60 * * * *", "minute field"},
+		{"* 24 * * *", "hour field"},
+		{"* * 0 * *", "day of month field"},
+		{"* * 32 * *", "day of month field"},
+		{"* * * 13 *", "month field"},
+		{"* * * * 8", "day of week field"},
+		{"* * * foo *", "month field"},
+		{"* * * * monday", "day of week field"},
+		{"*/0 * * * *", "invalid step"},
+		{"*/-5 * * * *", "invalid step"},
+		{"*/x * * * *", "invalid step"},
+		{"10-5 * * * *", "invalid range"},
+		{"1-2-3 * * * *", "minute field"},
+		{"1,,2 * * * *", "minute field"},
+		{"0 0 30 2 *", "never matches"},
+		{"0 0 31 apr,jun,sep,nov *", "never matches"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr, time.UTC)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseCron(%q) error = %v, want it to contain %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	utc := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		name  string
+		expr  string
+		after string
+		want  []string // 依次调用 Next 得到的运行时间
+	}{
+		{"every 15 minutes", "*/15 * * * *", "2026-01-01 10:07", []string{"2026-01-01 10:15", "2026-01-01 10:30", "2026-01-01 10:45", "2026-01-01 11:00"}},
+		{"exact minute is excluded", "30 9 * * *", "2026-01-01 09:30", []string{"2026-01-02 09:30"}},
+		{"seconds are truncated", "30 9 * * *", "2026-01-01 09:29", []string{"2026-01-01 09:30"}},
+		{"stepped range", "1-10/3 8 * * *", "2026-01-01 08:05", []string{"2026-01-01 08:07", "2026-01-01 08:10", "2026-01-02 08:01"}},
+		{"hour list", "0 9,12,18 * * *", "2026-01-01 12:00", []string{"2026-01-01 18:00", "2026-01-02 09:00"}},
+		{"weekdays", "0 9 * * mon-fri", "2026-01-02 10:00", []string{"2026-01-05 09:00", "2026-01-06 09:00"}}, // 2026-01-02 是周五
+		{"sunday as 7", "0 0 * * 7", "2026-01-01 00:00", []string{"2026-01-04 00:00", "2026-01-11 00:00"}},
+		{"year end", "0 0 * * *", "2026-12-31 23:59", []string{"2027-01-01 00:00"}},
+		{"@monthly", "@monthly", "2026-01-15 00:00", []string{"2026-02-01 00:00", "2026-03-01 00:00"}},
+		{"@yearly", "@yearly", "2026-01-01 00:00", []string{"2027-01-01 00:00"}},
+
+		// 月末：没有 31 日的月份直接跳过
+		{"31st skips short months", "0 12 31 * *", "2026-01-31 12:00", []string{"2026-03-31 12:00", "2026-05-31 12:00", "2026-07-31 12:00", "2026-08-31 12:00"}},
+		{"30th skips february", "0 0 30 * *", "2026-01-30 00:00", []string{"2026-03-30 00:00"}},
+		{"feb 29 only in leap years", "0 0 29 2 *", "2024-03-01 00:00", []string{"2028-02-29 00:00", "2032-02-29 00:00"}},
+		{"feb 29 from a leap day", "0 0 29 2 *", "2024-02-28 23:59", []string{"2024-02-29 00:00", "2028-02-29 00:00"}},
+		{"last days of february", "0 0 28,29 2 *", "2027-02-28 00:00", []string{"2028-02-28 00:00", "2028-02-29 00:00"}},
+
+		// 日和星期都受限时满足其一即可：每月 13 日或每个周五
+		{"dom or dow", "0 0 13 * fri", "2026-02-01 00:00", []string{"2026-02-06 00:00", "2026-02-13 00:00", "2026-02-20 00:00", "2026-02-27 00:00", "2026-03-06 00:00"}},
+		{"dom or dow on the 1st and 15th", "0 0 1,15 * mon", "2026-06-01 00:00", []string{"2026-06-08 00:00", "2026-06-15 00:00", "2026-06-22 00:00", "2026-06-29 00:00", "2026-07-01 00:00"}},
+		// 只有一个受限时按该字段匹配
+		{"dom only", "0 0 13 * *", "2026-02-01 00:00", []string{"2026-02-13 00:00", "2026-03-13 00:00"}},
+		{"dow only", "0 0 * * fri", "2026-02-01 00:00", []string{"2026-02-06 00:00", "2026-02-13 00:00"}},
+		{"dom with ? dow", "0 0 13 * ?", "2026-02-01 00:00", []string{"2026-02-13 00:00", "2026-03-13 00:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseCron(tt.expr, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := utc(tt.after)
+			for _, want := range tt.want {
+				got = s.Next(got)
+				if !got.Equal(utc(want)) {
+					t.Fatalf("Next = %s, want %s", got.Format("2006-01-02 15:04 Mon"), want)
+				}
+			}
+		})
+	}
+}
+
+// TestScheduleNextDST 夏令时切换：被跳过的时刻当天不运行，重复的一小时内固定时刻的任务只运行一次
+func TestScheduleNextDST(t *testing.T) {
+	ny := mustLocation(t, "America/New_York")
+	local := func(s string) time.Time {
+		t.Helper()
+		v, err := time.ParseInLocation("2006-01-02 15:04 MST", s, ny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	// 2026-03-08 02:00 EST 跳到 03:00 EDT；2026-11-01 02:00 EDT 回到 01:00 EST
+	tests := []struct {
+		name  string
+		expr  string
+		after string
+		want  []string
+	}{
+		{"daily job in the skipped hour", "30 2 * * *", "2026-03-07 02:30 EST", []string{"2026-03-09 02:30 EDT"}},
+		{"daily job after the skipped hour", "0 3 * * *", "2026-03-07 03:00 EST", []string{"2026-03-08 03:00 EDT", "2026-03-09 03:00 EDT"}},
+		{"hourly across spring forward", "0 * * * *", "2026-03-08 00:30 EST", []string{"2026-03-08 01:00 EST", "2026-03-08 03:00 EDT", "2026-03-08 04:00 EDT"}},
+		{"daily job in the repeated hour", "30 1 * * *", "2026-10-31 01:30 EDT", []string{"2026-11-01 01:30 EDT", "2026-11-02 01:30 EST"}},
+		{"daily midnight across fall back", "0 0 * * *", "2026-10-31 00:00 EDT", []string{"2026-11-01 00:00 EDT", "2026-11-02 00:00 EST"}},
+		{"from inside the repeated hour", "30 1 * * *", "2026-11-01 01:40 EST", []string{"2026-11-02 01:30 EST"}},
+		{"every 15 minutes across fall back", "*/15 * * * *", "2026-11-01 01:40 EDT", []string{"2026-11-01 01:45 EDT", "2026-11-01 01:00 EST", "2026-11-01 01:15 EST"}},
+		{"every 15 minutes inside the repeated hour", "*/15 * * * *", "2026-11-01 01:30 EST", []string{"2026-11-01 01:45 EST", "2026-11-01 02:00 EST"}},
+		{"hourly across fall back", "0 * * * *", "2026-11-01 00:30 EDT", []string{"2026-11-01 01:00 EDT", "2026-11-01 01:00 EST", "2026-11-01 02:00 EST"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseCron(tt.expr, ny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := local(tt.after)
+			for _, want := range tt.want {
+				got = s.Next(got)
+				if !got.Equal(local(want)) {
+					t.Fatalf("Next = %s, want %s", got.Format("2006-01-02 15:04 MST"), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"chatclaw/internal/sqlite"
+
+	"github.com/uptrace/bun"
+)
+
+// 会话模式
+const (
+	ConversationModeNew    = "new"    // 每次运行新建会话
+	ConversationModeAppend = "append" // 追加到同一个会话
+)
+
+// 通知方式（通知事件和 webhook 共用）
+const (
+	NotifyAlways  = "always"  // 每次运行结束都通知
+	NotifyChanged = "changed" // 回答与上次成功运行不同时通知（例如监控网页变化）
+	NotifyNever   = "never"
+)
+
+// 错过运行的处理方式（应用关闭或休眠期间到期的运行）
+const (
+	MissedRunOnce = "run_once" // 补跑一次
+	MissedSkip    = "skip"     // 跳过，只记录
+)
+
+// 运行触发方式
+const (
+	TriggerSchedule = "schedule"
+	TriggerMissed   = "missed"
+	TriggerManual   = "manual"
+)
+
+// 运行状态
+const (
+	RunStatusQueued    = "queued"
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+	RunStatusSkipped   = "skipped"
+	RunStatusCancelled = "cancelled"
+)
+
+// 事件名称
+const (
+	EventRunStarted   = "scheduler:run_started"
+	EventRunFinished  = "scheduler:run_finished"
+	EventNotification = "scheduler:notification"
+)
+
+const (
+	// maxJobNameRunes 任务名称长度上限
+	maxJobNameRunes = 100
+	// maxOutputRunes 运行记录中保存的回答长度上限
+	maxOutputRunes = 20000
+	// defaultRunsLimit 默认返回的运行记录条数
+	defaultRunsLimit = 50
+)
+
+func IsValidConversationMode(mode string) bool {
+	return mode == ConversationModeNew || mode == ConversationModeAppend
+}
+
+func IsValidNotifyMode(mode string) bool {
+	return mode == NotifyAlways || mode == NotifyChanged || mode == NotifyNever
+}
+
+func IsValidMissedPolicy(policy string) bool {
+	return policy == MissedRunOnce || policy == MissedSkip
+}
+
+// Job 定时任务 DTO（暴露给前端）
+type Job struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	AgentID  int64  `json:"agent_id"`
+	Prompt   string `json:"prompt"`
+	CronExpr string `json:"cron_expr"`
+	Enabled  bool   `json:"enabled"`
+
+	ConversationMode string  `json:"conversation_mode"` // new / append
+	ConversationID   int64   `json:"conversation_id"`   // append 模式使用的会话
+	LibraryIDs       []int64 `json:"library_ids"`
+
+	NotifyMode   string `json:"notify_mode"` // always / changed / never
+	WebhookURL   string `json:"webhook_url"`
+	MissedPolicy string `json:"missed_policy"` // run_once / skip
+
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Run 定时任务的一次运行记录
+type Run struct {
+	ID          int64      `json:"id"`
+	JobID       int64      `json:"job_id"`
+	Trigger     string     `json:"trigger"` // schedule / missed / manual
+	Status      string     `json:"status"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+
+	ConversationID int64  `json:"conversation_id"`
+	MessageID      int64  `json:"message_id"`
+	Output         string `json:"output"`
+	Error          string `json:"error"`
+	MissedCount    int    `json:"missed_count"` // 本次运行之前错过的运行次数
+	WebhookStatus  string `json:"webhook_status"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateJobInput 创建定时任务的输入参数
+type CreateJobInput struct {
+	Name             string  `json:"name"`
+	AgentID          int64   `json:"agent_id"`
+	Prompt           string  `json:"prompt"`
+	CronExpr         string  `json:"cron_expr"`
+	Enabled          bool    `json:"enabled"`
+	ConversationMode string  `json:"conversation_mode"` // 默认 new
+	LibraryIDs       []int64 `json:"library_ids"`
+	NotifyMode       string  `json:"notify_mode"` // 默认 always
+	WebhookURL       string  `json:"webhook_url"`
+	MissedPolicy     string  `json:"missed_policy"` // 默认 run_once
+}
+
+// UpdateJobInput 更新定时任务的输入参数（nil 表示不修改）
+type UpdateJobInput struct {
+	Name             *string  `json:"name"`
+	AgentID          *int64   `json:"agent_id"`
+	Prompt           *string  `json:"prompt"`
+	CronExpr         *string  `json:"cron_expr"`
+	Enabled          *bool    `json:"enabled"`
+	ConversationMode *string  `json:"conversation_mode"`
+	ConversationID   *int64   `json:"conversation_id"` // 0 表示下次运行时新建会话
+	LibraryIDs       *[]int64 `json:"library_ids"`
+	NotifyMode       *string  `json:"notify_mode"`
+	WebhookURL       *string  `json:"webhook_url"`
+	MissedPolicy     *string  `json:"missed_policy"`
+}
+
+// ListRunsInput 运行记录查询条件
+type ListRunsInput struct {
+	JobID  int64 `json:"job_id"` // 0 表示所有任务
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+}
+
+// RunNotification 运行结束的通知（通知事件和 webhook 的内容）
+type RunNotification struct {
+	JobID          int64     `json:"job_id"`
+	JobName        string    `json:"job_name"`
+	AgentID        int64     `json:"agent_id"`
+	RunID          int64     `json:"run_id"`
+	Trigger        string    `json:"trigger"`
+	Status         string    `json:"status"`
+	ConversationID int64     `json:"conversation_id"`
+	MessageID      int64     `json:"message_id"`
+	Output         string    `json:"output"`
+	Error          string    `json:"error,omitempty"`
+	Changed        bool      `json:"changed"` // 回答与上次成功运行不同
+	MissedCount    int       `json:"missed_count"`
+	ScheduledAt    time.Time `json:"scheduled_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+}
+
+type jobModel struct {
+	bun.BaseModel `bun:"table:scheduled_jobs,alias:j"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	CreatedAt time.Time `bun:"created_at,notnull"`
+	UpdatedAt time.Time `bun:"updated_at,notnull"`
+
+	Name     string `bun:"name,notnull"`
+	AgentID  int64  `bun:"agent_id,notnull"`
+	Prompt   string `bun:"prompt,notnull"`
+	CronExpr string `bun:"cron_expr,notnull"`
+	Enabled  bool   `bun:"enabled,notnull"`
+
+	ConversationMode string `bun:"conversation_mode,notnull"`
+	ConversationID   int64  `bun:"conversation_id,notnull"`
+	LibraryIDs       string `bun:"library_ids,notnull"` // JSON array stored as string
+
+	NotifyMode   string `bun:"notify_mode,notnull"`
+	WebhookURL   string `bun:"webhook_url,notnull"`
+	MissedPolicy string `bun:"missed_policy,notnull"`
+
+	// 时间以 UTC 字符串写入（见 formatTime），读取时由驱动解析
+	NextRunAt time.Time `bun:"next_run_at,nullzero,scanonly"`
+	LastRunAt time.Time `bun:"last_run_at,nullzero,scanonly"`
+}
+
+var _ bun.BeforeInsertHook = (*jobModel)(nil)
+
+func (*jobModel) BeforeInsert(ctx context.Context, query *bun.InsertQuery) error {
+	now := sqlite.NowUTC()
+	query.Value("created_at", "?", now)
+	query.Value("updated_at", "?", now)
+	return nil
+}
+
+var _ bun.BeforeUpdateHook = (*jobModel)(nil)
+
+func (*jobModel) BeforeUpdate(ctx context.Context, query *bun.UpdateQuery) error {
+	query.Set("updated_at = ?", sqlite.NowUTC())
+	return nil
+}
+
+func (m *jobModel) toDTO() Job {
+	libraryIDs := []int64{}
+	if m.LibraryIDs != "" && m.LibraryIDs != "[]" {
+		if err := json.Unmarshal([]byte(m.LibraryIDs), &libraryIDs); err != nil {
+			log.Printf("[scheduler] failed to parse library_ids for job %d: %v", m.ID, err)
+			libraryIDs = []int64{}
+		}
+	}
+	return Job{
+		ID:       m.ID,
+		Name:     m.Name,
+		AgentID:  m.AgentID,
+		Prompt:   m.Prompt,
+		CronExpr: m.CronExpr,
+		Enabled:  m.Enabled,
+
+		ConversationMode: m.ConversationMode,
+		ConversationID:   m.ConversationID,
+		LibraryIDs:       libraryIDs,
+
+		NotifyMode:   m.NotifyMode,
+		WebhookURL:   m.WebhookURL,
+		MissedPolicy: m.MissedPolicy,
+
+		NextRunAt: timePtr(m.NextRunAt),
+		LastRunAt: timePtr(m.LastRunAt),
+
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+type runModel struct {
+	bun.BaseModel `bun:"table:scheduled_runs,alias:r"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	CreatedAt time.Time `bun:"created_at,notnull"`
+	UpdatedAt time.Time `bun:"updated_at,notnull"`
+
+	JobID       int64     `bun:"job_id,notnull"`
+	Trigger     string    `bun:"trigger_type,notnull"`
+	Status      string    `bun:"status,notnull"`
+	ScheduledAt time.Time `bun:"scheduled_at,notnull,scanonly"`
+	StartedAt   time.Time `bun:"started_at,nullzero,scanonly"`
+	FinishedAt  time.Time `bun:"finished_at,nullzero,scanonly"`
+
+	ConversationID int64  `bun:"conversation_id,notnull"`
+	MessageID      int64  `bun:"message_id,notnull"`
+	Output         string `bun:"output,notnull"`
+	Error          string `bun:"error,notnull"`
+	MissedCount    int    `bun:"missed_count,notnull"`
+	WebhookStatus  string `bun:"webhook_status,notnull"`
+}
+
+var _ bun.BeforeInsertHook = (*runModel)(nil)
+
+func (*runModel) BeforeInsert(ctx context.Context, query *bun.InsertQuery) error {
+	now := sqlite.NowUTC()
+	query.Value("created_at", "?", now)
+	query.Value("updated_at", "?", now)
+	return nil
+}
+
+var _ bun.BeforeUpdateHook = (*runModel)(nil)
+
+func (*runModel) BeforeUpdate(ctx context.Context, query *bun.UpdateQuery) error {
+	query.Set("updated_at = ?", sqlite.NowUTC())
+	return nil
+}
+
+func (m *runModel) toDTO() Run {
+	return Run{
+		ID:          m.ID,
+		JobID:       m.JobID,
+		Trigger:     m.Trigger,
+		Status:      m.Status,
+		ScheduledAt: m.ScheduledAt,
+		StartedAt:   timePtr(m.StartedAt),
+		FinishedAt:  timePtr(m.FinishedAt),
+
+		ConversationID: m.ConversationID,
+		MessageID:      m.MessageID,
+		Output:         m.Output,
+		Error:          m.Error,
+		MissedCount:    m.MissedCount,
+		WebhookStatus:  m.WebhookStatus,
+
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// formatTime 将时间格式化为数据库中的 UTC 字符串（与 created_at 一致，便于比较）
+func formatTime(t time.Time) string {
+	return t.UTC().Format(sqlite.DateTimeFormat)
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
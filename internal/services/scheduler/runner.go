@@ -0,0 +1,514 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"chatclaw/internal/errs"
+	"chatclaw/internal/services/chat"
+	"chatclaw/internal/services/conversations"
+	"chatclaw/internal/taskmanager"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+const (
+	// JobTypeScheduledRun 任务管理器中的任务类型
+	JobTypeScheduledRun = "scheduled_run"
+
+	// checkInterval 检查到期任务的频率（cron 精确到分钟）
+	checkInterval = 20 * time.Second
+	// startupDelay 启动后延迟检查，等待任务管理器启动和会话恢复
+	startupDelay = 10 * time.Second
+	// missedGrace 到期超过该时长仍未运行视为错过（应用关闭或系统休眠）
+	missedGrace = 5 * time.Minute
+	// maxMissedCount 统计错过次数的上限（例如每分钟运行的任务关闭了很久）
+	maxMissedCount = 10000
+
+	// runTimeout 单次运行的最长时间
+	runTimeout = 30 * time.Minute
+	// cancelPollInterval 检查运行是否被取消的频率
+	cancelPollInterval = 500 * time.Millisecond
+	// webhookTimeout webhook 请求超时时间
+	webhookTimeout = 15 * time.Second
+)
+
+// RunJobData 定时运行任务的数据
+type RunJobData struct {
+	RunID int64 `json:"run_id"`
+}
+
+func runTaskKey(runID int64) string {
+	return fmt.Sprintf("scheduled_run:%d", runID)
+}
+
+func (s *SchedulerService) scheduleLoop(ctx context.Context) {
+	timer := time.NewTimer(startupDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+		s.tick(ctx, time.Now())
+		timer.Reset(checkInterval)
+	}
+}
+
+// tick 为到期的任务创建运行；应用关闭期间错过的运行按任务的 missed_policy 补跑一次或跳过
+func (s *SchedulerService) tick(ctx context.Context, now time.Time) {
+	if !s.mu.TryLock() {
+		return
+	}
+	defer s.mu.Unlock()
+
+	db, err := s.db()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	jobs := make([]jobModel, 0)
+	if err := db.NewSelect().
+		Model(&jobs).
+		Where("j.enabled = ?", true).
+		Where("j.next_run_at IS NOT NULL").
+		Where("j.next_run_at <= ?", formatTime(now)).
+		OrderExpr("j.next_run_at ASC").
+		Scan(ctx); err != nil {
+		s.app.Logger.Error("[scheduler] load due jobs failed", "error", err)
+		return
+	}
+
+	for i := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		s.runDueJob(ctx, db, &jobs[i], now)
+	}
+}
+
+func (s *SchedulerService) runDueJob(ctx context.Context, db *bun.DB, job *jobModel, now time.Time) {
+	sched, err := ParseCron(job.CronExpr, time.Local)
+	if err != nil {
+		// 只有手动修改数据库才会出现，停止调度避免每次检查都报错
+		s.app.Logger.Error("[scheduler] invalid cron expression", "job", job.ID, "cron", job.CronExpr, "error", err)
+		if _, err := db.NewUpdate().
+			Model((*jobModel)(nil)).
+			Set("next_run_at = NULL").
+			Where("id = ?", job.ID).
+			Exec(ctx); err != nil {
+			s.app.Logger.Error("[scheduler] update job failed", "job", job.ID, "error", err)
+		}
+		return
+	}
+
+	// 从 next_run_at 开始统计到现在为止到期的次数，只运行最近一次
+	latest, occurrences := job.NextRunAt, 1
+	for t := sched.Next(latest); !t.IsZero() && !t.After(now) && occurrences < maxMissedCount; t = sched.Next(t) {
+		latest = t
+		occurrences++
+	}
+
+	// 先推进下次运行时间，运行失败也不会在下次检查时重复创建
+	q := db.NewUpdate().Model((*jobModel)(nil)).Where("id = ?", job.ID)
+	if next := sched.Next(now); next.IsZero() {
+		q = q.Set("next_run_at = NULL")
+	} else {
+		q = q.Set("next_run_at = ?", formatTime(next))
+	}
+	if _, err := q.Exec(ctx); err != nil {
+		s.app.Logger.Error("[scheduler] update job next run failed", "job", job.ID, "error", err)
+		return
+	}
+
+	trigger := TriggerSchedule
+	if now.Sub(latest) > missedGrace {
+		if job.MissedPolicy == MissedSkip {
+			s.recordSkippedRun(ctx, db, job, TriggerMissed, latest, occurrences, "missed while the app was not running")
+			return
+		}
+		trigger = TriggerMissed
+	}
+
+	// 上一次运行还没有结束时跳过本次，避免同一任务堆积
+	active, err := db.NewSelect().
+		Model((*runModel)(nil)).
+		Where("job_id = ?", job.ID).
+		Where("status IN (?)", bun.In([]string{RunStatusQueued, RunStatusRunning})).
+		Exists(ctx)
+	if err != nil {
+		s.app.Logger.Error("[scheduler] check active runs failed", "job", job.ID, "error", err)
+		return
+	}
+	if active {
+		s.recordSkippedRun(ctx, db, job, trigger, latest, occurrences-1, "the previous run is still in progress")
+		return
+	}
+
+	if _, err := s.enqueueRun(ctx, db, job, trigger, latest, occurrences-1); err != nil {
+		s.app.Logger.Error("[scheduler] enqueue run failed", "job", job.ID, "error", err)
+	}
+}
+
+// enqueueRun 创建运行记录并提交到任务队列
+func (s *SchedulerService) enqueueRun(ctx context.Context, db *bun.DB, job *jobModel, trigger string, scheduledAt time.Time, missedCount int) (*Run, error) {
+	m := &runModel{
+		JobID:       job.ID,
+		Trigger:     trigger,
+		Status:      RunStatusQueued,
+		ScheduledAt: scheduledAt,
+		MissedCount: missedCount,
+	}
+	if _, err := db.NewInsert().
+		Model(m).
+		Value("scheduled_at", "?", formatTime(scheduledAt)).
+		Exec(ctx); err != nil {
+		return nil, errs.Wrap("error.schedule_save_failed", err)
+	}
+
+	if _, err := db.NewUpdate().
+		Model((*jobModel)(nil)).
+		Set("last_run_at = ?", formatTime(time.Now())).
+		Where("id = ?", job.ID).
+		Exec(ctx); err != nil {
+		s.app.Logger.Warn("[scheduler] update job last run failed", "job", job.ID, "error", err)
+	}
+
+	data, _ := json.Marshal(RunJobData{RunID: m.ID})
+	tm := taskmanager.Get()
+	if tm == nil || !tm.Submit(taskmanager.QueueSchedule, JobTypeScheduledRun, runTaskKey(m.ID), uuid.New().String(), data) {
+		m.Status = RunStatusFailed
+		m.Error = "submit to task queue failed"
+		s.finishRun(ctx, db, m)
+		return nil, errs.New("error.schedule_submit_failed")
+	}
+
+	dto := m.toDTO()
+	return &dto, nil
+}
+
+// recordSkippedRun 记录一次跳过的运行（错过且策略为跳过，或上一次运行尚未结束）
+func (s *SchedulerService) recordSkippedRun(ctx context.Context, db *bun.DB, job *jobModel, trigger string, scheduledAt time.Time, missedCount int, reason string) {
+	now := time.Now()
+	m := &runModel{
+		JobID:       job.ID,
+		Trigger:     trigger,
+		Status:      RunStatusSkipped,
+		ScheduledAt: scheduledAt,
+		FinishedAt:  now,
+		Error:       reason,
+		MissedCount: missedCount,
+	}
+	if _, err := db.NewInsert().
+		Model(m).
+		Value("scheduled_at", "?", formatTime(scheduledAt)).
+		Value("finished_at", "?", formatTime(now)).
+		Exec(ctx); err != nil {
+		s.app.Logger.Error("[scheduler] record skipped run failed", "job", job.ID, "error", err)
+		return
+	}
+	s.app.Event.Emit(EventRunFinished, m.toDTO())
+}
+
+// executeRun 任务处理器：在会话中运行提示词，记录结果并发送通知
+func (s *SchedulerService) executeRun(ctx context.Context, runID int64, info *taskmanager.TaskInfo) error {
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	var run runModel
+	if err := db.NewSelect().Model(&run).Where("r.id = ?", runID).Limit(1).Scan(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// 任务已删除
+			return nil
+		}
+		return err
+	}
+	switch run.Status {
+	case RunStatusQueued:
+	case RunStatusRunning:
+		// 应用在运行过程中退出，重启后不重复执行（会话中已经有这次的提问）
+		run.Status = RunStatusFailed
+		run.Error = "interrupted because the app was closed"
+		s.finishRun(ctx, db, &run)
+		return nil
+	default:
+		return nil
+	}
+
+	job, err := s.getJobModel(ctx, db, run.JobID)
+	if err != nil {
+		return nil
+	}
+	if info.IsCancelled() {
+		run.Status = RunStatusCancelled
+		s.finishRun(ctx, db, &run)
+		return nil
+	}
+
+	run.Status = RunStatusRunning
+	run.StartedAt = time.Now()
+	if _, err := db.NewUpdate().
+		Model((*runModel)(nil)).
+		Set("status = ?", run.Status).
+		Set("started_at = ?", formatTime(run.StartedAt)).
+		Where("id = ?", run.ID).
+		Exec(ctx); err != nil {
+		return taskmanager.Permanent(err)
+	}
+	s.app.Event.Emit(EventRunStarted, run.toDTO())
+
+	runCtx, cancel := context.WithTimeout(ctx, runTimeout)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(cancelPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				if info.IsCancelled() {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	convID, err := s.prepareConversation(ctx, db, job, run.StartedAt)
+	if err != nil {
+		run.Status = RunStatusFailed
+		run.Error = err.Error()
+		s.finishRun(ctx, db, &run)
+		s.notify(ctx, db, job, &run)
+		return taskmanager.Permanent(err)
+	}
+	run.ConversationID = convID
+
+	result, runErr := s.chat.RunMessage(runCtx, convID, job.Prompt)
+	switch {
+	case runErr != nil:
+		run.Status = RunStatusFailed
+		run.Error = runErr.Error()
+	case result.Status == chat.StatusSuccess:
+		run.Status = RunStatusSucceeded
+	case result.Status == chat.StatusCancelled:
+		run.Status = RunStatusCancelled
+		if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			run.Status = RunStatusFailed
+			run.Error = fmt.Sprintf("timed out after %s", runTimeout)
+		}
+	default:
+		run.Status = RunStatusFailed
+		run.Error = result.Error
+	}
+	if result != nil {
+		run.MessageID = result.MessageID
+		output := result.Content
+		if result.StructuredOutput != "" {
+			output = result.StructuredOutput
+		}
+		run.Output = truncateRunes(strings.TrimSpace(output), maxOutputRunes)
+	}
+
+	s.finishRun(ctx, db, &run)
+	s.notify(ctx, db, job, &run)
+	if run.Status == RunStatusFailed {
+		return taskmanager.Permanent(errors.New(run.Error))
+	}
+	return nil
+}
+
+// prepareConversation 返回本次运行使用的会话：new 模式每次新建，append 模式复用任务的会话（不存在时新建并保存）
+func (s *SchedulerService) prepareConversation(ctx context.Context, db *bun.DB, job *jobModel, startedAt time.Time) (int64, error) {
+	convService := conversations.NewConversationsService(s.app)
+	lastMessage := job.Prompt
+
+	if job.ConversationMode == ConversationModeAppend && job.ConversationID > 0 {
+		exists, err := db.NewSelect().
+			Table("conversations").
+			Where("id = ?", job.ConversationID).
+			Where("agent_id = ?", job.AgentID).
+			Exists(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if exists {
+			if _, err := convService.UpdateConversation(job.ConversationID, conversations.UpdateConversationInput{
+				LastMessage: &lastMessage,
+			}); err != nil {
+				s.app.Logger.Warn("[scheduler] update conversation failed", "conversation", job.ConversationID, "error", err)
+			}
+			return job.ConversationID, nil
+		}
+	}
+
+	name := job.Name
+	if job.ConversationMode == ConversationModeNew {
+		name = fmt.Sprintf("%s %s", job.Name, startedAt.Format("2006-01-02 15:04"))
+	}
+	var libraryIDs []int64
+	if dto := job.toDTO(); len(dto.LibraryIDs) > 0 {
+		libraryIDs = dto.LibraryIDs
+	}
+	conv, err := convService.CreateConversation(conversations.CreateConversationInput{
+		AgentID:     job.AgentID,
+		Name:        name,
+		LastMessage: lastMessage,
+		LibraryIDs:  libraryIDs,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if job.ConversationMode == ConversationModeAppend {
+		if _, err := db.NewUpdate().
+			Model((*jobModel)(nil)).
+			Set("conversation_id = ?", conv.ID).
+			Where("id = ?", job.ID).
+			Exec(ctx); err != nil {
+			s.app.Logger.Warn("[scheduler] save job conversation failed", "job", job.ID, "error", err)
+		}
+	}
+	return conv.ID, nil
+}
+
+// finishRun 记录运行结果
+func (s *SchedulerService) finishRun(ctx context.Context, db *bun.DB, run *runModel) {
+	run.FinishedAt = time.Now()
+	// 任务上下文可能已经取消，结果仍需保存
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if _, err := db.NewUpdate().
+		Model((*runModel)(nil)).
+		Set("status = ?", run.Status).
+		Set("finished_at = ?", formatTime(run.FinishedAt)).
+		Set("conversation_id = ?", run.ConversationID).
+		Set("message_id = ?", run.MessageID).
+		Set("output = ?", run.Output).
+		Set("error = ?", run.Error).
+		Where("id = ?", run.ID).
+		Exec(ctx); err != nil {
+		s.app.Logger.Error("[scheduler] save run result failed", "run", run.ID, "error", err)
+	}
+	s.app.Event.Emit(EventRunFinished, run.toDTO())
+}
+
+// notify 按任务的通知方式发送通知事件和 webhook
+func (s *SchedulerService) notify(ctx context.Context, db *bun.DB, job *jobModel, run *runModel) {
+	if job.NotifyMode == NotifyNever {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), webhookTimeout+5*time.Second)
+	defer cancel()
+
+	changed := true
+	if run.Status == RunStatusSucceeded {
+		var prev string
+		err := db.NewSelect().
+			Model((*runModel)(nil)).
+			Column("output").
+			Where("job_id = ?", job.ID).
+			Where("id < ?", run.ID).
+			Where("status = ?", RunStatusSucceeded).
+			OrderExpr("id DESC").
+			Limit(1).
+			Scan(ctx, &prev)
+		if err == nil {
+			changed = prev != run.Output
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			s.app.Logger.Warn("[scheduler] load previous run failed", "job", job.ID, "error", err)
+		}
+	}
+	// changed 模式只关心成功运行的结果变化，失败总是通知
+	if job.NotifyMode == NotifyChanged && run.Status == RunStatusSucceeded && !changed {
+		return
+	}
+
+	n := RunNotification{
+		JobID:          job.ID,
+		JobName:        job.Name,
+		AgentID:        job.AgentID,
+		RunID:          run.ID,
+		Trigger:        run.Trigger,
+		Status:         run.Status,
+		ConversationID: run.ConversationID,
+		MessageID:      run.MessageID,
+		Output:         run.Output,
+		Error:          run.Error,
+		Changed:        changed,
+		MissedCount:    run.MissedCount,
+		ScheduledAt:    run.ScheduledAt,
+		FinishedAt:     run.FinishedAt,
+	}
+	s.app.Event.Emit(EventNotification, n)
+
+	if job.WebhookURL == "" {
+		return
+	}
+	run.WebhookStatus = s.postWebhook(ctx, job.WebhookURL, n)
+	if _, err := db.NewUpdate().
+		Model((*runModel)(nil)).
+		Set("webhook_status = ?", run.WebhookStatus).
+		Where("id = ?", run.ID).
+		Exec(ctx); err != nil {
+		s.app.Logger.Warn("[scheduler] save webhook status failed", "run", run.ID, "error", err)
+	}
+}
+
+// postWebhook 把通知以 JSON POST 到 webhook，返回 HTTP 状态或错误信息
+func (s *SchedulerService) postWebhook(ctx context.Context, webhookURL string, n RunNotification) string {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err.Error()
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ChatClaw-Scheduler")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.app.Logger.Warn("[scheduler] webhook failed", "run", n.RunID, "error", err)
+		return err.Error()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		s.app.Logger.Warn("[scheduler] webhook returned error status", "run", n.RunID, "status", resp.Status)
+	}
+	return resp.Status
+}
+
+func truncateRunes(s string, limit int) string {
+	r := []rune(s)
+	if len(r) <= limit {
+		return s
+	}
+	return string(r[:limit])
+}
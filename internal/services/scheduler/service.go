@@ -0,0 +1,549 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"chatclaw/internal/errs"
+	"chatclaw/internal/services/chat"
+	"chatclaw/internal/sqlite"
+	"chatclaw/internal/taskmanager"
+
+	"github.com/uptrace/bun"
+	"github.com/wailsapp/wails/v3/pkg/application"
+)
+
+// previewCount PreviewSchedule 返回的运行时间个数
+const previewCount = 5
+
+// SchedulerService 定时任务服务（暴露给前端调用）：
+// 按 cron 表达式定时让助手执行提示词，运行结果写入会话并通过事件 / webhook 通知
+type SchedulerService struct {
+	app  *application.App
+	chat *chat.ChatService
+
+	// mu 保证同一时间只有一次调度检查
+	mu   sync.Mutex
+	stop context.CancelFunc
+	// wake 任务变化后立即重新检查
+	wake chan struct{}
+}
+
+// NewSchedulerService chatService 应与注册给前端的实例相同，
+// 这样定时运行和手动聊天共享同一套生成状态（同一会话不会同时生成）
+func NewSchedulerService(app *application.App, chatService *chat.ChatService) *SchedulerService {
+	return &SchedulerService{
+		app:  app,
+		chat: chatService,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+func (s *SchedulerService) db() (*bun.DB, error) {
+	db := sqlite.DB()
+	if db == nil {
+		return nil, errs.New("error.sqlite_not_initialized")
+	}
+	return db, nil
+}
+
+// ServiceStartup 注册任务处理器并启动调度循环（需在 DocumentService 启动任务管理器之前注册）
+func (s *SchedulerService) ServiceStartup(ctx context.Context, options application.ServiceOptions) error {
+	if tm := taskmanager.Get(); tm != nil {
+		tm.RegisterHandler(taskmanager.QueueSchedule, JobTypeScheduledRun, func(ctx context.Context, info *taskmanager.TaskInfo, data []byte) error {
+			var jobData RunJobData
+			if err := json.Unmarshal(data, &jobData); err != nil {
+				s.app.Logger.Error("failed to unmarshal scheduled run job data", "error", err)
+				return nil
+			}
+			return s.executeRun(ctx, jobData.RunID, info)
+		})
+		// 运行失败时记录在运行记录中，由下一次定时运行自然重试；重复执行会产生重复的会话和通知
+		tm.SetRetryPolicy(taskmanager.QueueSchedule, JobTypeScheduledRun, taskmanager.RetryPolicy{MaxAttempts: 1})
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	s.stop = cancel
+	go s.scheduleLoop(runCtx)
+	return nil
+}
+
+// ServiceShutdown 停止调度循环
+func (s *SchedulerService) ServiceShutdown() error {
+	if s.stop != nil {
+		s.stop()
+	}
+	return nil
+}
+
+// ListJobs 列出定时任务；agentID 为 0 时列出所有助手的任务
+func (s *SchedulerService) ListJobs(agentID int64) ([]Job, error) {
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	models := make([]jobModel, 0)
+	q := db.NewSelect().Model(&models).OrderExpr("j.id DESC")
+	if agentID > 0 {
+		q = q.Where("j.agent_id = ?", agentID)
+	}
+	if err := q.Scan(ctx); err != nil {
+		return nil, errs.Wrap("error.schedule_read_failed", err)
+	}
+
+	out := make([]Job, 0, len(models))
+	for i := range models {
+		out = append(out, models[i].toDTO())
+	}
+	return out, nil
+}
+
+// GetJob 获取单个定时任务
+func (s *SchedulerService) GetJob(id int64) (*Job, error) {
+	if id <= 0 {
+		return nil, errs.New("error.schedule_job_id_required")
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m, err := s.getJobModel(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	dto := m.toDTO()
+	return &dto, nil
+}
+
+// CreateJob 创建定时任务
+func (s *SchedulerService) CreateJob(input CreateJobInput) (*Job, error) {
+	if input.AgentID <= 0 {
+		return nil, errs.New("error.agent_id_required")
+	}
+	name, err := normalizeJobName(input.Name)
+	if err != nil {
+		return nil, err
+	}
+	prompt := strings.TrimSpace(input.Prompt)
+	if prompt == "" {
+		return nil, errs.New("error.schedule_prompt_required")
+	}
+	cronExpr := strings.TrimSpace(input.CronExpr)
+	sched, err := parseSchedule(cronExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	conversationMode := strings.TrimSpace(input.ConversationMode)
+	if conversationMode == "" {
+		conversationMode = ConversationModeNew
+	}
+	if !IsValidConversationMode(conversationMode) {
+		return nil, errs.New("error.schedule_conversation_mode_invalid")
+	}
+	notifyMode := strings.TrimSpace(input.NotifyMode)
+	if notifyMode == "" {
+		notifyMode = NotifyAlways
+	}
+	if !IsValidNotifyMode(notifyMode) {
+		return nil, errs.New("error.schedule_notify_mode_invalid")
+	}
+	missedPolicy := strings.TrimSpace(input.MissedPolicy)
+	if missedPolicy == "" {
+		missedPolicy = MissedRunOnce
+	}
+	if !IsValidMissedPolicy(missedPolicy) {
+		return nil, errs.New("error.schedule_missed_policy_invalid")
+	}
+	webhookURL, err := normalizeWebhookURL(input.WebhookURL)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := ensureAgentExists(ctx, db, input.AgentID); err != nil {
+		return nil, err
+	}
+
+	m := &jobModel{
+		Name:             name,
+		AgentID:          input.AgentID,
+		Prompt:           prompt,
+		CronExpr:         cronExpr,
+		Enabled:          input.Enabled,
+		ConversationMode: conversationMode,
+		LibraryIDs:       serializeLibraryIDs(input.LibraryIDs),
+		NotifyMode:       notifyMode,
+		WebhookURL:       webhookURL,
+		MissedPolicy:     missedPolicy,
+	}
+	q := db.NewInsert().Model(m)
+	if input.Enabled {
+		m.NextRunAt = sched.Next(time.Now())
+		q = q.Value("next_run_at", "?", formatTime(m.NextRunAt))
+	}
+	if _, err := q.Exec(ctx); err != nil {
+		return nil, errs.Wrap("error.schedule_save_failed", err)
+	}
+
+	s.notifyChanged()
+	dto := m.toDTO()
+	return &dto, nil
+}
+
+// UpdateJob 更新定时任务；修改 cron 表达式或重新启用时重新计算下次运行时间
+func (s *SchedulerService) UpdateJob(id int64, input UpdateJobInput) (*Job, error) {
+	if id <= 0 {
+		return nil, errs.New("error.schedule_job_id_required")
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cur, err := s.getJobModel(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	q := db.NewUpdate().Model((*jobModel)(nil)).Where("id = ?", id)
+
+	if input.Name != nil {
+		name, err := normalizeJobName(*input.Name)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("name = ?", name)
+	}
+	if input.AgentID != nil {
+		if *input.AgentID <= 0 {
+			return nil, errs.New("error.agent_id_required")
+		}
+		if err := ensureAgentExists(ctx, db, *input.AgentID); err != nil {
+			return nil, err
+		}
+		q = q.Set("agent_id = ?", *input.AgentID)
+		if *input.AgentID != cur.AgentID && input.ConversationID == nil {
+			// 追加的会话属于原助手，换助手后下次运行新建会话
+			q = q.Set("conversation_id = ?", 0)
+		}
+	}
+	if input.Prompt != nil {
+		prompt := strings.TrimSpace(*input.Prompt)
+		if prompt == "" {
+			return nil, errs.New("error.schedule_prompt_required")
+		}
+		q = q.Set("prompt = ?", prompt)
+	}
+	if input.ConversationMode != nil {
+		mode := strings.TrimSpace(*input.ConversationMode)
+		if !IsValidConversationMode(mode) {
+			return nil, errs.New("error.schedule_conversation_mode_invalid")
+		}
+		q = q.Set("conversation_mode = ?", mode)
+	}
+	if input.ConversationID != nil {
+		q = q.Set("conversation_id = ?", max(*input.ConversationID, 0))
+	}
+	if input.LibraryIDs != nil {
+		q = q.Set("library_ids = ?", serializeLibraryIDs(*input.LibraryIDs))
+	}
+	if input.NotifyMode != nil {
+		mode := strings.TrimSpace(*input.NotifyMode)
+		if !IsValidNotifyMode(mode) {
+			return nil, errs.New("error.schedule_notify_mode_invalid")
+		}
+		q = q.Set("notify_mode = ?", mode)
+	}
+	if input.WebhookURL != nil {
+		webhookURL, err := normalizeWebhookURL(*input.WebhookURL)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("webhook_url = ?", webhookURL)
+	}
+	if input.MissedPolicy != nil {
+		policy := strings.TrimSpace(*input.MissedPolicy)
+		if !IsValidMissedPolicy(policy) {
+			return nil, errs.New("error.schedule_missed_policy_invalid")
+		}
+		q = q.Set("missed_policy = ?", policy)
+	}
+
+	cronExpr, enabled := cur.CronExpr, cur.Enabled
+	if input.CronExpr != nil {
+		cronExpr = strings.TrimSpace(*input.CronExpr)
+		q = q.Set("cron_expr = ?", cronExpr)
+	}
+	if input.Enabled != nil {
+		enabled = *input.Enabled
+		q = q.Set("enabled = ?", enabled)
+	}
+	if input.CronExpr != nil || input.Enabled != nil {
+		sched, err := parseSchedule(cronExpr)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !enabled:
+			q = q.Set("next_run_at = NULL")
+		case !cur.Enabled || cronExpr != cur.CronExpr:
+			// 重新启用时不补跑停用期间的运行
+			q = q.Set("next_run_at = ?", formatTime(sched.Next(time.Now())))
+		}
+	}
+
+	if _, err := q.Exec(ctx); err != nil {
+		return nil, errs.Wrap("error.schedule_save_failed", err)
+	}
+
+	s.notifyChanged()
+	return s.GetJob(id)
+}
+
+// DeleteJob 删除定时任务及其运行记录（已创建的会话保留）
+func (s *SchedulerService) DeleteJob(id int64) error {
+	if id <= 0 {
+		return errs.New("error.schedule_job_id_required")
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 取消排队或正在执行的运行
+	var runIDs []int64
+	if err := db.NewSelect().
+		Model((*runModel)(nil)).
+		Column("id").
+		Where("job_id = ?", id).
+		Where("status IN (?)", bun.In([]string{RunStatusQueued, RunStatusRunning})).
+		Scan(ctx, &runIDs); err != nil {
+		return errs.Wrap("error.schedule_delete_failed", err)
+	}
+	if tm := taskmanager.Get(); tm != nil {
+		for _, runID := range runIDs {
+			tm.Cancel(runTaskKey(runID))
+		}
+	}
+
+	res, err := db.NewDelete().Model((*jobModel)(nil)).Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		return errs.Wrap("error.schedule_delete_failed", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errs.Newf("error.schedule_job_not_found", map[string]any{"ID": id})
+	}
+	return nil
+}
+
+// RunJobNow 立即运行一次任务（不影响下次定时运行时间），返回运行记录
+func (s *SchedulerService) RunJobNow(id int64) (*Run, error) {
+	if id <= 0 {
+		return nil, errs.New("error.schedule_job_id_required")
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err := s.getJobModel(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.enqueueRun(ctx, db, job, TriggerManual, time.Now(), 0)
+}
+
+// ListRuns 列出运行记录（按时间倒序）
+func (s *SchedulerService) ListRuns(input ListRunsInput) ([]Run, error) {
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	limit := input.Limit
+	if limit <= 0 || limit > 500 {
+		limit = defaultRunsLimit
+	}
+
+	models := make([]runModel, 0)
+	q := db.NewSelect().
+		Model(&models).
+		OrderExpr("r.id DESC").
+		Limit(limit).
+		Offset(max(input.Offset, 0))
+	if input.JobID > 0 {
+		q = q.Where("r.job_id = ?", input.JobID)
+	}
+	if err := q.Scan(ctx); err != nil {
+		return nil, errs.Wrap("error.schedule_read_failed", err)
+	}
+
+	out := make([]Run, 0, len(models))
+	for i := range models {
+		out = append(out, models[i].toDTO())
+	}
+	return out, nil
+}
+
+// CancelRun 取消排队或正在执行的运行
+func (s *SchedulerService) CancelRun(runID int64) error {
+	if runID <= 0 {
+		return errs.New("error.schedule_run_id_required")
+	}
+	if tm := taskmanager.Get(); tm != nil {
+		tm.Cancel(runTaskKey(runID))
+	}
+
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 还未开始的运行直接标记为取消；正在执行的运行由处理器在生成停止后记录
+	if _, err := db.NewUpdate().
+		Model((*runModel)(nil)).
+		Set("status = ?", RunStatusCancelled).
+		Set("finished_at = ?", formatTime(time.Now())).
+		Where("id = ?", runID).
+		Where("status = ?", RunStatusQueued).
+		Exec(ctx); err != nil {
+		return errs.Wrap("error.schedule_save_failed", err)
+	}
+	return nil
+}
+
+// PreviewSchedule 校验 cron 表达式并返回接下来的几次运行时间（本地时区）
+func (s *SchedulerService) PreviewSchedule(expr string) ([]time.Time, error) {
+	sched, err := parseSchedule(expr)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]time.Time, 0, previewCount)
+	t := time.Now()
+	for len(out) < previewCount {
+		t = sched.Next(t)
+		if t.IsZero() {
+			break
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func (s *SchedulerService) getJobModel(ctx context.Context, db *bun.DB, id int64) (*jobModel, error) {
+	var m jobModel
+	if err := db.NewSelect().Model(&m).Where("j.id = ?", id).Limit(1).Scan(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.Newf("error.schedule_job_not_found", map[string]any{"ID": id})
+		}
+		return nil, errs.Wrap("error.schedule_read_failed", err)
+	}
+	return &m, nil
+}
+
+// notifyChanged 任务变化后唤醒调度循环
+func (s *SchedulerService) notifyChanged() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func normalizeJobName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errs.New("error.schedule_name_required")
+	}
+	if len([]rune(name)) > maxJobNameRunes {
+		return "", errs.Newf("error.schedule_name_too_long", map[string]any{"Max": maxJobNameRunes})
+	}
+	return name, nil
+}
+
+func parseSchedule(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, errs.New("error.schedule_cron_required")
+	}
+	sched, err := ParseCron(expr, time.Local)
+	if err != nil {
+		return nil, errs.Newf("error.schedule_cron_invalid", map[string]any{"Error": err.Error()})
+	}
+	return sched, nil
+}
+
+// normalizeWebhookURL 允许为空；非空时必须是 http / https 地址
+func normalizeWebhookURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errs.New("error.schedule_webhook_invalid")
+	}
+	return raw, nil
+}
+
+func ensureAgentExists(ctx context.Context, db *bun.DB, agentID int64) error {
+	exists, err := db.NewSelect().Table("agents").Where("id = ?", agentID).Exists(ctx)
+	if err != nil {
+		return errs.Wrap("error.schedule_read_failed", err)
+	}
+	if !exists {
+		return errs.Newf("error.agent_not_found", map[string]any{"ID": agentID})
+	}
+	return nil
+}
+
+func serializeLibraryIDs(ids []int64) string {
+	if len(ids) == 0 {
+		return "[]"
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
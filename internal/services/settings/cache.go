@@ -59,7 +59,6 @@ func InitCache(app *application.App) error {
 	}
 
 	globalSettingsCache.mu.Lock()
-	defer globalSettingsCache.mu.Unlock()
 
 	// 重建（避免残留旧 key）
 	globalSettingsCache.values = make(map[string]string, len(rows))
@@ -77,9 +76,14 @@ func InitCache(app *application.App) error {
 		globalSettingsCache.categories[k] = Category(strings.TrimSpace(r.Category))
 	}
 	globalSettingsCache.loaded = true
+	count := len(globalSettingsCache.values)
+	globalSettingsCache.mu.Unlock()
+
+	// 限流配置需要在任何模型调用之前生效
+	applyRateLimits()
 
 	if app != nil {
-		app.Logger.Info("settings cache loaded", "count", len(globalSettingsCache.values))
+		app.Logger.Info("settings cache loaded", "count", count)
 	}
 	return nil
 }
@@ -0,0 +1,82 @@
+package settings
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	einoembed "chatclaw/internal/eino/embedding"
+	"chatclaw/internal/errs"
+)
+
+// embeddingBatchKey 供应商向量化批次配置（JSON：供应商 ID -> 批次大小 / 并发数）
+const embeddingBatchKey = "provider_embedding_batch"
+
+// ProviderEmbeddingBatch 单个供应商的向量化批次配置，0 表示使用默认值
+type ProviderEmbeddingBatch struct {
+	ProviderID  string `json:"provider_id"`
+	BatchSize   int    `json:"batch_size"`  // 单次请求最多包含的文本数
+	Parallelism int    `json:"parallelism"` // 同时进行的请求数
+}
+
+// loadEmbeddingBatches 从缓存读取批次配置（非法 JSON 视为未配置）
+func loadEmbeddingBatches() map[string]einoembed.BatchConfig {
+	out := make(map[string]einoembed.BatchConfig)
+	v, ok := GetValue(embeddingBatchKey)
+	if !ok || strings.TrimSpace(v) == "" {
+		return out
+	}
+	_ = json.Unmarshal([]byte(v), &out)
+	return out
+}
+
+// ListProviderEmbeddingBatches 返回已配置的供应商向量化批次
+func (s *SettingsService) ListProviderEmbeddingBatches() ([]ProviderEmbeddingBatch, error) {
+	if !cacheLoaded() {
+		return nil, errs.New("error.setting_cache_not_initialized")
+	}
+
+	batches := loadEmbeddingBatches()
+	out := make([]ProviderEmbeddingBatch, 0, len(batches))
+	for providerID, b := range batches {
+		out = append(out, ProviderEmbeddingBatch{
+			ProviderID:  providerID,
+			BatchSize:   b.BatchSize,
+			Parallelism: b.Parallelism,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ProviderID < out[j].ProviderID })
+	return out, nil
+}
+
+// SetProviderEmbeddingBatch 设置供应商的向量化批次，下一次向量化生效；全部为 0 时恢复默认值
+func (s *SettingsService) SetProviderEmbeddingBatch(input ProviderEmbeddingBatch) error {
+	providerID := strings.TrimSpace(input.ProviderID)
+	if providerID == "" {
+		return errs.New("error.provider_id_required")
+	}
+	if input.BatchSize < 0 || input.Parallelism < 0 {
+		return errs.New("error.setting_embedding_batch_invalid")
+	}
+	if !cacheLoaded() {
+		return errs.New("error.setting_cache_not_initialized")
+	}
+
+	batches := loadEmbeddingBatches()
+	b := einoembed.BatchConfig{
+		BatchSize:   input.BatchSize,
+		Parallelism: input.Parallelism,
+	}
+	if b == (einoembed.BatchConfig{}) {
+		delete(batches, providerID)
+	} else {
+		batches[providerID] = b
+	}
+
+	data, err := json.Marshal(batches)
+	if err != nil {
+		return errs.Wrap("error.setting_write_failed", err)
+	}
+	_, err = s.SetValue(embeddingBatchKey, string(data))
+	return err
+}
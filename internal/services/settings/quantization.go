@@ -0,0 +1,120 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"chatclaw/internal/errs"
+	"chatclaw/internal/sqlite"
+	"chatclaw/internal/sqlite/vecstore"
+)
+
+// vectorQuantizationKey 向量量化方式（none / int8 / binary）
+//
+// 量化方式是全局配置，对所有知识库生效，不提供按知识库覆盖：
+// 所有知识库的向量存放在同一张 doc_vec（vec0 虚拟表，按 library_id 分区）中，
+// 一张 vec0 表的 content 列只能有一种类型（FLOAT / INT8 / BIT），按知识库使用不同的量化方式
+// 需要拆分成多张向量表并在检索时分别查询，收益（只对超大知识库单独量化）不足以抵消这部分复杂度。
+const vectorQuantizationKey = "vector_quantization"
+
+// vectorQuantization 读取配置的量化方式，未配置或非法时不量化
+func vectorQuantization() vecstore.Quantization {
+	v, _ := GetValue(vectorQuantizationKey)
+	q, ok := vecstore.ParseQuantization(v)
+	if !ok {
+		return vecstore.QuantizationNone
+	}
+	return q
+}
+
+// VectorQuantizationEvent 后台转换结束后通过 "settings:vector_quantization" 事件通知前端
+type VectorQuantizationEvent struct {
+	Quantization string `json:"quantization"` // doc_vec 当前实际的量化方式
+	Target       string `json:"target"`       // 本次请求的量化方式
+	Error        string `json:"error,omitempty"`
+}
+
+// GetVectorQuantization 返回当前的向量量化方式：以 doc_vec 的实际列类型为准，
+// 转换进行中或失败时不会返回尚未生效的配置；向量表不存在时返回配置值
+func (s *SettingsService) GetVectorQuantization() (string, error) {
+	if !cacheLoaded() {
+		return "", errs.New("error.setting_cache_not_initialized")
+	}
+	db := sqlite.DB()
+	if db == nil {
+		return string(vectorQuantization()), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	q, _, err := vecstore.Schema(ctx, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return string(vectorQuantization()), nil
+	}
+	if err != nil {
+		return "", errs.Wrap("error.setting_read_failed", err)
+	}
+	return string(q), nil
+}
+
+// SetVectorQuantization 在后台把已有向量转换为新的量化方式（不重新调用嵌入接口），转换成功后才保存配置；
+// 结果通过 "settings:vector_quantization" 事件通知前端，失败时配置和 doc_vec 都保持原样。
+// 量化后 KNN 先按量化向量粗排，再用全精度向量对候选重新打分
+func (s *SettingsService) SetVectorQuantization(mode string) error {
+	q, ok := vecstore.ParseQuantization(mode)
+	if !ok {
+		return errs.Newf("error.setting_vector_quantization_invalid", map[string]any{"Mode": mode})
+	}
+	db, err := dbForWrite()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, dimension, err := vecstore.Schema(ctx, db)
+	if err != nil {
+		return errs.Wrap("error.setting_read_failed", err)
+	}
+	if err := q.Validate(dimension); err != nil {
+		return errs.Newf("error.setting_vector_quantization_invalid", map[string]any{"Mode": mode})
+	}
+
+	// Fire-and-forget: converting a large table can take a while.
+	go s.convertVectors(q)
+	return nil
+}
+
+func (s *SettingsService) convertVectors(q vecstore.Quantization) {
+	// Share the lock with re-embedding so the table is never rebuilt twice at once.
+	reembedMu.Lock()
+	defer reembedMu.Unlock()
+
+	db := sqlite.DB()
+	if db == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	event := VectorQuantizationEvent{Target: string(q)}
+	start := time.Now()
+	if err := vecstore.Convert(ctx, db, q); err != nil {
+		// Convert 在一个事务中完成，失败时 doc_vec 保持原来的列类型，配置也不更新
+		s.app.Logger.Error("convert doc_vec failed", "quantization", q, "error", err)
+		event.Error = errs.Wrap("error.setting_vector_quantization_convert_failed", err).Error()
+	} else {
+		s.app.Logger.Info("doc_vec converted", "quantization", q, "elapsed", time.Since(start))
+		if _, err := s.SetValue(vectorQuantizationKey, string(q)); err != nil {
+			s.app.Logger.Error("save vector quantization failed", "quantization", q, "error", err)
+			event.Error = err.Error()
+		}
+	}
+
+	current, _, err := vecstore.Schema(context.Background(), db)
+	if err != nil {
+		s.app.Logger.Warn("read doc_vec schema failed", "error", err)
+	}
+	event.Quantization = string(current)
+	s.app.Event.Emit("settings:vector_quantization", event)
+}
@@ -0,0 +1,101 @@
+package settings
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"chatclaw/internal/eino/ratelimit"
+	"chatclaw/internal/errs"
+)
+
+// rateLimitsKey 供应商限流配置（JSON：供应商 ID -> 限流配置）
+const rateLimitsKey = "provider_rate_limits"
+
+// ProviderRateLimit 单个供应商的限流配置，0 表示不限制
+type ProviderRateLimit struct {
+	ProviderID     string `json:"provider_id"`
+	RPM            int    `json:"rpm"`             // 每分钟请求数
+	TPM            int    `json:"tpm"`             // 每分钟 token 数
+	MaxConcurrency int    `json:"max_concurrency"` // 最大并发请求数
+}
+
+// loadRateLimits 从缓存读取限流配置（非法 JSON 视为未配置）
+func loadRateLimits() map[string]ratelimit.Limits {
+	out := make(map[string]ratelimit.Limits)
+	v, ok := GetValue(rateLimitsKey)
+	if !ok || strings.TrimSpace(v) == "" {
+		return out
+	}
+	_ = json.Unmarshal([]byte(v), &out)
+	return out
+}
+
+// applyRateLimits 把限流配置同步到 ratelimit 包（启动时加载缓存后调用）
+func applyRateLimits() {
+	for providerID, limits := range loadRateLimits() {
+		ratelimit.Configure(providerID, limits)
+	}
+}
+
+// ListProviderRateLimits 返回已配置的供应商限流
+func (s *SettingsService) ListProviderRateLimits() ([]ProviderRateLimit, error) {
+	if !cacheLoaded() {
+		return nil, errs.New("error.setting_cache_not_initialized")
+	}
+
+	limits := loadRateLimits()
+	out := make([]ProviderRateLimit, 0, len(limits))
+	for providerID, l := range limits {
+		out = append(out, ProviderRateLimit{
+			ProviderID:     providerID,
+			RPM:            l.RPM,
+			TPM:            l.TPM,
+			MaxConcurrency: l.MaxConcurrency,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ProviderID < out[j].ProviderID })
+	return out, nil
+}
+
+// SetProviderRateLimit 设置供应商限流，立即生效；全部为 0 时移除配置
+func (s *SettingsService) SetProviderRateLimit(input ProviderRateLimit) error {
+	providerID := strings.TrimSpace(input.ProviderID)
+	if providerID == "" {
+		return errs.New("error.provider_id_required")
+	}
+	if input.RPM < 0 || input.TPM < 0 || input.MaxConcurrency < 0 {
+		return errs.New("error.setting_rate_limit_invalid")
+	}
+	if !cacheLoaded() {
+		return errs.New("error.setting_cache_not_initialized")
+	}
+
+	limits := loadRateLimits()
+	l := ratelimit.Limits{
+		RPM:            input.RPM,
+		TPM:            input.TPM,
+		MaxConcurrency: input.MaxConcurrency,
+	}
+	if l == (ratelimit.Limits{}) {
+		delete(limits, providerID)
+	} else {
+		limits[providerID] = l
+	}
+
+	data, err := json.Marshal(limits)
+	if err != nil {
+		return errs.Wrap("error.setting_write_failed", err)
+	}
+	if _, err := s.SetValue(rateLimitsKey, string(data)); err != nil {
+		return err
+	}
+
+	ratelimit.Configure(providerID, l)
+	return nil
+}
+
+// GetThrottleStates 返回各供应商当前的限流状态（并发、最近一分钟用量、是否因 429 暂停）
+func (s *SettingsService) GetThrottleStates() []ratelimit.State {
+	return ratelimit.States()
+}
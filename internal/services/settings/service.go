@@ -10,9 +10,11 @@ import (
 	"sync"
 	"time"
 
+	"chatclaw/internal/eino/processor"
 	"chatclaw/internal/errs"
 	"chatclaw/internal/services/document"
 	"chatclaw/internal/sqlite"
+	"chatclaw/internal/sqlite/vecstore"
 	"chatclaw/internal/taskmanager"
 
 	"github.com/google/uuid"
@@ -267,46 +269,20 @@ func (s *SettingsService) triggerReembedAllDocuments(dimension int) {
 	defer cancel()
 
 	// 1) Rebuild vec0 table to match new dimension
-	// Best-effort: create a tmp table first, then swap to reduce downtime.
-	tmpName := fmt.Sprintf("doc_vec_tmp_%d", time.Now().UnixNano())
-	oldName := fmt.Sprintf("doc_vec_old_%d", time.Now().UnixNano())
-
-	_, _ = db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS "%s";`, tmpName))
-	_, _ = db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS "%s";`, oldName))
-
-	_, err := db.ExecContext(ctx, fmt.Sprintf(
-		`CREATE VIRTUAL TABLE "%s" USING vec0(id INTEGER PRIMARY KEY, content FLOAT[%d]);`,
-		tmpName, dimension,
-	))
-	if err != nil {
-		s.app.Logger.Error("create tmp doc_vec failed", "error", err)
+	// All vectors are re-embedded below, so the old table is simply dropped.
+	// (vec0 tables cannot be written to after a rename, so no tmp-table swap.)
+	if _, err := db.ExecContext(ctx, `DROP TABLE IF EXISTS doc_vec;`); err != nil {
+		s.app.Logger.Error("drop doc_vec failed", "error", err)
 		return
 	}
-
-	// Try rename-swap first (keeps old table if swap fails).
-	_, errRenameOld := db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE doc_vec RENAME TO "%s";`, oldName))
-	_, errRenameNew := db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE "%s" RENAME TO doc_vec;`, tmpName))
-	if errRenameNew != nil {
-		// Rollback: try restoring old table name if we renamed it.
-		if errRenameOld == nil {
-			_, _ = db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE "%s" RENAME TO doc_vec;`, oldName))
-		}
-		_, _ = db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS "%s";`, tmpName))
-
-		// Fallback to drop+create (as last resort).
-		_, _ = db.ExecContext(ctx, `DROP TABLE IF EXISTS doc_vec;`)
-		_, err2 := db.ExecContext(ctx, fmt.Sprintf(
-			`CREATE VIRTUAL TABLE IF NOT EXISTS doc_vec USING vec0(id INTEGER PRIMARY KEY, content FLOAT[%d]);`,
-			dimension,
-		))
-		if err2 != nil {
-			s.app.Logger.Error("fallback rebuild doc_vec failed", "error", err2)
-		}
-		return
+	q := vectorQuantization()
+	if err := q.Validate(dimension); err != nil {
+		s.app.Logger.Warn("vector quantization not applicable, falling back to none", "quantization", q, "error", err)
+		q = vecstore.QuantizationNone
 	}
-	// Drop old table after swap (ignore errors).
-	if errRenameOld == nil {
-		_, _ = db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS "%s";`, oldName))
+	if _, err := db.ExecContext(ctx, vecstore.TableSQL(dimension, q)); err != nil {
+		s.app.Logger.Error("rebuild doc_vec failed", "error", err)
+		return
 	}
 
 	// 2) Submit embedding-only jobs for all documents
@@ -349,6 +325,38 @@ func (s *SettingsService) triggerReembedAllDocuments(dimension int) {
 			RunID:     runID,
 		})
 		taskKey := fmt.Sprintf("doc:%d", r.ID)
-		tm.Submit(taskmanager.QueueDocument, document.JobTypeReembed, taskKey, runID, jobData)
+		// 批量重新向量化排在用户上传的文档之后
+		tm.SubmitWithPriority(taskmanager.QueueDocument, document.JobTypeReembed, taskKey, runID, taskmanager.PriorityLow, jobData)
 	}
 }
+
+// GetEmbeddingCacheUsage returns the number of cached embeddings and their size.
+func (s *SettingsService) GetEmbeddingCacheUsage() (*processor.EmbeddingCacheUsage, error) {
+	db, err := dbForWrite()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	usage, err := processor.GetEmbeddingCacheUsage(ctx, db)
+	if err != nil {
+		return nil, errs.Wrap("error.setting_read_failed", err)
+	}
+	return usage, nil
+}
+
+// ClearEmbeddingCache removes all cached embeddings; later processing calls the provider again.
+func (s *SettingsService) ClearEmbeddingCache() error {
+	db, err := dbForWrite()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := processor.ClearEmbeddingCache(ctx, db); err != nil {
+		return errs.Wrap("error.setting_write_failed", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"chatclaw/internal/errs"
+	"chatclaw/internal/taskmanager"
+
+	"github.com/wailsapp/wails/v3/pkg/application"
+)
+
+// ListJobsInput 任务列表查询条件（空值表示不过滤）
+type ListJobsInput struct {
+	Queue  string `json:"queue"`
+	Status string `json:"status"` // queued / running / succeeded / failed / cancelled
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// TasksService 后台任务服务（暴露给前端调用）：查看队列和任务状态，重试/取消/删除任务，控制队列
+type TasksService struct {
+	app *application.App
+}
+
+func NewTasksService(app *application.App) *TasksService {
+	return &TasksService{app: app}
+}
+
+func (s *TasksService) tm() (*taskmanager.TaskManager, error) {
+	tm := taskmanager.Get()
+	if tm == nil {
+		return nil, errs.New("error.task_manager_not_initialized")
+	}
+	return tm, nil
+}
+
+// ListQueues 返回所有队列的并发数、暂停状态和各状态任务数量
+func (s *TasksService) ListQueues() ([]taskmanager.QueueStatus, error) {
+	tm, err := s.tm()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, err := tm.QueueStatuses(ctx)
+	if err != nil {
+		return nil, errs.Wrap("error.task_list_failed", err)
+	}
+	return out, nil
+}
+
+// ListJobs 列出任务执行记录（最新的在前）
+func (s *TasksService) ListJobs(input ListJobsInput) ([]taskmanager.JobRecord, error) {
+	tm, err := s.tm()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, err := tm.ListJobs(ctx, taskmanager.JobFilter{
+		Queue:  strings.TrimSpace(input.Queue),
+		Status: strings.TrimSpace(input.Status),
+		Limit:  input.Limit,
+		Offset: input.Offset,
+	})
+	if err != nil {
+		return nil, errs.Wrap("error.task_list_failed", err)
+	}
+	return out, nil
+}
+
+// ListDeadLetters 列出死信任务（重试用尽或不可重试的失败任务）及每次失败的错误
+func (s *TasksService) ListDeadLetters(input ListJobsInput) ([]taskmanager.DeadLetter, error) {
+	tm, err := s.tm()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, err := tm.ListDeadLetters(ctx, taskmanager.JobFilter{
+		Queue:  strings.TrimSpace(input.Queue),
+		Limit:  input.Limit,
+		Offset: input.Offset,
+	})
+	if err != nil {
+		return nil, errs.Wrap("error.task_list_failed", err)
+	}
+	return out, nil
+}
+
+// GetJobFailures 返回任务的失败历史
+func (s *TasksService) GetJobFailures(id int64) ([]taskmanager.JobFailure, error) {
+	if id <= 0 {
+		return nil, errs.New("error.task_job_id_required")
+	}
+	tm, err := s.tm()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, err := tm.JobFailures(ctx, id)
+	if err != nil {
+		return nil, errs.Wrap("error.task_list_failed", err)
+	}
+	return out, nil
+}
+
+// RetryJob 重新执行失败或已取消的任务
+func (s *TasksService) RetryJob(id int64) error {
+	return s.jobAction(id, (*taskmanager.TaskManager).RetryJob)
+}
+
+// CancelJob 取消等待中或执行中的任务
+func (s *TasksService) CancelJob(id int64) error {
+	return s.jobAction(id, (*taskmanager.TaskManager).CancelJob)
+}
+
+// DeleteJob 删除任务及其执行记录
+func (s *TasksService) DeleteJob(id int64) error {
+	return s.jobAction(id, (*taskmanager.TaskManager).DeleteJob)
+}
+
+func (s *TasksService) jobAction(id int64, action func(*taskmanager.TaskManager, context.Context, int64) error) error {
+	if id <= 0 {
+		return errs.New("error.task_job_id_required")
+	}
+	tm, err := s.tm()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return toI18nError(action(tm, ctx, id))
+}
+
+// PauseQueue 暂停队列（正在执行的任务继续完成）
+func (s *TasksService) PauseQueue(queue string) error {
+	tm, err := s.tm()
+	if err != nil {
+		return err
+	}
+	return toI18nError(tm.PauseQueue(strings.TrimSpace(queue)))
+}
+
+// ResumeQueue 恢复队列
+func (s *TasksService) ResumeQueue(queue string) error {
+	tm, err := s.tm()
+	if err != nil {
+		return err
+	}
+	return toI18nError(tm.ResumeQueue(strings.TrimSpace(queue)))
+}
+
+// SetQueueWorkers 调整队列并发数（运行时生效，重启后恢复默认配置）
+func (s *TasksService) SetQueueWorkers(queue string, workers int) error {
+	if workers <= 0 || workers > 64 {
+		return errs.New("error.task_workers_invalid")
+	}
+	tm, err := s.tm()
+	if err != nil {
+		return err
+	}
+	return toI18nError(tm.SetWorkers(strings.TrimSpace(queue), workers))
+}
+
+// toI18nError 把任务管理器的错误转换为 i18n 业务错误
+func toI18nError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, taskmanager.ErrQueueNotFound):
+		return errs.New("error.task_queue_not_found")
+	case errors.Is(err, taskmanager.ErrJobNotFound):
+		return errs.New("error.task_job_not_found")
+	case errors.Is(err, taskmanager.ErrJobRunning):
+		return errs.New("error.task_job_running")
+	case errors.Is(err, taskmanager.ErrJobNotRetryable):
+		return errs.New("error.task_job_not_retryable")
+	default:
+		return errs.Wrap("error.task_action_failed", err)
+	}
+}
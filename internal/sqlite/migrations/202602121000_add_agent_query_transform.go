@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+-- 检索前的查询改写配置（query rewrite / multi-query / HyDE）
+alter table agents add column query_rewrite_enabled boolean not null default false;
+alter table agents add column multi_query_enabled boolean not null default false;
+alter table agents add column hyde_enabled boolean not null default false;
+-- 查询改写所用模型（为空时使用会话当前模型）
+alter table agents add column query_transform_provider_id varchar(64) not null default '';
+alter table agents add column query_transform_model_id varchar(128) not null default '';
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			// SQLite does not support dropping columns directly, would need to recreate table
+			// For now, we just leave the columns in the rollback case
+			return nil
+		},
+	)
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+-- 上下文增强：为每个分段生成上下文前缀的 LLM（为空表示不启用）
+alter table library add column context_llm_provider_id varchar(64) not null default '';
+alter table library add column context_llm_model_id varchar(128) not null default '';
+
+-- 分段的上下文前缀（与原文分开存储，仅用于向量化和分词，展示时使用原文）
+alter table document_nodes add column context_prefix text not null default '';
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			// SQLite does not support dropping columns directly, would need to recreate table
+			// For now, we just leave the columns in the rollback case
+			return nil
+		},
+	)
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+-- 分段对应的页码范围（PDF 等分页文档，从 1 开始；0 表示无页码）
+alter table document_nodes add column page_start integer not null default 0;
+alter table document_nodes add column page_end integer not null default 0;
+
+-- 没有可提取文本的页码（逗号分隔），作为 OCR 候选页
+alter table documents add column ocr_candidate_pages text not null default '';
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			// SQLite does not support dropping columns directly, would need to recreate table
+			// For now, we just leave the columns in the rollback case
+			return nil
+		},
+	)
+}
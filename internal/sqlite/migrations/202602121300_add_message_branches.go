@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+-- 会话树：parent_id 指向上一条消息（用户/助手消息构成树，工具消息挂在产生它的助手消息下；0 表示根）
+alter table messages add column parent_id integer not null default 0;
+create index if not exists idx_messages_parent_id on messages(conversation_id, parent_id);
+
+-- 当前激活分支的叶子消息（0 表示使用最新的消息）
+alter table conversations add column active_leaf_id integer not null default 0;
+
+-- 回填已有数据：历史会话都是线性的
+update messages set parent_id = coalesce((
+	select max(p.id) from messages p
+	where p.conversation_id = messages.conversation_id and p.id < messages.id and p.role != 'tool'
+), 0) where role != 'tool';
+
+update messages set parent_id = coalesce((
+	select max(p.id) from messages p
+	where p.conversation_id = messages.conversation_id and p.id < messages.id and p.role = 'assistant'
+), 0) where role = 'tool';
+
+update conversations set active_leaf_id = coalesce((
+	select max(m.id) from messages m
+	where m.conversation_id = conversations.id and m.role != 'tool'
+), 0);
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			// SQLite does not support dropping columns directly, would need to recreate table
+			// For now, we just leave the columns in the rollback case
+			return nil
+		},
+	)
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+-- 助手回复耗时（毫秒），用于对比同一轮对话的不同模型回答
+alter table messages add column latency_ms integer not null default 0;
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			// SQLite does not support dropping columns directly, would need to recreate table
+			// For now, we just leave the columns in the rollback case
+			return nil
+		},
+	)
+}
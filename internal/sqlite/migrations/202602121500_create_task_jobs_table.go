@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			// 任务执行记录：goqite 只保存待执行的消息，执行状态、重试次数和错误记录在这里
+			sql := `
+create table if not exists task_jobs (
+	id integer primary key autoincrement,
+	created_at datetime not null default current_timestamp,
+	updated_at datetime not null default current_timestamp,
+
+	message_id text not null,
+	queue varchar(64) not null,
+	job_type varchar(64) not null,
+	task_key varchar(255) not null default '',
+	run_id varchar(64) not null default '',
+	payload blob,
+
+	status varchar(16) not null default 'queued',
+	attempts integer not null default 0,
+	last_error text not null default '',
+	started_at datetime,
+	finished_at datetime
+);
+
+create unique index if not exists idx_task_jobs_message_id on task_jobs(message_id);
+create index if not exists idx_task_jobs_queue_status on task_jobs(queue, status);
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			if _, err := db.ExecContext(ctx, `drop table if exists task_jobs`); err != nil {
+				return err
+			}
+			return nil
+		},
+	)
+}
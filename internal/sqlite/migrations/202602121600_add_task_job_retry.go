@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+-- 任务优先级：数值越大越先执行
+alter table goqite add column priority integer not null default 0;
+create index if not exists goqite_queue_priority_created_idx on goqite (queue, priority desc, created);
+
+alter table task_jobs add column priority integer not null default 0;
+-- 失败后等待重试（退避）时的下次执行时间
+alter table task_jobs add column next_run_at datetime;
+
+-- 每次执行失败的记录，用于查看死信任务的失败历史
+create table if not exists task_job_failures (
+	id integer primary key autoincrement,
+	created_at datetime not null default current_timestamp,
+
+	job_id integer not null,
+	attempt integer not null default 0,
+	error text not null default '',
+	retryable boolean not null default true,
+
+	foreign key(job_id) references task_jobs(id) on delete cascade
+);
+
+create index if not exists idx_task_job_failures_job_id on task_job_failures(job_id);
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			// SQLite does not support dropping columns directly, would need to recreate table
+			// For now, we just leave the columns in the rollback case
+			sql := `
+drop table if exists task_job_failures;
+drop index if exists goqite_queue_priority_created_idx;
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+	)
+}
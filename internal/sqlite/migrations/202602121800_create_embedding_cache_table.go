@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			// 向量缓存：key 为 sha256(供应商/模型, 维度, 规范化文本)，按最近使用时间淘汰
+			sql := `
+create table if not exists embedding_cache (
+	key text primary key,
+	model_key varchar(255) not null,
+	dimension integer not null default 0,
+	vector blob not null,
+	size integer not null default 0,
+	hits integer not null default 0,
+	created_at datetime not null default current_timestamp,
+	last_used_at datetime not null default current_timestamp
+);
+
+create index if not exists idx_embedding_cache_last_used_at on embedding_cache(last_used_at);
+create index if not exists idx_embedding_cache_model_key on embedding_cache(model_key);
+
+INSERT OR IGNORE INTO settings (key, value, type, category, description, created_at, updated_at) VALUES
+('embedding_cache_max_mb', '512', 'string', 'general', 'Maximum size of the embedding cache in MB (0 disables the cache)', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+drop table if exists embedding_cache;
+DELETE FROM settings WHERE key IN ('embedding_cache_max_mb');
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+	)
+}
@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			// 大文件流式入库的断点：每批分段向量化并入库后更新，任务中断后从断点继续
+			sql := `
+create table if not exists document_ingest_checkpoints (
+	document_id integer primary key,
+	created_at datetime not null default current_timestamp,
+	updated_at datetime not null default current_timestamp,
+
+	signature text not null default '',
+	batch_count integer not null default 0,
+	chunk_count integer not null default 0,
+
+	foreign key(document_id) references documents(id) on delete cascade
+);
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+drop table if exists document_ingest_checkpoints;
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+	)
+}
@@ -0,0 +1,88 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strconv"
+
+	"github.com/uptrace/bun"
+)
+
+// docVecDimensionRe 从建表语句中读取向量维度
+var docVecDimensionRe = regexp.MustCompile(`(?i)FLOAT\[(\d+)\]`)
+
+// docVecDimension 当前 doc_vec 的向量维度（读取失败时使用建表时的默认值 1536）
+func docVecDimension(ctx context.Context, tx bun.Tx) int {
+	var ddl sql.NullString
+	if err := tx.QueryRowContext(ctx, `SELECT sql FROM sqlite_master WHERE name = 'doc_vec'`).Scan(&ddl); err != nil || !ddl.Valid {
+		return 1536
+	}
+	m := docVecDimensionRe.FindStringSubmatch(ddl.String)
+	if len(m) < 2 {
+		return 1536
+	}
+	dim, err := strconv.Atoi(m[1])
+	if err != nil || dim <= 0 {
+		return 1536
+	}
+	return dim
+}
+
+// rebuildDocVec 用新的建表语句重建 doc_vec 并保留已有向量
+// vec0 表重命名后无法继续写入，因此先复制到普通表，删除后按原名重建再写回
+func rebuildDocVec(ctx context.Context, db *bun.DB, createSQL func(dim int) string, copySQL, columns string) error {
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		dim := docVecDimension(ctx, tx)
+		stmts := []string{
+			`DROP TABLE IF EXISTS doc_vec_migrate;`,
+			copySQL,
+			`DROP TABLE IF EXISTS doc_vec;`,
+			createSQL(dim),
+			`INSERT INTO doc_vec (` + columns + `) SELECT ` + columns + ` FROM doc_vec_migrate;`,
+			`DROP TABLE doc_vec_migrate;`,
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			// doc_vec 增加 library_id 分区键和 level 元数据列，向量检索在 KNN 内部按知识库/层级过滤
+			// 没有对应节点的向量（历史残留）不再保留
+			return rebuildDocVec(ctx, db,
+				func(dim int) string {
+					return `CREATE VIRTUAL TABLE doc_vec USING vec0(
+	id INTEGER PRIMARY KEY,
+	library_id INTEGER PARTITION KEY,
+	level INTEGER,
+	content FLOAT[` + strconv.Itoa(dim) + `]
+);`
+				},
+				`CREATE TABLE doc_vec_migrate AS
+SELECT v.id AS id, n.library_id AS library_id, n.level AS level, v.content AS content
+FROM doc_vec v
+INNER JOIN document_nodes n ON n.id = v.id;`,
+				"id, library_id, level, content",
+			)
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			return rebuildDocVec(ctx, db,
+				func(dim int) string {
+					return `CREATE VIRTUAL TABLE doc_vec USING vec0(
+	id INTEGER PRIMARY KEY,
+	content FLOAT[` + strconv.Itoa(dim) + `]
+);`
+				},
+				`CREATE TABLE doc_vec_migrate AS SELECT id, content FROM doc_vec;`,
+				"id, content",
+			)
+		},
+	)
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+INSERT OR IGNORE INTO settings (key, value, type, category, description, created_at, updated_at) VALUES
+('maintenance_interval_hours', '0', 'string', 'general', 'Index check interval in hours (0 disables the scheduled check; repair always needs user confirmation)', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+('maintenance_last_run_at', '', 'string', 'general', 'Time of the last scheduled index check', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			if _, err := db.ExecContext(ctx, `
+DELETE FROM settings WHERE key IN ('maintenance_interval_hours', 'maintenance_last_run_at');
+`); err != nil {
+				return err
+			}
+			return nil
+		},
+	)
+}
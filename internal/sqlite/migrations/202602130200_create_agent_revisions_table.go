@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+-- 助手配置的修订历史（只追加），每次修改提示词/参数都会记录一条
+create table if not exists agent_revisions (
+	id integer primary key autoincrement,
+	created_at datetime not null default current_timestamp,
+
+	agent_id integer not null,
+	revision integer not null,
+	action varchar(16) not null default 'update', -- initial / create / update / restore / import
+	restored_from integer not null default 0,     -- action=restore 时恢复的修订号
+	author varchar(128) not null default '',
+	snapshot text not null default '{}',          -- 修订后的完整配置（JSON）
+	changes text not null default '[]',           -- 与上一修订相比的字段差异（JSON）
+
+	foreign key(agent_id) references agents(id) on delete cascade
+);
+
+create unique index if not exists idx_agent_revisions_agent_revision on agent_revisions(agent_id, revision);
+
+-- 助手当前的修订号；已有助手的初始修订在首次修改时补记
+alter table agents add column revision integer not null default 1;
+
+-- 生成该回复时助手的修订号（0 表示未知），用于把回答质量变化追溯到提示词修改
+alter table messages add column agent_revision integer not null default 0;
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			// SQLite does not support dropping columns directly, would need to recreate table
+			// For now, we just leave the columns in the rollback case
+			sql := `
+drop table if exists agent_revisions;
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+	)
+}
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+-- 长期记忆：助手在多个会话之间记住的用户偏好和事实
+create table if not exists agent_memories (
+	id integer primary key autoincrement,
+	created_at datetime not null default current_timestamp,
+	updated_at datetime not null default current_timestamp,
+
+	agent_id integer,                              -- 为空表示用户级记忆（所有助手共享）
+	content text not null,
+	content_tokens text not null default '',       -- 预分词后的 token 文本（用于 FTS）
+	source varchar(16) not null default 'manual',  -- manual / tool / extracted
+	conversation_id integer not null default 0,    -- 产生该记忆的会话（0 表示手动添加）
+
+	embedding blob,                                -- float32 小端序向量
+	embedding_model text not null default '',      -- 生成向量的 供应商/模型:维度，嵌入设置变化后重新生成
+
+	foreign key(agent_id) references agents(id) on delete cascade
+);
+create index if not exists idx_agent_memories_agent_id on agent_memories(agent_id);
+
+-- 记忆全文检索（contentless FTS），agent_id 为 0 表示用户级记忆
+CREATE VIRTUAL TABLE IF NOT EXISTS memory_fts USING fts5(
+	tokens,
+	agent_id,
+	content='',
+	tokenize='unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS agent_memories_ai AFTER INSERT ON agent_memories BEGIN
+  INSERT INTO memory_fts(rowid, tokens, agent_id)
+    VALUES (new.id, new.content_tokens, coalesce(new.agent_id, 0));
+END;
+
+CREATE TRIGGER IF NOT EXISTS agent_memories_ad AFTER DELETE ON agent_memories BEGIN
+  INSERT INTO memory_fts(memory_fts, rowid, tokens, agent_id)
+    VALUES('delete', old.id, old.content_tokens, coalesce(old.agent_id, 0));
+END;
+
+CREATE TRIGGER IF NOT EXISTS agent_memories_au AFTER UPDATE OF content_tokens, agent_id ON agent_memories BEGIN
+  INSERT INTO memory_fts(memory_fts, rowid, tokens, agent_id)
+    VALUES('delete', old.id, old.content_tokens, coalesce(old.agent_id, 0));
+  INSERT INTO memory_fts(rowid, tokens, agent_id)
+    VALUES (new.id, new.content_tokens, coalesce(new.agent_id, 0));
+END;
+
+-- 是否启用长期记忆，以及每轮对话后是否自动提取记忆
+alter table agents add column memory_enabled boolean not null default false;
+alter table agents add column memory_auto_extract boolean not null default false;
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			// SQLite does not support dropping columns directly, would need to recreate table
+			// For now, we just leave the columns in the rollback case
+			sql := `
+DROP TRIGGER IF EXISTS agent_memories_au;
+DROP TRIGGER IF EXISTS agent_memories_ad;
+DROP TRIGGER IF EXISTS agent_memories_ai;
+DROP TABLE IF EXISTS memory_fts;
+DROP TABLE IF EXISTS agent_memories;
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+	)
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+-- 结构化输出：回答须符合的 JSON Schema，为空表示普通文本回答
+alter table agents add column response_schema text not null default '';
+-- 通过校验的结构化回答（JSON）；未通过校验时记录原因
+alter table messages add column structured_output text not null default '';
+alter table messages add column structured_error text not null default '';
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			// SQLite does not support dropping columns directly, would need to recreate table
+			// For now, we just leave the columns in the rollback case
+			return nil
+		},
+	)
+}
@@ -0,0 +1,81 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+-- 定时任务：按 cron 表达式定时让助手执行一段提示词
+create table if not exists scheduled_jobs (
+	id integer primary key autoincrement,
+	created_at datetime not null default current_timestamp,
+	updated_at datetime not null default current_timestamp,
+
+	name varchar(100) not null,
+	agent_id integer not null,
+	prompt text not null,
+	cron_expr varchar(100) not null,                        -- 5 段 cron（分 时 日 月 周，本地时间）或 @daily 等
+	enabled boolean not null default true,
+
+	conversation_mode varchar(16) not null default 'new',   -- new：每次新建会话 / append：追加到同一会话
+	conversation_id integer not null default 0,             -- append 模式使用的会话（0 表示首次运行时创建）
+	library_ids text not null default '[]',                 -- 新建会话关联的知识库，为空时继承助手默认知识库
+
+	notify_mode varchar(16) not null default 'always',      -- always / changed（结果变化时）/ never
+	webhook_url text not null default '',                   -- 非空时把运行结果 POST 到该地址
+	missed_policy varchar(16) not null default 'run_once',  -- 应用关闭期间错过的运行：run_once 补跑一次 / skip 跳过
+
+	next_run_at datetime,
+	last_run_at datetime,
+
+	foreign key(agent_id) references agents(id) on delete cascade
+);
+create index if not exists idx_scheduled_jobs_agent_id on scheduled_jobs(agent_id);
+create index if not exists idx_scheduled_jobs_next_run_at on scheduled_jobs(enabled, next_run_at);
+
+-- 定时任务的运行记录
+create table if not exists scheduled_runs (
+	id integer primary key autoincrement,
+	created_at datetime not null default current_timestamp,
+	updated_at datetime not null default current_timestamp,
+
+	job_id integer not null,
+	trigger_type varchar(16) not null,                      -- schedule / missed / manual
+	status varchar(16) not null,                            -- queued / running / succeeded / failed / skipped / cancelled
+	scheduled_at datetime not null,
+	started_at datetime,
+	finished_at datetime,
+
+	conversation_id integer not null default 0,
+	message_id integer not null default 0,
+	output text not null default '',                        -- 助手回答（用于通知和变化检测）
+	error text not null default '',
+	missed_count integer not null default 0,                -- 本次运行之前错过的运行次数
+	webhook_status text not null default '',
+
+	foreign key(job_id) references scheduled_jobs(id) on delete cascade
+);
+create index if not exists idx_scheduled_runs_job_id on scheduled_runs(job_id, id);
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+drop table if exists scheduled_runs;
+drop table if exists scheduled_jobs;
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+	)
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(
+		func(ctx context.Context, db *bun.DB) error {
+			sql := `
+-- 工作区沙箱：文件工具只能访问工作区（execute 的工作目录），为空表示用户主目录
+alter table agents add column workspace_dir text not null default '';
+-- 额外的只读路径（JSON 数组）：文件工具可以读取但不能修改
+alter table agents add column read_only_paths text not null default '[]';
+-- 命令限制方式：blocklist 拒绝包含危险片段的命令 / allowlist 只允许 allowed_commands 中的程序
+alter table agents add column command_mode varchar(16) not null default 'blocklist';
+alter table agents add column allowed_commands text not null default '[]';
+-- 会话级工作区，为空时使用助手的工作区
+alter table conversations add column workspace_dir text not null default '';
+`
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			return nil
+		},
+		func(ctx context.Context, db *bun.DB) error {
+			// SQLite does not support dropping columns directly, would need to recreate table
+			// For now, we just leave the columns in the rollback case
+			return nil
+		},
+	)
+}
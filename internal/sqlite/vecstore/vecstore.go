@@ -0,0 +1,286 @@
+// Package vecstore 封装向量表 doc_vec 的建表、写入、检索和量化转换。
+//
+// doc_vec 是 sqlite-vec 的 vec0 虚拟表：library_id 为分区键、level 为元数据列，按知识库和层级的过滤在 KNN 内部完成。
+// 向量以 float32 小端序二进制写入；开启量化时 content 列存 int8 / bit 向量用于 KNN 粗排，
+// 辅助列 content_full 保留 float32 原始向量，用于对候选结果按全精度重新打分。
+// 量化方式由整张表的列类型决定，因此对所有知识库统一生效，不支持按知识库单独设置。
+package vecstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// Table 向量表名
+const Table = "doc_vec"
+
+// maxK sqlite-vec 单次 KNN 查询允许的最大 k
+const maxK = 4096
+
+// Quantization 向量量化方式
+type Quantization string
+
+const (
+	QuantizationNone   Quantization = "none"   // float32，不量化
+	QuantizationInt8   Quantization = "int8"   // 每维 1 字节（约为 float32 的 1/4）
+	QuantizationBinary Quantization = "binary" // 每维 1 bit（约为 float32 的 1/32），维度须为 8 的倍数
+)
+
+// DefaultDimension doc_vec 建表时的默认维度
+const DefaultDimension = 1536
+
+// ParseQuantization 解析量化方式，空字符串视为不量化
+func ParseQuantization(s string) (Quantization, bool) {
+	switch Quantization(strings.ToLower(strings.TrimSpace(s))) {
+	case "", QuantizationNone:
+		return QuantizationNone, true
+	case QuantizationInt8:
+		return QuantizationInt8, true
+	case QuantizationBinary:
+		return QuantizationBinary, true
+	}
+	return "", false
+}
+
+// Validate 检查量化方式是否适用于该维度
+func (q Quantization) Validate(dimension int) error {
+	if q == QuantizationBinary && dimension%8 != 0 {
+		return fmt.Errorf("binary quantization requires a dimension divisible by 8, got %d", dimension)
+	}
+	return nil
+}
+
+// oversample 量化检索时取回的候选倍数，候选按全精度重新打分后取前 k 个
+func (q Quantization) oversample() int {
+	switch q {
+	case QuantizationInt8:
+		return 4
+	case QuantizationBinary:
+		return 10
+	default:
+		return 1
+	}
+}
+
+// quantizeExpr 写入 / 查询时把 float32 向量转换为 content 列类型的 SQL 表达式
+func (q Quantization) quantizeExpr() string {
+	switch q {
+	case QuantizationInt8:
+		return "vec_quantize_int8(?, 'unit')"
+	case QuantizationBinary:
+		return "vec_quantize_binary(?)"
+	default:
+		return "?"
+	}
+}
+
+// TableSQL 返回创建 doc_vec 的语句
+func TableSQL(dimension int, q Quantization) string {
+	switch q {
+	case QuantizationInt8:
+		return fmt.Sprintf(
+			`CREATE VIRTUAL TABLE IF NOT EXISTS doc_vec USING vec0(id INTEGER PRIMARY KEY, library_id INTEGER PARTITION KEY, level INTEGER, content INT8[%d], +content_full BLOB);`,
+			dimension,
+		)
+	case QuantizationBinary:
+		return fmt.Sprintf(
+			`CREATE VIRTUAL TABLE IF NOT EXISTS doc_vec USING vec0(id INTEGER PRIMARY KEY, library_id INTEGER PARTITION KEY, level INTEGER, content BIT[%d], +content_full BLOB);`,
+			dimension,
+		)
+	default:
+		return fmt.Sprintf(
+			`CREATE VIRTUAL TABLE IF NOT EXISTS doc_vec USING vec0(id INTEGER PRIMARY KEY, library_id INTEGER PARTITION KEY, level INTEGER, content FLOAT[%d]);`,
+			dimension,
+		)
+	}
+}
+
+var (
+	dimensionRe = regexp.MustCompile(`(?i)(?:FLOAT|INT8|BIT)\[(\d+)\]`)
+	int8Re      = regexp.MustCompile(`(?i)\bcontent\s+INT8\[`)
+	bitRe       = regexp.MustCompile(`(?i)\bcontent\s+BIT\[`)
+)
+
+// Schema 读取当前 doc_vec 的量化方式和维度（以建表语句为准）
+func Schema(ctx context.Context, db bun.IDB) (Quantization, int, error) {
+	var ddl sql.NullString
+	if err := db.QueryRowContext(ctx, `SELECT sql FROM sqlite_master WHERE name = ?`, Table).Scan(&ddl); err != nil {
+		return "", 0, err
+	}
+	q := QuantizationNone
+	switch {
+	case int8Re.MatchString(ddl.String):
+		q = QuantizationInt8
+	case bitRe.MatchString(ddl.String):
+		q = QuantizationBinary
+	}
+	dimension := DefaultDimension
+	if m := dimensionRe.FindStringSubmatch(ddl.String); len(m) == 2 {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			dimension = n
+		}
+	}
+	return q, dimension, nil
+}
+
+// Encode 把向量编码为 float32 小端序二进制（sqlite-vec 的向量格式）
+func Encode(vec []float64) []byte {
+	buf := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(v)))
+	}
+	return buf
+}
+
+// Decode 解码 float32 小端序二进制，长度不合法时返回 nil
+func Decode(buf []byte) []float64 {
+	if len(buf)%4 != 0 {
+		return nil
+	}
+	vec := make([]float64, len(buf)/4)
+	for i := range vec {
+		vec[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:])))
+	}
+	return vec
+}
+
+// Store 写入（或覆盖）一个节点的向量
+// vec0 不支持更新量化列，覆盖统一按先删后插处理
+func Store(ctx context.Context, db bun.IDB, q Quantization, nodeID, libraryID int64, level int, vec []float64) error {
+	if _, err := db.NewRaw("DELETE FROM doc_vec WHERE id = ?", nodeID).Exec(ctx); err != nil {
+		return err
+	}
+	blob := Encode(vec)
+	if q == QuantizationNone {
+		_, err := db.NewRaw(
+			"INSERT INTO doc_vec (id, library_id, level, content) VALUES (?, ?, ?, ?)",
+			nodeID, libraryID, level, blob,
+		).Exec(ctx)
+		return err
+	}
+	_, err := db.NewRaw(
+		"INSERT INTO doc_vec (id, library_id, level, content, content_full) VALUES (?, ?, ?, "+q.quantizeExpr()+", ?)",
+		nodeID, libraryID, level, blob, blob,
+	).Exec(ctx)
+	return err
+}
+
+// Hit 一条检索结果，Distance 为与查询向量的 L2 距离（量化时为全精度重新打分后的距离）
+type Hit struct {
+	ID       int64
+	Distance float64
+}
+
+// Search 在一个知识库内做 KNN 检索，level 为 nil 时不过滤层级
+// 量化时先按量化向量取 k × 倍数个候选，再用 content_full 计算全精度距离取前 k 个
+func Search(ctx context.Context, db bun.IDB, q Quantization, libraryID int64, level *int, query []float64, k int) ([]Hit, error) {
+	if k <= 0 {
+		return nil, nil
+	}
+	blob := Encode(query)
+
+	cols := "id, distance"
+	if q != QuantizationNone {
+		cols += ", content_full"
+	}
+	sqlStr := "SELECT " + cols + " FROM doc_vec WHERE content MATCH " + q.quantizeExpr() + " AND k = ? AND library_id = ?"
+	args := []any{blob, min(k*q.oversample(), maxK), libraryID}
+	if level != nil {
+		sqlStr += " AND level = ?"
+		args = append(args, *level)
+	}
+
+	type row struct {
+		ID          int64   `bun:"id"`
+		Distance    float64 `bun:"distance"`
+		ContentFull []byte  `bun:"content_full"`
+	}
+	var rows []row
+	if err := db.NewRaw(sqlStr, args...).Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, 0, len(rows))
+	for _, r := range rows {
+		h := Hit{ID: r.ID, Distance: r.Distance}
+		if q != QuantizationNone {
+			full := Decode(r.ContentFull)
+			if len(full) != len(query) {
+				continue
+			}
+			h.Distance = l2Distance(query, full)
+		}
+		hits = append(hits, h)
+	}
+	if q != QuantizationNone {
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].Distance < hits[j].Distance })
+	}
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits, nil
+}
+
+// l2Distance 与 sqlite-vec float 向量的默认距离一致（float32 精度）
+func l2Distance(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(float32(a[i])) - float64(float32(b[i]))
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// Convert 按新的量化方式重建 doc_vec，已有向量直接转换，不需要重新调用嵌入接口
+// 全精度向量来自 content（未量化）或 content_full（已量化），转换在一个事务中完成
+func Convert(ctx context.Context, db *bun.DB, target Quantization) error {
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		current, dimension, err := Schema(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if current == target {
+			return nil
+		}
+		if err := target.Validate(dimension); err != nil {
+			return err
+		}
+
+		source := "content"
+		if current != QuantizationNone {
+			source = "content_full"
+		}
+		stmts := []string{
+			`DROP TABLE IF EXISTS doc_vec_convert;`,
+			`CREATE TABLE doc_vec_convert AS SELECT id, library_id, level, ` + source + ` AS content FROM doc_vec;`,
+			// vec0 表重命名后无法继续写入，删除后按原名重建
+			`DROP TABLE doc_vec;`,
+			TableSQL(dimension, target),
+		}
+		if target == QuantizationNone {
+			stmts = append(stmts, `INSERT INTO doc_vec (id, library_id, level, content) SELECT id, library_id, level, content FROM doc_vec_convert;`)
+		} else {
+			stmts = append(stmts, strings.Replace(
+				`INSERT INTO doc_vec (id, library_id, level, content, content_full) SELECT id, library_id, level, EXPR, content FROM doc_vec_convert;`,
+				"EXPR", strings.Replace(target.quantizeExpr(), "?", "content", 1), 1,
+			))
+		}
+		stmts = append(stmts, `DROP TABLE doc_vec_convert;`)
+
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,180 @@
+package vecstore
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+)
+
+// newTestDB 创建指定维度和量化方式的 doc_vec
+func newTestDB(t *testing.T, dimension int, q Quantization) *bun.DB {
+	t.Helper()
+	sqlite_vec.Auto()
+	sqlDB, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := bun.NewDB(sqlDB, sqlitedialect.New())
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(TableSQL(dimension, q)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testVectors 每个节点在自己的坐标轴上为 1，其余维度为很小的负数，量化为 bit 后也能区分最近邻
+func testVectors(dimension int) map[int64][]float64 {
+	vecs := make(map[int64][]float64, dimension)
+	for i := 0; i < dimension; i++ {
+		v := make([]float64, dimension)
+		for j := range v {
+			v[j] = -0.01 * float64(j+1)
+		}
+		v[i] = 1
+		vecs[int64(i+1)] = v
+	}
+	return vecs
+}
+
+// fullVectors 读取每个节点的全精度向量（未量化时来自 content，量化时来自 content_full）
+func fullVectors(t *testing.T, db *bun.DB) map[int64][]float64 {
+	t.Helper()
+	ctx := context.Background()
+	q, _, err := Schema(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := "content"
+	if q != QuantizationNone {
+		col = "content_full"
+	}
+	rows, err := db.QueryContext(ctx, "SELECT id, "+col+" FROM doc_vec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	vecs := make(map[int64][]float64)
+	for rows.Next() {
+		var id int64
+		var blob []byte
+		if err := rows.Scan(&id, &blob); err != nil {
+			t.Fatal(err)
+		}
+		vecs[id] = Decode(blob)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return vecs
+}
+
+func assertVectors(t *testing.T, got, want map[int64][]float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d vectors, want %d", len(got), len(want))
+	}
+	for id, w := range want {
+		g := got[id]
+		if len(g) != len(w) {
+			t.Fatalf("node %d: got %d dimensions, want %d", id, len(g), len(w))
+		}
+		for i := range w {
+			if float32(g[i]) != float32(w[i]) {
+				t.Fatalf("node %d dimension %d = %v, want %v", id, i, g[i], w[i])
+			}
+		}
+	}
+}
+
+// TestConvert 依次转换 none → int8 → binary → none：每一步列类型随之改变，全精度向量原样保留，检索仍能找到最近邻
+func TestConvert(t *testing.T) {
+	const dimension = 16
+	ctx := context.Background()
+	db := newTestDB(t, dimension, QuantizationNone)
+	vecs := testVectors(dimension)
+	for id, v := range vecs {
+		if err := Store(ctx, db, QuantizationNone, id, 1, 0, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, target := range []Quantization{QuantizationInt8, QuantizationBinary, QuantizationNone} {
+		t.Run(string(target), func(t *testing.T) {
+			if err := Convert(ctx, db, target); err != nil {
+				t.Fatal(err)
+			}
+			q, dim, err := Schema(ctx, db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q != target || dim != dimension {
+				t.Fatalf("schema = %s[%d], want %s[%d]", q, dim, target, dimension)
+			}
+			assertVectors(t, fullVectors(t, db), vecs)
+
+			for id, v := range vecs {
+				hits, err := Search(ctx, db, q, 1, nil, v, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(hits) != 1 || hits[0].ID != id {
+					t.Fatalf("nearest neighbour of node %d = %v", id, hits)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertToCurrentQuantizationIsNoop(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, 8, QuantizationInt8)
+	vecs := testVectors(8)
+	for id, v := range vecs {
+		if err := Store(ctx, db, QuantizationInt8, id, 1, 0, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Convert(ctx, db, QuantizationInt8); err != nil {
+		t.Fatal(err)
+	}
+	if q, _, err := Schema(ctx, db); err != nil || q != QuantizationInt8 {
+		t.Fatalf("schema = %s, %v", q, err)
+	}
+	assertVectors(t, fullVectors(t, db), vecs)
+}
+
+// TestConvertFailureKeepsTable 转换失败时 doc_vec 保持原来的列类型和数据
+func TestConvertFailureKeepsTable(t *testing.T) {
+	const dimension = 12 // 不是 8 的倍数，不支持 binary
+	ctx := context.Background()
+	db := newTestDB(t, dimension, QuantizationInt8)
+	vecs := testVectors(dimension)
+	for id, v := range vecs {
+		if err := Store(ctx, db, QuantizationInt8, id, 1, 0, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Convert(ctx, db, QuantizationBinary); err == nil {
+		t.Fatal("expected an error converting a 12-dimensional table to binary")
+	}
+	if q, dim, err := Schema(ctx, db); err != nil || q != QuantizationInt8 || dim != dimension {
+		t.Fatalf("schema = %s[%d], %v; want int8[%d]", q, dim, err, dimension)
+	}
+	assertVectors(t, fullVectors(t, db), vecs)
+
+	var leftovers int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE name = 'doc_vec_convert'").Scan(&leftovers); err != nil {
+		t.Fatal(err)
+	}
+	if leftovers != 0 {
+		t.Fatal("doc_vec_convert was left behind")
+	}
+}
@@ -0,0 +1,475 @@
+package taskmanager
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"maragu.dev/goqite"
+)
+
+// 任务状态
+const (
+	JobStatusQueued    = "queued"    // 等待执行（含失败后等待重试）
+	JobStatusRunning   = "running"   // 正在执行
+	JobStatusSucceeded = "succeeded" // 执行成功
+	JobStatusFailed    = "failed"    // 重试次数用尽或错误不可重试（死信）
+	JobStatusCancelled = "cancelled" // 已取消/被新任务替换
+)
+
+// 已结束任务的保留时间，超过后在启动时清理
+const finishedJobRetention = 7 * 24 * time.Hour
+
+var (
+	ErrQueueNotFound   = errors.New("task queue not found")
+	ErrJobNotFound     = errors.New("task job not found")
+	ErrJobRunning      = errors.New("task job is running")
+	ErrJobNotRetryable = errors.New("task job is not retryable")
+)
+
+// JobRecord 任务执行记录
+type JobRecord struct {
+	ID         int64      `json:"id"`
+	Queue      string     `json:"queue"`
+	JobType    string     `json:"job_type"`
+	TaskKey    string     `json:"task_key"`
+	RunID      string     `json:"run_id"`
+	Priority   int        `json:"priority"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	LastError  string     `json:"last_error"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"` // 等待重试时的下次执行时间
+}
+
+// JobFailure 任务单次执行失败的记录
+type JobFailure struct {
+	ID        int64     `json:"id"`
+	JobID     int64     `json:"job_id"`
+	Attempt   int       `json:"attempt"`
+	Error     string    `json:"error"`
+	Retryable bool      `json:"retryable"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DeadLetter 死信任务：重试用尽或不可重试的失败任务及其失败历史
+type DeadLetter struct {
+	Job      JobRecord    `json:"job"`
+	Failures []JobFailure `json:"failures"`
+}
+
+// JobFilter 任务查询条件（空值表示不过滤）
+type JobFilter struct {
+	Queue  string
+	Status string
+	Limit  int
+	Offset int
+}
+
+// QueueStatus 队列运行状态与各状态任务数量
+type QueueStatus struct {
+	Name      string `json:"name"`
+	Workers   int    `json:"workers"`
+	Paused    bool   `json:"paused"`
+	Queued    int    `json:"queued"`
+	Running   int    `json:"running"`
+	Failed    int    `json:"failed"`
+	Succeeded int    `json:"succeeded"`
+	Cancelled int    `json:"cancelled"`
+}
+
+// recordJobQueued 新任务入队时写入执行记录
+func (tm *TaskManager) recordJobQueued(ctx context.Context, messageID, queueName, jobType string, priority int, payload JobPayload, body []byte) {
+	if _, err := tm.db.ExecContext(ctx, `
+insert into task_jobs (message_id, queue, job_type, task_key, run_id, payload, priority, status)
+values (?, ?, ?, ?, ?, ?, ?, ?)`,
+		messageID, queueName, jobType, payload.TaskKey, payload.RunID, body, priority, JobStatusQueued); err != nil {
+		tm.app.Logger.Warn("record task job failed", "queue", queueName, "jobType", jobType, "error", err)
+	}
+}
+
+// markJobRunning 标记任务开始执行并返回当前执行次数
+// 升级前入队的任务没有执行记录，这里补一条
+func (tm *TaskManager) markJobRunning(queueName, messageID string, jm jobMessage) int {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(tm.ctx), 3*time.Second)
+	defer cancel()
+
+	var payload JobPayload
+	_ = json.Unmarshal(jm.Message, &payload)
+	body, _ := encodeJobMessage(jm.Name, jm.Message)
+
+	var attempts int
+	err := tm.db.QueryRowContext(ctx, `
+insert into task_jobs (message_id, queue, job_type, task_key, run_id, payload, status, attempts, started_at)
+values (?, ?, ?, ?, ?, ?, ?, 1, current_timestamp)
+on conflict(message_id) do update set
+	status = excluded.status,
+	attempts = task_jobs.attempts + 1,
+	started_at = current_timestamp,
+	next_run_at = null,
+	updated_at = current_timestamp
+returning attempts`,
+		messageID, queueName, jm.Name, payload.TaskKey, payload.RunID, body, JobStatusRunning).Scan(&attempts)
+	if err != nil {
+		tm.app.Logger.Warn("mark task job running failed", "queue", queueName, "id", messageID, "error", err)
+		return 1
+	}
+	return attempts
+}
+
+// recordJobRetry 任务失败但还会重试：记录错误并回到等待状态
+// nextRunAt 为零值表示立即可以执行（例如被应用退出打断）
+func (tm *TaskManager) recordJobRetry(messageID string, cause error, nextRunAt time.Time) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(tm.ctx), 3*time.Second)
+	defer cancel()
+
+	next := sql.NullTime{Time: nextRunAt.UTC(), Valid: !nextRunAt.IsZero()}
+	if _, err := tm.db.ExecContext(ctx, `
+update task_jobs set status = ?, last_error = ?, next_run_at = ?, updated_at = current_timestamp
+where message_id = ?`, JobStatusQueued, errorText(cause), next, messageID); err != nil {
+		tm.app.Logger.Warn("record task job retry failed", "id", messageID, "error", err)
+	}
+}
+
+// recordJobFailure 记录一次执行失败，作为死信的失败历史
+func (tm *TaskManager) recordJobFailure(messageID string, attempt int, cause error, retryable bool) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(tm.ctx), 3*time.Second)
+	defer cancel()
+
+	if _, err := tm.db.ExecContext(ctx, `
+insert into task_job_failures (job_id, attempt, error, retryable)
+select id, ?, ?, ? from task_jobs where message_id = ?`,
+		attempt, errorText(cause), retryable, messageID); err != nil {
+		tm.app.Logger.Warn("record task job failure failed", "id", messageID, "error", err)
+	}
+}
+
+// recordJobFinished 写入任务最终状态
+func (tm *TaskManager) recordJobFinished(ctx context.Context, messageID, status string, cause error) {
+	query := `
+update task_jobs set status = ?, finished_at = current_timestamp, updated_at = current_timestamp
+where message_id = ?`
+	args := []any{status, messageID}
+	if cause != nil {
+		query = `
+update task_jobs set status = ?, last_error = ?, finished_at = current_timestamp, updated_at = current_timestamp
+where message_id = ?`
+		args = []any{status, errorText(cause), messageID}
+	}
+	if _, err := tm.db.ExecContext(ctx, query, args...); err != nil {
+		tm.app.Logger.Warn("record task job result failed", "id", messageID, "error", err)
+	}
+}
+
+// recoverJobRecords 启动时整理执行记录：上次退出时“执行中”的任务会被重新执行，清理过期的已结束记录
+func (tm *TaskManager) recoverJobRecords() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := tm.db.ExecContext(ctx, `
+update task_jobs set status = ?, updated_at = current_timestamp where status = ?`,
+		JobStatusQueued, JobStatusRunning); err != nil {
+		tm.app.Logger.Warn("reset running task jobs failed", "error", err)
+	}
+
+	cutoff := time.Now().UTC().Add(-finishedJobRetention).Format("2006-01-02 15:04:05")
+	if _, err := tm.db.ExecContext(ctx, `
+delete from task_jobs where status in (?, ?) and finished_at < ?`,
+		JobStatusSucceeded, JobStatusCancelled, cutoff); err != nil {
+		tm.app.Logger.Warn("prune task jobs failed", "error", err)
+	}
+	if _, err := tm.db.ExecContext(ctx, `
+delete from task_job_failures where job_id not in (select id from task_jobs)`); err != nil {
+		tm.app.Logger.Warn("prune task job failures failed", "error", err)
+	}
+}
+
+// ListJobs 按条件列出任务执行记录（最新的在前）
+func (tm *TaskManager) ListJobs(ctx context.Context, filter JobFilter) ([]JobRecord, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if filter.Queue != "" {
+		where = append(where, "queue = ?")
+		args = append(args, filter.Queue)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	query := `select id, queue, job_type, task_key, run_id, priority, status, attempts, last_error,
+	created_at, updated_at, started_at, finished_at, next_run_at from task_jobs`
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	query += " order by id desc limit ? offset ?"
+	args = append(args, limit, max(filter.Offset, 0))
+
+	rows, err := tm.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]JobRecord, 0)
+	for rows.Next() {
+		var (
+			r                       JobRecord
+			started, finished, next sql.NullTime
+		)
+		if err := rows.Scan(&r.ID, &r.Queue, &r.JobType, &r.TaskKey, &r.RunID, &r.Priority, &r.Status, &r.Attempts, &r.LastError,
+			&r.CreatedAt, &r.UpdatedAt, &started, &finished, &next); err != nil {
+			return nil, err
+		}
+		if started.Valid {
+			r.StartedAt = &started.Time
+		}
+		if finished.Valid {
+			r.FinishedAt = &finished.Time
+		}
+		if next.Valid {
+			r.NextRunAt = &next.Time
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// JobFailures 返回任务的失败历史（按时间顺序）
+func (tm *TaskManager) JobFailures(ctx context.Context, jobID int64) ([]JobFailure, error) {
+	rows, err := tm.db.QueryContext(ctx, `
+select id, job_id, attempt, error, retryable, created_at from task_job_failures
+where job_id = ? order by id asc`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]JobFailure, 0)
+	for rows.Next() {
+		var f JobFailure
+		if err := rows.Scan(&f.ID, &f.JobID, &f.Attempt, &f.Error, &f.Retryable, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// ListDeadLetters 列出死信任务及其失败历史（filter.Status 会被忽略）
+func (tm *TaskManager) ListDeadLetters(ctx context.Context, filter JobFilter) ([]DeadLetter, error) {
+	filter.Status = JobStatusFailed
+	jobs, err := tm.ListJobs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]DeadLetter, 0, len(jobs))
+	for _, job := range jobs {
+		failures, err := tm.JobFailures(ctx, job.ID)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, DeadLetter{Job: job, Failures: failures})
+	}
+	return out, nil
+}
+
+// QueueStatuses 返回所有队列的运行状态和任务数量
+func (tm *TaskManager) QueueStatuses(ctx context.Context) ([]QueueStatus, error) {
+	byName := make(map[string]*QueueStatus, len(tm.queues))
+	out := make([]QueueStatus, 0, len(tm.queues))
+	for _, name := range tm.queueNames() {
+		q := tm.queues[name]
+		out = append(out, QueueStatus{
+			Name:    name,
+			Workers: int(q.workers.Load()),
+			Paused:  q.paused.Load(),
+		})
+	}
+	for i := range out {
+		byName[out[i].Name] = &out[i]
+	}
+
+	rows, err := tm.db.QueryContext(ctx, `select queue, status, count(*) from task_jobs group by queue, status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			queue, status string
+			count         int
+		)
+		if err := rows.Scan(&queue, &status, &count); err != nil {
+			return nil, err
+		}
+		qs, ok := byName[queue]
+		if !ok {
+			continue
+		}
+		switch status {
+		case JobStatusQueued:
+			qs.Queued = count
+		case JobStatusRunning:
+			qs.Running = count
+		case JobStatusFailed:
+			qs.Failed = count
+		case JobStatusSucceeded:
+			qs.Succeeded = count
+		case JobStatusCancelled:
+			qs.Cancelled = count
+		}
+	}
+	return out, rows.Err()
+}
+
+type jobRow struct {
+	messageID string
+	queue     string
+	jobType   string
+	taskKey   string
+	runID     string
+	status    string
+	priority  int
+	payload   []byte
+}
+
+func (tm *TaskManager) getJobRow(ctx context.Context, id int64) (*jobRow, error) {
+	var r jobRow
+	err := tm.db.QueryRowContext(ctx, `
+select message_id, queue, job_type, task_key, run_id, status, priority, payload from task_jobs where id = ?`, id).
+		Scan(&r.messageID, &r.queue, &r.jobType, &r.taskKey, &r.runID, &r.status, &r.priority, &r.payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// RetryJob 重新执行失败或已取消的任务（重置执行次数，保留失败历史）
+func (tm *TaskManager) RetryJob(ctx context.Context, id int64) error {
+	r, err := tm.getJobRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	if r.status != JobStatusFailed && r.status != JobStatusCancelled {
+		return ErrJobNotRetryable
+	}
+	q, ok := tm.queues[r.queue]
+	if !ok {
+		return ErrQueueNotFound
+	}
+	if len(r.payload) == 0 {
+		return ErrJobNotRetryable
+	}
+
+	// 旧消息可能仍在 goqite 中（例如重试次数用尽时删除失败），先删除再重新入队
+	_ = q.queue.Delete(ctx, goqite.ID(r.messageID))
+
+	newID, err := tm.sendMessage(ctx, q, r.payload, r.priority)
+	if err != nil {
+		return err
+	}
+	if _, err := tm.db.ExecContext(ctx, `
+update task_jobs set message_id = ?, status = ?, attempts = 0, last_error = '',
+	started_at = null, finished_at = null, next_run_at = null, updated_at = current_timestamp
+where id = ?`, string(newID), JobStatusQueued, id); err != nil {
+		return err
+	}
+
+	// 没有更新的同 key 任务时，重新登记任务记录（否则处理器会把它当作过期任务跳过）
+	if r.taskKey != "" {
+		tm.mu.Lock()
+		if _, exists := tm.tasks[r.taskKey]; !exists {
+			tm.tasks[r.taskKey] = &TaskInfo{Key: r.taskKey, RunID: r.runID}
+		}
+		tm.mu.Unlock()
+	}
+	return nil
+}
+
+// CancelJob 取消任务：等待中的任务直接出队；执行中的任务标记为取消，由处理器自行停止
+func (tm *TaskManager) CancelJob(ctx context.Context, id int64) error {
+	r, err := tm.getJobRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	switch r.status {
+	case JobStatusRunning:
+		tm.Cancel(r.taskKey)
+		return nil
+	case JobStatusQueued:
+	default:
+		return nil
+	}
+
+	q, ok := tm.queues[r.queue]
+	if !ok {
+		return ErrQueueNotFound
+	}
+	if err := q.queue.Delete(ctx, goqite.ID(r.messageID)); err != nil {
+		return err
+	}
+	tm.forgetTask(r.taskKey, r.runID)
+	tm.recordJobFinished(ctx, r.messageID, JobStatusCancelled, nil)
+	return nil
+}
+
+// DeleteJob 删除任务及其执行记录（执行中的任务不能删除）
+func (tm *TaskManager) DeleteJob(ctx context.Context, id int64) error {
+	r, err := tm.getJobRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	if r.status == JobStatusRunning {
+		return ErrJobRunning
+	}
+	if q, ok := tm.queues[r.queue]; ok {
+		if err := q.queue.Delete(ctx, goqite.ID(r.messageID)); err != nil {
+			return err
+		}
+	}
+	if r.status == JobStatusQueued {
+		tm.forgetTask(r.taskKey, r.runID)
+	}
+	if _, err := tm.db.ExecContext(ctx, `delete from task_job_failures where job_id = ?`, id); err != nil {
+		return err
+	}
+	_, err = tm.db.ExecContext(ctx, `delete from task_jobs where id = ?`, id)
+	return err
+}
+
+// forgetTask 移除出队任务的内存记录（仅当仍是同一次运行时），避免 IsTaskRunning 一直为 true
+func (tm *TaskManager) forgetTask(taskKey, runID string) {
+	if taskKey == "" {
+		return
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if cur, ok := tm.tasks[taskKey]; ok && cur.RunID == runID {
+		delete(tm.tasks, taskKey)
+	}
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
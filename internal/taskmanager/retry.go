@@ -0,0 +1,136 @@
+package taskmanager
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// 任务优先级：数值越大越先执行，同优先级按入队顺序执行
+const (
+	PriorityLow    = -10 // 批量后台任务，例如全库重新向量化
+	PriorityNormal = 0
+	PriorityHigh   = 10 // 用户正在等待结果的任务，例如刚上传的文档
+)
+
+// RetryPolicy 任务重试策略
+type RetryPolicy struct {
+	MaxAttempts    int           // 最多执行次数（含首次执行）
+	InitialBackoff time.Duration // 第一次重试前的等待时间
+	MaxBackoff     time.Duration // 等待时间上限
+	Multiplier     float64       // 每次重试等待时间的增长倍数
+}
+
+// DefaultRetryPolicy 未单独配置的任务类型使用的重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    defaultMaxAttempts,
+	InitialBackoff: 5 * time.Second,
+	MaxBackoff:     5 * time.Minute,
+	Multiplier:     2,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = max(DefaultRetryPolicy.MaxBackoff, p.InitialBackoff)
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	return p
+}
+
+// backoff 第 attempt 次执行失败后，下次执行前的等待时间（指数退避）
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(max(attempt-1, 0)))
+	if d > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(d)
+}
+
+// RetryableError 错误可以自行声明是否值得重试（例如 processor.PhaseError）
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+// permanentError 不可重试的错误：任务直接进入失败（死信）状态
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string   { return e.err.Error() }
+func (e *permanentError) Unwrap() error   { return e.err }
+func (e *permanentError) Retryable() bool { return false }
+
+// Permanent 将错误标记为不可重试
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsRetryable 判断任务错误是否可以重试
+// 错误链中最外层实现 RetryableError 的错误决定结果；未声明的错误默认可重试
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var re RetryableError
+	if errors.As(err, &re) {
+		return re.Retryable()
+	}
+	return true
+}
+
+// attemptKey 任务上下文中保存本次执行信息的 key
+type attemptKey struct{}
+
+// attemptInfo 本次执行是第几次，以及该任务类型最多执行几次
+type attemptInfo struct {
+	attempt     int
+	maxAttempts int
+}
+
+// WillRetry 判断处理器返回 err 后任务是否还会自动重试（ctx 为处理器收到的任务上下文）
+// 处理器可以据此把业务状态标记为“等待重试”而不是“失败”
+func WillRetry(ctx context.Context, err error) bool {
+	a, ok := ctx.Value(attemptKey{}).(attemptInfo)
+	return ok && IsRetryable(err) && a.attempt < a.maxAttempts
+}
+
+// SetRetryPolicy 为指定队列的任务类型设置重试策略
+// 应在初始化时、Start() 之前调用
+func (tm *TaskManager) SetRetryPolicy(queueName, jobType string, policy RetryPolicy) {
+	q, ok := tm.queues[queueName]
+	if !ok {
+		tm.app.Logger.Error("unknown queue for retry policy", "queue", queueName, "jobType", jobType)
+		return
+	}
+	q.policies[jobType] = policy.withDefaults()
+}
+
+// retryPolicy 返回任务类型的重试策略
+func (q *taskQueue) retryPolicy(jobType string) RetryPolicy {
+	if p, ok := q.policies[jobType]; ok {
+		return p
+	}
+	return DefaultRetryPolicy
+}
+
+// maxReceive 消息最多被取走的次数：比最大执行次数多留余量，应用退出打断的执行也会增加接收次数
+func (q *taskQueue) maxReceive() int {
+	n := DefaultRetryPolicy.MaxAttempts
+	for _, p := range q.policies {
+		n = max(n, p.MaxAttempts)
+	}
+	return n + 2
+}
@@ -0,0 +1,318 @@
+package taskmanager
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"maragu.dev/goqite"
+)
+
+const (
+	// defaultMaxAttempts 单个任务最多执行次数，用尽后记为失败
+	defaultMaxAttempts = 3
+	// messageTimeout 消息被取走后的可见性超时，任务运行期间会持续延长
+	messageTimeout = 5 * time.Second
+	// goqiteTimeFormat goqite 表中时间列的格式（按字符串比较）
+	goqiteTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+	// exhaustedSweepInterval 检查接收次数已用尽的消息的间隔
+	exhaustedSweepInterval = 30 * time.Second
+)
+
+// errSkipped 处理器因任务取消/被替换而跳过执行（消息删除，记录为已取消）
+var errSkipped = errors.New("task skipped")
+
+// jobMessage goqite 消息体，与 goqite/jobs 的编码格式保持一致（升级前入队的任务仍可解析）
+type jobMessage struct {
+	Name    string
+	Message []byte
+}
+
+func encodeJobMessage(jobType string, payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(jobMessage{Name: jobType, Message: payload}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeJobMessage(body []byte) (jobMessage, error) {
+	var jm jobMessage
+	err := gob.NewDecoder(bytes.NewReader(body)).Decode(&jm)
+	return jm, err
+}
+
+// handlerFunc 包装后的任务处理器
+type handlerFunc func(ctx context.Context, msg []byte) error
+
+// taskQueue 单个队列：goqite 队列 + 运行状态
+// 与 goqite/jobs.Runner 不同，这里支持暂停/恢复和运行时调整并发数，暂停时正在执行的任务不受影响。
+type taskQueue struct {
+	name     string
+	queue    *goqite.Queue
+	cfg      QueueConfig
+	handlers map[string]handlerFunc
+	policies map[string]RetryPolicy // jobType -> 重试策略
+
+	workers atomic.Int32 // 最大并发数
+	running atomic.Int32 // 正在执行的任务数
+	paused  atomic.Bool
+}
+
+// hasCapacity 是否可以再取一个任务执行
+func (q *taskQueue) hasCapacity() bool {
+	return !q.paused.Load() && q.running.Load() < q.workers.Load()
+}
+
+// sendMessage 写入一条 goqite 消息（goqite.Send 不支持优先级，这里直接插入）
+func (tm *TaskManager) sendMessage(ctx context.Context, q *taskQueue, body []byte, priority int) (goqite.ID, error) {
+	timeout := time.Now().Format(goqiteTimeFormat)
+
+	var id goqite.ID
+	err := tm.db.QueryRowContext(ctx, `
+insert into goqite (queue, body, timeout, priority) values (?, ?, ?, ?) returning id`,
+		q.name, body, timeout, priority).Scan(&id)
+	return id, err
+}
+
+// receiveMessage 取出一条到期的消息：优先级高的先执行，同优先级按入队顺序
+// 与 goqite.Receive 相同，取走后在 messageTimeout 内对其他 worker 不可见
+func (tm *TaskManager) receiveMessage(ctx context.Context, q *taskQueue) (*goqite.Message, error) {
+	now := time.Now()
+
+	var m goqite.Message
+	err := tm.db.QueryRowContext(ctx, `
+update goqite
+set timeout = ?, received = received + 1
+where id = (
+	select id from goqite
+	where queue = ? and ? >= timeout and received < ?
+	order by priority desc, created
+	limit 1
+)
+returning id, body`,
+		now.Add(messageTimeout).Format(goqiteTimeFormat), q.name, now.Format(goqiteTimeFormat), q.maxReceive()).
+		Scan(&m.ID, &m.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// failExhaustedMessages 处理接收次数已用尽的消息（例如每次执行都被应用退出打断）：
+// receiveMessage 不会再取走这类消息，这里删除消息并把任务记为失败（进入死信），可在任务列表中手动重试
+func (tm *TaskManager) failExhaustedMessages(q *taskQueue) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(tm.ctx), 5*time.Second)
+	defer cancel()
+
+	type exhausted struct {
+		id       string
+		body     []byte
+		received int
+	}
+	rows, err := tm.db.QueryContext(ctx, `
+select id, body, received from goqite
+where queue = ? and ? >= timeout and received >= ?`,
+		q.name, time.Now().Format(goqiteTimeFormat), q.maxReceive())
+	if err != nil {
+		tm.app.Logger.Warn("query exhausted jobs failed", "queue", q.name, "error", err)
+		return
+	}
+	var list []exhausted
+	for rows.Next() {
+		var e exhausted
+		if err := rows.Scan(&e.id, &e.body, &e.received); err != nil {
+			tm.app.Logger.Warn("scan exhausted job failed", "queue", q.name, "error", err)
+			continue
+		}
+		list = append(list, e)
+	}
+	rows.Close()
+
+	for _, e := range list {
+		jm, _ := decodeJobMessage(e.body)
+		cause := fmt.Errorf("job was received %d times without finishing", e.received)
+		tm.app.Logger.Warn("job exhausted its receives", "queue", q.name, "jobType", jm.Name, "id", e.id, "received", e.received)
+		tm.recordJobFailure(e.id, e.received, cause, false)
+		tm.finishJob(q, e.id, jm.Name, JobStatusFailed, e.received, cause)
+
+		// 处理器没有运行，不会清理任务的内存记录
+		var payload JobPayload
+		if json.Unmarshal(jm.Message, &payload) == nil {
+			tm.forgetTask(payload.TaskKey, payload.RunID)
+		}
+	}
+}
+
+// run 轮询队列并执行任务，直到 ctx 取消；返回前等待正在执行的任务结束
+func (tm *TaskManager) runQueue(q *taskQueue) {
+	defer tm.wg.Done()
+
+	tm.app.Logger.Info("task queue started", "queue", q.name, "workers", q.workers.Load())
+
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+
+	var lastSweep time.Time
+	for {
+		select {
+		case <-tm.ctx.Done():
+			tm.jobsWG.Wait()
+			tm.app.Logger.Info("task queue stopped", "queue", q.name)
+			return
+		case <-ticker.C:
+		}
+
+		if time.Since(lastSweep) >= exhaustedSweepInterval {
+			lastSweep = time.Now()
+			tm.failExhaustedMessages(q)
+		}
+
+		// 一次轮询尽量填满空闲 worker
+		for q.hasCapacity() {
+			m, err := tm.receiveMessage(tm.ctx, q)
+			if err != nil {
+				if tm.ctx.Err() == nil {
+					tm.app.Logger.Warn("receive job failed", "queue", q.name, "error", err)
+					// 出错时稍等，避免频繁访问数据库
+					time.Sleep(time.Second)
+				}
+				break
+			}
+			if m == nil {
+				break
+			}
+			q.running.Add(1)
+			tm.jobsWG.Add(1)
+			go func() {
+				defer tm.jobsWG.Done()
+				defer q.running.Add(-1)
+				tm.runJob(q, m)
+			}()
+		}
+	}
+}
+
+// runJob 执行单个任务：更新执行记录，运行期间延长消息超时，成功后删除消息
+func (tm *TaskManager) runJob(q *taskQueue, m *goqite.Message) {
+	messageID := string(m.ID)
+
+	jm, err := decodeJobMessage(m.Body)
+	if err != nil {
+		tm.app.Logger.Error("failed to decode job message", "queue", q.name, "id", messageID, "error", err)
+		tm.recordJobFailure(messageID, 0, err, false)
+		tm.finishJob(q, messageID, "", JobStatusFailed, 0, err)
+		return
+	}
+
+	attempts := tm.markJobRunning(q.name, messageID, jm)
+
+	handler, ok := q.handlers[jm.Name]
+	if !ok {
+		err := fmt.Errorf("job type %q not registered", jm.Name)
+		tm.app.Logger.Error("unknown job type", "queue", q.name, "jobType", jm.Name, "id", messageID)
+		tm.recordJobFailure(messageID, attempts, err, false)
+		tm.finishJob(q, messageID, jm.Name, JobStatusFailed, attempts, err)
+		return
+	}
+
+	policy := q.retryPolicy(jm.Name)
+	jobCtx, cancel := context.WithCancel(context.WithValue(tm.ctx, attemptKey{}, attemptInfo{attempt: attempts, maxAttempts: policy.MaxAttempts}))
+	defer cancel()
+
+	// 任务运行期间持续延长消息超时，避免被其他 worker 重复取走
+	extendDone := make(chan struct{})
+	go func() {
+		defer close(extendDone)
+		interval := messageTimeout - messageTimeout/5
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-time.After(interval):
+				if err := q.queue.Extend(jobCtx, m.ID, messageTimeout); err != nil && jobCtx.Err() == nil {
+					tm.app.Logger.Warn("extend job timeout failed", "queue", q.name, "id", messageID, "error", err)
+				}
+			}
+		}
+	}()
+
+	before := time.Now()
+	err = func() (err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				err = fmt.Errorf("panic: %v", rec)
+			}
+		}()
+		return handler(jobCtx, jm.Message)
+	}()
+
+	switch {
+	case err == nil:
+		tm.app.Logger.Info("job done", "queue", q.name, "jobType", jm.Name, "id", messageID, "duration", time.Since(before))
+		tm.finishJob(q, messageID, jm.Name, JobStatusSucceeded, attempts, nil)
+	case tm.ctx.Err() != nil:
+		// 应用退出导致的中断：保留消息，下次启动继续执行
+		tm.app.Logger.Info("job interrupted by shutdown", "queue", q.name, "jobType", jm.Name, "id", messageID)
+		tm.recordJobRetry(messageID, nil, time.Time{})
+	case errors.Is(err, errSkipped):
+		tm.finishJob(q, messageID, jm.Name, JobStatusCancelled, attempts, nil)
+	default:
+		retryable := IsRetryable(err)
+		tm.recordJobFailure(messageID, attempts, err, retryable)
+		if !retryable || attempts >= policy.MaxAttempts {
+			// 进入死信：保留执行记录和失败历史，可在任务列表中查看并手动重试
+			tm.app.Logger.Warn("job failed", "queue", q.name, "jobType", jm.Name, "id", messageID,
+				"attempt", attempts, "retryable", retryable, "error", err)
+			tm.finishJob(q, messageID, jm.Name, JobStatusFailed, attempts, err)
+			return
+		}
+
+		// 消息保留在队列中，退避时间过后重新取走执行
+		cancel()
+		<-extendDone
+		delay := policy.backoff(attempts)
+		tm.app.Logger.Warn("job failed, will retry", "queue", q.name, "jobType", jm.Name, "id", messageID,
+			"attempt", attempts, "retryIn", delay, "error", err)
+		ctx, cancelExtend := context.WithTimeout(context.WithoutCancel(tm.ctx), 3*time.Second)
+		defer cancelExtend()
+		if err := q.queue.Extend(ctx, m.ID, delay); err != nil {
+			tm.app.Logger.Warn("delay job retry failed", "queue", q.name, "id", messageID, "error", err)
+		}
+		tm.recordJobRetry(messageID, err, time.Now().Add(delay))
+		tm.markRetryPending(q, messageID, jm)
+	}
+}
+
+// markRetryPending 记录任务正在等待重试的消息，使 Cancel(taskKey) 能在退避期间直接出队
+func (tm *TaskManager) markRetryPending(q *taskQueue, messageID string, jm jobMessage) {
+	var payload JobPayload
+	if err := json.Unmarshal(jm.Message, &payload); err != nil || payload.TaskKey == "" {
+		return
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if info, ok := tm.tasks[payload.TaskKey]; ok && info.RunID == payload.RunID && !info.Cancelled {
+		info.retry = &pendingRetry{queue: q, messageID: messageID}
+	}
+}
+
+// finishJob 结束任务：删除 goqite 消息并写入最终状态
+func (tm *TaskManager) finishJob(q *taskQueue, messageID, jobType, status string, attempts int, cause error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(tm.ctx), 3*time.Second)
+	defer cancel()
+
+	if err := q.queue.Delete(ctx, goqite.ID(messageID)); err != nil {
+		tm.app.Logger.Warn("delete job message failed", "queue", q.name, "jobType", jobType, "id", messageID, "error", err)
+	}
+	tm.recordJobFinished(ctx, messageID, status, cause)
+}
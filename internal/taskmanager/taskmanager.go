@@ -4,18 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/wailsapp/wails/v3/pkg/application"
 	"maragu.dev/goqite"
-	"maragu.dev/goqite/jobs"
 )
 
 // 预定义队列名称（可按需扩展）
 const (
 	QueueThumbnail = "thumbnail" // 快任务：缩略图生成
 	QueueDocument  = "document"  // 慢任务：文档解析、向量化
+	QueueSchedule  = "schedule"  // 定时任务：助手定时运行
 )
 
 // QueueConfig 单个任务队列的配置
@@ -48,7 +49,8 @@ type TaskManager struct {
 	tasks   map[string]*TaskInfo // taskKey -> TaskInfo（用于取消跟踪）
 	ctx     context.Context
 	cancel  context.CancelFunc
-	wg      sync.WaitGroup
+	wg      sync.WaitGroup // 队列轮询 goroutine
+	jobsWG  sync.WaitGroup // 正在执行的任务
 	stopped bool
 }
 
@@ -57,6 +59,14 @@ type TaskInfo struct {
 	Key       string // 任务唯一标识
 	RunID     string // 运行 ID
 	Cancelled bool   // 是否已取消
+
+	retry *pendingRetry // 失败后等待重试时的消息，Cancel 时直接出队
+}
+
+// pendingRetry 处于退避等待中的任务消息
+type pendingRetry struct {
+	queue     *taskQueue
+	messageID string
 }
 
 // IsCancelled 检查任务是否应该停止
@@ -64,12 +74,6 @@ func (info *TaskInfo) IsCancelled() bool {
 	return info == nil || info.Cancelled
 }
 
-type taskQueue struct {
-	name   string
-	queue  *goqite.Queue
-	runner *jobs.Runner
-}
-
 // JobPayload 序列化的任务数据
 type JobPayload struct {
 	TaskKey string `json:"task_key"`
@@ -109,23 +113,22 @@ func Init(app *application.App, sqlDB *sql.DB, cfg Config) error {
 		for name, qcfg := range cfg.Queues {
 			qcfg = qcfg.withDefaults()
 
+			// 收发消息由 receiveMessage/sendMessage 完成（支持优先级），goqite 用于延长超时和删除消息
 			q := goqite.New(goqite.NewOpts{
-				DB:   sqlDB,
-				Name: name,
-			})
-
-			r := jobs.NewRunner(jobs.NewRunnerOpts{
-				Limit:        qcfg.Workers,
-				Log:          app.Logger,
-				PollInterval: qcfg.PollInterval,
-				Queue:        q,
+				DB:      sqlDB,
+				Name:    name,
+				Timeout: messageTimeout,
 			})
 
-			tm.queues[name] = &taskQueue{
-				name:   name,
-				queue:  q,
-				runner: r,
+			tq := &taskQueue{
+				name:     name,
+				queue:    q,
+				cfg:      qcfg,
+				handlers: make(map[string]handlerFunc),
+				policies: make(map[string]RetryPolicy),
 			}
+			tq.workers.Store(int32(qcfg.Workers))
+			tm.queues[name] = tq
 		}
 
 		instance = tm
@@ -147,11 +150,16 @@ func (tm *TaskManager) RegisterHandler(queueName, jobType string, handler func(c
 		return
 	}
 
-	q.runner.Register(jobType, func(ctx context.Context, msg []byte) error {
+	if _, exists := q.handlers[jobType]; exists {
+		tm.app.Logger.Error("job type already registered", "queue", queueName, "jobType", jobType)
+		return
+	}
+
+	q.handlers[jobType] = func(ctx context.Context, msg []byte) error {
 		var payload JobPayload
 		if err := json.Unmarshal(msg, &payload); err != nil {
 			tm.app.Logger.Error("failed to unmarshal job payload", "queue", queueName, "jobType", jobType, "error", err)
-			return nil // 不重试格式错误的任务
+			return Permanent(err) // 不重试格式错误的任务
 		}
 
 		// 检查任务是否已取消/被替换。
@@ -182,42 +190,99 @@ func (tm *TaskManager) RegisterHandler(queueName, jobType string, handler func(c
 		if info.IsCancelled() {
 			// 任务已取消
 			tm.removeTask(payload.TaskKey, info)
-			return nil
+			return errSkipped
 		}
 		if info.RunID != payload.RunID {
 			// 任务已被新运行替换，跳过旧任务
-			return nil
+			return errSkipped
 		}
+		tm.mu.Lock()
+		info.retry = nil
+		tm.mu.Unlock()
 
 		// 执行处理器
 		err := handler(ctx, info, payload.Data)
+		cancelled := info.IsCancelled()
 
-		// 完成后清理任务记录
-		tm.removeTask(payload.TaskKey, info)
+		// 完成后清理任务记录；还会自动重试时保留，退避期间仍可按 taskKey 取消
+		if err == nil || cancelled || !WillRetry(ctx, err) {
+			tm.removeTask(payload.TaskKey, info)
+		}
 
+		if err == nil && cancelled {
+			return errSkipped
+		}
 		return err
-	})
+	}
 }
 
-// Start 启动所有 job runner，应在注册完所有 handler 后调用
+// Start 启动所有队列，应在注册完所有 handler 后调用
 func (tm *TaskManager) Start() {
+	tm.recoverJobRecords()
 	for _, q := range tm.queues {
-		tq := q // 捕获变量
 		tm.wg.Add(1)
-		go func() {
-			defer tm.wg.Done()
-			tq.runner.Start(tm.ctx)
-		}()
+		go tm.runQueue(q)
 	}
 }
 
-// Submit 提交任务到指定队列
+// queueNames 返回排序后的队列名称
+func (tm *TaskManager) queueNames() []string {
+	names := make([]string, 0, len(tm.queues))
+	for name := range tm.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PauseQueue 暂停队列：不再取新任务，正在执行的任务继续完成
+func (tm *TaskManager) PauseQueue(queueName string) error {
+	q, ok := tm.queues[queueName]
+	if !ok {
+		return ErrQueueNotFound
+	}
+	q.paused.Store(true)
+	tm.app.Logger.Info("task queue paused", "queue", queueName)
+	return nil
+}
+
+// ResumeQueue 恢复已暂停的队列
+func (tm *TaskManager) ResumeQueue(queueName string) error {
+	q, ok := tm.queues[queueName]
+	if !ok {
+		return ErrQueueNotFound
+	}
+	q.paused.Store(false)
+	tm.app.Logger.Info("task queue resumed", "queue", queueName)
+	return nil
+}
+
+// SetWorkers 运行时调整队列并发数；调小时正在执行的任务不会被中断
+func (tm *TaskManager) SetWorkers(queueName string, workers int) error {
+	q, ok := tm.queues[queueName]
+	if !ok {
+		return ErrQueueNotFound
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	q.workers.Store(int32(workers))
+	tm.app.Logger.Info("task queue workers changed", "queue", queueName, "workers", workers)
+	return nil
+}
+
+// Submit 以普通优先级提交任务到指定队列
 // queueName: 预定义的队列常量之一
 // jobType: 已注册的任务类型名称
 // taskKey: 唯一标识；提交相同 key 会取消之前的任务
 // runID: 版本标识，用于检测过期任务
 // data: 可选的负载数据
 func (tm *TaskManager) Submit(queueName, jobType, taskKey, runID string, data []byte) bool {
+	return tm.SubmitWithPriority(queueName, jobType, taskKey, runID, PriorityNormal, data)
+}
+
+// SubmitWithPriority 提交任务到指定队列，priority 越大越先执行（见 PriorityHigh 等常量）
+func (tm *TaskManager) SubmitWithPriority(queueName, jobType, taskKey, runID string, priority int, data []byte) bool {
 	if tm == nil {
 		return false
 	}
@@ -257,8 +322,15 @@ func (tm *TaskManager) Submit(queueName, jobType, taskKey, runID string, data []
 		return false
 	}
 
-	// 提交到 goqite
-	if err := jobs.Create(tm.ctx, q.queue, jobType, payloadBytes); err != nil {
+	// 提交到 goqite，并写入执行记录
+	body, err := encodeJobMessage(jobType, payloadBytes)
+	if err == nil {
+		var messageID goqite.ID
+		if messageID, err = tm.sendMessage(tm.ctx, q, body, priority); err == nil {
+			tm.recordJobQueued(tm.ctx, string(messageID), queueName, jobType, priority, payload, body)
+		}
+	}
+	if err != nil {
 		tm.app.Logger.Error("failed to create job", "queue", queueName, "jobType", jobType, "taskKey", taskKey, "error", err)
 		// 失败时移除任务记录
 		tm.mu.Lock()
@@ -272,13 +344,25 @@ func (tm *TaskManager) Submit(queueName, jobType, taskKey, runID string, data []
 	return true
 }
 
-// Cancel 通过 taskKey 将任务标记为已取消
+// Cancel 通过 taskKey 将任务标记为已取消；任务正在等待重试时直接出队
 func (tm *TaskManager) Cancel(taskKey string) {
 	tm.mu.Lock()
-	defer tm.mu.Unlock()
+	info, ok := tm.tasks[taskKey]
+	if !ok {
+		tm.mu.Unlock()
+		return
+	}
+	info.Cancelled = true
+	retry := info.retry
+	if retry != nil {
+		info.retry = nil
+		delete(tm.tasks, taskKey)
+	}
+	tm.mu.Unlock()
 
-	if info, ok := tm.tasks[taskKey]; ok {
-		info.Cancelled = true
+	if retry != nil {
+		// 消息若已被重新取走，处理器会看到 Cancelled 并跳过
+		tm.finishJob(retry.queue, retry.messageID, "", JobStatusCancelled, 0, nil)
 	}
 }
 
@@ -314,7 +398,7 @@ func (tm *TaskManager) removeTask(taskKey string, info *TaskInfo) {
 	}
 }
 
-// Stop 优雅停止所有 job runner 并等待完成
+// Stop 优雅停止所有队列并等待正在执行的任务完成
 func (tm *TaskManager) Stop() {
 	tm.mu.Lock()
 	if tm.stopped {
@@ -328,7 +412,7 @@ func (tm *TaskManager) Stop() {
 	tm.wg.Wait()
 }
 
-// StopNow 立即停止所有 job runner
+// StopNow 立即停止所有队列（正在执行的任务会被标记为取消）
 func (tm *TaskManager) StopNow() {
 	tm.mu.Lock()
 	if tm.stopped {